@@ -0,0 +1,69 @@
+package midi
+
+import (
+	"errors"
+)
+
+// AlignTempo re-times a file to the tempo map of a reference file, so stems exported at
+// different tempos line up bar for bar when layered. The events keep their musical position:
+// ticks are scaled to the ticks per quarter note of the reference, the tempo events of all
+// tracks are replaced by the reference tempo changes in the first track, and time signatures
+// are kept. A file with a SMPTE division has no musical positions, its events keep their time
+// and are placed at the ticks of the reference at that time. The chunks are rebuilt
+func AlignTempo(target *File, reference *TempoMap) error {
+	if reference == nil || reference.TicksPerQuarterNote == 0 {
+		return errors.New("reference tempo map should have a ticks per quarter note division")
+	}
+
+	if len(target.Tracks) == 0 {
+		return errors.New("file has no tracks to align")
+	}
+
+	var convert func(uint32) uint32
+
+	if target.Header != nil && target.Header.DivisionType == DivisionFramesTicks {
+		// Place SMPTE events at the ticks of the reference tempo, not the default tempo
+		from := target.TempoMap()
+
+		convert = func(tick uint32) uint32 {
+			return reference.DurationToTick(from.TickToDuration(tick))
+		}
+	} else {
+		convert = songTickConverter(target, reference.TicksPerQuarterNote)
+	}
+
+	header := FileHeader{Format: Format1}
+	if target.Header != nil {
+		header = *target.Header
+	}
+
+	err := header.SetTicksPerQuarterNote(reference.TicksPerQuarterNote)
+	if err != nil {
+		return err
+	}
+
+	for index, track := range target.Tracks {
+		events := []AbsEvent{}
+
+		for _, ae := range track.AbsEvents() {
+			if me, ok := ae.Event.(*MetaEvent); ok && me.MetaType == SetTempo {
+				continue
+			}
+
+			events = append(events, AbsEvent{Tick: convert(ae.Tick), Event: ae.Event})
+		}
+
+		if index == 0 {
+			// The reference tempo changes come before the other conductor events at a tick
+			track.Events = buildConductorTrackWith(reference, nil, nil, events).Events
+			continue
+		}
+
+		track.SetAbsEvents(events)
+	}
+
+	target.Header = &header
+	target.Rebuild()
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package midi
+
+// Histogram holds bucketed counts, bucket i counts the values in
+// [i * BucketSize, (i + 1) * BucketSize)
+type Histogram struct {
+	BucketSize uint32
+	Counts     []int
+}
+
+// newHistogram creates a histogram for values up to max
+func newHistogram(bucketSize uint32, max uint32) *Histogram {
+	if bucketSize == 0 {
+		bucketSize = 1
+	}
+
+	return &Histogram{
+		BucketSize: bucketSize,
+		Counts:     make([]int, max/bucketSize+1),
+	}
+}
+
+// add counts a value
+func (h *Histogram) add(value uint32) {
+	h.Counts[value/h.BucketSize]++
+}
+
+// VelocityHistogram counts the note on velocities of notes
+func VelocityHistogram(notes []Note, bucketSize uint32) *Histogram {
+	h := newHistogram(bucketSize, 127)
+
+	for _, note := range notes {
+		h.add(uint32(note.Velocity & 0x7F))
+	}
+
+	return h
+}
+
+// DurationHistogram counts the durations in ticks of notes
+func DurationHistogram(notes []Note, bucketSize uint32) *Histogram {
+	max := uint32(0)
+	for _, note := range notes {
+		if note.Duration() > max {
+			max = note.Duration()
+		}
+	}
+
+	h := newHistogram(bucketSize, max)
+
+	for _, note := range notes {
+		h.add(note.Duration())
+	}
+
+	return h
+}
+
+// PitchClassHistogram counts the pitch classes (C = 0 to B = 11) of notes
+func PitchClassHistogram(notes []Note) [12]int {
+	counts := [12]int{}
+
+	for _, note := range notes {
+		counts[note.Key%12]++
+	}
+
+	return counts
+}
+
+// Density returns the number of notes starting in each window of windowTicks ticks, covering
+// the track from tick 0 to the last event
+func Density(track *Track, windowTicks uint32) []float64 {
+	if windowTicks == 0 {
+		return []float64{}
+	}
+
+	end := uint32(0)
+	for _, event := range track.Events {
+		end += event.DeltaTime()
+	}
+
+	density := make([]float64, end/windowTicks+1)
+
+	for _, note := range track.Notes() {
+		density[note.Start/windowTicks]++
+	}
+
+	return density
+}
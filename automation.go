@@ -0,0 +1,208 @@
+package midi
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// ControllerPitchBend selects the pitch wheel lane instead of a control change number
+	ControllerPitchBend uint16 = 0x100
+	// ControllerChannelPressure selects the channel pressure lane instead of a control change number
+	ControllerChannelPressure uint16 = 0x101
+)
+
+// Point is a controller value at an absolute tick
+type Point struct {
+	Tick  uint32
+	Value uint16
+}
+
+// laneValue returns the value of event if it belongs to the controller lane of channel
+func laneValue(event Event, channel uint16, controller uint16) (uint16, bool) {
+	ce, ok := event.(*ChannelEvent)
+	if !ok || ce.Channel != channel {
+		return 0, false
+	}
+
+	switch {
+	case controller == ControllerPitchBend && ce.eventType == PitchWheelChange:
+		return ce.Value1, true
+	case controller == ControllerChannelPressure && ce.eventType == ChannelPressure:
+		return ce.Value1, true
+	case controller < 0x80 && ce.eventType == ControlChange && ce.Value1 == controller:
+		return ce.Value2, true
+	}
+
+	return 0, false
+}
+
+// Automation extracts a single controller lane of a channel as points sorted by tick, controller
+// is a control change number or ControllerPitchBend or ControllerChannelPressure
+func Automation(track *Track, channel uint16, controller uint16) []Point {
+	points := []Point{}
+	tick := uint32(0)
+
+	for _, event := range track.Events {
+		tick += event.DeltaTime()
+
+		if value, ok := laneValue(event, channel, controller); ok {
+			points = append(points, Point{Tick: tick, Value: value})
+		}
+	}
+
+	return points
+}
+
+// Interpolation mode between automation points
+type Interpolation uint8
+
+const (
+	// InterpolationStep holds the value of a point until the next point
+	InterpolationStep Interpolation = iota
+	// InterpolationLinear ramps linearly between points
+	InterpolationLinear
+)
+
+// AutomationLane is an editable controller lane of a channel
+type AutomationLane struct {
+	Channel       uint16
+	Controller    uint16
+	Interpolation Interpolation
+	// Ticks between generated events when ramping with linear interpolation
+	Resolution uint32
+	// Points sorted by tick
+	Points []Point
+}
+
+// NewAutomationLane creates a lane from the controller events in track
+func NewAutomationLane(track *Track, channel uint16, controller uint16) *AutomationLane {
+	return &AutomationLane{
+		Channel:    channel,
+		Controller: controller,
+		Resolution: 10,
+		Points:     Automation(track, channel, controller),
+	}
+}
+
+// search returns the index of the first point at or after tick
+func (l *AutomationLane) search(tick uint32) int {
+	return sort.Search(len(l.Points), func(i int) bool {
+		return l.Points[i].Tick >= tick
+	})
+}
+
+// Insert adds a point, a point at the same tick is replaced
+func (l *AutomationLane) Insert(p Point) {
+	index := l.search(p.Tick)
+
+	if index < len(l.Points) && l.Points[index].Tick == p.Tick {
+		l.Points[index] = p
+		return
+	}
+
+	l.Points = append(l.Points, Point{})
+	copy(l.Points[index+1:], l.Points[index:])
+	l.Points[index] = p
+}
+
+// Move moves the point at index to a new tick and value
+func (l *AutomationLane) Move(index int, tick uint32, value uint16) {
+	l.Delete(index)
+	l.Insert(Point{Tick: tick, Value: value})
+}
+
+// Delete removes the point at index
+func (l *AutomationLane) Delete(index int) {
+	if index < 0 || index >= len(l.Points) {
+		return
+	}
+
+	l.Points = append(l.Points[:index], l.Points[index+1:]...)
+}
+
+// event creates a controller event for the lane
+func (l *AutomationLane) event(value uint16) Event {
+	switch l.Controller {
+	case ControllerPitchBend:
+		return NewChannelEvent(0, PitchWheelChange, l.Channel, value, 0)
+	case ControllerChannelPressure:
+		return NewChannelEvent(0, ChannelPressure, l.Channel, value, 0)
+	}
+
+	return NewChannelEvent(0, ControlChange, l.Channel, l.Controller, value)
+}
+
+// Events renders the lane to controller events, linear interpolation generates intermediate
+// events every Resolution ticks
+func (l *AutomationLane) Events() []AbsEvent {
+	events := []AbsEvent{}
+	resolution := l.Resolution
+	if resolution == 0 {
+		resolution = 1
+	}
+
+	for index, p := range l.Points {
+		events = append(events, AbsEvent{Tick: p.Tick, Event: l.event(p.Value)})
+
+		if l.Interpolation != InterpolationLinear || index+1 >= len(l.Points) {
+			continue
+		}
+
+		next := l.Points[index+1]
+		last := p.Value
+
+		for tick := p.Tick + resolution; tick < next.Tick; tick += resolution {
+			value := interpolate(p, next, tick)
+			if value != last {
+				events = append(events, AbsEvent{Tick: tick, Event: l.event(value)})
+				last = value
+			}
+		}
+	}
+
+	return events
+}
+
+// ApplyTo replaces the controller events of the lane in track by the rendered lane
+func (l *AutomationLane) ApplyTo(track *Track) {
+	Strip(track, func(event Event) bool {
+		_, ok := laneValue(event, l.Channel, l.Controller)
+		return ok
+	})
+
+	Overdub(track, l.Events())
+}
+
+// interpolate returns the linear interpolated value between two points
+func interpolate(a, b Point, tick uint32) uint16 {
+	if b.Tick <= a.Tick {
+		return b.Value
+	}
+
+	position := float64(tick-a.Tick) / float64(b.Tick-a.Tick)
+
+	return uint16(math.Round(float64(a.Value) + (float64(b.Value)-float64(a.Value))*position))
+}
+
+// ValueAt returns the effective value of the lane at tick using the interpolation mode of the
+// lane, false is returned if tick is before the first point
+func ValueAt(lane *AutomationLane, tick uint32) (uint16, bool) {
+	index := lane.search(tick)
+
+	if index < len(lane.Points) && lane.Points[index].Tick == tick {
+		return lane.Points[index].Value, true
+	}
+
+	if index == 0 {
+		return 0, false
+	}
+
+	previous := lane.Points[index-1]
+
+	if lane.Interpolation != InterpolationLinear || index >= len(lane.Points) {
+		return previous.Value, true
+	}
+
+	return interpolate(previous, lane.Points[index], tick), true
+}
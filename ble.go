@@ -0,0 +1,268 @@
+package midi
+
+import (
+	"errors"
+)
+
+// BLEMessage is an event with a 13 bits BLE-MIDI timestamp in milliseconds
+type BLEMessage struct {
+	Timestamp uint16
+	Event     Event
+}
+
+// EncodeBLEPackets encodes messages to BLE-MIDI packets of at most maxPacketSize bytes (the
+// connection MTU minus 3). Channel messages use running status within a packet and system
+// exclusive messages are segmented across packets
+func EncodeBLEPackets(messages []BLEMessage, maxPacketSize int) ([][]byte, error) {
+	if maxPacketSize < 5 {
+		return nil, errors.New("maximum BLE-MIDI packet size should be at least 5 bytes")
+	}
+
+	packets := [][]byte{}
+	var packet []byte
+	var runningStatus byte
+	var high, low uint16
+
+	newPacket := func(timestamp uint16) {
+		if len(packet) > 1 {
+			packets = append(packets, packet)
+		}
+
+		high = (timestamp >> 7) & 0x3F
+		low = 0
+		packet = make([]byte, 1, maxPacketSize)
+		packet[0] = 0x80 | byte(high)
+		runningStatus = 0
+	}
+
+	newPacket(0)
+
+	for _, message := range messages {
+		data, err := framedMessageBytes(message.Event)
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp := message.Timestamp & 0x1FFF
+		messageHigh := (timestamp >> 7) & 0x3F
+		messageLow := timestamp & 0x7F
+
+		// Receivers only infer a single wrap of the low timestamp bits
+		sameHigh := messageHigh == high && messageLow >= low
+		wrapped := messageHigh == (high+1)&0x3F && messageLow < low
+
+		if len(packet) <= 1 {
+			newPacket(timestamp)
+		} else if !sameHigh && !wrapped {
+			newPacket(timestamp)
+		} else if wrapped {
+			high = messageHigh
+		}
+
+		low = messageLow
+		timestampByte := 0x80 | byte(messageLow)
+
+		if data[0] == 0xF0 {
+			// Timestamp, 0xF0 and data, continued in new packets as needed, 0xF7 gets its own timestamp
+			if len(packet)+2 > maxPacketSize {
+				newPacket(timestamp)
+			}
+
+			packet = append(packet, timestampByte, 0xF0)
+
+			for _, b := range data[1 : len(data)-1] {
+				if len(packet) >= maxPacketSize {
+					packets = append(packets, packet)
+					packet = make([]byte, 1, maxPacketSize)
+					packet[0] = 0x80 | byte(high)
+				}
+
+				packet = append(packet, b)
+			}
+
+			if len(packet)+2 > maxPacketSize {
+				packets = append(packets, packet)
+				packet = make([]byte, 1, maxPacketSize)
+				packet[0] = 0x80 | byte(high)
+			}
+
+			packet = append(packet, timestampByte, 0xF7)
+			runningStatus = 0
+
+			continue
+		}
+
+		if len(packet)+1+len(data) > maxPacketSize {
+			newPacket(timestamp)
+		}
+
+		packet = append(packet, timestampByte)
+
+		if data[0] < 0xF0 && data[0] == runningStatus {
+			packet = append(packet, data[1:]...)
+		} else {
+			packet = append(packet, data...)
+		}
+
+		if data[0] < 0xF0 {
+			runningStatus = data[0]
+		} else if data[0] < 0xF8 {
+			runningStatus = 0
+		}
+	}
+
+	if len(packet) > 1 {
+		packets = append(packets, packet)
+	}
+
+	return packets, nil
+}
+
+// BLEDecoder decodes BLE-MIDI packets to messages, it keeps running status and system exclusive
+// state between packets
+type BLEDecoder struct {
+	runningStatus  byte
+	inSysEx        bool
+	sysEx          []byte
+	sysExTimestamp uint16
+}
+
+// Decode decodes a BLE-MIDI packet
+func (d *BLEDecoder) Decode(packet []byte) ([]BLEMessage, error) {
+	if len(packet) < 2 || packet[0]&0xC0 != 0x80 {
+		return nil, errors.New("invalid BLE-MIDI packet header")
+	}
+
+	messages := []BLEMessage{}
+	high := uint16(packet[0] & 0x3F)
+	low := uint16(0)
+	timestamp := uint16(0)
+	haveTimestamp := false
+
+	setTimestamp := func(b byte) {
+		newLow := uint16(b & 0x7F)
+		if haveTimestamp && newLow < low {
+			high = (high + 1) & 0x3F
+		}
+
+		low = newLow
+		timestamp = high<<7 | low
+		haveTimestamp = true
+	}
+
+	emit := func(status byte, data []byte) error {
+		event, err := ParseMessage(status, data)
+		if err != nil {
+			return err
+		}
+
+		messages = append(messages, BLEMessage{Timestamp: timestamp, Event: event})
+		return nil
+	}
+
+	i := 1
+
+	for i < len(packet) {
+		b := packet[i]
+
+		if d.inSysEx {
+			if b&0x80 == 0 {
+				d.sysEx = append(d.sysEx, b)
+				i++
+				continue
+			}
+
+			// Timestamp byte followed by end of exclusive or an interleaved real time message
+			if i+1 >= len(packet) {
+				return messages, errors.New("timestamp byte at end of packet")
+			}
+
+			setTimestamp(b)
+			status := packet[i+1]
+
+			if status == 0xF7 {
+				d.sysEx = append(d.sysEx, 0xF7)
+				d.inSysEx = false
+
+				saved := timestamp
+				timestamp = d.sysExTimestamp
+				err := emit(0xF0, d.sysEx)
+				timestamp = saved
+
+				if err != nil {
+					return messages, err
+				}
+
+				i += 2
+				continue
+			}
+
+			if status >= 0xF8 {
+				if err := emit(status, nil); err != nil {
+					return messages, err
+				}
+
+				i += 2
+				continue
+			}
+
+			// Any other status aborts the system exclusive message
+			d.inSysEx = false
+			d.sysEx = nil
+			i++
+			continue
+		}
+
+		status := d.runningStatus
+
+		if b&0x80 != 0 {
+			setTimestamp(b)
+			i++
+
+			if i >= len(packet) {
+				return messages, errors.New("timestamp byte at end of packet")
+			}
+
+			if packet[i]&0x80 != 0 {
+				status = packet[i]
+				i++
+			}
+		} else if !haveTimestamp {
+			return messages, errors.New("data byte without timestamp")
+		}
+
+		if status == 0 {
+			return messages, errors.New("received data byte without running status active")
+		}
+
+		if status == 0xF0 {
+			d.inSysEx = true
+			d.sysEx = []byte{}
+			d.sysExTimestamp = timestamp
+			continue
+		}
+
+		length := messageDataLength(status)
+		if length < 0 {
+			return messages, errors.New("unsupported status byte in BLE-MIDI packet")
+		}
+
+		if i+length > len(packet) {
+			return messages, errors.New("message data exceeds packet length")
+		}
+
+		if err := emit(status, packet[i:i+length]); err != nil {
+			return messages, err
+		}
+
+		i += length
+
+		if status < 0xF0 {
+			d.runningStatus = status
+		} else if status < 0xF8 {
+			d.runningStatus = 0
+		}
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,57 @@
+package midi
+
+// TrackBuilder builds a track from events placed at absolute ticks or musical positions
+type TrackBuilder struct {
+	TicksPerQuarterNote uint16
+	// Time signatures used to resolve musical positions, 4/4 if nil
+	TimeSignatures *TimeSigMap
+	// Channel used for notes
+	Channel uint16
+	// Order of events at the same tick
+	Order  OrderPolicy
+	events []AbsEvent
+}
+
+// NewTrackBuilder creates a new track builder
+func NewTrackBuilder(ticksPerQuarterNote uint16) *TrackBuilder {
+	return &TrackBuilder{
+		TicksPerQuarterNote: ticksPerQuarterNote,
+		events:              []AbsEvent{},
+	}
+}
+
+// Tick converts a musical position to an absolute tick
+func (b *TrackBuilder) Tick(p Position) uint32 {
+	return b.TimeSignatures.PositionToTick(p, b.TicksPerQuarterNote)
+}
+
+// AddEvent adds an event at an absolute tick
+func (b *TrackBuilder) AddEvent(tick uint32, event Event) {
+	b.events = append(b.events, AbsEvent{Tick: tick, Event: event})
+}
+
+// AddNote adds a note on the builder channel at a musical position
+func (b *TrackBuilder) AddNote(at Position, length Duration, key uint8, velocity uint8) {
+	start := b.Tick(at)
+
+	b.AddEvent(start, NewChannelEvent(0, NoteOn, b.Channel, uint16(key), uint16(velocity)))
+	b.AddEvent(start+length.Ticks(b.TicksPerQuarterNote), NewChannelEvent(0, NoteOff, b.Channel, uint16(key), 0))
+}
+
+// Build creates the track, events are sorted by tick and ordered within a tick by the order
+// policy of the builder and an end of track event is appended
+func (b *TrackBuilder) Build() *Track {
+	events := make([]AbsEvent, len(b.events))
+	copy(events, b.events)
+
+	SortAbsEvents(events, b.Order)
+
+	endTick := uint32(0)
+	if len(events) > 0 {
+		endTick = events[len(events)-1].Tick
+	}
+
+	events = append(events, AbsEvent{Tick: endTick, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+
+	return NewTrackFromAbsEvents(events)
+}
@@ -0,0 +1,50 @@
+package midi
+
+// canonicalizeTrack normalizes the events of a track
+func canonicalizeTrack(track *Track) {
+	events := track.AbsEvents()
+	kept := make([]AbsEvent, 0, len(events)+1)
+	end := uint32(0)
+
+	for _, ae := range events {
+		if ae.Tick > end {
+			end = ae.Tick
+		}
+
+		if isEndOfTrack(ae.Event) {
+			continue
+		}
+
+		if ce, ok := ae.Event.(*ChannelEvent); ok && ce.eventType == NoteOn && ce.Value2 == 0 {
+			ce.eventType = NoteOff
+		}
+
+		kept = append(kept, ae)
+	}
+
+	SortAbsEvents(kept, OrderCanonical)
+
+	kept = append(kept, AbsEvent{Tick: end, Event: NewMetaEvent(0, EndOfTrack, nil)})
+	track.SetAbsEvents(kept)
+}
+
+// Canonicalize normalizes the file so semantically equal files serialize to identical bytes,
+// e.g. for hashing and diffing. Events at the same tick are sorted with OrderCanonical, note ons
+// with velocity 0 become note offs, every track ends with exactly one end of track event and the
+// chunks are regenerated without running status and with minimal variable length quantities.
+// Unknown chunks are dropped
+func (f *File) Canonicalize() {
+	for _, track := range f.Tracks {
+		canonicalizeTrack(track)
+	}
+
+	f.Rebuild()
+
+	// Drop unknown chunks, Rebuild puts them last
+	known := len(f.Tracks)
+	if f.Header != nil {
+		known++
+	}
+
+	f.Chunks = f.Chunks[:known]
+}
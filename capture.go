@@ -0,0 +1,122 @@
+package midi
+
+import (
+	"time"
+)
+
+// TrackWriter receives track events in order, with their delta times set
+type TrackWriter interface {
+	WriteEvent(event Event) error
+}
+
+// Capture converts live events with wall clock timestamps to events with delta ticks and
+// appends them to a track writer, e.g. to record a hardware input to a midi file
+type Capture struct {
+	// Tempo in beats per minute used to convert wall clock time to ticks
+	BPM                 float64
+	TicksPerQuarterNote uint16
+	// UseClock derives ticks from received timing clock events (24 per quarter note)
+	// instead of the configured tempo
+	UseClock bool
+
+	writer        TrackWriter
+	started       bool
+	start         time.Time
+	lastTick      uint32
+	clocks        uint32
+	lastClock     time.Time
+	clockInterval time.Duration
+}
+
+// NewCapture creates a new capture writing to writer
+func NewCapture(writer TrackWriter, bpm float64, ticksPerQuarterNote uint16) *Capture {
+	return &Capture{
+		BPM:                 bpm,
+		TicksPerQuarterNote: ticksPerQuarterNote,
+		writer:              writer,
+	}
+}
+
+// Start sets the wall clock time of tick 0, if not called the time of the first event is used
+func (c *Capture) Start(t time.Time) {
+	c.started = true
+	c.start = t
+	c.lastTick = 0
+	c.clocks = 0
+	c.lastClock = t
+	c.clockInterval = 0
+}
+
+// tickAt converts a wall clock time to an absolute tick
+func (c *Capture) tickAt(t time.Time) uint32 {
+	if c.UseClock {
+		tick := uint64(c.clocks) * uint64(c.TicksPerQuarterNote) / 24
+
+		// Interpolate between clocks with the last measured clock interval
+		if c.clockInterval > 0 {
+			elapsed := t.Sub(c.lastClock)
+			if elapsed > c.clockInterval {
+				elapsed = c.clockInterval
+			}
+
+			if elapsed > 0 {
+				tick += uint64(elapsed) * uint64(c.TicksPerQuarterNote) / (24 * uint64(c.clockInterval))
+			}
+		}
+
+		return uint32(tick)
+	}
+
+	elapsed := t.Sub(c.start)
+	if elapsed < 0 {
+		return 0
+	}
+
+	return uint32(elapsed.Seconds() * c.BPM / 60.0 * float64(c.TicksPerQuarterNote))
+}
+
+// Add captures an event received at time t. Real time events are not written, in clock mode
+// timing clock events advance the capture position and start resets it
+func (c *Capture) Add(t time.Time, event Event) error {
+	if !c.started {
+		c.Start(t)
+	}
+
+	switch event.EventType() {
+	case TimingClock:
+		if c.UseClock {
+			c.clocks++
+			c.clockInterval = t.Sub(c.lastClock)
+			c.lastClock = t
+		}
+
+		return nil
+	case Start:
+		if c.UseClock {
+			c.clocks = 0
+			c.clockInterval = 0
+			c.lastClock = t
+		}
+
+		return nil
+	case Continue, Stop, ActiveSensing:
+		return nil
+	}
+
+	tick := c.tickAt(t)
+
+	// Never go back in time
+	if tick < c.lastTick {
+		tick = c.lastTick
+	}
+
+	event.SetDeltaTime(tick - c.lastTick)
+	c.lastTick = tick
+
+	return c.writer.WriteEvent(event)
+}
+
+// Tick returns the absolute tick of the last captured event
+func (c *Capture) Tick() uint32 {
+	return c.lastTick
+}
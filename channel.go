@@ -13,6 +13,19 @@ type ChannelEvent struct {
 	Value2  uint16
 }
 
+// NewChannelEvent creates a new channel event, for pitch wheel changes value1 holds the 14 bits value
+func NewChannelEvent(deltaTime uint32, eventType EventType, channel uint16, value1 uint16, value2 uint16) *ChannelEvent {
+	return &ChannelEvent{
+		coreEvent: coreEvent{
+			eventType: eventType,
+			deltaTime: deltaTime,
+		},
+		Channel: channel,
+		Value1:  value1,
+		Value2:  value2,
+	}
+}
+
 // String representation
 func (e *ChannelEvent) String() string {
 	if e.eventType == PitchWheelChange || e.eventType == ProgramChange {
@@ -0,0 +1,303 @@
+package midi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock provides the song time the player follows, implementations can be driven by the system
+// timer, an audio engine or an external midi clock
+type Clock interface {
+	// Start resets the song time to 0
+	Start()
+	// Now returns the elapsed song time
+	Now() time.Duration
+	// WaitUntil blocks until the song time reached d or the context is done
+	WaitUntil(ctx context.Context, d time.Duration) error
+}
+
+// InternalClock follows the system timer
+type InternalClock struct {
+	start time.Time
+}
+
+// NewInternalClock creates a new internal clock
+func NewInternalClock() *InternalClock {
+	return &InternalClock{start: time.Now()}
+}
+
+// Start resets the song time to 0
+func (c *InternalClock) Start() {
+	c.start = time.Now()
+}
+
+// Now returns the elapsed song time
+func (c *InternalClock) Now() time.Duration {
+	return time.Since(c.start)
+}
+
+// WallTime returns the wall clock time of song time d
+func (c *InternalClock) WallTime(d time.Duration) time.Time {
+	return c.start.Add(d)
+}
+
+// WaitUntil sleeps until the song time reached d or the context is done
+func (c *InternalClock) WaitUntil(ctx context.Context, d time.Duration) error {
+	return sleepUntil(ctx, c.start.Add(d))
+}
+
+// OfflineClock never waits, waiting jumps the song time forward so a player iterates the whole
+// file instantly while sinks still receive the computed target times, e.g. to bounce a file or
+// in tests
+type OfflineClock struct {
+	// Wall clock time of song time 0 used for target times
+	Origin time.Time
+	now    time.Duration
+}
+
+// NewOfflineClock creates a new offline clock with target times relative to origin
+func NewOfflineClock(origin time.Time) *OfflineClock {
+	return &OfflineClock{Origin: origin}
+}
+
+// Start resets the song time to 0
+func (c *OfflineClock) Start() {
+	c.now = 0
+}
+
+// Now returns the song time reached so far
+func (c *OfflineClock) Now() time.Duration {
+	return c.now
+}
+
+// WallTime returns the wall clock time of song time d relative to the origin
+func (c *OfflineClock) WallTime(d time.Duration) time.Time {
+	return c.Origin.Add(d)
+}
+
+// WaitUntil moves the song time to d without waiting
+func (c *OfflineClock) WaitUntil(ctx context.Context, d time.Duration) error {
+	if d > c.now {
+		c.now = d
+	}
+
+	return ctx.Err()
+}
+
+// advancingClock is the base of clocks that are advanced by callbacks
+type advancingClock struct {
+	mutex  sync.Mutex
+	notify chan struct{}
+}
+
+// init creates the notification channel if needed, the mutex must be held
+func (c *advancingClock) init() {
+	if c.notify == nil {
+		c.notify = make(chan struct{})
+	}
+}
+
+// advanced wakes up all waiters, the mutex must be held
+func (c *advancingClock) advanced() {
+	c.init()
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// waitUntil blocks until now returns at least d, now is called with the mutex held
+func (c *advancingClock) waitUntil(ctx context.Context, d time.Duration, now func() time.Duration) error {
+	for {
+		c.mutex.Lock()
+		c.init()
+		reached := now() >= d
+		notify := c.notify
+		c.mutex.Unlock()
+
+		if reached {
+			return ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// SampleClock is driven by an audio engine, the audio callback advances it by the number of
+// rendered frames so playback follows the sample clock
+type SampleClock struct {
+	advancingClock
+	SampleRate int
+	frames     int64
+}
+
+// NewSampleClock creates a new sample clock
+func NewSampleClock(sampleRate int) *SampleClock {
+	return &SampleClock{SampleRate: sampleRate}
+}
+
+// Start resets the song time to 0
+func (c *SampleClock) Start() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.frames = 0
+	c.advanced()
+}
+
+// Advance moves the clock forward by a number of frames, call it from the audio callback
+func (c *SampleClock) Advance(frames int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.frames += int64(frames)
+	c.advanced()
+}
+
+// now returns the song time, the mutex must be held
+func (c *SampleClock) now() time.Duration {
+	if c.SampleRate <= 0 {
+		return 0
+	}
+
+	return time.Duration(c.frames * int64(time.Second) / int64(c.SampleRate))
+}
+
+// Now returns the elapsed song time
+func (c *SampleClock) Now() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now()
+}
+
+// WaitUntil blocks until the audio engine advanced the clock to d or the context is done
+func (c *SampleClock) WaitUntil(ctx context.Context, d time.Duration) error {
+	return c.waitUntil(ctx, d, c.now)
+}
+
+// MIDIClock follows an external midi clock, every received timing clock pulse (24 per quarter
+// note) advances the song position which is converted to song time with a tempo map. A song
+// position pointer received while stopped moves the song position on the next continue
+type MIDIClock struct {
+	advancingClock
+	tempoMap *TempoMap
+	pulses   uint32
+	// pending is the song position of a song position pointer waiting for continue
+	pending uint16
+	located bool
+	// jumps counts the moves to a song position pointer
+	jumps uint64
+}
+
+// NewMIDIClock creates a new midi clock, tempoMap converts positions to song time
+func NewMIDIClock(tempoMap *TempoMap) *MIDIClock {
+	return &MIDIClock{tempoMap: tempoMap}
+}
+
+// Start resets the song position to 0
+func (c *MIDIClock) Start() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pulses = 0
+	c.located = false
+	c.advanced()
+}
+
+// SetSongPosition stores the position in midi beats of a song position pointer, the song
+// position moves there on the next Continue
+func (c *MIDIClock) SetSongPosition(position uint16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pending = position & MaxSongPosition
+	c.located = true
+}
+
+// Continue moves the song position to the last song position pointer if one was received
+// since the last start or continue, otherwise the song position is kept
+func (c *MIDIClock) Continue() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.located {
+		return
+	}
+
+	c.pulses = uint32(c.pending) * ClocksPerMIDIBeat
+	c.located = false
+	c.jumps++
+	c.advanced()
+}
+
+// location returns the tick of the song position and the number of moves to a song position
+// pointer, a player restarts at the tick when the number changes
+func (c *MIDIClock) location() (uint32, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return uint32(uint64(c.pulses) * uint64(c.tempoMap.TicksPerQuarterNote) / 24), c.jumps
+}
+
+// Pulse advances the song position by one midi clock
+func (c *MIDIClock) Pulse() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pulses++
+	c.advanced()
+}
+
+// HandleEvent advances the clock on timing clock events, resets it on start and follows song
+// position pointers on continue, so the clock can be used as sink of a live midi input
+func (c *MIDIClock) HandleEvent(track int, tick uint32, event Event) error {
+	switch event.EventType() {
+	case TimingClock:
+		c.Pulse()
+	case Start:
+		c.Start()
+	case Continue:
+		c.Continue()
+	case SongPositionPointer:
+		if e, ok := event.(*SystemCommonEvent); ok {
+			c.SetSongPosition(e.Value1)
+		}
+	}
+
+	return nil
+}
+
+// now returns the song time, the mutex must be held
+func (c *MIDIClock) now() time.Duration {
+	tick := uint64(c.pulses) * uint64(c.tempoMap.TicksPerQuarterNote) / 24
+	return c.tempoMap.TickToDuration(uint32(tick))
+}
+
+// Now returns the song time of the current song position
+func (c *MIDIClock) Now() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now()
+}
+
+// WaitUntil blocks until the external clock reached song time d, the song position jumped to a
+// song position pointer or the context is done
+func (c *MIDIClock) WaitUntil(ctx context.Context, d time.Duration) error {
+	c.mutex.Lock()
+	jumps := c.jumps
+	c.mutex.Unlock()
+
+	return c.waitUntil(ctx, d, func() time.Duration {
+		// Return early after a jump so a player can restart at the new position
+		if c.jumps != jumps {
+			return d
+		}
+
+		return c.now()
+	})
+}
@@ -0,0 +1,99 @@
+package midi
+
+import (
+	"bytes"
+)
+
+// EventCloner is implemented by custom event types so File.Clone can copy them
+type EventCloner interface {
+	Clone() Event
+}
+
+// cloneEvent returns an independent copy of an event, custom events are copied if they implement
+// EventCloner and shared otherwise
+func cloneEvent(event Event) Event {
+	switch e := event.(type) {
+	case *ChannelEvent:
+		c := *e
+		return &c
+	case *MetaEvent:
+		c := *e
+		c.Data = bytes.Clone(e.Data)
+		c.pooled = nil
+		return &c
+	case *SequencerSpecificEvent:
+		c := *e
+		c.Data = bytes.Clone(e.Data)
+		c.pooled = nil
+		c.ManufacturerID = bytes.Clone(e.ManufacturerID)
+		return &c
+	case *SystemExclusiveEvent:
+		c := *e
+		c.Data = bytes.Clone(e.Data)
+		c.pooled = nil
+		return &c
+	case *SystemCommonEvent:
+		c := *e
+		return &c
+	case *SystemRealTimeEvent:
+		c := *e
+		return &c
+	case *RawEvent:
+		return e.Clone()
+	case EventCloner:
+		return e.Clone()
+	}
+
+	return event
+}
+
+// Clone returns a copy of the track with copies of all events
+func (t *Track) Clone() *Track {
+	events := make([]Event, len(t.Events))
+	for index, event := range t.Events {
+		events[index] = cloneEvent(event)
+	}
+
+	return &Track{Events: events}
+}
+
+// Clone returns an independent copy of the file: header, tracks, events, chunk data, warnings and track
+// errors are copied, so the copy can be edited without affecting the original
+func (f *File) Clone() *File {
+	c := &File{
+		Tracks:   make([]*Track, len(f.Tracks)),
+		Chunks:   make([]*Chunk, len(f.Chunks)),
+		Warnings: append([]Warning(nil), f.Warnings...),
+	}
+
+	if f.Header != nil {
+		header := *f.Header
+		c.Header = &header
+	}
+
+	for index, track := range f.Tracks {
+		c.Tracks[index] = track.Clone()
+	}
+
+	clonedChunks := map[*Chunk]*Chunk{}
+
+	for index, chunk := range f.Chunks {
+		c.Chunks[index] = &Chunk{
+			Type:   chunk.Type,
+			Length: chunk.Length,
+			Data:   bytes.Clone(chunk.Data),
+		}
+
+		clonedChunks[chunk] = c.Chunks[index]
+	}
+
+	for _, trackErr := range f.trackErrors {
+		if clone, ok := clonedChunks[trackErr.Chunk]; ok {
+			trackErr.Chunk = clone
+		}
+
+		c.trackErrors = append(c.trackErrors, trackErr)
+	}
+
+	return c
+}
@@ -30,6 +30,9 @@ func (e *SystemCommonEvent) WriteTo(w io.Writer) (int64, error) {
 	data[2] = byte(e.Value2)
 
 	switch e.eventType {
+	case MTCQuarterFrame:
+		data[0] = 0xF1
+		numBytes = 2
 	case SongPositionPointer:
 		data[0] = 0xF2
 		data[1] = byte(e.Value1 & 0x7F)
@@ -90,6 +93,11 @@ func parseSongPositionPointer(statusByte uint8, deltaTime uint32, data []byte) (
 	return
 }
 
+// parseMTCQuarterFrame parses a midi time code quarter frame event
+func parseMTCQuarterFrame(statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error) {
+	return parseSystemCommonEvent(deltaTime, MTCQuarterFrame, 1, data)
+}
+
 // parseSongSelect parses a song select event
 func parseSongSelect(statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error) {
 	return parseSystemCommonEvent(deltaTime, SongSelect, 1, data)
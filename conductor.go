@@ -0,0 +1,70 @@
+package midi
+
+import (
+	"sort"
+)
+
+// MarkerPoint is a named position in a song
+type MarkerPoint struct {
+	Tick uint32
+	Name string
+}
+
+// BuildConductorTrack creates the conductor track (track 0) of a format 1 file from tempo
+// changes, time signature changes and markers. Events at the same tick are ordered time
+// signature first, then tempo, then marker, and the track is closed with an end of track event.
+// Concatenate and AlignTempo build their conductor tracks with it
+func BuildConductorTrack(tempoMap *TempoMap, timeSigMap *TimeSigMap, markers []MarkerPoint) *Track {
+	events := []AbsEvent{}
+
+	if timeSigMap != nil {
+		for _, change := range timeSigMap.Changes {
+			events = append(events, AbsEvent{Tick: change.Tick, Event: change.MetaEvent(0)})
+		}
+	}
+
+	if tempoMap != nil {
+		for _, change := range tempoMap.Changes {
+			events = append(events, AbsEvent{Tick: change.Tick, Event: change.MetaEvent(0)})
+		}
+	}
+
+	for _, marker := range markers {
+		events = append(events, AbsEvent{Tick: marker.Tick, Event: NewMetaEvent(0, Marker, []byte(marker.Name))})
+	}
+
+	// Events were appended per kind so a stable sort keeps the kind order within a tick
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Tick < events[j].Tick
+	})
+
+	endTick := uint32(0)
+	if len(events) > 0 {
+		endTick = events[len(events)-1].Tick
+	}
+
+	events = append(events, AbsEvent{Tick: endTick, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+
+	return NewTrackFromAbsEvents(events)
+}
+
+// buildConductorTrackWith creates a conductor track with BuildConductorTrack and merges the other
+// conductor events, e.g. key signatures and track names, after the built events at the same tick.
+// The end of track moves to the last end of track of events if that is later
+func buildConductorTrackWith(tempoMap *TempoMap, timeSigMap *TimeSigMap, markers []MarkerPoint, events []AbsEvent) *Track {
+	merged := BuildConductorTrack(tempoMap, timeSigMap, markers).AbsEvents()
+
+	for _, ae := range events {
+		if isEndOfTrack(ae.Event) {
+			if end := &merged[len(merged)-1]; ae.Tick > end.Tick {
+				end.Tick = ae.Tick
+			}
+
+			continue
+		}
+
+		merged = insertAbsEvent(merged, ae, false)
+	}
+
+	return NewTrackFromAbsEvents(merged)
+}
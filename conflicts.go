@@ -0,0 +1,275 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ConflictOptions control the detection of conflicting controller automation
+type ConflictOptions struct {
+	// MinJump is the smallest value change counted as a jump, 16 if 0
+	MinJump uint16
+	// MinReversals is the number of successive direction reversals between jumps that make a
+	// conflict, 4 if 0
+	MinReversals int
+}
+
+// withDefaults returns the options with defaults for unset values
+func (opts ConflictOptions) withDefaults() ConflictOptions {
+	if opts.MinJump == 0 {
+		opts.MinJump = 16
+	}
+
+	if opts.MinReversals == 0 {
+		opts.MinReversals = 4
+	}
+
+	return opts
+}
+
+// ConflictPoint is a controller event of a conflict
+type ConflictPoint struct {
+	Track int
+	Tick  uint32
+	Value uint16
+	// Take is 0 for the take writing the first point of the conflict and 1 for the other take
+	Take  int
+	event *ChannelEvent
+}
+
+// ControllerConflict is a range where a controller lane zig-zags between two takes, typically
+// two recordings of the same controller merged into one track or two tracks writing the same
+// controller of a channel
+type ControllerConflict struct {
+	Channel    uint16
+	Controller uint16
+	// Start and End are the ticks of the first and last point of the conflict
+	Start uint32
+	End   uint32
+	// Tracks writing the controller in the conflict, sorted
+	Tracks []int
+	// Points of the conflict in time order, separated in two takes
+	Points []ConflictPoint
+}
+
+// String returns a description of the conflict
+func (c ControllerConflict) String() string {
+	return fmt.Sprintf("controller %v on channel %v zig-zags between two takes from tick %v to %v", c.Controller, c.Channel, c.Start, c.End)
+}
+
+// ControllerConflicts finds conflicting controller automation. The control changes of every
+// channel and controller are followed in time order over all tracks, a point is a reversal when
+// the lane jumps by at least MinJump towards it and away from it in the opposite direction. A run
+// of at least MinReversals successive reversals is a conflict, its points are separated in two
+// takes by following the values closest to each take. Channel mode controllers are ignored.
+// Conflicts are sorted by start tick, channel and controller
+func (f *File) ControllerConflicts(opts ConflictOptions) []ControllerConflict {
+	opts = opts.withDefaults()
+
+	type laneKey struct {
+		channel    uint16
+		controller uint16
+	}
+
+	lanes := map[laneKey][]ConflictPoint{}
+	it := NewEventIterator(f, false)
+
+	for it.Next() {
+		ce, ok := it.Event().(*ChannelEvent)
+		if !ok || ce.eventType != ControlChange || ce.Value1 >= 120 {
+			continue
+		}
+
+		key := laneKey{channel: ce.Channel, controller: ce.Value1}
+		lanes[key] = append(lanes[key], ConflictPoint{Track: it.Track(), Tick: it.Tick(), Value: ce.Value2, event: ce})
+	}
+
+	jump := func(a, b ConflictPoint) int {
+		if b.Value >= a.Value+opts.MinJump {
+			return 1
+		}
+
+		if a.Value >= b.Value+opts.MinJump {
+			return -1
+		}
+
+		return 0
+	}
+
+	conflicts := []ControllerConflict{}
+
+	for key, points := range lanes {
+		run := 0
+
+		for i := 1; i < len(points); i++ {
+			if i < len(points)-1 {
+				in, out := jump(points[i-1], points[i]), jump(points[i], points[i+1])
+				if in != 0 && out == -in {
+					run++
+					continue
+				}
+			}
+
+			if run >= opts.MinReversals {
+				// The run holds the reversals i-run to i-1 and their outer neighbours
+				conflicts = append(conflicts, newControllerConflict(key.channel, key.controller, points[i-run-1:i+1], opts.MinJump))
+			}
+
+			run = 0
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		a, b := conflicts[i], conflicts[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+
+		return a.Controller < b.Controller
+	})
+
+	return conflicts
+}
+
+// newControllerConflict creates a conflict from its points and separates them in two takes
+func newControllerConflict(channel, controller uint16, points []ConflictPoint, minJump uint16) ControllerConflict {
+	c := ControllerConflict{
+		Channel:    channel,
+		Controller: controller,
+		Start:      points[0].Tick,
+		End:        points[len(points)-1].Tick,
+		Points:     append([]ConflictPoint{}, points...),
+	}
+
+	distance := func(a, b uint16) uint16 {
+		if a > b {
+			return a - b
+		}
+
+		return b - a
+	}
+
+	last := [2]uint16{c.Points[0].Value}
+	started := false
+	tracks := map[int]bool{}
+
+	for index := range c.Points {
+		p := &c.Points[index]
+		tracks[p.Track] = true
+
+		if index > 0 {
+			switch {
+			case !started:
+				if distance(p.Value, last[0]) >= minJump {
+					p.Take = 1
+					started = true
+				}
+			case distance(p.Value, last[1]) < distance(p.Value, last[0]):
+				p.Take = 1
+			}
+		}
+
+		last[p.Take] = p.Value
+	}
+
+	for track := range tracks {
+		c.Tracks = append(c.Tracks, track)
+	}
+
+	sort.Ints(c.Tracks)
+
+	return c
+}
+
+// ValidateControllers reports conflicting controller automation found by ControllerConflicts as
+// WarningError joined with errors.Join, nil if there are no conflicts
+func (f *File) ValidateControllers(opts ConflictOptions) error {
+	var errs []error
+
+	for _, c := range f.ControllerConflicts(opts) {
+		errs = append(errs, WarningError{Warning{Track: c.Tracks[0], Tick: c.Start, Message: c.String()}})
+	}
+
+	return errors.Join(errs...)
+}
+
+// ConflictResolution selects how ResolveControllerConflict resolves a conflict
+type ConflictResolution int
+
+const (
+	// ResolveKeepLast keeps the take writing the last point of the conflict and removes the
+	// events of the other take
+	ResolveKeepLast ConflictResolution = iota
+	// ResolveAverage sets every point to the average of the current values of both takes
+	ResolveAverage
+	// ResolveSplit moves the events of the second take to another channel
+	ResolveSplit
+)
+
+// ResolveControllerConflict resolves a conflict found by ControllerConflicts on the same file,
+// splitChannel is the channel the second take moves to with ResolveSplit. The chunks are rebuilt
+func (f *File) ResolveControllerConflict(c ControllerConflict, resolution ConflictResolution, splitChannel uint16) error {
+	if len(c.Points) == 0 {
+		return errors.New("conflict has no points")
+	}
+
+	for _, p := range c.Points {
+		if p.Track < 0 || p.Track >= len(f.Tracks) || p.event == nil {
+			return errors.New("conflict does not belong to this file")
+		}
+	}
+
+	switch resolution {
+	case ResolveKeepLast:
+		keep := c.Points[len(c.Points)-1].Take
+		removed := map[Event]bool{}
+
+		for _, p := range c.Points {
+			if p.Take != keep {
+				removed[p.event] = true
+			}
+		}
+
+		for _, track := range c.Tracks {
+			Strip(f.Tracks[track], func(event Event) bool {
+				return removed[event]
+			})
+		}
+	case ResolveAverage:
+		current := [2]uint16{}
+		seen := [2]bool{}
+
+		for _, p := range c.Points {
+			current[p.Take] = p.Value
+			seen[p.Take] = true
+
+			value := p.Value
+			if seen[0] && seen[1] {
+				value = (current[0] + current[1] + 1) / 2
+			}
+
+			p.event.Value2 = value
+		}
+	case ResolveSplit:
+		if splitChannel > 15 {
+			return fmt.Errorf("split channel %v out of range", splitChannel)
+		}
+
+		for _, p := range c.Points {
+			if p.Take == 1 {
+				p.event.Channel = splitChannel
+			}
+		}
+	default:
+		return fmt.Errorf("unknown conflict resolution %v", resolution)
+	}
+
+	f.Rebuild()
+
+	return nil
+}
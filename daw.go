@@ -0,0 +1,188 @@
+package midi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// TrackColor is the display color of a track in a sequencer
+type TrackColor struct {
+	R, G, B uint8
+}
+
+// String returns the color as hex, e.g. #FF8000
+func (c TrackColor) String() string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// TrackColorFormat describes how a sequencer stores the color of a track in a sequencer specific
+// meta event. Vendor layouts (Cakewalk and Anvil Studio for example) differ between versions and
+// are not publicly documented, so no layouts are built in. Applications register the layouts they
+// have verified against files of the sequencer they target
+type TrackColorFormat struct {
+	// ManufacturerID of the sequencer specific event, one byte or three bytes starting with 0x00
+	ManufacturerID []byte
+	// Encode returns the vendor data that follows the manufacturer id
+	Encode func(color TrackColor) []byte
+	// Decode returns the color stored in the vendor data, an error is returned if the data does
+	// not hold a color, e.g. because the sequencer uses the same id for other metadata
+	Decode func(data []byte) (TrackColor, error)
+}
+
+var (
+	trackColorFormatsMutex sync.RWMutex
+	trackColorFormats      = map[string]TrackColorFormat{}
+)
+
+// RegisterTrackColorFormat registers a track color format and installs a sequencer specific
+// decoder for its manufacturer id, so parsed color events surface as *SequencerSpecificEvent
+// with a TrackColor value
+func RegisterTrackColorFormat(format TrackColorFormat) error {
+	if format.Encode == nil || format.Decode == nil {
+		return errors.New("track color format should have an encoder and a decoder")
+	}
+
+	err := RegisterSequencerSpecificDecoder(format.ManufacturerID, func(data []byte) (interface{}, error) {
+		return format.Decode(data)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	trackColorFormatsMutex.Lock()
+	defer trackColorFormatsMutex.Unlock()
+
+	trackColorFormats[string(format.ManufacturerID)] = format
+
+	return nil
+}
+
+// trackColorFormat returns the registered track color format for a manufacturer id
+func trackColorFormat(manufacturerID []byte) (TrackColorFormat, bool) {
+	trackColorFormatsMutex.RLock()
+	defer trackColorFormatsMutex.RUnlock()
+
+	format, ok := trackColorFormats[string(manufacturerID)]
+
+	return format, ok
+}
+
+// trackColorFromEvent returns the color stored in a sequencer specific event with a registered
+// track color format
+func trackColorFromEvent(event Event) (TrackColor, []byte, bool) {
+	var me *MetaEvent
+
+	switch e := event.(type) {
+	case *SequencerSpecificEvent:
+		me = &e.MetaEvent
+	case *MetaEvent:
+		me = e
+	default:
+		return TrackColor{}, nil, false
+	}
+
+	if me.MetaType != SequencerSpecific {
+		return TrackColor{}, nil, false
+	}
+
+	id, rest, err := splitManufacturerID(me.Data)
+	if err != nil {
+		return TrackColor{}, nil, false
+	}
+
+	format, ok := trackColorFormat(id)
+	if !ok {
+		return TrackColor{}, nil, false
+	}
+
+	color, err := format.Decode(rest)
+	if err != nil {
+		return TrackColor{}, nil, false
+	}
+
+	return color, id, true
+}
+
+// Color returns the color of the first sequencer specific event of the track in a registered
+// track color format, false is returned if the track has no color
+func (t *Track) Color() (TrackColor, bool) {
+	for _, event := range t.Events {
+		if color, _, ok := trackColorFromEvent(event); ok {
+			return color, true
+		}
+	}
+
+	return TrackColor{}, false
+}
+
+// SetColor stores the color in the registered track color format of manufacturerID at the start
+// of the track, after the sequence number and track name. Color events of the same format are
+// removed
+func (t *Track) SetColor(manufacturerID []byte, color TrackColor) error {
+	format, ok := trackColorFormat(manufacturerID)
+	if !ok {
+		return fmt.Errorf("no track color format registered for manufacturer %X", manufacturerID)
+	}
+
+	events := []AbsEvent{}
+	for _, ae := range t.AbsEvents() {
+		if _, id, ok := trackColorFromEvent(ae.Event); ok && bytes.Equal(id, manufacturerID) {
+			continue
+		}
+
+		events = append(events, ae)
+	}
+
+	data := append(bytes.Clone(format.ManufacturerID), format.Encode(color)...)
+	event := decodeSequencerSpecificEvent(NewMetaEvent(0, SequencerSpecific, data))
+
+	// Sequencers expect the sequence number and track name to be the first events of a track
+	index := 0
+	for i, ae := range events {
+		if ae.Tick > 0 {
+			break
+		}
+
+		if me, ok := ae.Event.(*MetaEvent); ok && (me.MetaType == SequenceNumber || me.MetaType == TrackName) {
+			index = i + 1
+		}
+	}
+
+	events = append(events, AbsEvent{})
+	copy(events[index+1:], events[index:])
+	events[index] = AbsEvent{Tick: 0, Event: event}
+
+	t.SetAbsEvents(events)
+
+	return nil
+}
+
+// Markers returns the marker and cue point meta events of the track, sequencers such as Logic
+// export their arrangement markers this way
+func (t *Track) Markers() []MarkerPoint {
+	markers := []MarkerPoint{}
+
+	for _, ae := range t.AbsEvents() {
+		me, ok := ae.Event.(*MetaEvent)
+		if !ok || (me.MetaType != Marker && me.MetaType != CuePoint) {
+			continue
+		}
+
+		markers = append(markers, MarkerPoint{Tick: ae.Tick, Name: string(me.Data)})
+	}
+
+	return markers
+}
+
+// Markers returns the markers of the conductor track, the first track of a file, see
+// Track.Markers. Use BuildConductorTrack to write markers
+func (f *File) Markers() []MarkerPoint {
+	if len(f.Tracks) == 0 {
+		return []MarkerPoint{}
+	}
+
+	return f.Tracks[0].Markers()
+}
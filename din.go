@@ -0,0 +1,133 @@
+package midi
+
+import (
+	"sort"
+	"time"
+)
+
+// DINByteDuration is the transmission time of one byte on a 31.25 kbaud DIN connection (ten bits
+// per byte including start and stop bit)
+const DINByteDuration = 320 * time.Microsecond
+
+// DINMessage is an event due at a time offset
+type DINMessage struct {
+	Time  time.Duration
+	Event Event
+}
+
+// DINByte is a byte with the time offset its transmission starts
+type DINByte struct {
+	Time time.Duration
+	Byte byte
+}
+
+// DINScheduler serializes events to a DIN byte stream, it keeps the running status and the line
+// time between calls to Schedule
+type DINScheduler struct {
+	// RunningStatus omits repeated channel status bytes
+	RunningStatus bool
+	status        byte
+	lineTime      time.Duration
+}
+
+// NewDINScheduler creates a new DIN scheduler
+func NewDINScheduler(runningStatus bool) *DINScheduler {
+	return &DINScheduler{RunningStatus: runningStatus}
+}
+
+// Schedule serializes messages in time order. A message starts when it is due or as soon as the
+// line is free. Real time messages are sent at their due time, interleaved between the bytes of
+// a message that is being transmitted if needed
+func (s *DINScheduler) Schedule(messages []DINMessage) ([]DINByte, error) {
+	sorted := make([]DINMessage, len(messages))
+	copy(sorted, messages)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time < sorted[j].Time
+	})
+
+	realTime := []DINMessage{}
+	other := []DINMessage{}
+
+	for _, message := range sorted {
+		if realTimeStatus(message.Event) != 0 {
+			realTime = append(realTime, message)
+		} else {
+			other = append(other, message)
+		}
+	}
+
+	result := []DINByte{}
+
+	send := func(b byte, due time.Duration) {
+		if s.lineTime < due {
+			s.lineTime = due
+		}
+
+		result = append(result, DINByte{Time: s.lineTime, Byte: b})
+		s.lineTime += DINByteDuration
+	}
+
+	// sendRealTime sends the real time messages due before limit
+	sendRealTime := func(limit time.Duration) {
+		for len(realTime) > 0 && realTime[0].Time <= limit {
+			send(realTimeStatus(realTime[0].Event), realTime[0].Time)
+			realTime = realTime[1:]
+		}
+	}
+
+	for _, message := range other {
+		data, err := framedMessageBytes(message.Event)
+		if err != nil {
+			return nil, err
+		}
+
+		// Real time messages due before the line becomes available for this message
+		start := message.Time
+		if s.lineTime > start {
+			start = s.lineTime
+		}
+
+		sendRealTime(start)
+
+		status := data[0]
+
+		if s.RunningStatus && status < 0xF0 && status == s.status {
+			data = data[1:]
+		}
+
+		if status < 0xF0 {
+			s.status = status
+		} else {
+			s.status = 0
+		}
+
+		for index, b := range data {
+			if index > 0 {
+				sendRealTime(s.lineTime)
+			}
+
+			send(b, message.Time)
+		}
+	}
+
+	for _, message := range realTime {
+		send(realTimeStatus(message.Event), message.Time)
+	}
+
+	return result, nil
+}
+
+// realTimeStatus returns the status byte of a real time event, 0 for other events
+func realTimeStatus(event Event) byte {
+	if _, ok := event.(*SystemRealTimeEvent); !ok {
+		return 0
+	}
+
+	data, err := MessageBytes(event)
+	if err != nil {
+		return 0
+	}
+
+	return data[0]
+}
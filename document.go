@@ -0,0 +1,318 @@
+package midi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// FileDocument is the schema used to marshal files to structured formats like JSON and YAML
+type FileDocument struct {
+	Format   Format           `json:"format" yaml:"format"`
+	Division DivisionDocument `json:"division" yaml:"division"`
+	Tracks   []TrackDocument  `json:"tracks" yaml:"tracks"`
+}
+
+// DivisionDocument holds either ticks per quarter note or a SMPTE division
+type DivisionDocument struct {
+	TicksPerQuarterNote uint16 `json:"ticksPerQuarterNote,omitempty" yaml:"ticksPerQuarterNote,omitempty"`
+	FramesPerSecond     uint8  `json:"framesPerSecond,omitempty" yaml:"framesPerSecond,omitempty"`
+	TicksPerFrame       uint8  `json:"ticksPerFrame,omitempty" yaml:"ticksPerFrame,omitempty"`
+}
+
+// TrackDocument holds the events of a track
+type TrackDocument struct {
+	Events []EventDocument `json:"events" yaml:"events"`
+}
+
+// EventDocument is an event at an absolute tick, only the fields used by the event type are set.
+// Type is the event type name as in the text format, e.g. NoteOn or Meta
+type EventDocument struct {
+	Tick    uint32  `json:"tick" yaml:"tick"`
+	Type    string  `json:"type" yaml:"type"`
+	Channel *uint16 `json:"channel,omitempty" yaml:"channel,omitempty"`
+	Key     *uint16 `json:"key,omitempty" yaml:"key,omitempty"`
+	// NoteName is the key spelled in the active key signature, e.g. F#4, it is ignored when read
+	NoteName   string  `json:"noteName,omitempty" yaml:"noteName,omitempty"`
+	Velocity   *uint16 `json:"velocity,omitempty" yaml:"velocity,omitempty"`
+	Controller *uint16 `json:"controller,omitempty" yaml:"controller,omitempty"`
+	// Value of control changes, program changes, pressure, pitch wheel and system common events
+	Value *uint16 `json:"value,omitempty" yaml:"value,omitempty"`
+	// MetaType is the meta type name or a hex number for unknown meta types
+	MetaType string `json:"metaType,omitempty" yaml:"metaType,omitempty"`
+	// Text of text meta events with valid UTF-8 data
+	Text *string `json:"text,omitempty" yaml:"text,omitempty"`
+	// Data of other meta events and system exclusive events as hex
+	Data string `json:"data,omitempty" yaml:"data,omitempty"`
+	// Continuation is set for system exclusive events with status 0xF7
+	Continuation bool `json:"continuation,omitempty" yaml:"continuation,omitempty"`
+	// Status byte of raw events as hex, the data bytes are in Data
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// documentValue returns a pointer to v for optional document fields
+func documentValue(v uint16) *uint16 {
+	return &v
+}
+
+// newEventDocument converts an event at tick to its document form
+func newEventDocument(tick uint32, event Event) (EventDocument, error) {
+	doc := EventDocument{Tick: tick, Type: eventTypeToString(event.EventType())}
+
+	switch e := event.(type) {
+	case *ChannelEvent:
+		doc.Channel = documentValue(e.Channel)
+
+		switch e.eventType {
+		case NoteOff, NoteOn, PolyphonicKeyPressure:
+			doc.Key = documentValue(e.Value1)
+			doc.Velocity = documentValue(e.Value2)
+		case ControlChange:
+			doc.Controller = documentValue(e.Value1)
+			doc.Value = documentValue(e.Value2)
+		default:
+			doc.Value = documentValue(e.Value1)
+		}
+	case *SequencerSpecificEvent:
+		return newEventDocument(tick, &e.MetaEvent)
+	case *MetaEvent:
+		doc.MetaType = metaTypeToString(e.MetaType)
+		if doc.MetaType == "Unknown" {
+			doc.MetaType = fmt.Sprintf("0x%02x", uint8(e.MetaType))
+		}
+
+		// Text that is not valid UTF-8 (Latin-1 names for example) would be altered by the encoder
+		if isTextMetaType(e.MetaType) && utf8.Valid(e.Data) {
+			text := string(e.Data)
+			doc.Text = &text
+		} else {
+			doc.Data = hex.EncodeToString(e.Data)
+		}
+	case *SystemExclusiveEvent:
+		doc.Data = hex.EncodeToString(e.Data)
+		doc.Continuation = e.Continuation
+	case *SystemCommonEvent:
+		if e.eventType != TuneRequest {
+			doc.Value = documentValue(e.Value1)
+		}
+	case *SystemRealTimeEvent:
+	case *RawEvent:
+		doc.Type = eventTypeToString(Raw)
+		doc.Status = fmt.Sprintf("%02x", e.Status)
+		doc.Data = hex.EncodeToString(e.Data)
+	default:
+		return doc, fmt.Errorf("event %v has no document representation", event)
+	}
+
+	return doc, nil
+}
+
+// documentField returns the value of a required field
+func documentField(v *uint16, name string) (uint16, error) {
+	if v == nil {
+		return 0, fmt.Errorf("missing %v", name)
+	}
+
+	return *v, nil
+}
+
+// Event converts the document to an event with delta time 0
+func (doc EventDocument) Event() (Event, error) {
+	if doc.Type == "Meta" {
+		metaType, ok := textMetaTypes[doc.MetaType]
+		if !ok {
+			v, err := strconv.ParseUint(doc.MetaType, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("unknown meta type %v", doc.MetaType)
+			}
+
+			metaType = MetaType(v)
+		}
+
+		if doc.Text != nil {
+			return NewMetaEvent(0, metaType, []byte(*doc.Text)), nil
+		}
+
+		data, err := hex.DecodeString(doc.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewMetaEvent(0, metaType, data), nil
+	}
+
+	eventType, ok := textEventTypes[doc.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %v", doc.Type)
+	}
+
+	switch eventType {
+	case NoteOff, NoteOn, PolyphonicKeyPressure, ControlChange:
+		value1, value2 := doc.Key, doc.Velocity
+		if eventType == ControlChange {
+			value1, value2 = doc.Controller, doc.Value
+		}
+
+		channel, err := documentField(doc.Channel, "channel")
+		if err != nil {
+			return nil, err
+		}
+
+		v1, err := documentField(value1, "key or controller")
+		if err != nil {
+			return nil, err
+		}
+
+		v2, err := documentField(value2, "velocity or value")
+		if err != nil {
+			return nil, err
+		}
+
+		return NewChannelEvent(0, eventType, channel, v1, v2), nil
+	case ProgramChange, ChannelPressure, PitchWheelChange:
+		channel, err := documentField(doc.Channel, "channel")
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := documentField(doc.Value, "value")
+		if err != nil {
+			return nil, err
+		}
+
+		return NewChannelEvent(0, eventType, channel, value, 0), nil
+	case SystemExclusive:
+		data, err := hex.DecodeString(doc.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: data, Continuation: doc.Continuation}, nil
+	case SongPositionPointer, SongSelect, MTCQuarterFrame:
+		value, err := documentField(doc.Value, "value")
+		if err != nil {
+			return nil, err
+		}
+
+		return &SystemCommonEvent{coreEvent: coreEvent{eventType: eventType}, Value1: value}, nil
+	case TuneRequest:
+		return &SystemCommonEvent{coreEvent: coreEvent{eventType: eventType}}, nil
+	case Raw:
+		return parseRawEvent(doc.Status, doc.Data)
+	}
+
+	return &SystemRealTimeEvent{coreEvent: coreEvent{eventType: eventType}}, nil
+}
+
+// Document converts the file to its document form
+func (f *File) Document() (*FileDocument, error) {
+	doc := &FileDocument{Tracks: make([]TrackDocument, len(f.Tracks))}
+
+	if f.Header != nil {
+		doc.Format = f.Header.Format
+
+		if f.Header.DivisionType == DivisionFramesTicks {
+			doc.Division.FramesPerSecond = f.Header.FramesPerSecond
+			doc.Division.TicksPerFrame = f.Header.TicksPerFrame
+		} else {
+			doc.Division.TicksPerQuarterNote = f.Header.TicksPerQuarterNote
+		}
+	}
+
+	keyMap := f.KeyMap()
+
+	for index, track := range f.Tracks {
+		events := track.AbsEvents()
+		doc.Tracks[index].Events = make([]EventDocument, len(events))
+
+		for eventIndex, ae := range events {
+			eventDoc, err := newEventDocument(ae.Tick, ae.Event)
+			if err != nil {
+				return nil, err
+			}
+
+			if eventDoc.Key != nil && *eventDoc.Key <= 0x7F {
+				eventDoc.NoteName = keyMap.NoteName(ae.Tick, uint8(*eventDoc.Key))
+			}
+
+			doc.Tracks[index].Events[eventIndex] = eventDoc
+		}
+	}
+
+	return doc, nil
+}
+
+// SetDocument replaces the header and tracks of the file with the document and rebuilds the chunks
+func (f *File) SetDocument(doc *FileDocument) error {
+	header := &FileHeader{Format: doc.Format}
+
+	var err error
+	if doc.Division.FramesPerSecond != 0 {
+		err = header.SetSMPTE(doc.Division.FramesPerSecond, doc.Division.TicksPerFrame)
+	} else {
+		err = header.SetTicksPerQuarterNote(doc.Division.TicksPerQuarterNote)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tracks := make([]*Track, len(doc.Tracks))
+
+	for index, trackDoc := range doc.Tracks {
+		events := make([]AbsEvent, len(trackDoc.Events))
+
+		for eventIndex, eventDoc := range trackDoc.Events {
+			if eventIndex > 0 && eventDoc.Tick < events[eventIndex-1].Tick {
+				return fmt.Errorf("track %v: ticks should be ascending", index)
+			}
+
+			event, err := eventDoc.Event()
+			if err != nil {
+				return fmt.Errorf("track %v, event %v: %v", index, eventIndex, err)
+			}
+
+			events[eventIndex] = AbsEvent{Tick: eventDoc.Tick, Event: event}
+		}
+
+		tracks[index] = NewTrackFromAbsEvents(events)
+	}
+
+	f.Header = header
+	f.Tracks = tracks
+	f.Chunks = nil
+	f.Warnings = nil
+	f.trackErrors = nil
+	f.Rebuild()
+
+	return nil
+}
+
+// MarshalJSON marshals the file in the document schema
+func (f *File) MarshalJSON() ([]byte, error) {
+	doc, err := f.Document()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON unmarshals a file in the document schema
+func (f *File) UnmarshalJSON(data []byte) error {
+	doc := &FileDocument{}
+
+	err := json.Unmarshal(data, doc)
+	if err != nil {
+		return err
+	}
+
+	if doc.Tracks == nil {
+		return errors.New("document has no tracks")
+	}
+
+	return f.SetDocument(doc)
+}
@@ -0,0 +1,137 @@
+package midi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GMDrumChannel is the channel of the General MIDI percussion part, channel 10 counting from 1
+const GMDrumChannel uint16 = 9
+
+// gmDrumNames holds the General MIDI percussion key map
+var gmDrumNames = map[uint8]string{
+	35: "Acoustic Bass Drum",
+	36: "Bass Drum 1",
+	37: "Side Stick",
+	38: "Acoustic Snare",
+	39: "Hand Clap",
+	40: "Electric Snare",
+	41: "Low Floor Tom",
+	42: "Closed Hi-Hat",
+	43: "High Floor Tom",
+	44: "Pedal Hi-Hat",
+	45: "Low Tom",
+	46: "Open Hi-Hat",
+	47: "Low-Mid Tom",
+	48: "Hi-Mid Tom",
+	49: "Crash Cymbal 1",
+	50: "High Tom",
+	51: "Ride Cymbal 1",
+	52: "Chinese Cymbal",
+	53: "Ride Bell",
+	54: "Tambourine",
+	55: "Splash Cymbal",
+	56: "Cowbell",
+	57: "Crash Cymbal 2",
+	58: "Vibraslap",
+	59: "Ride Cymbal 2",
+	60: "Hi Bongo",
+	61: "Low Bongo",
+	62: "Mute Hi Conga",
+	63: "Open Hi Conga",
+	64: "Low Conga",
+	65: "High Timbale",
+	66: "Low Timbale",
+	67: "High Agogo",
+	68: "Low Agogo",
+	69: "Cabasa",
+	70: "Maracas",
+	71: "Short Whistle",
+	72: "Long Whistle",
+	73: "Short Guiro",
+	74: "Long Guiro",
+	75: "Claves",
+	76: "Hi Wood Block",
+	77: "Low Wood Block",
+	78: "Mute Cuica",
+	79: "Open Cuica",
+	80: "Mute Triangle",
+	81: "Open Triangle",
+}
+
+// GMDrumName returns the General MIDI percussion name of key, or an empty string for keys
+// outside the drum map
+func GMDrumName(key uint8) string {
+	return gmDrumNames[key]
+}
+
+// isDrumKeyEvent returns the key of a note or key pressure event on channel
+func isDrumKeyEvent(event Event, channel uint16) (uint8, bool) {
+	ce, ok := event.(*ChannelEvent)
+	if !ok || ce.Channel != channel {
+		return 0, false
+	}
+
+	switch ce.eventType {
+	case NoteOn, NoteOff, PolyphonicKeyPressure:
+		return uint8(ce.Value1), true
+	}
+
+	return 0, false
+}
+
+// SplitDrums splits a drum track in one track per instrument, the note and key pressure events
+// on channel are moved to a track per key, sorted by key, with their timing and velocities
+// unchanged. If nameTracks is true each instrument track starts with a track name from the
+// General MIDI drum map, or "Drum <key>" for keys outside it. All other events, like program
+// changes, controllers and meta events, stay in the remainder track. Every track ends at the
+// end of the original track
+func SplitDrums(track *Track, channel uint16, nameTracks bool) (instruments []*Track, remainder *Track) {
+	perKey := map[uint8][]AbsEvent{}
+	rest := []AbsEvent{}
+	end := uint32(0)
+
+	for _, ae := range track.AbsEvents() {
+		end = ae.Tick
+
+		if key, ok := isDrumKeyEvent(ae.Event, channel); ok {
+			perKey[key] = append(perKey[key], AbsEvent{Tick: ae.Tick, Event: cloneEvent(ae.Event)})
+			continue
+		}
+
+		rest = append(rest, AbsEvent{Tick: ae.Tick, Event: cloneEvent(ae.Event)})
+	}
+
+	keys := make([]int, 0, len(perKey))
+	for key := range perKey {
+		keys = append(keys, int(key))
+	}
+
+	sort.Ints(keys)
+
+	instruments = make([]*Track, 0, len(keys))
+
+	for _, key := range keys {
+		events := []AbsEvent{}
+
+		if nameTracks {
+			name := GMDrumName(uint8(key))
+			if name == "" {
+				name = fmt.Sprintf("Drum %v", key)
+			}
+
+			events = append(events, AbsEvent{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte(name))})
+		}
+
+		events = append(events, perKey[uint8(key)]...)
+		events = append(events, AbsEvent{Tick: end, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+
+		instruments = append(instruments, NewTrackFromAbsEvents(events))
+	}
+
+	if len(rest) == 0 || !isEndOfTrack(rest[len(rest)-1].Event) {
+		rest = append(rest, AbsEvent{Tick: end, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+	}
+
+	return instruments, NewTrackFromAbsEvents(rest)
+}
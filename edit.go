@@ -0,0 +1,300 @@
+package midi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Overdub merges events at absolute ticks into an existing track without changing the timing
+// of the existing events. New events are placed after existing events at the same tick, end of
+// track events in the new events are ignored and the end of track of dst is moved if needed
+func Overdub(dst *Track, events []AbsEvent) {
+	OverdubWithOrder(dst, events, OrderPreserve)
+}
+
+// OverdubWithOrder merges events like Overdub and orders all events at the same tick with the
+// order policy, existing events stay before new events of equal order
+func OverdubWithOrder(dst *Track, events []AbsEvent, order OrderPolicy) {
+	added := make([]AbsEvent, 0, len(events))
+	for _, ae := range events {
+		if !isEndOfTrack(ae.Event) {
+			added = append(added, ae)
+		}
+	}
+
+	sort.SliceStable(added, func(i, j int) bool {
+		return added[i].Tick < added[j].Tick
+	})
+
+	existing := dst.AbsEvents()
+
+	var endOfTrack *AbsEvent
+	if len(existing) > 0 && isEndOfTrack(existing[len(existing)-1].Event) {
+		endOfTrack = &existing[len(existing)-1]
+		existing = existing[:len(existing)-1]
+	}
+
+	merged := make([]AbsEvent, 0, len(existing)+len(added)+1)
+	i, j := 0, 0
+
+	for i < len(existing) || j < len(added) {
+		if j >= len(added) || (i < len(existing) && existing[i].Tick <= added[j].Tick) {
+			merged = append(merged, existing[i])
+			i++
+		} else {
+			merged = append(merged, added[j])
+			j++
+		}
+	}
+
+	if order != OrderPreserve {
+		SortAbsEvents(merged, order)
+	}
+
+	if endOfTrack != nil {
+		if len(merged) > 0 && merged[len(merged)-1].Tick > endOfTrack.Tick {
+			endOfTrack.Tick = merged[len(merged)-1].Tick
+		}
+
+		merged = append(merged, *endOfTrack)
+	}
+
+	dst.SetAbsEvents(merged)
+}
+
+// filterEvents returns the events for which keep returns true, the delta times of removed events
+// are added to the next kept event so the timing of the kept events is preserved
+func filterEvents(events []Event, keep func(Event) bool) []Event {
+	kept := make([]Event, 0, len(events))
+	carry := uint32(0)
+
+	for _, event := range events {
+		if !keep(event) {
+			carry += event.DeltaTime()
+			continue
+		}
+
+		if carry > 0 {
+			event.SetDeltaTime(event.DeltaTime() + carry)
+			carry = 0
+		}
+
+		kept = append(kept, event)
+	}
+
+	return kept
+}
+
+// CompactOptions controls what File.Compact removes
+type CompactOptions struct {
+	// RemoveMetaOnlyTracks also removes tracks that contain nothing but text like meta events
+	// (names, text, markers, lyrics, ...), tempo, time and key signature are never noise
+	RemoveMetaOnlyTracks bool
+	// MergeSysExContinuations merges a system exclusive event without terminating 0xF7 and the
+	// 0xF7 continuation events directly following it into a single event
+	MergeSysExContinuations bool
+}
+
+// CompactReport describes what File.Compact changed
+type CompactReport struct {
+	// Indices of the removed tracks in the original file
+	RemovedTracks []int
+	// Number of continuation events merged into their initial system exclusive event
+	MergedSysExEvents int
+}
+
+// isMetaNoise returns true for meta events that carry no musical information
+func isMetaNoise(event Event) bool {
+	me, ok := event.(*MetaEvent)
+	if !ok {
+		return false
+	}
+
+	switch me.MetaType {
+	case SetTempo, SMPTEOffset, TimeSignature, KeySignature:
+		return false
+	}
+
+	return true
+}
+
+// sysExAssembler merges system exclusive events without terminating 0xF7 with the continuation
+// events directly following them. Continuation events that do not follow an unterminated event
+// are escaped bytes and are kept
+type sysExAssembler struct {
+	open *SystemExclusiveEvent
+	// Limit of the data length of an assembled message, 0 means no limit
+	maxBytes int
+}
+
+// add returns false if event is a continuation merged into the open event, an error is
+// returned if the assembled message exceeds the limit
+func (a *sysExAssembler) add(event Event) (bool, error) {
+	se, ok := event.(*SystemExclusiveEvent)
+	if !ok {
+		a.open = nil
+		return true, nil
+	}
+
+	if se.Continuation && a.open != nil {
+		length := len(a.open.Data) + len(se.Data)
+		if a.maxBytes > 0 && length > a.maxBytes {
+			return false, fmt.Errorf("system exclusive event of %v bytes, the limit is %v", length, a.maxBytes)
+		}
+
+		a.open.Data = append(a.open.Data, se.Data...)
+
+		if len(se.Data) > 0 && se.Data[len(se.Data)-1] == 0xF7 {
+			a.open = nil
+		}
+
+		return false, nil
+	}
+
+	a.open = nil
+
+	if !se.Continuation && (len(se.Data) == 0 || se.Data[len(se.Data)-1] != 0xF7) {
+		se.Retain()
+		a.open = se
+	}
+
+	return true, nil
+}
+
+// terminated returns true if no event is waiting for continuations
+func (a *sysExAssembler) terminated() bool {
+	return a.open == nil
+}
+
+// mergeSysExContinuations merges unterminated system exclusive events with their continuations,
+// an error is returned if an assembled message is longer than maxBytes
+func mergeSysExContinuations(track *Track, maxBytes int) (int, error) {
+	merged := 0
+	assembler := &sysExAssembler{maxBytes: maxBytes}
+
+	var limitErr error
+
+	events := filterEvents(track.Events, func(event Event) bool {
+		if limitErr != nil {
+			return true
+		}
+
+		keep, err := assembler.add(event)
+		if err != nil {
+			limitErr = err
+			return true
+		}
+
+		if !keep {
+			merged++
+		}
+
+		return keep
+	})
+
+	if limitErr != nil {
+		return 0, limitErr
+	}
+
+	track.Events = events
+
+	return merged, nil
+}
+
+// Compact removes tracks that only contain an end of track event (or only meta noise if
+// requested) and optionally merges fragmented system exclusive events. The conductor track of
+// a format 1 file is always kept. Chunks and header are updated to match the tracks
+func (f *File) Compact(opts CompactOptions) CompactReport {
+	report := CompactReport{RemovedTracks: []int{}}
+	chunkIndices := f.trackChunkIndices()
+	chunksMatch := len(chunkIndices) == len(f.Tracks)
+	offset := f.conductorOffset()
+
+	removedChunks := map[int]bool{}
+	tracks := make([]*Track, 0, len(f.Tracks))
+
+	for index, track := range f.Tracks {
+		empty := true
+
+		for _, event := range track.Events {
+			if isEndOfTrack(event) || (opts.RemoveMetaOnlyTracks && isMetaNoise(event)) {
+				continue
+			}
+
+			empty = false
+			break
+		}
+
+		if empty && index >= offset {
+			report.RemovedTracks = append(report.RemovedTracks, index)
+
+			if chunksMatch {
+				removedChunks[chunkIndices[index]] = true
+			}
+
+			continue
+		}
+
+		if opts.MergeSysExContinuations {
+			merged, _ := mergeSysExContinuations(track, 0)
+			report.MergedSysExEvents += merged
+
+			if merged > 0 && chunksMatch {
+				f.Chunks[chunkIndices[index]] = track.Chunk()
+			}
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	chunks := make([]*Chunk, 0, len(f.Chunks))
+	for index, chunk := range f.Chunks {
+		if !removedChunks[index] {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	f.Tracks = tracks
+	f.Chunks = chunks
+
+	if f.Header != nil {
+		f.Header.NumTracks = uint16(len(tracks))
+		f.updateHeaderChunk()
+	}
+
+	return report
+}
+
+// Strip removes the events for which predicate returns true while preserving the timing of the
+// remaining events, the number of removed events is returned
+func Strip(track *Track, predicate func(Event) bool) int {
+	before := len(track.Events)
+
+	track.Events = filterEvents(track.Events, func(event Event) bool {
+		return !predicate(event)
+	})
+
+	return before - len(track.Events)
+}
+
+// StripAftertouch removes polyphonic key pressure and channel pressure events
+func StripAftertouch(track *Track) int {
+	return Strip(track, func(event Event) bool {
+		return event.EventType() == PolyphonicKeyPressure || event.EventType() == ChannelPressure
+	})
+}
+
+// StripSysEx removes system exclusive events
+func StripSysEx(track *Track) int {
+	return Strip(track, func(event Event) bool {
+		return event.EventType() == SystemExclusive
+	})
+}
+
+// StripChannel removes all channel events on channel (0-15)
+func StripChannel(track *Track, channel uint16) int {
+	return Strip(track, func(event Event) bool {
+		ce, ok := event.(*ChannelEvent)
+		return ok && ce.Channel == channel
+	})
+}
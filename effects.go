@@ -0,0 +1,260 @@
+package midi
+
+import (
+	"math"
+	"sort"
+)
+
+// Delay adds echoes to the notes of a track like a midi delay effect. Every note is repeated
+// repeats times, each echo delayTicks after the previous one with the same channel, key and
+// length and the velocity of the previous one multiplied by velocityDecay, limited to 127. The
+// echoes of a note stop when the velocity would drop below 1. Echo note offs are placed before
+// existing events at the same tick and echo note ons after them, so an echo never ends a note
+// starting at the same tick. The end of track is moved if needed and the number of echo notes
+// added is returned
+func Delay(track *Track, delayTicks uint32, repeats int, velocityDecay float64) int {
+	if delayTicks == 0 || repeats <= 0 {
+		return 0
+	}
+
+	events := track.AbsEvents()
+	added := 0
+
+	for _, note := range track.Notes() {
+		velocity := float64(note.Velocity)
+
+		for repeat := 1; repeat <= repeats; repeat++ {
+			velocity = math.Min(velocity*velocityDecay, 127)
+			if math.Round(velocity) < 1 {
+				break
+			}
+
+			offset := delayTicks * uint32(repeat)
+
+			echo := note
+			echo.Velocity = uint8(math.Round(velocity))
+			echo.Start += offset
+			echo.End += offset
+
+			on, off := echo.events()
+			events = insertAbsEvent(events, on, false)
+			events = insertAbsEvent(events, off, true)
+			added++
+		}
+	}
+
+	track.SetAbsEvents(events)
+
+	return added
+}
+
+// StrumDirection selects which chord note Strum plays first
+type StrumDirection int
+
+const (
+	// StrumUp plays the lowest note of a chord first
+	StrumUp StrumDirection = iota
+	// StrumDown plays the highest note of a chord first
+	StrumDown
+)
+
+// StrumOptions configures Strum
+type StrumOptions struct {
+	// Direction of the strum
+	Direction StrumDirection
+	// Spread in ticks between the starts of successive chord notes
+	Spread uint32
+}
+
+// Strum humanizes chords by spreading their notes, notes starting at the same tick on the same
+// channel are started Spread ticks after each other in the order of Direction. The note ends are
+// kept, a note is never delayed past the tick before its note off. The number of delayed notes
+// is returned
+func Strum(track *Track, opts StrumOptions) int {
+	if opts.Spread == 0 {
+		return 0
+	}
+
+	type chordKey struct {
+		tick    uint32
+		channel uint16
+	}
+
+	events := track.AbsEvents()
+	chords := map[chordKey][]int{}
+	order := []chordKey{}
+
+	for index, ae := range events {
+		ce, ok := ae.Event.(*ChannelEvent)
+		if !ok || ce.eventType != NoteOn || isNoteOff(ce) {
+			continue
+		}
+
+		key := chordKey{tick: ae.Tick, channel: ce.Channel}
+		if _, ok := chords[key]; !ok {
+			order = append(order, key)
+		}
+
+		chords[key] = append(chords[key], index)
+	}
+
+	moved := map[int]uint32{}
+	strummed := []int{}
+
+	for _, key := range order {
+		notes := chords[key]
+		if len(notes) < 2 {
+			continue
+		}
+
+		sort.SliceStable(notes, func(i, j int) bool {
+			a := events[notes[i]].Event.(*ChannelEvent).Value1
+			b := events[notes[j]].Event.(*ChannelEvent).Value1
+
+			if opts.Direction == StrumDown {
+				return a > b
+			}
+
+			return a < b
+		})
+
+		for position, index := range notes[1:] {
+			tick := key.tick + opts.Spread*uint32(position+1)
+
+			// Find the note off ending this note so the note keeps at least one tick
+			ce := events[index].Event.(*ChannelEvent)
+			for _, ae := range events[index+1:] {
+				if off, ok := ae.Event.(*ChannelEvent); ok && isNoteOff(off) && off.Channel == ce.Channel && off.Value1 == ce.Value1 {
+					if ae.Tick <= key.tick {
+						tick = key.tick
+					} else if tick >= ae.Tick {
+						tick = ae.Tick - 1
+					}
+
+					break
+				}
+			}
+
+			if tick != key.tick {
+				moved[index] = tick
+				strummed = append(strummed, index)
+			}
+		}
+	}
+
+	if len(strummed) == 0 {
+		return 0
+	}
+
+	kept := make([]AbsEvent, 0, len(events))
+	for index, ae := range events {
+		if _, ok := moved[index]; !ok {
+			kept = append(kept, ae)
+		}
+	}
+
+	// Delayed notes start after existing events at their new tick, so a note off of the same key
+	// at that tick does not end them
+	for _, index := range strummed {
+		kept = insertAbsEvent(kept, AbsEvent{Tick: moved[index], Event: events[index].Event}, false)
+	}
+
+	track.SetAbsEvents(kept)
+
+	return len(strummed)
+}
+
+// StealPolicy selects the note LimitPolyphony ends when a note starts with all voices in use
+type StealPolicy int
+
+const (
+	// StealOldest ends the note that started first
+	StealOldest StealPolicy = iota
+	// StealQuietest ends the note with the lowest velocity, the oldest of equally quiet notes
+	StealQuietest
+	// StealLowest ends the note with the lowest key, the oldest of notes on the same key
+	StealLowest
+)
+
+// LimitPolyphony enforces a maximum number of simultaneous notes over all channels of a track,
+// like the voice limit of a hardware synth. When a note starts while maxVoices notes are
+// sounding, a note chosen by stealPolicy ends at that tick, a stolen note starting at the same
+// tick is removed. The note events are rewritten from the notes, with note offs before note ons
+// at the same tick, other events are kept. The number of stolen notes is returned
+func LimitPolyphony(track *Track, maxVoices int, stealPolicy StealPolicy) int {
+	if maxVoices <= 0 {
+		return 0
+	}
+
+	notes := track.Notes()
+	active := []int{}
+	removed := map[int]bool{}
+	stolen := 0
+
+	for index, note := range notes {
+		sounding := active[:0]
+		for _, a := range active {
+			if notes[a].End > note.Start {
+				sounding = append(sounding, a)
+			}
+		}
+
+		active = sounding
+
+		if len(active) >= maxVoices {
+			victim := 0
+
+			for i, a := range active[1:] {
+				candidate, current := notes[a], notes[active[victim]]
+
+				switch stealPolicy {
+				case StealQuietest:
+					if candidate.Velocity < current.Velocity {
+						victim = i + 1
+					}
+				case StealLowest:
+					if candidate.Key < current.Key {
+						victim = i + 1
+					}
+				}
+			}
+
+			notes[active[victim]].End = note.Start
+			if notes[active[victim]].Start == note.Start {
+				removed[active[victim]] = true
+			}
+
+			active = append(active[:victim], active[victim+1:]...)
+			stolen++
+		}
+
+		active = append(active, index)
+	}
+
+	if stolen == 0 {
+		return 0
+	}
+
+	events := []AbsEvent{}
+	for _, ae := range track.AbsEvents() {
+		if ce, ok := ae.Event.(*ChannelEvent); ok && (ce.eventType == NoteOn || ce.eventType == NoteOff) {
+			continue
+		}
+
+		events = append(events, ae)
+	}
+
+	for index, note := range notes {
+		if removed[index] {
+			continue
+		}
+
+		on, off := note.events()
+		events = insertAbsEvent(events, on, false)
+		events = insertAbsEvent(events, off, true)
+	}
+
+	track.SetAbsEvents(events)
+
+	return stolen
+}
@@ -0,0 +1,89 @@
+package midi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FirstUserEventType is the first event type handed out by RegisterEventType, built-in event
+// types stay below it
+const FirstUserEventType EventType = 0x80
+
+var (
+	// userEventTypesMutex guards userEventTypes
+	userEventTypesMutex sync.RWMutex
+	// userEventTypes holds the names of registered event types from FirstUserEventType on
+	userEventTypes []string
+)
+
+// RegisterEventType reserves an event type for extension events, e.g. decoded system exclusive
+// messages, so they can be used in filters, String and EventTypes without colliding with
+// built-in types. Registering a name again returns the same type. It panics if the name is used
+// by a built-in type or all user event types are taken
+func RegisterEventType(name string) EventType {
+	for eventType := NoteOff; eventType <= Raw; eventType++ {
+		if eventTypeToString(eventType) == name {
+			panic(fmt.Sprintf("midi: event type name %v is used by a built-in event type", name))
+		}
+	}
+
+	userEventTypesMutex.Lock()
+	defer userEventTypesMutex.Unlock()
+
+	for index, existing := range userEventTypes {
+		if existing == name {
+			return FirstUserEventType + EventType(index)
+		}
+	}
+
+	if len(userEventTypes) > int(^EventType(0)-FirstUserEventType) {
+		panic("midi: no user event types left")
+	}
+
+	userEventTypes = append(userEventTypes, name)
+
+	return FirstUserEventType + EventType(len(userEventTypes)-1)
+}
+
+// userEventTypeName returns the name of a registered event type or an empty string
+func userEventTypeName(eventType EventType) string {
+	if eventType < FirstUserEventType {
+		return ""
+	}
+
+	userEventTypesMutex.RLock()
+	defer userEventTypesMutex.RUnlock()
+
+	index := int(eventType - FirstUserEventType)
+	if index >= len(userEventTypes) {
+		return ""
+	}
+
+	return userEventTypes[index]
+}
+
+// EventTypes returns the built-in event types followed by the registered event types
+func EventTypes() []EventType {
+	userEventTypesMutex.RLock()
+	defer userEventTypesMutex.RUnlock()
+
+	eventTypes := []EventType{}
+	for eventType := NoteOff; eventType <= Raw; eventType++ {
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	for index := range userEventTypes {
+		eventTypes = append(eventTypes, FirstUserEventType+EventType(index))
+	}
+
+	return eventTypes
+}
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	if name := eventTypeToString(t); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("EventType(%d)", uint8(t))
+}
@@ -9,6 +9,19 @@ import (
 type SystemExclusiveEvent struct {
 	coreEvent
 	Data []byte
+	// Continuation is true for events with status 0xF7, the continuation packets of a system
+	// exclusive message divided over several events or escaped bytes sent as is
+	Continuation bool
+	pooled       *[]byte
+}
+
+// Retain detaches the event data from the parser's reusable buffers, events handed out
+// by the pooled parse paths must be retained if they are kept after the callback returns
+func (e *SystemExclusiveEvent) Retain() {
+	if e.pooled != nil {
+		e.Data = retainPayload(e.Data)
+		e.pooled = nil
+	}
 }
 
 // WriteTo writer
@@ -22,7 +35,12 @@ func (e *SystemExclusiveEvent) WriteTo(w io.Writer) (int64, error) {
 
 	totalBytesWritten += int64(n)
 
-	n, err = w.Write([]byte{0xF0})
+	status := byte(0xF0)
+	if e.Continuation {
+		status = 0xF7
+	}
+
+	n, err = w.Write([]byte{status})
 	if err != nil {
 		return 0, err
 	}
@@ -46,6 +64,11 @@ func (e *SystemExclusiveEvent) WriteTo(w io.Writer) (int64, error) {
 
 // parseSystemExclusive parses a system exclusive event
 func parseSystemExclusive(statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error) {
+	return parseSystemExclusiveEvent(statusByte, deltaTime, data, false)
+}
+
+// parseSystemExclusiveEvent parses a system exclusive event, the payload is taken from the pool if pooled is true
+func parseSystemExclusiveEvent(statusByte uint8, deltaTime uint32, data []byte, pooled bool) (event Event, bytesRead uint32, err error) {
 	numBytes, bytesRead, err := readVariableLengthInteger(data)
 	if err != nil {
 		return
@@ -58,17 +81,32 @@ func parseSystemExclusive(statusByte uint8, deltaTime uint32, data []byte) (even
 	}
 
 	bytesRead += numBytes
-	exclusiveData := make([]byte, numBytes)
 
-	copy(exclusiveData, data)
+	// Registered system exclusive parsers get a private copy of the data, continuation packets do
+	// not start with a manufacturer id and are never handed to them
+	if parser := registeredSysExParser(data[:numBytes]); parser != nil && statusByte != 0xF7 {
+		event, err = parser(deltaTime, retainPayload(data[:numBytes]))
+		return
+	}
 
-	event = &SystemExclusiveEvent{
+	se := &SystemExclusiveEvent{
 		coreEvent: coreEvent{
 			deltaTime: deltaTime,
 			eventType: SystemExclusive,
 		},
-		Data: exclusiveData,
+		Continuation: statusByte == 0xF7,
+	}
+
+	if pooled {
+		se.pooled = getPayload(numBytes)
+		se.Data = *se.pooled
+	} else {
+		se.Data = make([]byte, numBytes)
 	}
 
+	copy(se.Data, data)
+
+	event = se
+
 	return
 }
@@ -0,0 +1,261 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SetTicksPerQuarterNote sets a metrical division of n ticks per quarter note, n must fit in 15 bits
+func (h *FileHeader) SetTicksPerQuarterNote(n uint16) error {
+	if n == 0 || n > 0x7FFF {
+		return fmt.Errorf("ticks per quarter note %d out of range 1-32767", n)
+	}
+
+	h.Division = n
+	h.DivisionType = DivisionTicksPerQuarterNote
+	h.TicksPerQuarterNote = n
+	h.FramesPerSecond = 0
+	h.TicksPerFrame = 0
+
+	return nil
+}
+
+// SetSMPTE sets a SMPTE division, framesPerSecond is 24, 25, 29 (30 drop frame) or 30
+func (h *FileHeader) SetSMPTE(framesPerSecond, ticksPerFrame uint8) error {
+	switch framesPerSecond {
+	case 24, 25, 29, 30:
+	default:
+		return fmt.Errorf("invalid SMPTE frame rate %d", framesPerSecond)
+	}
+
+	if ticksPerFrame == 0 {
+		return errors.New("ticks per frame should be at least 1")
+	}
+
+	// The frame rate is stored as a negative two's complement number in the upper byte
+	h.Division = uint16(uint8(-int8(framesPerSecond)))<<8 | uint16(ticksPerFrame)
+	h.DivisionType = DivisionFramesTicks
+	h.TicksPerQuarterNote = 0
+	h.FramesPerSecond = framesPerSecond
+	h.TicksPerFrame = ticksPerFrame
+
+	return nil
+}
+
+// Rebuild regenerates the raw chunks from the header and tracks: a header chunk with the number
+// of tracks updated followed by one chunk per track. Unknown chunks are kept after the tracks.
+// The chunks are what WriteTo writes, call Rebuild after editing the header or tracks
+func (f *File) Rebuild() {
+	chunks := make([]*Chunk, 0, len(f.Tracks)+1)
+
+	if f.Header != nil {
+		f.Header.NumTracks = uint16(len(f.Tracks))
+		chunks = append(chunks, f.Header.Chunk())
+	}
+
+	for _, track := range f.Tracks {
+		chunks = append(chunks, track.Chunk())
+	}
+
+	for _, chunk := range f.Chunks {
+		if chunk.Type != HeaderType && chunk.Type != TrackType {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	f.Chunks = chunks
+}
+
+// conductorOffset returns 1 if the first track is a conductor track that must stay in front
+func (f *File) conductorOffset() int {
+	if f.Header != nil && f.Header.Format == Format1 && len(f.Tracks) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// trackChunkIndices returns the indices of the track chunks in the raw chunks
+func (f *File) trackChunkIndices() []int {
+	indices := []int{}
+
+	for index, chunk := range f.Chunks {
+		if chunk.Type == TrackType {
+			indices = append(indices, index)
+		}
+	}
+
+	return indices
+}
+
+// updateHeaderChunk replaces the raw header chunk with a chunk generated from the header
+func (f *File) updateHeaderChunk() {
+	for index, chunk := range f.Chunks {
+		if chunk.Type == HeaderType {
+			f.Chunks[index] = f.Header.Chunk()
+			return
+		}
+	}
+}
+
+// reorderTracks puts the tracks in the order given by indices and applies the same order
+// to the raw track chunks if they correspond with the tracks
+func (f *File) reorderTracks(indices []int) {
+	trackChunkIndices := f.trackChunkIndices()
+
+	tracks := make([]*Track, len(indices))
+	for index, oldIndex := range indices {
+		tracks[index] = f.Tracks[oldIndex]
+	}
+
+	if len(trackChunkIndices) == len(f.Tracks) {
+		chunks := make([]*Chunk, len(indices))
+		for index, oldIndex := range indices {
+			chunks[index] = f.Chunks[trackChunkIndices[oldIndex]]
+		}
+
+		for index, chunkIndex := range trackChunkIndices {
+			f.Chunks[chunkIndex] = chunks[index]
+		}
+	}
+
+	f.Tracks = tracks
+}
+
+// MoveTrack moves the track at index from to index to, shifting the tracks in between. The
+// conductor track of a format 1 file can not be moved and no track can be moved in front of it
+func (f *File) MoveTrack(from, to int) error {
+	if from < 0 || from >= len(f.Tracks) || to < 0 || to >= len(f.Tracks) {
+		return errors.New("track index out of range")
+	}
+
+	offset := f.conductorOffset()
+	if from < offset || to < offset {
+		return errors.New("the conductor track of a format 1 file must remain the first track")
+	}
+
+	indices := make([]int, 0, len(f.Tracks))
+	for index := range f.Tracks {
+		if index != from {
+			indices = append(indices, index)
+		}
+	}
+
+	indices = append(indices[:to], append([]int{from}, indices[to:]...)...)
+
+	f.reorderTracks(indices)
+
+	return nil
+}
+
+// SortTracksBy stable sorts the tracks using less, the conductor track of a format 1 file
+// stays in front
+func (f *File) SortTracksBy(less func(a, b *Track) bool) {
+	offset := f.conductorOffset()
+
+	indices := make([]int, len(f.Tracks))
+	for index := range indices {
+		indices[index] = index
+	}
+
+	sortable := indices[offset:]
+
+	sort.SliceStable(sortable, func(i, j int) bool {
+		return less(f.Tracks[sortable[i]], f.Tracks[sortable[j]])
+	})
+
+	f.reorderTracks(indices)
+}
+
+// SplitByChannelToTracks redistributes the events of every track so each resulting track holds
+// the channel events of exactly one channel, in channel order in place of the original track.
+// The first track keeps its meta and system exclusive events as conductor track, the channel
+// events it holds move to tracks of their own. In other tracks the meta and system exclusive
+// events stay with the lowest channel, tracks without channel events are kept as they are. Every
+// split track ends at the end of its original track. A format 0 file becomes a format 1 file,
+// format 2 files are rejected because their tracks are independent sequences. The chunks are
+// rebuilt
+func (f *File) SplitByChannelToTracks() error {
+	if f.Header != nil && f.Header.Format == Format2 {
+		return errors.New("format 2 tracks are independent sequences and can not be split")
+	}
+
+	tracks := make([]*Track, 0, len(f.Tracks))
+
+	for index, track := range f.Tracks {
+		events := track.AbsEvents()
+		channels := map[uint16]bool{}
+
+		for _, ae := range events {
+			if ce, ok := ae.Event.(*ChannelEvent); ok {
+				channels[ce.Channel] = true
+			}
+		}
+
+		if len(channels) == 0 || (index > 0 && len(channels) == 1) {
+			tracks = append(tracks, track)
+			continue
+		}
+
+		order := make([]int, 0, len(channels)+1)
+		for channel := range channels {
+			order = append(order, int(channel))
+		}
+
+		sort.Ints(order)
+
+		// Meta and system exclusive events go to the conductor or the lowest channel
+		other := order[0]
+		if index == 0 {
+			other = -1
+			order = append([]int{other}, order...)
+		}
+
+		split := map[int][]AbsEvent{}
+		end := uint32(0)
+
+		for _, ae := range events {
+			end = ae.Tick
+
+			if ce, ok := ae.Event.(*ChannelEvent); ok {
+				split[int(ce.Channel)] = append(split[int(ce.Channel)], ae)
+			} else if !isEndOfTrack(ae.Event) {
+				split[other] = append(split[other], ae)
+			}
+		}
+
+		for _, channel := range order {
+			split[channel] = append(split[channel], AbsEvent{Tick: end, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+			tracks = append(tracks, NewTrackFromAbsEvents(split[channel]))
+		}
+	}
+
+	if f.Header != nil && f.Header.Format == Format0 && len(tracks) > 1 {
+		f.Header.Format = Format1
+	}
+
+	f.Tracks = tracks
+	f.Rebuild()
+
+	return nil
+}
+
+// newFileWithTracks creates a file with ticks per quarter note division from tracks, the chunks
+// are generated from the header and tracks
+func newFileWithTracks(format Format, ticksPerQuarterNote uint16, tracks []*Track) *File {
+	f := NewFile()
+
+	f.Header = &FileHeader{
+		Format:              format,
+		NumTracks:           uint16(len(tracks)),
+		Division:            ticksPerQuarterNote & 0x7FFF,
+		DivisionType:        DivisionTicksPerQuarterNote,
+		TicksPerQuarterNote: ticksPerQuarterNote & 0x7FFF,
+	}
+
+	f.Tracks = tracks
+	f.Rebuild()
+
+	return f
+}
@@ -0,0 +1,131 @@
+package midi
+
+import (
+	"time"
+)
+
+// EventSource produces events, e.g. a live midi input
+type EventSource interface {
+	// ReadEvent returns the next event, io.EOF is returned when the source is exhausted
+	ReadEvent() (Event, error)
+}
+
+// EventFilter decides if an event passes, true keeps the event
+type EventFilter func(event Event) bool
+
+// OnlyChannels passes channel events on the given channels (0-15), other events pass unchanged
+func OnlyChannels(channels ...uint16) EventFilter {
+	mask := uint16(0)
+	for _, channel := range channels {
+		mask |= 1 << (channel & 0xF)
+	}
+
+	return func(event Event) bool {
+		ce, ok := event.(*ChannelEvent)
+		return !ok || mask&(1<<(ce.Channel&0xF)) != 0
+	}
+}
+
+// OnlyTypes passes events of the given types
+func OnlyTypes(eventTypes ...EventType) EventFilter {
+	return func(event Event) bool {
+		for _, eventType := range eventTypes {
+			if event.EventType() == eventType {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// DropTypes drops events of the given types
+func DropTypes(eventTypes ...EventType) EventFilter {
+	only := OnlyTypes(eventTypes...)
+
+	return func(event Event) bool {
+		return !only(event)
+	}
+}
+
+// DropActiveSensing drops active sensing events
+func DropActiveSensing() EventFilter {
+	return DropTypes(ActiveSensing)
+}
+
+// DropTimingClock drops timing clock events
+func DropTimingClock() EventFilter {
+	return DropTypes(TimingClock)
+}
+
+// passes returns true if event passes all filters
+func passes(filters []EventFilter, event Event) bool {
+	for _, filter := range filters {
+		if !filter(event) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterSink forwards events passing all filters
+type filterSink struct {
+	sink    EventSink
+	filters []EventFilter
+}
+
+// FilterSink wraps a sink so it only receives events passing all filters, target times are
+// forwarded if the wrapped sink accepts them. The player only applies its lookahead to the filter
+// if the wrapped sink accepts target times
+func FilterSink(sink EventSink, filters ...EventFilter) TimedEventSink {
+	return &filterSink{sink: sink, filters: filters}
+}
+
+// HandleEvent forwards the event if it passes
+func (s *filterSink) HandleEvent(track int, tick uint32, event Event) error {
+	if !passes(s.filters, event) {
+		return nil
+	}
+
+	return s.sink.HandleEvent(track, tick, event)
+}
+
+// HandleTimedEvent forwards the event with its target time if it passes
+func (s *filterSink) HandleTimedEvent(at time.Time, track int, tick uint32, event Event) error {
+	if !passes(s.filters, event) {
+		return nil
+	}
+
+	return dispatch(s.sink, at, track, tick, event)
+}
+
+// acceptsTargetTimes returns true if the wrapped sink accepts target times
+func (s *filterSink) acceptsTargetTimes() bool {
+	return acceptsTargetTimes(s.sink)
+}
+
+// filterSource reads events passing all filters
+type filterSource struct {
+	source  EventSource
+	filters []EventFilter
+}
+
+// FilterSource wraps a source so it only returns events passing all filters
+func FilterSource(source EventSource, filters ...EventFilter) EventSource {
+	return &filterSource{source: source, filters: filters}
+}
+
+// ReadEvent returns the next event that passes
+func (s *filterSource) ReadEvent() (Event, error) {
+	for {
+		event, err := s.source.ReadEvent()
+		if err != nil {
+			return nil, err
+		}
+
+		if passes(s.filters, event) {
+			return event, nil
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package midi
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// DefaultFingerprintSize is the default n-gram length used for fingerprints
+const DefaultFingerprintSize = 4
+
+// Fingerprint is a multiset of hashed interval and rhythm n-grams, it is invariant under
+// transposition and tempo changes
+type Fingerprint map[uint64]int
+
+// NewFingerprint creates the fingerprint of a file from n-grams of size n. The melodic outline
+// is the highest note at each onset, drums (channel 10) are ignored
+func NewFingerprint(f *File, n int) Fingerprint {
+	if n < 1 {
+		n = DefaultFingerprintSize
+	}
+
+	// Highest key per onset
+	onsets := []Note{}
+	for _, note := range f.Notes() {
+		if note.Channel == 9 {
+			continue
+		}
+
+		last := len(onsets) - 1
+		if last >= 0 && onsets[last].Start == note.Start {
+			if note.Key > onsets[last].Key {
+				onsets[last] = note
+			}
+
+			continue
+		}
+
+		onsets = append(onsets, note)
+	}
+
+	// Interval and quantized inter onset interval ratio per step
+	type step struct {
+		interval int8
+		rhythm   int8
+	}
+
+	steps := []step{}
+	for index := 2; index < len(onsets); index++ {
+		previous := float64(onsets[index-1].Start - onsets[index-2].Start)
+		current := float64(onsets[index].Start - onsets[index-1].Start)
+
+		steps = append(steps, step{
+			interval: int8(int(onsets[index].Key) - int(onsets[index-1].Key)),
+			rhythm:   int8(math.Round(2 * math.Log2(current/previous))),
+		})
+	}
+
+	fingerprint := Fingerprint{}
+	buf := make([]byte, 2*n)
+
+	for index := 0; index+n <= len(steps); index++ {
+		for offset, s := range steps[index : index+n] {
+			buf[2*offset] = byte(s.interval)
+			buf[2*offset+1] = byte(s.rhythm)
+		}
+
+		h := fnv.New64a()
+		h.Write(buf)
+		fingerprint[binary.BigEndian.Uint64(h.Sum(nil))]++
+	}
+
+	return fingerprint
+}
+
+// Similarity returns the weighted Jaccard similarity of two fingerprints between 0 (nothing in
+// common) and 1 (identical)
+func Similarity(a, b Fingerprint) float64 {
+	intersection := 0
+	union := 0
+
+	for hash, countA := range a {
+		countB := b[hash]
+
+		if countA < countB {
+			intersection += countA
+			union += countB
+		} else {
+			intersection += countB
+			union += countA
+		}
+	}
+
+	for hash, countB := range b {
+		if _, ok := a[hash]; !ok {
+			union += countB
+		}
+	}
+
+	if union == 0 {
+		return 0
+	}
+
+	return float64(intersection) / float64(union)
+}
@@ -1 +1,8 @@
 module github.com/almerlucke/gomidi
+
+go 1.23
+
+require (
+	google.golang.org/protobuf v1.36.9
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,127 @@
+package midi
+
+import (
+	"time"
+)
+
+// EventIterator iterates over the events of all tracks of a file in time order, events at the
+// same tick are returned in track order
+type EventIterator struct {
+	tracks    []*Track
+	positions []int
+	ticks     []uint32
+	cursor    *tempoCursor
+	track     int
+	tick      uint32
+	event     Event
+	time      time.Duration
+}
+
+// NewEventIterator creates a time ordered iterator over the events of a file, if withTime is
+// true the wall clock offset of each event is computed through the tempo map of the file
+func NewEventIterator(f *File, withTime bool) *EventIterator {
+	it := &EventIterator{
+		tracks:    f.Tracks,
+		positions: make([]int, len(f.Tracks)),
+		ticks:     make([]uint32, len(f.Tracks)),
+		track:     -1,
+	}
+
+	for index, track := range f.Tracks {
+		if len(track.Events) > 0 {
+			it.ticks[index] = track.Events[0].DeltaTime()
+		}
+	}
+
+	if withTime {
+		it.cursor = newTempoCursor(f.TempoMap())
+	}
+
+	return it
+}
+
+// Next advances to the next event, false is returned if all events were visited
+func (it *EventIterator) Next() bool {
+	next := -1
+
+	for index, track := range it.tracks {
+		if it.positions[index] >= len(track.Events) {
+			continue
+		}
+
+		if next == -1 || it.ticks[index] < it.ticks[next] {
+			next = index
+		}
+	}
+
+	if next == -1 {
+		it.event = nil
+		return false
+	}
+
+	track := it.tracks[next]
+	position := it.positions[next]
+
+	it.track = next
+	it.tick = it.ticks[next]
+	it.event = track.Events[position]
+
+	if it.cursor != nil {
+		it.time = it.cursor.timeAt(it.tick)
+	}
+
+	position++
+	it.positions[next] = position
+
+	if position < len(track.Events) {
+		it.ticks[next] += track.Events[position].DeltaTime()
+	}
+
+	return true
+}
+
+// Event returns the current event
+func (it *EventIterator) Event() Event {
+	return it.event
+}
+
+// Track returns the track index of the current event
+func (it *EventIterator) Track() int {
+	return it.track
+}
+
+// Tick returns the absolute tick of the current event
+func (it *EventIterator) Tick() uint32 {
+	return it.tick
+}
+
+// Time returns the wall clock offset of the current event, always 0 if the iterator was
+// created without time
+func (it *EventIterator) Time() time.Duration {
+	return it.time
+}
+
+// TimedEvent is an event at an absolute time offset from the start of a file
+type TimedEvent struct {
+	Time  time.Duration
+	Track int
+	Event Event
+}
+
+// Flatten resolves the tempo map of a file into a time ordered list of events with absolute
+// time offsets, events at the same time are in track order. Set tempo events are dropped since
+// the times already account for them
+func Flatten(f *File) []TimedEvent {
+	events := []TimedEvent{}
+	it := NewEventIterator(f, true)
+
+	for it.Next() {
+		if me, ok := it.Event().(*MetaEvent); ok && me.MetaType == SetTempo {
+			continue
+		}
+
+		events = append(events, TimedEvent{Time: it.Time(), Track: it.Track(), Event: it.Event()})
+	}
+
+	return events
+}
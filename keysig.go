@@ -0,0 +1,205 @@
+package midi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// KeySignatureChange is a key signature change at an absolute tick
+type KeySignatureChange struct {
+	Tick uint32
+	// Number of sharps if positive or flats if negative, -7 to 7
+	Sharps int8
+	// Minor is true for a minor key
+	Minor bool
+}
+
+// MetaEvent creates a key signature meta event for the key signature change
+func (c KeySignatureChange) MetaEvent(deltaTime uint32) *MetaEvent {
+	minor := byte(0)
+	if c.Minor {
+		minor = 1
+	}
+
+	return NewMetaEvent(deltaTime, KeySignature, []byte{byte(c.Sharps), minor})
+}
+
+// String returns the name of the key, e.g. Eb major or F# minor
+func (c KeySignatureChange) String() string {
+	// Tonics of the major keys and their relative minor keys from 7 flats to 7 sharps
+	majors := []string{"Cb", "Gb", "Db", "Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#"}
+	minors := []string{"Ab", "Eb", "Bb", "F", "C", "G", "D", "A", "E", "B", "F#", "C#", "G#", "D#", "A#"}
+
+	index := int(c.Sharps) + 7
+	if index < 0 || index >= len(majors) {
+		return fmt.Sprintf("unknown key %v", c.Sharps)
+	}
+
+	if c.Minor {
+		return minors[index] + " minor"
+	}
+
+	return majors[index] + " major"
+}
+
+// keySignatureFromData decodes the data of a key signature meta event
+func keySignatureFromData(tick uint32, data []byte) (KeySignatureChange, bool) {
+	if len(data) < 2 {
+		return KeySignatureChange{}, false
+	}
+
+	return KeySignatureChange{Tick: tick, Sharps: int8(data[0]), Minor: data[1] == 1}, true
+}
+
+// KeyMap holds the key signature changes of a file
+type KeyMap struct {
+	// Key signature changes sorted by tick
+	Changes []KeySignatureChange
+}
+
+// NewKeyMap creates a new key map, the changes are sorted by tick
+func NewKeyMap(changes []KeySignatureChange) *KeyMap {
+	sorted := make([]KeySignatureChange, len(changes))
+	copy(sorted, changes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Tick < sorted[j].Tick
+	})
+
+	return &KeyMap{Changes: sorted}
+}
+
+// KeyMap returns the key map of the file, key signatures may be placed in any track so the key
+// signature events of all tracks are collected
+func (f *File) KeyMap() *KeyMap {
+	changes := []KeySignatureChange{}
+
+	for _, track := range f.Tracks {
+		tick := uint32(0)
+
+		for _, event := range track.Events {
+			tick += event.DeltaTime()
+
+			me, ok := event.(*MetaEvent)
+			if !ok || me.MetaType != KeySignature {
+				continue
+			}
+
+			if change, ok := keySignatureFromData(tick, me.Data); ok {
+				changes = append(changes, change)
+			}
+		}
+	}
+
+	return NewKeyMap(changes)
+}
+
+// At returns the key signature at tick, C major before the first change
+func (m *KeyMap) At(tick uint32) KeySignatureChange {
+	ks := KeySignatureChange{}
+
+	if m == nil {
+		return ks
+	}
+
+	for _, change := range m.Changes {
+		if change.Tick > tick {
+			break
+		}
+
+		ks = change
+	}
+
+	return ks
+}
+
+// NoteName returns the name of key spelled in the key signature active at tick
+func (m *KeyMap) NoteName(tick uint32, key uint8) string {
+	return NoteName(key, m.At(tick))
+}
+
+// noteLetters are the letters of the natural notes with their pitch classes
+var noteLetters = []struct {
+	letter     byte
+	pitchClass int
+}{
+	{'C', 0}, {'D', 2}, {'E', 4}, {'F', 5}, {'G', 7}, {'A', 9}, {'B', 11},
+}
+
+// Order in which sharps and flats are added to key signatures, as indices in noteLetters
+var (
+	sharpOrder = []int{3, 0, 4, 1, 5, 2, 6}
+	flatOrder  = []int{6, 2, 5, 1, 4, 0, 3}
+)
+
+// NoteName returns the name of a key with octave, key 60 is C4. Notes of the scale are spelled
+// as in the key signature, e.g. E# in C# major, other notes use sharps in sharp keys and C major
+// and flats in flat keys
+func NoteName(key uint8, ks KeySignatureChange) string {
+	// Accidental of each letter in the key signature
+	accidentals := make([]int, len(noteLetters))
+
+	sharps := int(ks.Sharps)
+	for index := 0; index < sharps && index < len(sharpOrder); index++ {
+		accidentals[sharpOrder[index]] = 1
+	}
+
+	for index := 0; index < -sharps && index < len(flatOrder); index++ {
+		accidentals[flatOrder[index]] = -1
+	}
+
+	pitchClass := int(key) % 12
+
+	letter := -1
+	accidental := 0
+
+	for index, nl := range noteLetters {
+		if (nl.pitchClass+accidentals[index]+12)%12 == pitchClass {
+			letter = index
+			accidental = accidentals[index]
+			break
+		}
+	}
+
+	// Not in the scale, use the natural if there is one
+	if letter == -1 {
+		for index, nl := range noteLetters {
+			if nl.pitchClass == pitchClass {
+				letter, accidental = index, 0
+				break
+			}
+		}
+	}
+
+	// Otherwise raise the natural below or lower the natural above
+	if letter == -1 {
+		for index, nl := range noteLetters {
+			if sharps >= 0 && (nl.pitchClass+1)%12 == pitchClass {
+				letter, accidental = index, 1
+				break
+			}
+
+			if sharps < 0 && (nl.pitchClass+11)%12 == pitchClass {
+				letter, accidental = index, -1
+				break
+			}
+		}
+	}
+
+	name := string(noteLetters[letter].letter)
+
+	switch accidental {
+	case 1:
+		name += "#"
+	case -1:
+		name += "b"
+	}
+
+	// The octave follows the letter, B#3 sounds as C4
+	octave := (int(key)-accidental)/12 - 1
+	if int(key)-accidental < 0 {
+		octave = -2
+	}
+
+	return fmt.Sprintf("%v%v", name, octave)
+}
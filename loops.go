@@ -0,0 +1,178 @@
+package midi
+
+import (
+	"sort"
+)
+
+// LoopCandidate is a section of bars that is repeated right after itself
+type LoopCandidate struct {
+	// StartBar is the number of the first bar of the section, bars start at 1
+	StartBar int
+	// EndBar is the number of the last bar of the section
+	EndBar int
+	// Repeats is the number of times the section is played in a row, including the first time
+	Repeats int
+	// Similarity is the average similarity of the repetitions to the section, from 0 to 1 for
+	// exact repetitions
+	Similarity float64
+}
+
+// Bars returns the number of bars of the section
+func (c LoopCandidate) Bars() int {
+	return c.EndBar - c.StartBar + 1
+}
+
+// loopNote is a note relative to the start of its bar
+type loopNote struct {
+	track   int
+	channel uint16
+	key     uint8
+	offset  uint32
+	length  uint32
+}
+
+// FindLoops detects sections of bars that repeat exactly or nearly, for loop extraction. Bars
+// are compared by their notes, a note matches when track, channel, key, position in the bar and
+// length are the same, velocities are ignored. The similarity of two sections is the number of
+// matching notes divided by the number of distinct notes of both, bars of different length never
+// match and silent sections are not reported. A section is a candidate when it is followed by at
+// least one repetition with a similarity of at least minSimilarity, 1 only finds exact
+// repetitions. Candidates that are multiples of a shorter candidate covering the same bars with
+// at least the same similarity are left out. Candidates are sorted by similarity, then by the
+// number of bars they cover and then by start bar. Files with SMPTE division have no bars and
+// have no candidates
+func FindLoops(f *File, minSimilarity float64) []LoopCandidate {
+	bars := []Measure{}
+	for m := range Bars(f) {
+		bars = append(bars, m)
+	}
+
+	if len(bars) < 2 {
+		return nil
+	}
+
+	contents := make([]map[loopNote]int, len(bars))
+	for index := range contents {
+		contents[index] = map[loopNote]int{}
+	}
+
+	for _, note := range f.Notes() {
+		index := sort.Search(len(bars), func(i int) bool { return bars[i].End > note.Start })
+		if index == len(bars) {
+			continue
+		}
+
+		contents[index][loopNote{
+			track:   note.Track,
+			channel: note.Channel,
+			key:     note.Key,
+			offset:  note.Start - bars[index].Start,
+			length:  note.End - note.Start,
+		}]++
+	}
+
+	// similarity compares the sections of length bars starting at bar index a and b, it returns
+	// false if the bar lengths differ or both sections are silent
+	similarity := func(a, b, length int) (float64, bool) {
+		shared, total := 0, 0
+
+		for i := 0; i < length; i++ {
+			x, y := bars[a+i], bars[b+i]
+			if x.End-x.Start != y.End-y.Start {
+				return 0, false
+			}
+
+			for note, count := range contents[a+i] {
+				other := contents[b+i][note]
+				shared += min(count, other)
+				total += max(count, other)
+			}
+
+			for note, count := range contents[b+i] {
+				if _, ok := contents[a+i][note]; !ok {
+					total += count
+				}
+			}
+		}
+
+		if total == 0 {
+			return 0, false
+		}
+
+		return float64(shared) / float64(total), true
+	}
+
+	candidates := []LoopCandidate{}
+
+	for length := 1; length*2 <= len(bars); length++ {
+		for start := 0; start+2*length <= len(bars); start++ {
+			// A repetition of the previous section is part of the candidate starting there
+			if start >= length {
+				if s, ok := similarity(start-length, start, length); ok && s >= minSimilarity {
+					continue
+				}
+			}
+
+			repeats := 1
+			sum := 0.0
+
+			for next := start + length; next+length <= len(bars); next += length {
+				s, ok := similarity(start, next, length)
+				if !ok || s < minSimilarity {
+					break
+				}
+
+				repeats++
+				sum += s
+			}
+
+			if repeats > 1 {
+				candidates = append(candidates, LoopCandidate{
+					StartBar:   bars[start].Number,
+					EndBar:     bars[start+length-1].Number,
+					Repeats:    repeats,
+					Similarity: sum / float64(repeats-1),
+				})
+			}
+		}
+	}
+
+	// covers returns the number of the last bar played by a candidate
+	covers := func(c LoopCandidate) int {
+		return c.StartBar + c.Bars()*c.Repeats - 1
+	}
+
+	result := []LoopCandidate{}
+
+	for _, c := range candidates {
+		redundant := false
+
+		for _, shorter := range candidates {
+			if shorter.Bars() < c.Bars() && c.Bars()%shorter.Bars() == 0 &&
+				shorter.StartBar <= c.StartBar && covers(shorter) >= covers(c) &&
+				shorter.Similarity >= c.Similarity {
+				redundant = true
+				break
+			}
+		}
+
+		if !redundant {
+			result = append(result, c)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+
+		if a.Bars()*a.Repeats != b.Bars()*b.Repeats {
+			return a.Bars()*a.Repeats > b.Bars()*b.Repeats
+		}
+
+		return a.StartBar < b.StartBar
+	})
+
+	return result
+}
@@ -0,0 +1,78 @@
+package midi
+
+import (
+	"iter"
+)
+
+// MeasureEvent is an event of a measure with its track index and absolute tick
+type MeasureEvent struct {
+	Track int
+	Tick  uint32
+	Event Event
+}
+
+// Measure is a bar of a file with the events starting in it, it is not called Bar because Bar
+// already creates a musical position
+type Measure struct {
+	// Number of the bar, bars start at 1 as in Position
+	Number int
+	// Start tick of the bar
+	Start uint32
+	// End tick of the bar, which is the start tick of the next bar
+	End uint32
+	// Time signature of the bar, 4/4 before the first change
+	TimeSignature TimeSignatureChange
+	// Events starting in the bar in time order, events at the same tick are in track order
+	Events []MeasureEvent
+}
+
+// Bars yields the bars of a file up to the bar holding the last event, bars without events are
+// yielded as well. Time signature changes take effect at the start of the next bar, as in
+// PositionToTick. End of track events at the end tick of a bar belong to that bar so a track
+// ending on a bar line does not add an empty bar. Files with SMPTE division have no bars and
+// yield nothing
+func Bars(f *File) iter.Seq[Measure] {
+	return func(yield func(Measure) bool) {
+		if f.Header == nil || f.Header.DivisionType != DivisionTicksPerQuarterNote || f.Header.TicksPerQuarterNote == 0 {
+			return
+		}
+
+		ticksPerQuarterNote := uint32(f.Header.TicksPerQuarterNote)
+		timeSigMap := f.TimeSigMap()
+
+		measure := func(number int, start uint32) Measure {
+			ts := timeSigMap.At(start)
+
+			length := uint32(ts.Numerator) * ticksPerQuarterNote * 4
+			if ts.Denominator != 0 {
+				length /= uint32(ts.Denominator)
+			}
+
+			// A time signature without beats would never end the bar, use a 4/4 bar instead
+			if length == 0 {
+				length = ticksPerQuarterNote * 4
+			}
+
+			return Measure{Number: number, Start: start, End: start + length, TimeSignature: ts}
+		}
+
+		m := measure(1, 0)
+		it := NewEventIterator(f, false)
+
+		for it.Next() {
+			for it.Tick() >= m.End && !(it.Tick() == m.End && isEndOfTrack(it.Event())) {
+				if !yield(m) {
+					return
+				}
+
+				m = measure(m.Number+1, m.End)
+			}
+
+			m.Events = append(m.Events, MeasureEvent{Track: it.Track(), Tick: it.Tick(), Event: it.Event()})
+		}
+
+		if len(m.Events) > 0 {
+			yield(m)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package midi
+
+// songTickConverter returns a function converting ticks of f to ticks at ticksPerQuarterNote.
+// Ticks per quarter note are scaled, SMPTE ticks are converted through their time at the
+// default tempo
+func songTickConverter(f *File, ticksPerQuarterNote uint16) func(uint32) uint32 {
+	if f.Header == nil {
+		return func(tick uint32) uint32 { return tick }
+	}
+
+	// SMPTE headers have no ticks per quarter note, check the division type first
+	if f.Header.DivisionType == DivisionFramesTicks {
+		from := f.TempoMap()
+		to := NewTempoMap(ticksPerQuarterNote, nil)
+
+		return func(tick uint32) uint32 {
+			return to.DurationToTick(from.TickToDuration(tick))
+		}
+	}
+
+	if f.Header.TicksPerQuarterNote == 0 {
+		return func(tick uint32) uint32 { return tick }
+	}
+
+	from := uint64(f.Header.TicksPerQuarterNote)
+	to := uint64(ticksPerQuarterNote)
+
+	return func(tick uint32) uint32 {
+		return uint32((uint64(tick)*to + from/2) / from)
+	}
+}
+
+// nextBarStart returns tick if a bar starts at tick, otherwise the start of the next bar
+func nextBarStart(timeSigMap *TimeSigMap, ticksPerQuarterNote uint16, tick uint32) uint32 {
+	starts := timeSigMap.BarStartTicks(ticksPerQuarterNote, tick)
+
+	start := starts[len(starts)-1]
+	if start == tick {
+		return tick
+	}
+
+	beats, beatLength := barLength(timeSigMap.At(start), ticksPerQuarterNote)
+
+	return start + beats*beatLength
+}
+
+// isConductorEvent returns true for the events moved to the conductor track of a medley when a
+// song is a format 0 file
+func isConductorEvent(event Event) bool {
+	me, ok := event.(*MetaEvent)
+	return ok && (me.MetaType == SetTempo || me.MetaType == TimeSignature || me.MetaType == KeySignature || me.MetaType == Marker)
+}
+
+// Concatenate appends songs end to end in a new format 1 file. Every song starts gapTicks after
+// the first bar line at or after the end of the previous song, a gap of whole bars keeps the
+// downbeats of the song on bar lines. The division is the highest ticks per quarter note of the
+// songs, ticks of other songs are scaled and SMPTE songs are converted at the default tempo.
+// The conductor track of each song goes to the conductor track, other tracks go to the track
+// with the same index, the single track of a format 0 song goes to track 1 with its tempo, time
+// signature, key signature and marker events moved to the conductor track. Every song starts with its own
+// tempo and time signature, 120 bpm and 4/4 if it has none at its first tick, and the channels
+// used by the previous song get all notes off, reset all controllers and program 0 before the
+// next song starts
+func Concatenate(files []*File, gapTicks uint32) *File {
+	ticksPerQuarterNote := uint16(0)
+
+	for _, f := range files {
+		if f.Header != nil && f.Header.DivisionType == DivisionTicksPerQuarterNote && f.Header.TicksPerQuarterNote > ticksPerQuarterNote {
+			ticksPerQuarterNote = f.Header.TicksPerQuarterNote
+		}
+	}
+
+	if ticksPerQuarterNote == 0 {
+		ticksPerQuarterNote = 480
+	}
+
+	// Tempo, time signature and marker events of the conductor track are collected for
+	// BuildConductorTrack, the other conductor events are merged in
+	tempos := []TempoChange{}
+	timeSignatures := []TimeSignatureChange{}
+	markers := []MarkerPoint{}
+
+	tracks := [][]AbsEvent{{}}
+	add := func(index int, ae AbsEvent) {
+		if me, ok := ae.Event.(*MetaEvent); ok && index == 0 {
+			switch me.MetaType {
+			case SetTempo:
+				if tempo, ok := tempoFromData(me.Data); ok {
+					tempos = append(tempos, TempoChange{Tick: ae.Tick, MicrosecondsPerQuarterNote: tempo})
+					return
+				}
+			case TimeSignature:
+				if ts, ok := timeSignatureFromData(ae.Tick, me.Data); ok {
+					timeSignatures = append(timeSignatures, ts)
+					return
+				}
+			case Marker:
+				markers = append(markers, MarkerPoint{Tick: ae.Tick, Name: string(me.Data)})
+				return
+			}
+		}
+
+		for len(tracks) <= index {
+			tracks = append(tracks, []AbsEvent{})
+		}
+
+		tracks[index] = append(tracks[index], ae)
+	}
+
+	offset := uint32(0)
+	usedChannels := [16]bool{}
+
+	for songIndex, f := range files {
+		convert := songTickConverter(f, ticksPerQuarterNote)
+		smpte := f.Header != nil && f.Header.DivisionType == DivisionFramesTicks
+		format0 := f.Header != nil && f.Header.Format == Format0
+
+		if songIndex > 0 {
+			for channel, used := range usedChannels {
+				if !used {
+					continue
+				}
+
+				add(1, AbsEvent{Tick: offset, Event: NewChannelEvent(0, ControlChange, uint16(channel), ControllerAllNotesOff, 0)})
+				add(1, AbsEvent{Tick: offset, Event: NewChannelEvent(0, ControlChange, uint16(channel), ControllerResetAllControllers, 0)})
+				add(1, AbsEvent{Tick: offset, Event: NewChannelEvent(0, ProgramChange, uint16(channel), 0, 0)})
+			}
+
+			usedChannels = [16]bool{}
+		}
+
+		tempoMap, timeSigMap, _ := ExtractTempoMap(f)
+
+		if smpte || len(tempoMap.Changes) == 0 || tempoMap.Changes[0].Tick != 0 {
+			add(0, AbsEvent{Tick: offset, Event: TempoChange{MicrosecondsPerQuarterNote: DefaultTempo}.MetaEvent(0)})
+		}
+
+		if len(timeSigMap.Changes) == 0 || timeSigMap.Changes[0].Tick != 0 {
+			add(0, AbsEvent{Tick: offset, Event: timeSigMap.At(0).MetaEvent(0)})
+		}
+
+		for trackIndex, track := range f.Tracks {
+			for _, ae := range track.AbsEvents() {
+				if isEndOfTrack(ae.Event) {
+					continue
+				}
+
+				if me, ok := ae.Event.(*MetaEvent); ok && smpte && me.MetaType == SetTempo {
+					continue
+				}
+
+				if ce, ok := ae.Event.(*ChannelEvent); ok && ce.Channel < 16 {
+					usedChannels[ce.Channel] = true
+				}
+
+				target := trackIndex
+				if format0 && !isConductorEvent(ae.Event) {
+					target = 1
+				}
+
+				add(target, AbsEvent{Tick: offset + convert(ae.Tick), Event: cloneEvent(ae.Event)})
+			}
+		}
+
+		offset += convert(f.endTick())
+
+		if songIndex < len(files)-1 {
+			offset = nextBarStart(NewTimeSigMap(timeSignatures), ticksPerQuarterNote, offset) + gapTicks
+		}
+	}
+
+	result := make([]*Track, len(tracks))
+
+	for index, events := range tracks {
+		events = append(events, AbsEvent{Tick: offset, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+
+		if index == 0 {
+			result[index] = buildConductorTrackWith(NewTempoMap(ticksPerQuarterNote, tempos), NewTimeSigMap(timeSignatures), markers, events)
+			continue
+		}
+
+		result[index] = NewTrackFromAbsEvents(events)
+	}
+
+	return newFileWithTracks(Format1, ticksPerQuarterNote, result)
+}
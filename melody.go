@@ -0,0 +1,46 @@
+package midi
+
+// ExtractMelody pulls a monophonic lead line from the notes of all tracks with the skyline
+// heuristic: the highest note starting at a tick wins, a note sounding above it keeps playing
+// and a higher note cuts the current note short. Notes on the General MIDI drum channel are
+// ignored. The melody notes keep their channel and velocities and the track ends at the end of
+// the file
+func ExtractMelody(f *File) *Track {
+	melody := []Note{}
+
+	for _, note := range f.Notes() {
+		if note.Channel == GMDrumChannel || note.End <= note.Start {
+			continue
+		}
+
+		if len(melody) == 0 {
+			melody = append(melody, note)
+			continue
+		}
+
+		last := &melody[len(melody)-1]
+
+		switch {
+		case note.Start >= last.End:
+			melody = append(melody, note)
+		case note.Key <= last.Key:
+			// Covered by the sounding melody note
+		case note.Start == last.Start:
+			*last = note
+		default:
+			last.End = note.Start
+			melody = append(melody, note)
+		}
+	}
+
+	events := make([]AbsEvent, 0, len(melody)*2+1)
+
+	for _, note := range melody {
+		on, off := note.events()
+		events = append(events, on, off)
+	}
+
+	events = append(events, AbsEvent{Tick: f.endTick(), Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+
+	return NewTrackFromAbsEvents(events)
+}
@@ -47,6 +47,28 @@ type MetaEvent struct {
 	coreEvent
 	MetaType MetaType
 	Data     []byte
+	pooled   *[]byte
+}
+
+// NewMetaEvent creates a new meta event
+func NewMetaEvent(deltaTime uint32, metaType MetaType, data []byte) *MetaEvent {
+	return &MetaEvent{
+		coreEvent: coreEvent{
+			eventType: Meta,
+			deltaTime: deltaTime,
+		},
+		MetaType: metaType,
+		Data:     data,
+	}
+}
+
+// Retain detaches the event data from the parser's reusable buffers, events handed out
+// by the pooled parse paths must be retained if they are kept after the callback returns
+func (e *MetaEvent) Retain() {
+	if e.pooled != nil {
+		e.Data = retainPayload(e.Data)
+		e.pooled = nil
+	}
 }
 
 // String representation
@@ -72,40 +94,8 @@ func (e *MetaEvent) WriteTo(w io.Writer) (int64, error) {
 
 	totalBytesWritten += int64(n)
 
-	var metaType byte
-
-	switch e.MetaType {
-	case SequenceNumber:
-		metaType = 0x0
-	case Text:
-		metaType = 0x1
-	case CopyrightNotice:
-		metaType = 0x2
-	case TrackName:
-		metaType = 0x3
-	case InstrumentName:
-		metaType = 0x4
-	case Lyric:
-		metaType = 0x5
-	case Marker:
-		metaType = 0x6
-	case CuePoint:
-		metaType = 0x7
-	case ChannelPrefix:
-		metaType = 0x20
-	case EndOfTrack:
-		metaType = 0x2F
-	case SetTempo:
-		metaType = 0x51
-	case SMPTEOffset:
-		metaType = 0x54
-	case TimeSignature:
-		metaType = 0x58
-	case KeySignature:
-		metaType = 0x59
-	case SequencerSpecific:
-		metaType = 0x7F
-	}
+	// Unknown meta types are written as is
+	metaType := byte(e.MetaType)
 
 	n, err = w.Write([]byte{metaType})
 	if err != nil {
@@ -169,6 +159,11 @@ func metaTypeToString(metaType MetaType) string {
 
 // parseMeta parses a meta event
 func parseMeta(statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error) {
+	return parseMetaEvent(deltaTime, data, false)
+}
+
+// parseMetaEvent parses a meta event, the payload is taken from the pool if pooled is true
+func parseMetaEvent(deltaTime uint32, data []byte, pooled bool) (event Event, bytesRead uint32, err error) {
 	if len(data) == 0 {
 		err = errors.New("end of data before meta event was identified")
 		return
@@ -195,22 +190,39 @@ func parseMeta(statusByte uint8, deltaTime uint32, data []byte) (event Event, by
 
 	bytesRead += numBytes
 
-	// Copy meta data
-	metaData := make([]byte, numBytes)
-	copy(metaData, data)
+	// Offset 1 for metaStatusByte
+	bytesRead++
+
+	// Registered meta parsers get a private copy of the meta data
+	if parser := registeredMetaParser(metaType); parser != nil {
+		event, err = parser(deltaTime, retainPayload(data[:numBytes]))
+		return
+	}
 
 	// Create new event
-	event = &MetaEvent{
+	me := &MetaEvent{
 		coreEvent: coreEvent{
 			eventType: Meta,
 			deltaTime: deltaTime,
 		},
 		MetaType: metaType,
-		Data:     metaData,
 	}
 
-	// Offset 1 for metaStatusByte
-	bytesRead++
+	// Copy meta data
+	if pooled {
+		me.pooled = getPayload(numBytes)
+		me.Data = *me.pooled
+	} else {
+		me.Data = make([]byte, numBytes)
+	}
+
+	copy(me.Data, data)
+
+	event = me
+
+	if metaType == SequencerSpecific {
+		event = decodeSequencerSpecificEvent(me)
+	}
 
 	return
 }
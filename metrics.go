@@ -0,0 +1,64 @@
+package midi
+
+// ParseMetrics collects statistics while reading files, set ReadOptions.Metrics to collect them.
+// Metrics accumulate when the same struct is used for several files
+type ParseMetrics struct {
+	// Number of events per event type
+	Events map[EventType]int
+	// Chunks in the order they were read
+	Chunks []ChunkMetrics
+	// Number of channel events without status byte
+	RunningStatusEvents int
+	// Number of delta times per encoded length in bytes
+	DeltaTimeSizes map[int]int
+}
+
+// ChunkMetrics describes a chunk read from a file
+type ChunkMetrics struct {
+	Type ChunkType
+	// Length of the chunk data without type and length
+	Length uint32
+	// Number of events, only counted for track chunks
+	Events int
+}
+
+// addChunk records a chunk, metrics can be nil
+func (m *ParseMetrics) addChunk(chunk *Chunk) {
+	if m == nil {
+		return
+	}
+
+	m.Chunks = append(m.Chunks, ChunkMetrics{Type: chunk.Type, Length: chunk.Length})
+}
+
+// addEvent records an event of the last chunk with the encoded length of its delta time
+func (m *ParseMetrics) addEvent(eventType EventType, deltaTimeSize uint32, runningStatus bool) {
+	if m.Events == nil {
+		m.Events = map[EventType]int{}
+	}
+
+	if m.DeltaTimeSizes == nil {
+		m.DeltaTimeSizes = map[int]int{}
+	}
+
+	m.Events[eventType]++
+	m.DeltaTimeSizes[int(deltaTimeSize)]++
+
+	if runningStatus {
+		m.RunningStatusEvents++
+	}
+
+	if len(m.Chunks) > 0 {
+		m.Chunks[len(m.Chunks)-1].Events++
+	}
+}
+
+// TotalEvents returns the number of events parsed
+func (m *ParseMetrics) TotalEvents() int {
+	total := 0
+	for _, n := range m.Events {
+		total += n
+	}
+
+	return total
+}
@@ -0,0 +1,136 @@
+package midi
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MetronomeTrack is the track index metronome clicks are dispatched with, so a Router can send
+// them to their own port
+const MetronomeTrack = -2
+
+// Metronome generates click events on the beats of bars. The metronome clicks during playback
+// while enabled, a count-in always clicks
+type Metronome struct {
+	// Output channel of the clicks
+	Channel        uint16
+	Key            uint8
+	Velocity       uint8
+	AccentKey      uint8
+	AccentVelocity uint8
+	// Accents marks the accented beats of a bar, e.g. {true, false, true, false, false} for a 2+3
+	// grouping of 5/8. Only the first beat is accented if empty
+	Accents []bool
+	// Length of a click in ticks, 0 uses a sixteenth note
+	Length uint32
+
+	enabled atomic.Bool
+}
+
+// NewMetronome creates a new metronome clicking wood blocks on the general midi drum channel
+func NewMetronome() *Metronome {
+	return &Metronome{
+		Channel:        9,
+		Key:            77,
+		Velocity:       90,
+		AccentKey:      76,
+		AccentVelocity: 120,
+	}
+}
+
+// Enable enables or disables clicking during playback, safe to call while playing
+func (m *Metronome) Enable(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// Enabled returns true if the metronome clicks during playback
+func (m *Metronome) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// accented returns true if beat of a bar is accented
+func (m *Metronome) accented(beat uint32) bool {
+	if len(m.Accents) == 0 {
+		return beat == 0
+	}
+
+	return beat < uint32(len(m.Accents)) && m.Accents[beat]
+}
+
+// barLength returns the length in ticks of a bar of time signature ts, 4/4 if ts is not set
+func barLength(ts TimeSignatureChange, ticksPerQuarterNote uint16) (beats uint32, beatLength uint32) {
+	numerator, denominator := uint32(ts.Numerator), uint32(ts.Denominator)
+	if numerator == 0 || denominator == 0 {
+		numerator, denominator = 4, 4
+	}
+
+	return numerator, uint32(ticksPerQuarterNote) * 4 / denominator
+}
+
+// Clicks returns the click events for a number of bars of time signature ts starting at tick 0
+func (m *Metronome) Clicks(bars int, ts TimeSignatureChange, ticksPerQuarterNote uint16) []AbsEvent {
+	beats, beatLength := barLength(ts, ticksPerQuarterNote)
+	if beatLength == 0 {
+		return nil
+	}
+
+	length := m.Length
+	if length == 0 {
+		length = uint32(ticksPerQuarterNote) / 4
+	}
+
+	events := []AbsEvent{}
+
+	for beat := uint32(0); beat < uint32(bars)*beats; beat++ {
+		key, velocity := m.Key, m.Velocity
+		if m.accented(beat % beats) {
+			key, velocity = m.AccentKey, m.AccentVelocity
+		}
+
+		tick := beat * beatLength
+		events = insertAbsEvent(events, AbsEvent{
+			Tick:  tick,
+			Event: NewChannelEvent(0, NoteOn, m.Channel, uint16(key), uint16(velocity)),
+		}, false)
+		events = insertAbsEvent(events, AbsEvent{
+			Tick:  tick + length,
+			Event: NewChannelEvent(0, NoteOff, m.Channel, uint16(key), 0),
+		}, true)
+	}
+
+	return events
+}
+
+// clicksUntil returns the clicks of all beats before end following the time signatures
+func (m *Metronome) clicksUntil(timeSigMap *TimeSigMap, ticksPerQuarterNote uint16, end uint32) []AbsEvent {
+	events := []AbsEvent{}
+
+	for _, start := range timeSigMap.BarStartTicks(ticksPerQuarterNote, end) {
+		if start >= end {
+			break
+		}
+
+		for _, ae := range m.Clicks(1, timeSigMap.At(start), ticksPerQuarterNote) {
+			ae.Tick += start
+			events = insertAbsEvent(events, ae, ae.Event.EventType() == NoteOff)
+		}
+	}
+
+	return events
+}
+
+// countIn returns the clicks of a count-in of bars at a fixed tempo in microseconds per quarter
+// note, with the time offset of every click and the total length of the count-in
+func (m *Metronome) countIn(bars int, ts TimeSignatureChange, tempo uint32, ticksPerQuarterNote uint16) ([]AbsEvent, []time.Duration, time.Duration) {
+	tempoMap := NewTempoMap(ticksPerQuarterNote, []TempoChange{{MicrosecondsPerQuarterNote: tempo}})
+	clicks := m.Clicks(bars, ts, ticksPerQuarterNote)
+	times := make([]time.Duration, len(clicks))
+
+	for index, ae := range clicks {
+		times[index] = tempoMap.TickToDuration(ae.Tick)
+	}
+
+	beats, beatLength := barLength(ts, ticksPerQuarterNote)
+
+	return clicks, times, tempoMap.TickToDuration(uint32(bars) * beats * beatLength)
+}
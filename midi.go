@@ -50,8 +50,15 @@ type File struct {
 	Header *FileHeader
 	// All tracks in the order they appeared
 	Tracks []*Track
-	// Also keep a pointer to the raw chunks
+	// Also keep a pointer to the raw chunks, the chunks are authoritative for writing and are
+	// regenerated from Header and Tracks by Rebuild
 	Chunks []*Chunk
+	// Recoverable problems found while reading
+	Warnings []Warning
+	// Track chunks that could not be parsed while reading
+	trackErrors []TrackError
+	// Number of track chunks read so far, including tracks that could not be parsed
+	trackChunks int
 }
 
 // NewFile creates a new initialized file
@@ -62,6 +69,49 @@ func NewFile() *File {
 	}
 }
 
+// Warning describes a recoverable problem found in a file
+type Warning struct {
+	// Track index, -1 if the warning is not related to a track
+	Track int
+	// Absolute tick, only meaningful if Track is not -1
+	Tick    uint32
+	Message string
+}
+
+// String representation
+func (w Warning) String() string {
+	if w.Track < 0 {
+		return w.Message
+	}
+
+	return fmt.Sprintf("track %v, tick %v: %v", w.Track, w.Tick, w.Message)
+}
+
+// TrackError is a track chunk that could not be parsed and was skipped while reading, the raw
+// chunk stays in Chunks until Rebuild
+type TrackError struct {
+	// Index of the track chunk among all track chunks of the file
+	Index int
+	Chunk *Chunk
+	Err   error
+}
+
+// Error returns the track index and the parse error
+func (e TrackError) Error() string {
+	return fmt.Sprintf("track %v: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the parse error
+func (e TrackError) Unwrap() error {
+	return e.Err
+}
+
+// TrackErrors returns the track chunks skipped while reading because they could not be parsed,
+// Tracks holds only the tracks that were parsed
+func (f *File) TrackErrors() []TrackError {
+	return f.trackErrors
+}
+
 // Event is the minimal interface all midi event types should conform to
 type Event interface {
 	io.WriterTo
@@ -161,6 +211,10 @@ const (
 	ActiveSensing
 	// Meta midi event
 	Meta
+	// MTCQuarterFrame midi time code quarter frame event
+	MTCQuarterFrame
+	// Raw uninterpreted track content
+	Raw
 )
 
 func eventTypeToString(eventType EventType) string {
@@ -199,7 +253,11 @@ func eventTypeToString(eventType EventType) string {
 		return "ActiveSensing"
 	case Meta:
 		return "Meta"
+	case MTCQuarterFrame:
+		return "MTCQuarterFrame"
+	case Raw:
+		return "Raw"
 	}
 
-	return ""
+	return userEventTypeName(eventType)
 }
@@ -1,8 +1,21 @@
 package midi
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
 	"os"
+	"sort"
+	"strings"
 	"testing"
+	"testing/iotest"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestReadVariableLengthInteger(t *testing.T) {
@@ -181,3 +194,2518 @@ func TestMidi(t *testing.T) {
 	// defer f.Close()
 	// mft.WriteTo(f)
 }
+
+func TestPeekHeader(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	header, err := PeekHeader(fo)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if header.NumTracks == 0 {
+		t.Errorf("expected header to report at least one track")
+	}
+}
+
+func TestOpenMapped(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	if len(mf.Tracks) == 0 {
+		t.Errorf("expected mapped file to contain tracks")
+	}
+}
+
+func BenchmarkChunkTrack(b *testing.B) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		b.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, chunk := range mf.Chunks {
+			if chunk.Type != TrackType {
+				continue
+			}
+
+			_, err := chunk.Track()
+			if err != nil {
+				b.Fatalf("err %v", err)
+			}
+		}
+	}
+}
+
+func TestPooledParseRetain(t *testing.T) {
+	// Two text meta events
+	data := []byte{0x00, 0xFF, 0x01, 0x03, 'a', 'b', 'c', 0x00, 0xFF, 0x01, 0x03, 'd', 'e', 'f'}
+
+	retained := []*MetaEvent{}
+
+	err := parseTrackData(data, true, func(event Event) error {
+		me := event.(*MetaEvent)
+		me.Retain()
+		retained = append(retained, me)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if string(retained[0].Data) != "abc" || string(retained[1].Data) != "def" {
+		t.Errorf("expected retained data to be preserved, got %q and %q", retained[0].Data, retained[1].Data)
+	}
+}
+
+func TestMoveTrack(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	tracks := append([]*Track{}, mf.Tracks...)
+	chunks := append([]*Chunk{}, mf.Chunks...)
+
+	if err := mf.MoveTrack(0, 2); err == nil {
+		t.Errorf("expected moving the conductor track to fail")
+	}
+
+	if err := mf.MoveTrack(3, 1); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if mf.Tracks[1] != tracks[3] || mf.Tracks[2] != tracks[1] || mf.Tracks[3] != tracks[2] {
+		t.Errorf("unexpected track order after move")
+	}
+
+	// Chunk 0 is the header chunk
+	if mf.Chunks[2] != chunks[4] || mf.Chunks[3] != chunks[2] || mf.Chunks[4] != chunks[3] {
+		t.Errorf("unexpected chunk order after move")
+	}
+
+	mf.SortTracksBy(func(a, b *Track) bool {
+		return len(a.Events) > len(b.Events)
+	})
+
+	if mf.Tracks[0] != tracks[0] || mf.Tracks[1] != tracks[1] {
+		t.Errorf("unexpected track order after sort")
+	}
+}
+
+func TestSequencerSpecificDecoder(t *testing.T) {
+	id := []byte{0x00, 0x20, 0x7F}
+
+	err := RegisterSequencerSpecificDecoder(id, func(data []byte) (interface{}, error) {
+		return string(data), nil
+	})
+
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer RegisterSequencerSpecificDecoder(id, nil)
+
+	data := []byte{0x00, 0xFF, 0x7F, 0x06, 0x00, 0x20, 0x7F, 'r', 'e', 'd'}
+
+	chunk := &Chunk{Type: TrackType, Length: uint32(len(data)), Data: data}
+
+	track, err := chunk.Track()
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	se, ok := track.Events[0].(*SequencerSpecificEvent)
+	if !ok {
+		t.Fatalf("expected a sequencer specific event, got %T", track.Events[0])
+	}
+
+	if se.Value != "red" {
+		t.Errorf("expected decoded value red, got %v", se.Value)
+	}
+}
+
+func TestTrackColor(t *testing.T) {
+	id := []byte{0x00, 0x20, 0x7E}
+
+	err := RegisterTrackColorFormat(TrackColorFormat{
+		ManufacturerID: id,
+		Encode: func(color TrackColor) []byte {
+			return []byte{'C', color.R >> 1, color.G >> 1, color.B >> 1}
+		},
+		Decode: func(data []byte) (TrackColor, error) {
+			if len(data) != 4 || data[0] != 'C' {
+				return TrackColor{}, errors.New("no color")
+			}
+
+			return TrackColor{R: data[1] << 1, G: data[2] << 1, B: data[3] << 1}, nil
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer RegisterSequencerSpecificDecoder(id, nil)
+
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Lead"))},
+		{Tick: 0, Event: NewMetaEvent(0, Marker, []byte("intro"))},
+		{Tick: 960, Event: NewMetaEvent(0, CuePoint, []byte("drop"))},
+		{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	if _, ok := track.Color(); ok {
+		t.Error("expected a track without color")
+	}
+
+	if err := track.SetColor([]byte{0x41}, TrackColor{}); err == nil {
+		t.Error("expected an error for an unregistered format")
+	}
+
+	for _, color := range []TrackColor{{R: 0x10, G: 0x20, B: 0x30}, {R: 0xFE, G: 0x80, B: 0x00}} {
+		if err := track.SetColor(id, color); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunk := track.Chunk()
+
+	read, err := chunk.Track()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.Events) != 5 {
+		t.Errorf("expected the first color to be replaced, got %v events", len(read.Events))
+	}
+
+	if me, ok := read.Events[0].(*MetaEvent); !ok || me.MetaType != TrackName {
+		t.Errorf("expected the track name to stay the first event, got %v", read.Events[0])
+	}
+
+	if _, ok := read.Events[1].(*SequencerSpecificEvent); !ok {
+		t.Errorf("expected the color after the track name, got %v", read.Events[1])
+	}
+
+	if color, ok := read.Color(); !ok || color.String() != "#FE8000" {
+		t.Errorf("expected color #FE8000, got %v %v", color, ok)
+	}
+
+	markers := read.Markers()
+	if len(markers) != 2 || markers[0].Name != "intro" || markers[1].Tick != 960 {
+		t.Errorf("unexpected markers %v", markers)
+	}
+}
+
+func TestPatchMap(t *testing.T) {
+	text := `# test device
+device Test Synth
+0 0 Acoustic Grand Piano
+121:1 0 Wide Acoustic Grand
+0 48 String Ensemble 1
+`
+
+	pm, err := ReadPatchMap(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pm.Device != "Test Synth" || len(pm.Patches) != 3 {
+		t.Fatalf("unexpected patch map %+v", pm)
+	}
+
+	if name, ok := pm.Name(BankNumber(121, 1), 0); !ok || name != "Wide Acoustic Grand" {
+		t.Errorf("expected Wide Acoustic Grand, got %v", name)
+	}
+
+	if name, ok := pm.Name(BankNumber(121, 2), 48); !ok || name != "String Ensemble 1" {
+		t.Errorf("expected fallback to bank 0, got %v", name)
+	}
+
+	if _, ok := pm.Name(0, 1); ok {
+		t.Error("expected no name for an unknown program")
+	}
+
+	if patch, ok := pm.Lookup("wide acoustic grand"); !ok || patch.Bank != 121<<7|1 {
+		t.Errorf("unexpected lookup result %+v", patch)
+	}
+
+	if _, err := ReadPatchMap(strings.NewReader("0 128 Invalid\n")); err == nil {
+		t.Error("expected an error for an invalid program")
+	}
+
+	jsonData, err := json.Marshal(pm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJSON, err := ReadPatchMapJSON(bytes.NewReader(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fromJSON.Device != pm.Device || len(fromJSON.Patches) != len(pm.Patches) {
+		t.Errorf("unexpected patch map from JSON %+v", fromJSON)
+	}
+
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, ControlChange, 1, ControllerBankSelectMSB, 121),
+		NewChannelEvent(0, ControlChange, 1, ControllerBankSelectLSB, 1),
+		NewChannelEvent(0, ProgramChange, 2, 48, 0),
+		NewChannelEvent(10, ProgramChange, 1, 0, 0),
+	}}
+
+	changes := track.PatchChanges()
+	if len(changes) != 2 || changes[0].Bank != 0 || changes[1].Bank != BankNumber(121, 1) || changes[1].Tick != 10 {
+		t.Errorf("unexpected patch changes %+v", changes)
+	}
+}
+
+func TestSplitDrums(t *testing.T) {
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Drums"))},
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, GMDrumChannel, 7, 100)},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, GMDrumChannel, 36, 120)},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, GMDrumChannel, 42, 60)},
+		{Tick: 60, Event: NewChannelEvent(0, NoteOff, GMDrumChannel, 36, 0)},
+		{Tick: 60, Event: NewChannelEvent(0, NoteOff, GMDrumChannel, 42, 0)},
+		{Tick: 240, Event: NewChannelEvent(0, NoteOn, GMDrumChannel, 36, 90)},
+		{Tick: 240, Event: NewChannelEvent(0, NoteOn, GMDrumChannel, 90, 80)},
+		{Tick: 300, Event: NewChannelEvent(0, NoteOff, GMDrumChannel, 36, 0)},
+		{Tick: 300, Event: NewChannelEvent(0, NoteOff, GMDrumChannel, 90, 0)},
+		{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	instruments, remainder := SplitDrums(track, GMDrumChannel, true)
+
+	if len(instruments) != 3 || len(remainder.Events) != 3 {
+		t.Fatalf("expected 3 instruments and 3 remaining events, got %v and %v", len(instruments), len(remainder.Events))
+	}
+
+	names := []string{"Bass Drum 1", "Closed Hi-Hat", "Drum 90"}
+	for index, instrument := range instruments {
+		if name := string(instrument.Events[0].(*MetaEvent).Data); name != names[index] {
+			t.Errorf("expected track name %v, got %v", names[index], name)
+		}
+
+		if end := instrument.AbsEvents()[len(instrument.Events)-1]; end.Tick != 480 || !isEndOfTrack(end.Event) {
+			t.Errorf("expected instrument %v to end at 480", index)
+		}
+	}
+
+	notes := instruments[0].Notes()
+	if len(notes) != 2 || notes[0].Velocity != 120 || notes[1].Velocity != 90 || notes[1].Start != 240 {
+		t.Errorf("unexpected bass drum notes %+v", notes)
+	}
+
+	if GMDrumName(38) != "Acoustic Snare" || GMDrumName(20) != "" {
+		t.Errorf("unexpected drum map names")
+	}
+}
+
+func TestExtractMelody(t *testing.T) {
+	notes := func(channel uint16, spans ...uint32) *Track {
+		track := &Track{}
+		for i := 0; i < len(spans); i += 3 {
+			on, off := Note{Channel: channel, Key: uint8(spans[i]), Velocity: 100, Start: spans[i+1], End: spans[i+1] + spans[i+2]}.events()
+			track.SetAbsEvents(insertAbsEvent(insertAbsEvent(track.AbsEvents(), on, false), off, true))
+		}
+
+		return track
+	}
+
+	f := newFileWithTracks(Format1, 480, []*Track{
+		notes(0, 60, 0, 480, 64, 0, 480, 67, 0, 480, 72, 480, 960, 65, 960, 480, 76, 1200, 240),
+		notes(1, 48, 0, 1920),
+		notes(GMDrumChannel, 90, 0, 240),
+	})
+
+	melody := ExtractMelody(f).Notes()
+	expected := []Note{
+		{Channel: 0, Key: 67, Velocity: 100, Start: 0, End: 480},
+		{Channel: 0, Key: 72, Velocity: 100, Start: 480, End: 1200},
+		{Channel: 0, Key: 76, Velocity: 100, Start: 1200, End: 1440},
+	}
+
+	if len(melody) != len(expected) {
+		t.Fatalf("expected %v melody notes, got %+v", len(expected), melody)
+	}
+
+	for index, note := range melody {
+		if note != expected[index] {
+			t.Errorf("expected melody note %+v, got %+v", expected[index], note)
+		}
+	}
+}
+
+func TestSplitByChannelToTracks(t *testing.T) {
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Song"))},
+		{Tick: 0, Event: TempoChange{MicrosecondsPerQuarterNote: 400000}.MetaEvent(0)},
+		{Tick: 0, Event: NewChannelEvent(0, ProgramChange, 1, 33, 0)},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+		{Tick: 240, Event: NewChannelEvent(0, NoteOn, 1, 36, 100)},
+		{Tick: 480, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+		{Tick: 480, Event: NewChannelEvent(0, NoteOff, 1, 36, 0)},
+		{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	f := newFileWithTracks(Format0, 480, []*Track{track})
+
+	err := f.SplitByChannelToTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Header.Format != Format1 || len(f.Tracks) != 3 || f.Header.NumTracks != 3 {
+		t.Fatalf("expected a format 1 file with 3 tracks, got format %v with %v tracks", f.Header.Format, len(f.Tracks))
+	}
+
+	lengths := []int{3, 3, 4}
+	for index, track := range f.Tracks {
+		events := track.AbsEvents()
+		if len(events) != lengths[index] {
+			t.Errorf("expected %v events in track %v, got %v", lengths[index], index, len(events))
+		}
+
+		if last := events[len(events)-1]; last.Tick != 960 || !isEndOfTrack(last.Event) {
+			t.Errorf("expected track %v to end at 960", index)
+		}
+
+		for _, ae := range events {
+			if ce, ok := ae.Event.(*ChannelEvent); ok && (index == 0 || ce.Channel != uint16(index-1)) {
+				t.Errorf("unexpected channel %v in track %v", ce.Channel, index)
+			}
+		}
+	}
+
+	// A named instrument track keeps its name with the lowest channel
+	instrument := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Keys"))},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 5, 60, 100)},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 3, 64, 100)},
+		{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	f = newFileWithTracks(Format1, 480, []*Track{NewTrackFromAbsEvents([]AbsEvent{{Tick: 0, Event: NewMetaEvent(0, EndOfTrack, nil)}}), instrument})
+
+	err = f.SplitByChannelToTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.Tracks) != 3 || len(f.Tracks[1].Events) != 3 || f.Tracks[1].Events[1].(*ChannelEvent).Channel != 3 {
+		t.Errorf("expected the track name with channel 3 in track 1, got %v tracks", len(f.Tracks))
+	}
+
+	f.Header.Format = Format2
+	if err := f.SplitByChannelToTracks(); err == nil {
+		t.Errorf("expected an error splitting a format 2 file")
+	}
+}
+
+func TestDelay(t *testing.T) {
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 2, 60, 100)},
+		{Tick: 240, Event: NewChannelEvent(0, NoteOff, 2, 60, 0)},
+		{Tick: 480, Event: NewChannelEvent(0, NoteOn, 2, 60, 80)},
+		{Tick: 720, Event: NewChannelEvent(0, NoteOff, 2, 60, 0)},
+		{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	if added := Delay(track, 480, 3, 0.5); added != 6 {
+		t.Fatalf("expected 6 echoes, got %v", added)
+	}
+
+	velocities := map[uint32][]uint8{}
+	for _, note := range track.Notes() {
+		if note.Channel != 2 || note.Key != 60 || note.Duration() != 240 {
+			t.Errorf("unexpected echo %+v", note)
+		}
+
+		velocities[note.Start] = append(velocities[note.Start], note.Velocity)
+	}
+
+	expected := map[uint32][]uint8{0: {100}, 480: {80, 50}, 960: {25, 40}, 1440: {13, 20}, 1920: {10}}
+	for tick, want := range expected {
+		got := velocities[tick]
+		if len(got) != len(want) {
+			t.Errorf("expected velocities %v at %v, got %v", want, tick, got)
+			continue
+		}
+
+		for index := range want {
+			if got[index] != want[index] {
+				t.Errorf("expected velocities %v at %v, got %v", want, tick, got)
+			}
+		}
+	}
+
+	events := track.AbsEvents()
+	if last := events[len(events)-1]; last.Tick != 2160 || !isEndOfTrack(last.Event) {
+		t.Errorf("expected end of track at 2160, got %v", last.Tick)
+	}
+}
+
+func TestStrum(t *testing.T) {
+	chord := func() *Track {
+		return NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 64, 100)},
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 67, 100)},
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 1, 36, 100)},
+			{Tick: 15, Event: NewChannelEvent(0, NoteOff, 0, 67, 0)},
+			{Tick: 480, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+			{Tick: 480, Event: NewChannelEvent(0, NoteOff, 0, 64, 0)},
+			{Tick: 480, Event: NewChannelEvent(0, NoteOff, 1, 36, 0)},
+			{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		})
+	}
+
+	starts := func(track *Track) map[uint8]uint32 {
+		result := map[uint8]uint32{}
+		for _, note := range track.Notes() {
+			result[note.Key] = note.Start
+		}
+
+		return result
+	}
+
+	track := chord()
+	if moved := Strum(track, StrumOptions{Direction: StrumUp, Spread: 10}); moved != 2 {
+		t.Errorf("expected 2 strummed notes, got %v", moved)
+	}
+
+	// The highest note is limited to the tick before its note off
+	expected := map[uint8]uint32{60: 0, 64: 10, 67: 14, 36: 0}
+	for key, start := range starts(track) {
+		if expected[key] != start {
+			t.Errorf("expected key %v to start at %v, got %v", key, expected[key], start)
+		}
+	}
+
+	track = chord()
+	Strum(track, StrumOptions{Direction: StrumDown, Spread: 10})
+
+	expected = map[uint8]uint32{67: 0, 64: 10, 60: 20, 36: 0}
+	for key, start := range starts(track) {
+		if expected[key] != start {
+			t.Errorf("expected key %v to start at %v strumming down, got %v", key, expected[key], start)
+		}
+	}
+}
+
+func TestLimitPolyphony(t *testing.T) {
+	// Three held notes and a fourth note starting while they sound
+	newTrack := func() *Track {
+		return NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 60, 50)},
+			{Tick: 100, Event: NewChannelEvent(0, NoteOn, 0, 55, 90)},
+			{Tick: 200, Event: NewChannelEvent(0, NoteOn, 1, 64, 30)},
+			{Tick: 300, Event: NewChannelEvent(0, NoteOn, 0, 72, 100)},
+			{Tick: 960, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+			{Tick: 960, Event: NewChannelEvent(0, NoteOff, 0, 55, 0)},
+			{Tick: 960, Event: NewChannelEvent(0, NoteOff, 1, 64, 0)},
+			{Tick: 960, Event: NewChannelEvent(0, NoteOff, 0, 72, 0)},
+			{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		})
+	}
+
+	for policy, victim := range map[StealPolicy]uint8{StealOldest: 60, StealQuietest: 64, StealLowest: 55} {
+		track := newTrack()
+
+		if stolen := LimitPolyphony(track, 3, policy); stolen != 1 {
+			t.Errorf("expected 1 stolen note with policy %v, got %v", policy, stolen)
+		}
+
+		for _, note := range track.Notes() {
+			end := uint32(960)
+			if note.Key == victim {
+				end = 300
+			}
+
+			if note.End != end {
+				t.Errorf("expected key %v to end at %v with policy %v, got %v", note.Key, end, policy, note.End)
+			}
+		}
+	}
+
+	track := newTrack()
+	if stolen := LimitPolyphony(track, 1, StealOldest); stolen != 3 || len(track.Notes()) != 4 {
+		t.Errorf("expected 3 stolen notes keeping 4 notes, got %v", stolen)
+	}
+}
+
+func TestStreamParser(t *testing.T) {
+	data, err := os.ReadFile("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	mf := &File{}
+	if _, err := mf.ReadBytes(data); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	mf.Tracks[1].Events = append([]Event{
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x7E, 0x7F, 0x09, 0x01, 0xF7}},
+	}, mf.Tracks[1].Events...)
+	mf.Rebuild()
+	mf.Chunks = append(mf.Chunks[:2], append([]*Chunk{{Type: "XFIH", Length: 3, Data: []byte{1, 2, 3}}}, mf.Chunks[2:]...)...)
+
+	buf := &bytes.Buffer{}
+	if _, err := mf.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make([][]Event, len(mf.Tracks))
+	parser := NewStreamParser(iotest.OneByteReader(bytes.NewReader(buf.Bytes())), ReadOptions{})
+
+	err = parser.Parse(func(track int, event Event) error {
+		if parser.Header() == nil {
+			t.Fatalf("expected the header before the first event")
+		}
+
+		events[track] = append(events[track], event)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parser.Header().NumTracks != mf.Header.NumTracks {
+		t.Errorf("expected %v tracks in the header, got %v", mf.Header.NumTracks, parser.Header().NumTracks)
+	}
+
+	for index, track := range mf.Tracks {
+		if len(events[index]) != len(track.Events) {
+			t.Fatalf("expected %v events in track %v, got %v", len(track.Events), index, len(events[index]))
+		}
+
+		for i, event := range track.Events {
+			expected, _ := textEventLine(event)
+			actual, _ := textEventLine(events[index][i])
+
+			if event.DeltaTime() != events[index][i].DeltaTime() || expected != actual {
+				t.Errorf("expected %v in track %v, got %v", expected, index, actual)
+			}
+		}
+	}
+
+	parser = NewStreamParser(bytes.NewReader(buf.Bytes()), ReadOptions{MaxSysExBytes: 4})
+	if err := parser.Parse(func(int, Event) error { return nil }); err == nil {
+		t.Errorf("expected an error for system exclusive data over the limit")
+	}
+
+	parser = NewStreamParser(bytes.NewReader(buf.Bytes()[:buf.Len()-2]), ReadOptions{})
+	if err := parser.Parse(func(int, Event) error { return nil }); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected an unexpected end of file for a truncated track, got %v", err)
+	}
+}
+
+func TestSetInstrument(t *testing.T) {
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Lead"))},
+		{Tick: 0, Event: NewChannelEvent(0, ProgramChange, 3, 5, 0)},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 3, 60, 100)},
+		{Tick: 480, Event: NewChannelEvent(0, NoteOff, 3, 60, 0)},
+		{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	track.SetInstrument(0x79, 1, 24)
+	track.SetInstrument(0x79, 2, 25)
+
+	if len(track.Events) != 8 {
+		t.Fatalf("expected 8 events, got %v", len(track.Events))
+	}
+
+	if me := track.Events[0].(*MetaEvent); me.MetaType != TrackName {
+		t.Errorf("expected the track name to stay first")
+	}
+
+	if me := track.Events[1].(*MetaEvent); me.MetaType != InstrumentName || string(me.Data) != "Acoustic Guitar (steel)" {
+		t.Errorf("expected the instrument name of program 25, got %q", me.Data)
+	}
+
+	changes := track.PatchChanges()
+	if len(changes) != 1 || changes[0] != (PatchChange{Tick: 0, Channel: 3, Bank: BankNumber(0x79, 2), Program: 25}) {
+		t.Errorf("unexpected patch changes %+v", changes)
+	}
+
+	if GMProgramName(0) != "Acoustic Grand Piano" || GMProgramName(127) != "Gunshot" || GMProgramName(128) != "" {
+		t.Errorf("unexpected General MIDI program names")
+	}
+}
+
+func TestSetupEvents(t *testing.T) {
+	events := SetupEvents(DefaultSetupOptions())
+	if len(events) != 1+16*10 {
+		t.Fatalf("expected 161 events, got %v", len(events))
+	}
+
+	if se, ok := events[0].(*SystemExclusiveEvent); !ok || !bytes.Equal(se.Data, []byte{0x7E, 0x7F, 0x09, 0x01, 0xF7}) {
+		t.Errorf("expected General MIDI system on first")
+	}
+
+	events = SetupEvents(SetupOptions{
+		Reset:          ResetGS,
+		Channels:       []uint16{9},
+		Controllers:    []ControllerValue{{Controller: ControllerVolume, Value: 90}},
+		PitchBendRange: 12,
+	})
+
+	lines := []string{}
+	for _, event := range events[1:] {
+		line, _ := textEventLine(event)
+		lines = append(lines, line)
+	}
+
+	expected := []string{
+		"ControlChange 9 7 90",
+		"ControlChange 9 101 0",
+		"ControlChange 9 100 0",
+		"ControlChange 9 6 12",
+		"ControlChange 9 38 0",
+		"ControlChange 9 101 127",
+		"ControlChange 9 100 127",
+	}
+
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	if len(SetupEvents(SetupOptions{Reset: ResetNone, Channels: []uint16{}})) != 0 {
+		t.Errorf("expected no events without reset and channels")
+	}
+}
+
+func TestStrictDataBytes(t *testing.T) {
+	// A note on whose velocity byte has the high bit set, and a track without end of track
+	corrupt := []byte{0x00, 0x90, 0x3C, 0xE4, 0x60, 0x80, 0x3C, 0x00, 0x00, 0xFF, 0x2F, 0x00}
+	unterminated := []byte{0x00, 0x90, 0x3C, 0x64, 0x60, 0x80, 0x3C, 0x00}
+
+	for index, data := range [][]byte{corrupt, unterminated} {
+		mf := newFileWithTracks(Format0, 96, nil)
+		mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: uint32(len(data)), Data: data})
+		mf.Header.NumTracks = 1
+		mf.updateHeaderChunk()
+
+		buf := &bytes.Buffer{}
+		mf.WriteTo(buf)
+
+		read := &File{}
+		if _, err := read.ReadBytes(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(read.Tracks) != 1 || len(read.Warnings) != 1 {
+			t.Errorf("expected track %v to be read with 1 warning, got %v", index, read.Warnings)
+		}
+
+		var warning WarningError
+		if _, err := read.ReadBytesWithOptions(buf.Bytes(), ReadOptions{Strict: true}); !errors.As(err, &warning) {
+			t.Errorf("expected track %v to be rejected in strict mode, got %v", index, err)
+		}
+	}
+
+	// The stream parser rejects the data byte in strict mode as well
+	mf := newFileWithTracks(Format0, 96, nil)
+	mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: uint32(len(corrupt)), Data: corrupt})
+
+	buf := &bytes.Buffer{}
+	mf.WriteTo(buf)
+
+	if err := NewStreamParser(bytes.NewReader(buf.Bytes()), ReadOptions{Strict: true}).Parse(func(int, Event) error { return nil }); err == nil {
+		t.Errorf("expected the stream parser to reject the data byte")
+	}
+}
+
+func TestPatchUsage(t *testing.T) {
+	f := newFileWithTracks(Format1, 480, []*Track{
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewChannelEvent(0, ProgramChange, 0, 5, 0)},
+			{Tick: 480, Event: NewChannelEvent(0, ControlChange, 0, ControllerBankSelectMSB, 121)},
+			{Tick: 480, Event: NewChannelEvent(0, ProgramChange, 0, 5, 0)},
+			{Tick: 960, Event: NewChannelEvent(0, ProgramChange, 0, 5, 0)},
+			{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewChannelEvent(0, ControlChange, GMDrumChannel, ControllerBankSelectMSB, 120)},
+			{Tick: 0, Event: NewChannelEvent(0, ProgramChange, GMDrumChannel, 0, 0)},
+			{Tick: 240, Event: NewChannelEvent(0, ControlChange, 1, ControllerBankSelectMSB, 0)},
+			{Tick: 240, Event: NewChannelEvent(0, ProgramChange, 1, 200, 0)},
+			{Tick: 240, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+	})
+
+	usage := f.PatchUsage()
+	expected := []PatchUsage{
+		{Channel: 0, Bank: 0, Program: 5, Count: 1, Track: 0, Tick: 0, MissingBankSelect: true},
+		{Channel: 0, Bank: BankNumber(121, 0), Program: 5, Count: 2, Track: 0, Tick: 480, OutsideGM: true},
+		{Channel: 1, Bank: 0, Program: 200, Count: 1, Track: 1, Tick: 240, OutsideGM: true},
+		{Channel: GMDrumChannel, Bank: BankNumber(120, 0), Program: 0, Count: 1, Track: 1, Tick: 0},
+	}
+
+	if len(usage) != len(expected) {
+		t.Fatalf("expected %v combinations, got %+v", len(expected), usage)
+	}
+
+	for index, u := range usage {
+		if u != expected[index] {
+			t.Errorf("expected %+v, got %+v", expected[index], u)
+		}
+	}
+}
+
+func TestFragmentedReads(t *testing.T) {
+	data, err := os.ReadFile("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	expected := &File{}
+	if _, err := expected.ReadBytes(data); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	readers := map[string]io.Reader{
+		"one byte": iotest.OneByteReader(bytes.NewReader(data)),
+		"half":     iotest.HalfReader(bytes.NewReader(data)),
+		"data err": iotest.DataErrReader(bytes.NewReader(data)),
+	}
+
+	for name, r := range readers {
+		f := &File{}
+
+		n, err := f.ReadFrom(r)
+		if err != nil {
+			t.Fatalf("%v reader: %v", name, err)
+		}
+
+		if n != int64(len(data)) {
+			t.Errorf("%v reader: expected %v bytes read, got %v", name, len(data), n)
+		}
+
+		if len(f.Tracks) != len(expected.Tracks) || len(f.Warnings) != len(expected.Warnings) {
+			t.Fatalf("%v reader: expected %v tracks, got %v", name, len(expected.Tracks), len(f.Tracks))
+		}
+
+		for index, track := range f.Tracks {
+			if len(track.Events) != len(expected.Tracks[index].Events) {
+				t.Errorf("%v reader: expected %v events in track %v, got %v", name, len(expected.Tracks[index].Events), index, len(track.Events))
+			}
+		}
+	}
+
+	header, err := PeekHeader(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil || *header != *expected.Header {
+		t.Errorf("expected the header to be peeked one byte at a time, got %v", err)
+	}
+
+	// A cut short chunk is an unexpected end of file, a corrupt length does not allocate the
+	// claimed size
+	if _, err := (&File{}).ReadFrom(iotest.OneByteReader(bytes.NewReader(data[:len(data)-3]))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected an unexpected end of file, got %v", err)
+	}
+
+	corrupt := append([]byte("MTrk\xFF\xFF\xFF\xF0"), 0x00, 0xFF, 0x2F, 0x00)
+	chunk := &Chunk{}
+	if _, err := chunk.ReadFrom(bytes.NewReader(corrupt)); !errors.Is(err, io.ErrUnexpectedEOF) || cap(chunk.Data) > maxChunkPreallocation {
+		t.Errorf("expected an unexpected end of file without a large allocation, got %v", err)
+	}
+}
+
+func TestControllerConflicts(t *testing.T) {
+	// Two volume takes merged into one track: one fading in from 20, one holding at 100
+	newFile := func() *File {
+		events := []AbsEvent{}
+		for i := uint32(0); i < 6; i++ {
+			events = append(events,
+				AbsEvent{Tick: i * 120, Event: NewChannelEvent(0, ControlChange, 0, ControllerVolume, uint16(20+i*4))},
+				AbsEvent{Tick: i*120 + 60, Event: NewChannelEvent(0, ControlChange, 0, ControllerVolume, 100)},
+			)
+		}
+
+		// A smooth pan ramp is not a conflict
+		for i := uint32(0); i < 8; i++ {
+			events = append(events, AbsEvent{Tick: i * 90, Event: NewChannelEvent(0, ControlChange, 0, ControllerPan, uint16(i*16))})
+		}
+
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Tick < events[j].Tick })
+		events = append(events, AbsEvent{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)})
+
+		return newFileWithTracks(Format0, 480, []*Track{NewTrackFromAbsEvents(events)})
+	}
+
+	f := newFile()
+	conflicts := f.ControllerConflicts(ConflictOptions{})
+	if len(conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %v", conflicts)
+	}
+
+	c := conflicts[0]
+	if c.Controller != ControllerVolume || c.Start != 0 || c.End != 660 || len(c.Points) != 12 || len(c.Tracks) != 1 {
+		t.Fatalf("unexpected conflict %v with %v points", c, len(c.Points))
+	}
+
+	for index, p := range c.Points {
+		if p.Take != index%2 {
+			t.Errorf("expected point %v in take %v, got %v", index, index%2, p.Take)
+		}
+	}
+
+	var warning WarningError
+	if err := f.ValidateControllers(ConflictOptions{}); !errors.As(err, &warning) || warning.Tick != 0 {
+		t.Errorf("expected a conflict warning, got %v", err)
+	}
+
+	if err := f.ResolveControllerConflict(c, ResolveKeepLast, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if points := Automation(f.Tracks[0], 0, ControllerVolume); len(points) != 6 || points[0].Value != 100 {
+		t.Errorf("expected the last take to be kept, got %v", points)
+	}
+
+	f = newFile()
+	if err := f.ResolveControllerConflict(f.ControllerConflicts(ConflictOptions{})[0], ResolveAverage, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if points := Automation(f.Tracks[0], 0, ControllerVolume); points[1].Value != 60 || points[11].Value != 70 {
+		t.Errorf("expected averaged values, got %v", points)
+	}
+
+	f = newFile()
+	if err := f.ResolveControllerConflict(f.ControllerConflicts(ConflictOptions{})[0], ResolveSplit, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Automation(f.Tracks[0], 0, ControllerVolume)) != 6 || len(Automation(f.Tracks[0], 1, ControllerVolume)) != 6 {
+		t.Errorf("expected the second take on channel 1")
+	}
+
+	if len(f.ControllerConflicts(ConflictOptions{})) != 0 {
+		t.Errorf("expected no conflicts after splitting")
+	}
+}
+
+func TestSysExContinuations(t *testing.T) {
+	// An unterminated message continued 2 ticks later, a note, and an escape event that does not
+	// continue a message
+	data := []byte{
+		0x00, 0xF0, 0x03, 0x43, 0x10, 0x4C,
+		0x02, 0xF7, 0x02, 0x00, 0xF7,
+		0x01, 0x90, 0x3C, 0x64,
+		0x00, 0xF7, 0x01, 0xF8,
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+
+	mf := newFileWithTracks(Format0, 96, nil)
+	mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: uint32(len(data)), Data: data})
+	mf.Header.NumTracks = 1
+	mf.updateHeaderChunk()
+
+	buf := &bytes.Buffer{}
+	mf.WriteTo(buf)
+
+	check := func(name string, events []Event) {
+		if len(events) != 4 {
+			t.Fatalf("%v: expected 4 events, got %v", name, len(events))
+		}
+
+		se, ok := events[0].(*SystemExclusiveEvent)
+		if !ok || se.Continuation || !bytes.Equal(se.Data, []byte{0x43, 0x10, 0x4C, 0x00, 0xF7}) {
+			t.Errorf("%v: expected the message to be assembled, got %v", name, events[0])
+		}
+
+		if events[1].DeltaTime() != 3 {
+			t.Errorf("%v: expected the note to keep its tick, got delta time %v", name, events[1].DeltaTime())
+		}
+
+		if escape, ok := events[2].(*SystemExclusiveEvent); !ok || !escape.Continuation {
+			t.Errorf("%v: expected the escape event to be kept, got %v", name, events[2])
+		}
+	}
+
+	read := &File{}
+	if _, err := read.ReadBytes(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	check("read", read.Tracks[0].Events)
+
+	events := []Event{}
+	err := NewStreamParser(iotest.OneByteReader(bytes.NewReader(buf.Bytes())), ReadOptions{}).Parse(func(_ int, event Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check("stream", events)
+
+	events = []Event{}
+	_, err = (&File{}).ReadFromSink(bytes.NewReader(buf.Bytes()), EventSinkFunc(func(_ int, _ uint32, event Event) error {
+		if se, ok := event.(*SystemExclusiveEvent); ok {
+			se.Retain()
+		}
+
+		events = append(events, event)
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check("sink", events)
+
+	// Each fragment is within the limit but the assembled message is not
+	limit := ReadOptions{MaxSysExBytes: 4}
+	if _, err := read.ReadBytesWithOptions(buf.Bytes(), limit); err == nil {
+		t.Error("expected the assembled message to exceed the limit")
+	}
+
+	err = NewStreamParser(bytes.NewReader(buf.Bytes()), limit).Parse(func(int, Event) error { return nil })
+	if err == nil {
+		t.Error("expected the assembled message to exceed the limit when streaming")
+	}
+
+	_, err = (&File{}).ReadFromSinkWithOptions(bytes.NewReader(buf.Bytes()), EventSinkFunc(func(int, uint32, Event) error { return nil }), limit)
+	if err == nil {
+		t.Error("expected the assembled message to exceed the limit when reading to a sink")
+	}
+
+	// Fragments are kept on request and written back as they were read
+	if _, err := read.ReadBytesWithOptions(buf.Bytes(), ReadOptions{KeepSysExFragments: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.Tracks[0].Events) != 5 {
+		t.Fatalf("expected 5 events with fragments kept, got %v", len(read.Tracks[0].Events))
+	}
+
+	fragments := 0
+	_, err = (&File{}).ReadFromSinkWithOptions(bytes.NewReader(buf.Bytes()), EventSinkFunc(func(int, uint32, Event) error {
+		fragments++
+		return nil
+	}), ReadOptions{KeepSysExFragments: true})
+
+	if err != nil || fragments != 5 {
+		t.Errorf("expected 5 events with fragments kept when reading to a sink, got %v (%v)", fragments, err)
+	}
+
+	if se, ok := read.Tracks[0].Events[1].(*SystemExclusiveEvent); !ok || !se.Continuation || se.DeltaTime() != 2 {
+		t.Errorf("expected a continuation event, got %v", read.Tracks[0].Events[1])
+	}
+
+	if chunk := read.Tracks[0].Chunk(); !bytes.Equal(chunk.Data, data) {
+		t.Errorf("expected the fragments to be written back unchanged, got % X", chunk.Data)
+	}
+}
+
+func TestRegisterMetaParser(t *testing.T) {
+	RegisterMetaParser(0x60, func(deltaTime uint32, data []byte) (Event, error) {
+		return NewMetaEvent(deltaTime, Text, append([]byte("custom "), data...)), nil
+	})
+
+	defer RegisterMetaParser(0x60, nil)
+
+	data := []byte{0x00, 0xFF, 0x60, 0x02, 'o', 'k', 0x00, 0xFF, 0x2F, 0x00}
+	chunk := &Chunk{Type: TrackType, Length: uint32(len(data)), Data: data}
+
+	track, err := chunk.Track()
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if me := track.Events[0].(*MetaEvent); string(me.Data) != "custom ok" {
+		t.Errorf("expected custom parsed data, got %q", me.Data)
+	}
+
+	if me := track.Events[1].(*MetaEvent); me.MetaType != EndOfTrack {
+		t.Errorf("expected end of track after custom event, got %v", me)
+	}
+}
+
+type noteOnCounter struct {
+	BaseVisitor
+	count int
+}
+
+func (v *noteOnCounter) VisitNoteOn(e *ChannelEvent) error {
+	v.count++
+	return nil
+}
+
+func TestParseTrack(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	visitor := &noteOnCounter{}
+
+	err = ParseTrack(mf.Chunks[2].Data, visitor)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	count := 0
+	for _, event := range mf.Tracks[1].Events {
+		if event.EventType() == NoteOn {
+			count++
+		}
+	}
+
+	if visitor.count != count {
+		t.Errorf("expected %v note on events, visited %v", count, visitor.count)
+	}
+}
+
+func TestReadFromSink(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	counts := map[int]int{}
+	mf := NewFile()
+
+	_, err = mf.ReadFromSink(fo, EventSinkFunc(func(track int, tick uint32, event Event) error {
+		counts[track]++
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if len(counts) != int(mf.Header.NumTracks) || len(mf.Tracks) != 0 {
+		t.Errorf("expected events for %v tracks without retained tracks, got %v", mf.Header.NumTracks, counts)
+	}
+}
+
+func TestTrackAddNote(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, ProgramChange, 0, 5, 0),
+		NewMetaEvent(100, EndOfTrack, []byte{}),
+	}}
+
+	track.AddNote(50, 100, 0, 60, 90)
+
+	events := track.AbsEvents()
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %v", len(events))
+	}
+
+	if events[1].Tick != 50 || events[1].Event.EventType() != NoteOn {
+		t.Errorf("expected note on at tick 50, got %v at %v", events[1].Event, events[1].Tick)
+	}
+
+	if events[2].Tick != 150 || events[2].Event.EventType() != NoteOff {
+		t.Errorf("expected note off at tick 150, got %v at %v", events[2].Event, events[2].Tick)
+	}
+
+	if events[3].Tick != 150 || !isEndOfTrack(events[3].Event) {
+		t.Errorf("expected end of track to move to tick 150, got %v at %v", events[3].Event, events[3].Tick)
+	}
+}
+
+func TestOverdub(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(10, NoteOn, 0, 60, 100),
+		NewChannelEvent(10, NoteOff, 0, 60, 0),
+		NewMetaEvent(0, EndOfTrack, []byte{}),
+	}}
+
+	Overdub(track, []AbsEvent{
+		{Tick: 30, Event: NewChannelEvent(0, NoteOff, 0, 64, 0)},
+		{Tick: 10, Event: NewChannelEvent(0, NoteOn, 0, 64, 100)},
+	})
+
+	expected := []uint32{10, 10, 20, 30, 30}
+	events := track.AbsEvents()
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v events, got %v", len(expected), len(events))
+	}
+
+	for index, ae := range events {
+		if ae.Tick != expected[index] {
+			t.Errorf("event %v: expected tick %v, got %v", index, expected[index], ae.Tick)
+		}
+	}
+
+	if ev := events[1].Event.(*ChannelEvent); ev.Value1 != 64 {
+		t.Errorf("expected overdubbed note after existing note at the same tick")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	mf.Tracks = append(mf.Tracks, &Track{Events: []Event{
+		NewMetaEvent(0, TrackName, []byte("empty")),
+		NewMetaEvent(0, EndOfTrack, []byte{}),
+	}})
+
+	mf.Tracks[2].Events = append([]Event{
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x43, 0x10}},
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive, deltaTime: 5}, Data: []byte{0x4C, 0xF7}, Continuation: true},
+	}, mf.Tracks[2].Events...)
+
+	report := mf.Compact(CompactOptions{RemoveMetaOnlyTracks: true, MergeSysExContinuations: true})
+
+	if len(report.RemovedTracks) != 1 || report.RemovedTracks[0] != 4 {
+		t.Errorf("expected track 4 to be removed, got %v", report.RemovedTracks)
+	}
+
+	if report.MergedSysExEvents != 1 {
+		t.Errorf("expected one merged continuation, got %v", report.MergedSysExEvents)
+	}
+
+	if se := mf.Tracks[2].Events[0].(*SystemExclusiveEvent); len(se.Data) != 4 {
+		t.Errorf("expected merged system exclusive data, got %X", se.Data)
+	}
+
+	if mf.Tracks[2].Events[1].DeltaTime() != 5 {
+		t.Errorf("expected delta time of merged event to carry over")
+	}
+
+	if mf.Header.NumTracks != 4 {
+		t.Errorf("expected 4 tracks in header, got %v", mf.Header.NumTracks)
+	}
+}
+
+func TestStrip(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		NewChannelEvent(10, ChannelPressure, 0, 50, 0),
+		NewChannelEvent(10, NoteOn, 1, 64, 100),
+		NewChannelEvent(10, NoteOff, 0, 60, 0),
+		NewMetaEvent(0, EndOfTrack, []byte{}),
+	}}
+
+	if n := StripAftertouch(track); n != 1 {
+		t.Errorf("expected 1 removed event, got %v", n)
+	}
+
+	if n := StripChannel(track, 1); n != 1 {
+		t.Errorf("expected 1 removed event, got %v", n)
+	}
+
+	events := track.AbsEvents()
+	if len(events) != 3 || events[1].Tick != 30 {
+		t.Errorf("expected note off to stay at tick 30, got %v", events)
+	}
+}
+
+func TestAutomationLane(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, ControlChange, 0, 7, 0),
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		NewChannelEvent(100, ControlChange, 0, 7, 100),
+		NewChannelEvent(0, ControlChange, 0, 10, 64),
+		NewMetaEvent(0, EndOfTrack, []byte{}),
+	}}
+
+	lane := NewAutomationLane(track, 0, 7)
+	if len(lane.Points) != 2 {
+		t.Fatalf("expected 2 points, got %v", lane.Points)
+	}
+
+	lane.Interpolation = InterpolationLinear
+	lane.Resolution = 25
+	lane.Move(1, 100, 40)
+	lane.ApplyTo(track)
+
+	points := Automation(track, 0, 7)
+	expected := []Point{{0, 0}, {25, 10}, {50, 20}, {75, 30}, {100, 40}}
+
+	if len(points) != len(expected) {
+		t.Fatalf("expected %v points, got %v", expected, points)
+	}
+
+	for index, p := range points {
+		if p != expected[index] {
+			t.Errorf("point %v: expected %v, got %v", index, expected[index], p)
+		}
+	}
+
+	if other := Automation(track, 0, 10); len(other) != 1 {
+		t.Errorf("expected other controller lane to be untouched, got %v", other)
+	}
+}
+
+func TestValueAt(t *testing.T) {
+	lane := &AutomationLane{Points: []Point{{Tick: 100, Value: 10}, {Tick: 200, Value: 30}}}
+
+	if _, ok := ValueAt(lane, 99); ok {
+		t.Error("expected no value before the first point")
+	}
+
+	step := map[uint32]uint16{100: 10, 150: 10, 199: 10, 200: 30, 1000: 30}
+	for tick, expected := range step {
+		if value, ok := ValueAt(lane, tick); !ok || value != expected {
+			t.Errorf("step at tick %v: expected %v, got %v", tick, expected, value)
+		}
+	}
+
+	lane.Interpolation = InterpolationLinear
+
+	linear := map[uint32]uint16{100: 10, 150: 20, 175: 25, 200: 30, 1000: 30}
+	for tick, expected := range linear {
+		if value, ok := ValueAt(lane, tick); !ok || value != expected {
+			t.Errorf("linear at tick %v: expected %v, got %v", tick, expected, value)
+		}
+	}
+}
+
+func TestNoteList(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		NewChannelEvent(10, NoteOn, 0, 64, 100),
+		NewChannelEvent(10, NoteOn, 0, 60, 0),
+		NewChannelEvent(10, NoteOn, 0, 67, 100),
+		NewChannelEvent(10, NoteOff, 0, 64, 0),
+		NewChannelEvent(0, NoteOff, 0, 67, 0),
+	}}
+
+	notes := track.Notes()
+	if len(notes) != 3 {
+		t.Fatalf("expected 3 notes, got %v", notes)
+	}
+
+	if notes[0].Start != 0 || notes[0].End != 20 || notes[1].End != 40 {
+		t.Errorf("unexpected note pairing %v", notes)
+	}
+
+	l := NewNoteList(notes)
+
+	if active := l.NotesActiveAt(20); len(active) != 1 || active[0].Key != 64 {
+		t.Errorf("expected only key 64 active at tick 20, got %v", active)
+	}
+
+	if inRange := l.NotesInRange(15, 31); len(inRange) != 3 {
+		t.Errorf("expected 3 notes in range, got %v", inRange)
+	}
+
+	if onKey := l.NotesOnKey(67); len(onKey) != 1 || onKey[0].Start != 30 {
+		t.Errorf("expected one note on key 67, got %v", onKey)
+	}
+}
+
+func TestFrequencyToNote(t *testing.T) {
+	for key := 0; key < 128; key++ {
+		for _, cents := range []float64{-49, -20, 0, 20, 49} {
+			f := NoteToFrequency(uint8(key), cents/100, A4Frequency)
+
+			if k, c := FrequencyToNote(f); int(k) != key || math.Abs(c-cents) > 1e-6 {
+				t.Errorf("key %v %+v cents: got key %v %+v cents", key, cents, k, c)
+			}
+		}
+	}
+
+	// Frequencies outside the midi range are clamped, the cents give the distance to the edge
+	if k, c := FrequencyToNote(NoteToFrequency(0, -3, A4Frequency)); k != 0 || math.Abs(c+300) > 1e-6 {
+		t.Errorf("expected key 0 -300 cents, got %v %v", k, c)
+	}
+
+	if k, c := FrequencyToNote(NoteToFrequency(127, 5, A4Frequency)); k != 127 || math.Abs(c-500) > 1e-6 {
+		t.Errorf("expected key 127 +500 cents, got %v %v", k, c)
+	}
+
+	for _, f := range []float64{0, -440} {
+		if k, c := FrequencyToNote(f); k != 0 || c != 0 {
+			t.Errorf("expected key 0 without cents for %v Hz, got %v %v", f, k, c)
+		}
+	}
+}
+
+func TestRetune(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, ControlChange, 0, 7, 100),
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		NewChannelEvent(0, NoteOn, 0, 64, 100),
+		NewChannelEvent(10, NoteOff, 0, 60, 0),
+		NewChannelEvent(0, NoteOff, 0, 64, 0),
+	}}
+
+	opts := RetuneOptions{Channels: []uint16{1, 2}}
+	opts.Offsets[64] = -14
+
+	if err := Retune(track, opts); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	channels := map[uint8]uint16{}
+	bends := map[uint16]uint16{}
+
+	for _, event := range track.Events {
+		ce := event.(*ChannelEvent)
+
+		switch ce.EventType() {
+		case NoteOn:
+			channels[uint8(ce.Value1)] = ce.Channel
+		case PitchWheelChange:
+			bends[ce.Channel] = ce.Value1
+		}
+	}
+
+	if channels[60] == channels[64] {
+		t.Errorf("expected simultaneous notes on different channels")
+	}
+
+	if bends[channels[60]] != 8192 || bends[channels[64]] >= 8192 {
+		t.Errorf("unexpected pitch bends %v", bends)
+	}
+}
+
+func TestScala(t *testing.T) {
+	scl := "! test.scl\n!\nQuarter comma meantone fragment\n 3\n!\n 193.157\n 5/4\n 2/1\n"
+
+	scale, err := ParseScale(strings.NewReader(scl))
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if len(scale.Cents) != 3 || scale.Cents[2] != 1200 {
+		t.Fatalf("unexpected scale %v", scale)
+	}
+
+	kbm := "! test.kbm\n3\n0\n127\n60\n60\n261.625565\n3\n0\nx\n1\n"
+
+	mapping, err := ParseKeyboardMapping(strings.NewReader(kbm))
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	frequencies := scale.Frequencies(mapping)
+
+	if math.Abs(frequencies[60]-261.625565) > 1e-6 || frequencies[61] != 0 {
+		t.Errorf("unexpected frequencies %v %v", frequencies[60], frequencies[61])
+	}
+
+	if math.Abs(frequencies[63]-2*261.625565) > 1e-6 {
+		t.Errorf("expected octave at key 63, got %v", frequencies[63])
+	}
+
+	events := TuningSysEx(0x7F, 0, frequencies)
+	if len(events) != 1 || events[0].Data[len(events[0].Data)-1] != 0xF7 {
+		t.Errorf("expected a single terminated system exclusive event")
+	}
+
+	// Retuning all 128 keys does not fit the data byte holding the count of a single message
+	var linear [128]float64
+	for key := range linear {
+		linear[key] = NoteToFrequency(uint8(key), 0, A4Frequency)
+	}
+
+	events = TuningSysEx(0x7F, 0, linear)
+	if len(events) != 2 || events[0].Data[5] != 127 || events[1].Data[5] != 1 {
+		t.Fatalf("expected 127 and 1 key changes, got %v events", len(events))
+	}
+
+	for _, se := range events {
+		for _, b := range se.Data[:len(se.Data)-1] {
+			if b > 0x7F {
+				t.Fatalf("expected only data bytes, got % X", se.Data)
+			}
+		}
+	}
+
+	// Frequencies above the range retune to the highest frequency instead of leaving the key as is
+	var high [128]float64
+	high[0] = NoteToFrequency(127, 2, A4Frequency)
+	high[1] = NoteToFrequency(127, 0.99999, A4Frequency)
+
+	data := TuningSysEx(0x7F, 0, high)[0].Data
+	for index, change := range [][]byte{data[6:10], data[10:14]} {
+		if !bytes.Equal(change[1:], []byte{0x7F, 0x7F, 0x7E}) {
+			t.Errorf("change %v: expected the highest tuning, got % X", index, change)
+		}
+	}
+}
+
+func TestHistograms(t *testing.T) {
+	notes := []Note{
+		{Key: 60, Velocity: 10, Start: 0, End: 100},
+		{Key: 72, Velocity: 31, Start: 0, End: 240},
+		{Key: 64, Velocity: 32, Start: 100, End: 580},
+		{Key: 67, Velocity: 127, Start: 200, End: 300},
+	}
+
+	velocities := VelocityHistogram(notes, 32)
+	if len(velocities.Counts) != 4 || velocities.Counts[0] != 2 || velocities.Counts[1] != 1 || velocities.Counts[3] != 1 {
+		t.Errorf("unexpected velocity counts %v", velocities.Counts)
+	}
+
+	// Durations 100, 240, 480 and 100 in buckets of 120 ticks
+	durations := DurationHistogram(notes, 120)
+	expected := []int{2, 0, 1, 0, 1}
+	if len(durations.Counts) != len(expected) {
+		t.Fatalf("expected duration counts %v, got %v", expected, durations.Counts)
+	}
+
+	for index, count := range durations.Counts {
+		if count != expected[index] {
+			t.Errorf("expected duration counts %v, got %v", expected, durations.Counts)
+			break
+		}
+	}
+
+	if classes := PitchClassHistogram(notes); classes[0] != 2 || classes[4] != 1 || classes[7] != 1 {
+		t.Errorf("unexpected pitch classes %v", classes)
+	}
+
+	if h := VelocityHistogram(nil, 0); h.BucketSize != 1 || len(h.Counts) != 128 {
+		t.Errorf("expected a bucket size of 1 for 0, got %v with %v buckets", h.BucketSize, len(h.Counts))
+	}
+}
+
+func TestDensity(t *testing.T) {
+	track := &Track{}
+	track.AddNote(0, 10, 0, 60, 100)
+	track.AddNote(99, 10, 0, 62, 100)
+	track.AddNote(100, 10, 0, 64, 100)
+	track.AddNote(250, 50, 0, 65, 100)
+
+	// Notes starting at the last tick of a window count in it, the last window holds the end
+	density := Density(track, 100)
+	expected := []float64{2, 1, 1, 0}
+	if len(density) != len(expected) {
+		t.Fatalf("expected density %v, got %v", expected, density)
+	}
+
+	for index, value := range density {
+		if value != expected[index] {
+			t.Errorf("expected density %v, got %v", expected, density)
+			break
+		}
+	}
+
+	if density := Density(track, 0); len(density) != 0 {
+		t.Errorf("expected no windows for a window of 0 ticks, got %v", density)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	a := NewFingerprint(mf.File, DefaultFingerprintSize)
+	if len(a) == 0 {
+		t.Fatalf("expected a non empty fingerprint")
+	}
+
+	if s := Similarity(a, a); s != 1 {
+		t.Errorf("expected identical fingerprints to have similarity 1, got %v", s)
+	}
+
+	if s := Similarity(a, Fingerprint{}); s != 0 {
+		t.Errorf("expected similarity 0 with empty fingerprint, got %v", s)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	opts := DefaultTokenizerOptions(mf.Header.TicksPerQuarterNote)
+	tokens := Tokenize(mf.File, opts)
+
+	decoded := Detokenize(tokens, mf.Header.TicksPerQuarterNote, opts)
+
+	if len(decoded.Notes()) != len(mf.Notes()) {
+		t.Errorf("expected %v notes after decoding, got %v", len(mf.Notes()), len(decoded.Notes()))
+	}
+
+	if again := Tokenize(decoded, opts); len(again) != len(tokens) {
+		t.Errorf("expected %v tokens after round trip, got %v", len(tokens), len(again))
+	}
+}
+
+func TestExportStepPattern(t *testing.T) {
+	b := NewTrackBuilder(96)
+	b.Channel = 9
+	b.AddNote(Bar(1), Sixteenth, 36, 100)
+	b.AddNote(Bar(1).Beat(2), Sixteenth, 38, 90)
+	b.AddNote(Bar(1).Beat(2).Tick(3), Sixteenth, 38, 110)
+	b.AddNote(Bar(2).Beat(4).Tick(25), Sixteenth, 42, 80)
+
+	pattern := ExportStepPattern(b.Build(), nil, 96, 16)
+
+	if pattern.NumBars != 2 {
+		t.Fatalf("expected 2 bars, got %v", pattern.NumBars)
+	}
+
+	if s := pattern.Lanes[38][0][4]; s.Velocity != 110 || !s.Flam {
+		t.Errorf("expected flam with velocity 110 on step 5, got %v", s)
+	}
+
+	if s := pattern.Lanes[42][1][13]; s.Velocity != 80 {
+		t.Errorf("expected hit on bar 2 step 14, got %v", pattern.Lanes[42][1])
+	}
+
+	zero := NewTimeSigMap([]TimeSignatureChange{{Numerator: 4, Denominator: 0}})
+	if pattern := ExportStepPattern(b.Build(), zero, 96, 16); pattern.NumBars != 2 {
+		t.Errorf("expected a zero denominator to be treated as 4/4, got %v bars", pattern.NumBars)
+	}
+}
+
+func TestTrackCountMismatch(t *testing.T) {
+	track := &Track{}
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	f := newFileWithTracks(Format1, 96, []*Track{track})
+	f.Header.NumTracks = 3
+	f.Chunks[0] = f.Header.Chunk()
+
+	buf := &bytes.Buffer{}
+	for _, chunk := range f.Chunks {
+		chunk.WriteTo(buf)
+	}
+
+	mf := &File{}
+	if _, err := mf.ReadBytes(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mf.Warnings) != 1 {
+		t.Errorf("expected a track count warning, got %v", mf.Warnings)
+	}
+
+	if _, err := mf.ReadBytesWithOptions(buf.Bytes(), ReadOptions{Strict: true}); err == nil {
+		t.Error("expected a track count error in strict mode")
+	}
+
+	fixed := &bytes.Buffer{}
+	if _, err := mf.WriteTo(fixed); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mf.ReadFromWithOptions(fixed, ReadOptions{Strict: true}); err != nil {
+		t.Errorf("expected the writer to fix the track count, got %v", err)
+	}
+}
+
+func TestHeaderChunkPolicy(t *testing.T) {
+	track := &Track{}
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	f := newFileWithTracks(Format0, 96, []*Track{track})
+	second := newFileWithTracks(Format1, 480, nil).Header.Chunk()
+
+	// Late header followed by a second header
+	buf := &bytes.Buffer{}
+	f.Chunks[1].WriteTo(buf)
+	f.Chunks[0].WriteTo(buf)
+	second.WriteTo(buf)
+
+	mf := &File{}
+	if _, err := mf.ReadBytes(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mf.Warnings) != 2 {
+		t.Errorf("expected 2 warnings, got %v", mf.Warnings)
+	}
+
+	if mf.Header.TicksPerQuarterNote != 96 || len(mf.Chunks) != 2 || mf.Chunks[0].Type != HeaderType {
+		t.Errorf("expected the first header to be used and moved to the front")
+	}
+
+	if _, err := mf.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), ReadOptions{Strict: true}); err == nil {
+		t.Error("expected an error for a late header in strict mode")
+	}
+}
+
+func TestIgnoreTrailingData(t *testing.T) {
+	track := &Track{}
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	buf := &bytes.Buffer{}
+	newFileWithTracks(Format0, 96, []*Track{track}).WriteTo(buf)
+	buf.Write([]byte{0x00, 0x00, 0x1A, 0x1A, 0x1A})
+
+	mf := &File{}
+	if _, err := mf.ReadBytes(buf.Bytes()); err == nil {
+		t.Error("expected trailing data to fail by default")
+	}
+
+	if _, err := mf.ReadBytesWithOptions(buf.Bytes(), ReadOptions{IgnoreTrailingData: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mf.Tracks) != 1 || len(mf.Warnings) != 1 {
+		t.Errorf("expected 1 track and a trailing data warning, got %d tracks and %v", len(mf.Tracks), mf.Warnings)
+	}
+
+	if _, err := mf.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), ReadOptions{IgnoreTrailingData: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mf.Tracks) != 1 || len(mf.Warnings) != 1 {
+		t.Errorf("expected 1 track and a trailing data warning, got %d tracks and %v", len(mf.Tracks), mf.Warnings)
+	}
+
+	// A track that is skipped still counts as one of the declared tracks
+	bad := []byte{0x00, 0xF4, 0x01}
+	skipped := newFileWithTracks(Format0, 96, nil)
+	skipped.Header.NumTracks = 1
+	skipped.Chunks[0] = skipped.Header.Chunk()
+	skipped.Chunks = append(skipped.Chunks, &Chunk{Type: TrackType, Length: uint32(len(bad)), Data: bad})
+
+	buf.Reset()
+	skipped.WriteTo(buf)
+	buf.Write([]byte{0x00, 0x00, 0x1A, 0x1A, 0x1A})
+
+	if _, err := mf.ReadBytesWithOptions(buf.Bytes(), ReadOptions{IgnoreTrailingData: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mf.Tracks) != 0 || len(mf.TrackErrors()) != 1 || len(mf.Warnings) != 2 {
+		t.Errorf("expected a skipped track and a trailing data warning, got %d tracks and %v", len(mf.Tracks), mf.Warnings)
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	a := &Track{}
+	a.AddNote(0, 96, 0, 60, 100)
+	a.AddNote(96, 96, 0, 62, 100)
+	a.Events = append(a.Events, &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x7E, 0x7F, 0x09, 0x01, 0xF7}})
+	a.Events = append(a.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	b := &Track{}
+	b.Events = append(b.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	buf := &bytes.Buffer{}
+	newFileWithTracks(Format1, 96, []*Track{a, b}).WriteTo(buf)
+
+	limits := map[string]ReadOptions{
+		"tracks": {MaxTracks: 1},
+		"events": {MaxEventsPerTrack: 5},
+		"sysex":  {MaxSysExBytes: 4},
+	}
+
+	for name, opts := range limits {
+		mf := &File{}
+		if _, err := mf.ReadBytesWithOptions(buf.Bytes(), opts); err == nil {
+			t.Errorf("expected the %v limit to be exceeded", name)
+		}
+
+		if _, err := mf.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), opts); err == nil {
+			t.Errorf("expected the %v limit to be exceeded when reading from a reader", name)
+		}
+	}
+
+	mf := &File{}
+	if _, err := mf.ReadBytesWithOptions(buf.Bytes(), ReadOptions{MaxTracks: 2, MaxEventsPerTrack: 6, MaxSysExBytes: 5}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadLogger(t *testing.T) {
+	track := &Track{}
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	buf := &bytes.Buffer{}
+	newFileWithTracks(Format0, 96, []*Track{track}).WriteTo(buf)
+	buf.Write([]byte{0x00, 0x00, 0x1A, 0x1A, 0x1A})
+
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	mf := &File{}
+	if _, err := mf.ReadBytesWithOptions(buf.Bytes(), ReadOptions{IgnoreTrailingData: true, Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+
+	output := logs.String()
+	if strings.Count(output, "midi chunk") != 2 || !strings.Contains(output, "trailing data ignored") {
+		t.Errorf("expected 2 chunks and the skipped trailing data to be logged, got %v", output)
+	}
+
+	logs.Reset()
+	mf.WriteToWithOptions(&bytes.Buffer{}, WriteOptions{Logger: logger})
+
+	if strings.Count(logs.String(), "midi chunk") != 2 {
+		t.Errorf("expected 2 written chunks to be logged, got %v", logs.String())
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	track := &Track{}
+	track.AddNote(0, 200, 0, 60, 100)
+	track.AddNote(200, 96, 0, 62, 100)
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	buf := &bytes.Buffer{}
+	newFileWithTracks(Format0, 96, []*Track{track}).WriteTo(buf)
+
+	metrics := &ParseMetrics{}
+	mf := &File{}
+	if _, err := mf.ReadBytesWithOptions(buf.Bytes(), ReadOptions{Metrics: metrics}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics.Chunks) != 2 || metrics.Chunks[0].Type != HeaderType || metrics.Chunks[1].Events != 5 {
+		t.Errorf("unexpected chunk metrics %v", metrics.Chunks)
+	}
+
+	if metrics.TotalEvents() != 5 || metrics.Events[NoteOn] != 2 || metrics.Events[Meta] != 1 {
+		t.Errorf("unexpected event counts %v", metrics.Events)
+	}
+
+	// The note off at 200 ticks needs a 2 byte delta time
+	if metrics.DeltaTimeSizes[1] != 4 || metrics.DeltaTimeSizes[2] != 1 {
+		t.Errorf("unexpected delta time sizes %v", metrics.DeltaTimeSizes)
+	}
+
+	if _, err := mf.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), ReadOptions{Metrics: metrics}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics.Chunks) != 4 || metrics.TotalEvents() != 10 {
+		t.Errorf("expected metrics to accumulate, got %v chunks and %v events", len(metrics.Chunks), metrics.TotalEvents())
+	}
+
+	runningStatus := &ParseMetrics{}
+	err := parseTrackDataWithOptions([]byte{0x00, 0x90, 60, 100, 0x00, 62, 100}, false, ReadOptions{Metrics: runningStatus}, func(Event) error {
+		return nil
+	})
+
+	if err != nil || runningStatus.RunningStatusEvents != 1 {
+		t.Errorf("expected 1 running status event, got %v (%v)", runningStatus.RunningStatusEvents, err)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	track := &Track{}
+	track.AddNote(0, 96, 0, 60, 100)
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	mf := newFileWithTracks(Format1, 96, []*Track{track})
+	for i := 0; i < 2; i++ {
+		// A data byte without running status
+		mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: 2, Data: []byte{0x00, 0x60}})
+	}
+
+	buf := &bytes.Buffer{}
+	mf.WriteTo(buf)
+
+	read := &File{}
+	if _, err := read.ReadBytesWithOptions(buf.Bytes(), ReadOptions{Strict: true}); err == nil {
+		t.Fatal("expected strict mode to stop at the first track error")
+	}
+
+	_, err := read.ReadFromWithOptions(bytes.NewReader(buf.Bytes()), ReadOptions{Strict: true, CollectErrors: true})
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	// Skipped tracks count as track chunks, the header track count matches
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("expected 2 skipped tracks, got %v", err)
+	}
+
+	var warningErr WarningError
+	if !errors.As(err, &warningErr) || warningErr.Track != 1 {
+		t.Errorf("expected a warning error for track 1, got %v", err)
+	}
+
+	_, err = read.ReadBytesWithOptions(buf.Bytes(), ReadOptions{CollectErrors: true, MaxEventsPerTrack: 1})
+
+	joined, ok = err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 1 {
+		t.Fatalf("expected the event limit error, got %v", err)
+	}
+}
+
+func TestTrackErrors(t *testing.T) {
+	a := &Track{}
+	a.AddNote(0, 96, 0, 60, 100)
+	a.Events = append(a.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	b := &Track{}
+	b.Events = append(b.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	mf := newFileWithTracks(Format1, 96, []*Track{a})
+	mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: 2, Data: []byte{0x00, 0x60}}, b.Chunk())
+
+	buf := &bytes.Buffer{}
+	mf.WriteTo(buf)
+
+	read := &File{}
+	if _, err := read.ReadBytes(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	trackErrors := read.TrackErrors()
+	if len(read.Tracks) != 2 || len(trackErrors) != 1 || trackErrors[0].Index != 1 {
+		t.Fatalf("expected track 1 to be skipped, got %v tracks and %v", len(read.Tracks), trackErrors)
+	}
+
+	if !bytes.Equal(trackErrors[0].Chunk.Data, []byte{0x00, 0x60}) || len(read.Chunks) != 4 {
+		t.Errorf("expected the raw chunk of the skipped track to be kept")
+	}
+
+	clone := read.Clone()
+	if len(clone.TrackErrors()) != 1 || clone.TrackErrors()[0].Chunk != clone.Chunks[2] {
+		t.Errorf("expected the clone to reference its own chunk of the skipped track")
+	}
+
+	written := &bytes.Buffer{}
+	read.WriteTo(written)
+
+	if !bytes.Equal(buf.Bytes(), written.Bytes()) {
+		t.Errorf("expected the skipped track to be written back unchanged")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := &Track{}
+	valid.AddNote(0, 96, 0, 60, 100)
+	valid.Events = append(valid.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	if err := newFileWithTracks(Format1, 96, []*Track{valid}).Validate(); err != nil {
+		t.Errorf("expected a valid file, got %v", err)
+	}
+
+	invalid := &Track{}
+	invalid.Events = []Event{
+		NewChannelEvent(0, NoteOn, 16, 60, 100),
+		NewChannelEvent(96, NoteOff, 0, 60, 128),
+	}
+
+	err := newFileWithTracks(Format0, 96, []*Track{valid, invalid}).Validate()
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 4 {
+		t.Fatalf("expected 4 problems, got %v", err)
+	}
+}
+
+func TestRunningStatusMode(t *testing.T) {
+	afterMeta := []byte{0x00, 0x90, 0x3C, 0x64, 0x00, 0xFF, 0x01, 0x01, 0x41, 0x00, 0x3E, 0x64, 0x00, 0xFF, 0x2F, 0x00}
+	afterSysEx := []byte{0x00, 0x90, 0x3C, 0x64, 0x00, 0xF0, 0x02, 0x7E, 0xF7, 0x00, 0x40, 0x64, 0x00, 0xFF, 0x2F, 0x00}
+
+	tests := []struct {
+		data  []byte
+		mode  RunningStatusMode
+		valid bool
+	}{
+		{afterMeta, RunningStatusDefault, true},
+		{afterMeta, RunningStatusSpec, false},
+		{afterMeta, RunningStatusKeep, true},
+		{afterSysEx, RunningStatusDefault, false},
+		{afterSysEx, RunningStatusSpec, false},
+		{afterSysEx, RunningStatusKeep, true},
+	}
+
+	for index, test := range tests {
+		mf := newFileWithTracks(Format0, 96, nil)
+		mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: uint32(len(test.data)), Data: test.data})
+
+		buf := &bytes.Buffer{}
+		mf.WriteTo(buf)
+
+		read := &File{}
+		_, err := read.ReadBytesWithOptions(buf.Bytes(), ReadOptions{Strict: true, RunningStatus: test.mode})
+
+		if test.valid && (err != nil || len(read.Tracks[0].Events) != 4) {
+			t.Errorf("test %v: expected 4 events, got %v", index, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("test %v: expected running status to be cancelled", index)
+		}
+	}
+}
+
+func TestParserBounds(t *testing.T) {
+	if _, _, err := readVariableLengthInteger([]byte{0x81, 0x80, 0x80, 0x80, 0x00}); err == nil {
+		t.Error("expected a variable length quantity longer than 4 bytes to fail")
+	}
+
+	if _, err := (&Chunk{Type: HeaderType, Length: 6, Data: []byte{0x00}}).FileHeader(); err == nil {
+		t.Error("expected a header chunk with short data to fail")
+	}
+
+	RegisterStatusParser(0xF4, func(statusByte uint8, deltaTime uint32, data []byte) (Event, uint32, error) {
+		return nil, 0, nil
+	})
+
+	RegisterStatusParser(0xF5, func(statusByte uint8, deltaTime uint32, data []byte) (Event, uint32, error) {
+		var values []byte
+		return RealTimeEvent(0xF8), uint32(values[4]), nil
+	})
+
+	defer RegisterStatusParser(0xF4, nil)
+	defer RegisterStatusParser(0xF5, nil)
+
+	for _, data := range [][]byte{{0x00, 0xF4}, {0x00, 0xF5}} {
+		if err := parseTrackData(data, false, func(Event) error { return nil }); err == nil {
+			t.Errorf("expected parsing % x to fail", data)
+		}
+	}
+
+	if _, err := ParseMessage(0xF5, nil); err == nil {
+		t.Error("expected a panicking parser to return an error")
+	}
+}
+
+func TestKeepRawEvents(t *testing.T) {
+	// A note on, an undefined real time status byte, a note off and an undefined system common
+	// status byte followed by bytes that can not be interpreted
+	data := []byte{0x00, 0x90, 0x3C, 0x64, 0x00, 0xF9, 0x60, 0x80, 0x3C, 0x00, 0x00, 0xF4, 0x01, 0x02, 0x00, 0xFF, 0x2F, 0x00}
+
+	mf := newFileWithTracks(Format0, 96, nil)
+	mf.Chunks = append(mf.Chunks, &Chunk{Type: TrackType, Length: uint32(len(data)), Data: data})
+
+	buf := &bytes.Buffer{}
+	mf.WriteTo(buf)
+
+	read := &File{}
+	if _, err := read.ReadBytes(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.TrackErrors()) != 1 {
+		t.Fatalf("expected the track to be skipped without raw events")
+	}
+
+	if _, err := read.ReadBytesWithOptions(buf.Bytes(), ReadOptions{KeepRawEvents: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := read.Tracks[0].Events
+	if len(events) != 4 || len(read.Warnings) != 2 {
+		t.Fatalf("expected 4 events and 2 raw event warnings, got %v and %v", events, read.Warnings)
+	}
+
+	raw, ok := events[3].(*RawEvent)
+	if !ok || raw.Status != 0xF4 || len(raw.Data) != 6 || events[1].EventType() != Raw {
+		t.Errorf("unexpected raw events %v and %v", events[1], events[3])
+	}
+
+	read.Rebuild()
+
+	written := &bytes.Buffer{}
+	read.WriteTo(written)
+
+	if !bytes.Equal(buf.Bytes(), written.Bytes()) {
+		t.Errorf("expected raw events to be written verbatim")
+	}
+
+	if read.Validate() == nil {
+		t.Errorf("expected raw events to fail validation")
+	}
+
+	text := &bytes.Buffer{}
+	if err := read.WriteText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	fromText := &File{}
+	if err := fromText.ReadText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	written.Reset()
+	fromText.WriteTo(written)
+
+	if !bytes.Equal(buf.Bytes(), written.Bytes()) {
+		t.Errorf("expected raw events to survive the text round trip")
+	}
+}
+
+func TestRegisterEventType(t *testing.T) {
+	sampleDump := RegisterEventType("SampleDump")
+
+	if sampleDump < FirstUserEventType || RegisterEventType("SampleDump") != sampleDump {
+		t.Fatalf("expected a stable user event type, got %v", uint8(sampleDump))
+	}
+
+	event := NewRawEvent(0, 0xF0, []byte{0x7E, 0x00, 0x01})
+	event.SetEventType(sampleDump)
+
+	if sampleDump.String() != "SampleDump" || !strings.HasPrefix(event.String(), "SampleDump") {
+		t.Errorf("expected the registered name, got %v and %v", sampleDump, event)
+	}
+
+	if !OnlyTypes(sampleDump)(event) || DropTypes(sampleDump)(event) {
+		t.Errorf("expected filters to handle the registered type")
+	}
+
+	eventTypes := EventTypes()
+	if eventTypes[len(eventTypes)-1] < sampleDump {
+		t.Errorf("expected the registered type to be listed")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a built-in name to panic")
+		}
+	}()
+
+	RegisterEventType("NoteOn")
+}
+
+func TestCanonicalize(t *testing.T) {
+	a := &Track{}
+	a.AddNote(0, 96, 0, 64, 100)
+	a.AddNote(0, 96, 0, 60, 100)
+	a.Events = append([]Event{NewChannelEvent(0, ProgramChange, 0, 5, 0)}, a.Events...)
+
+	b := &Track{}
+	b.Events = []Event{
+		NewChannelEvent(0, ProgramChange, 0, 5, 0),
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		NewChannelEvent(0, NoteOn, 0, 64, 100),
+		NewChannelEvent(96, NoteOn, 0, 64, 0),
+		NewChannelEvent(0, NoteOff, 0, 60, 0),
+		NewMetaEvent(0, EndOfTrack, nil),
+	}
+
+	var outputs [][]byte
+
+	for _, track := range []*Track{a, b} {
+		f := newFileWithTracks(Format0, 96, []*Track{track})
+		f.Canonicalize()
+
+		buf := &bytes.Buffer{}
+		f.WriteTo(buf)
+		outputs = append(outputs, buf.Bytes())
+	}
+
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Errorf("expected identical canonical output\n% X\n% X", outputs[0], outputs[1])
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	mf.Tracks = mf.Tracks[:2]
+	mf.Rebuild()
+
+	if len(mf.Chunks) != 3 || mf.Header.NumTracks != 2 {
+		t.Fatalf("expected a header and 2 track chunks, got %d chunks", len(mf.Chunks))
+	}
+
+	buf := &bytes.Buffer{}
+	mf.WriteTo(buf)
+
+	f := &File{}
+	if _, err := f.ReadFromWithOptions(buf, ReadOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.Tracks) != 2 || len(f.Tracks[1].Events) != len(mf.Tracks[1].Events) {
+		t.Errorf("expected the rebuilt tracks to be written")
+	}
+}
+
+// failingEvent is an event that fails to write after writing part of its data
+type failingEvent struct {
+	coreEvent
+}
+
+func (e *failingEvent) WriteTo(w io.Writer) (int64, error) {
+	n, _ := w.Write([]byte{0x00, 0x90})
+	return int64(n), errors.New("write failed")
+}
+
+func TestChunkBuilder(t *testing.T) {
+	b := NewChunkBuilder(3)
+
+	if err := b.WriteEvent(NewChannelEvent(0, NoteOn, 0, 60, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := b.WriteEvents([]Event{NewChannelEvent(10, NoteOff, 0, 60, 0), &failingEvent{}})
+	if err == nil {
+		t.Fatal("expected an error for the failing event")
+	}
+
+	if !bytes.Equal(b.Bytes(), []byte{0x00, 0x90, 60, 100}) {
+		t.Errorf("expected the failed write to be removed, got % X", b.Bytes())
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := b.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), []byte{'M', 'T', 'r', 'k', 0, 0, 0, 4, 0x00, 0x90, 60, 100}) {
+		t.Errorf("unexpected chunk % X", buf.Bytes())
+	}
+
+	track := &Track{Events: []Event{NewChannelEvent(0, NoteOn, 0, 60, 100), &failingEvent{}}}
+	if _, err := track.BuildChunk(); err == nil {
+		t.Error("expected BuildChunk to fail")
+	}
+
+	if chunk := track.Chunk(); chunk.Length != 4 {
+		t.Errorf("expected the failing event to be left out, got length %v", chunk.Length)
+	}
+}
+
+func TestClone(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	c := mf.Clone()
+
+	c.Header.Format = Format0
+	c.Tracks[0].Events[0].SetDeltaTime(1000)
+	c.Chunks[1].Data[0] = 0x7F
+
+	if mf.Header.Format == Format0 || mf.Tracks[0].Events[0].DeltaTime() == 1000 || mf.Chunks[1].Data[0] == 0x7F {
+		t.Errorf("expected the original to be unchanged")
+	}
+
+	mf.Close()
+
+	track := &Track{Events: []Event{
+		&SystemRealTimeEvent{coreEvent: coreEvent{eventType: TimingClock}},
+		NewRawEvent(0, 0xF9, []byte{0x01}),
+	}}
+
+	clone := track.Clone()
+	clone.Events[0].SetDeltaTime(10)
+	clone.Events[1].(*RawEvent).Data[0] = 0x02
+
+	if track.Events[0].DeltaTime() != 0 || track.Events[1].(*RawEvent).Data[0] != 0x01 {
+		t.Errorf("expected real time and raw events to be copied")
+	}
+
+	// Chunk data of the clone stays valid after the mapping is closed
+	if _, err := c.Chunks[2].Track(); err != nil {
+		t.Errorf("err %v", err)
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	mf := &File{}
+	if _, err := mf.ReadFrom(fo); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	mf.Tracks[1].Events = append([]Event{
+		NewMetaEvent(0, Text, []byte("a \"quoted\"\ntext")),
+		NewMetaEvent(0, 0x60, []byte{1, 2}),
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x7E, 0xF7}},
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0xF8}, Continuation: true},
+		NewRawEvent(0, 0xF4, []byte{0x01, 0x02}),
+		NewRawEvent(0, 0xF9, nil),
+	}, mf.Tracks[1].Events...)
+	mf.Rebuild()
+
+	text := &bytes.Buffer{}
+	if err := mf.WriteText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &File{}
+	if err := f.ReadText(bytes.NewReader(text.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, actual := &bytes.Buffer{}, &bytes.Buffer{}
+	mf.WriteTo(expected)
+	f.WriteTo(actual)
+
+	if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+		t.Errorf("expected the text round trip to reproduce the file")
+	}
+}
+
+func TestDocumentRoundTrip(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	mf := &File{}
+	if _, err := mf.ReadFrom(fo); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	mf.Tracks[1].Events = append([]Event{
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0xF8}, Continuation: true},
+		NewRawEvent(0, 0xF4, []byte{0x01, 0x02}),
+		NewRawEvent(0, 0xF9, nil),
+		NewMetaEvent(0, TrackName, []byte{'C', 'a', 'f', 0xE9, 0xFF}),
+	}, mf.Tracks[1].Events...)
+	mf.Rebuild()
+
+	expected := &bytes.Buffer{}
+	mf.WriteTo(expected)
+
+	jsonData, err := json.Marshal(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yamlData, err := yaml.Marshal(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJSON, fromYAML := &File{}, &File{}
+
+	if err := json.Unmarshal(jsonData, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := yaml.Unmarshal(yamlData, fromYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, f := range map[string]*File{"json": fromJSON, "yaml": fromYAML} {
+		actual := &bytes.Buffer{}
+		f.WriteTo(actual)
+
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Errorf("expected the %v round trip to reproduce the file", name)
+		}
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	mf := &File{}
+	if _, err := mf.ReadFrom(fo); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	mf.Tracks[1].Events = append([]Event{
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0xF8}, Continuation: true},
+		NewRawEvent(0, 0xF4, []byte{0x01, 0x02}),
+		NewRawEvent(0, 0xF9, nil),
+	}, mf.Tracks[1].Events...)
+	mf.Rebuild()
+
+	expected := &bytes.Buffer{}
+	mf.WriteTo(expected)
+
+	data, err := mf.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromProto := &File{}
+	if err := fromProto.FromProto(data); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := &bytes.Buffer{}
+	fromProto.WriteTo(actual)
+
+	if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+		t.Errorf("expected the protobuf round trip to reproduce the file")
+	}
+
+	eventData, err := EventToProto(NewChannelEvent(96, NoteOn, 9, 36, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := EventFromProto(eventData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e, ok := event.(*ChannelEvent); !ok || e.DeltaTime() != 96 || e.Channel != 9 || e.Value1 != 36 || e.Value2 != 100 {
+		t.Errorf("unexpected event %v", event)
+	}
+
+	if _, err := EventFromProto([]byte{0x10, 0x7F}); err == nil {
+		t.Errorf("expected an error for an unknown event type")
+	}
+}
+
+type sqlStatement struct {
+	query string
+	args  []any
+}
+
+type sqlRecorder struct {
+	statements []sqlStatement
+}
+
+func (r *sqlRecorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	r.statements = append(r.statements, sqlStatement{query: query, args: args})
+	return nil, nil
+}
+
+func (r *sqlRecorder) inserts(table string) []sqlStatement {
+	statements := []sqlStatement{}
+	for _, statement := range r.statements {
+		if strings.HasPrefix(statement.query, "INSERT INTO "+table+" ") {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
+
+func TestExportSQL(t *testing.T) {
+	mf := NewFile()
+	mf.Header = &FileHeader{Format: Format1}
+	mf.Header.SetTicksPerQuarterNote(480)
+
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Bass"))},
+		{Tick: 0, Event: NewMetaEvent(0, SetTempo, []byte{0x07, 0xA1, 0x20})},
+		{Tick: 0, Event: &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0xF8}, Continuation: true}},
+	})
+	track.AddNote(480, 240, 1, 40, 90)
+	mf.Tracks = []*Track{track}
+
+	db := &sqlRecorder{}
+	if err := mf.ExportSQL(context.Background(), db, 7, "bass.mid"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.inserts("files")) != 1 || len(db.inserts("tracks")) != 1 {
+		t.Fatalf("expected one file and one track row")
+	}
+
+	if name := db.inserts("tracks")[0].args[2]; name != "Bass" {
+		t.Errorf("expected track name Bass, got %v", name)
+	}
+
+	events := db.inserts("events")
+	if len(events) != len(track.Events) {
+		t.Fatalf("expected %v event rows, got %v", len(track.Events), len(events))
+	}
+
+	if continuation := events[2].args[11]; continuation != true {
+		t.Errorf("expected the continuation column to be set, got %v", continuation)
+	}
+
+	notes := db.inserts("notes")
+	if len(notes) != 1 {
+		t.Fatalf("expected one note row, got %v", len(notes))
+	}
+
+	// 500000 microseconds per quarter note, start at 1 quarter and end at 1.5 quarters
+	args := notes[0].args
+	if args[3] != uint8(40) || args[6] != uint32(480) || args[7] != uint32(720) || args[8] != 0.5 || args[9] != 0.75 {
+		t.Errorf("unexpected note row %v", args)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	var last, total int64
+
+	progress := func(bytesRead, totalBytes int64) {
+		if bytesRead < last {
+			t.Errorf("expected progress to increase, got %v after %v", bytesRead, last)
+		}
+
+		last, total = bytesRead, totalBytes
+	}
+
+	mf := &File{}
+	if _, err := mf.ReadFromWithOptions(fo, ReadOptions{Progress: progress}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := fo.Stat()
+	if last != info.Size() || total != info.Size() {
+		t.Errorf("expected progress to reach %v, got %v of %v", info.Size(), last, total)
+	}
+
+	last = 0
+	buf := &bytes.Buffer{}
+	if _, err := mf.WriteToWithOptions(buf, WriteOptions{Progress: progress}); err != nil {
+		t.Fatal(err)
+	}
+
+	if last != int64(buf.Len()) || total != int64(buf.Len()) {
+		t.Errorf("expected write progress to reach %v, got %v of %v", buf.Len(), last, total)
+	}
+
+	text := &bytes.Buffer{}
+	mf.WriteText(text)
+
+	last = 0
+	size := int64(text.Len())
+	if err := (&File{}).ReadText(NewProgressReader(text, progress)); err != nil {
+		t.Fatal(err)
+	}
+
+	if last != size || total != size {
+		t.Errorf("expected text progress to reach %v, got %v of %v", size, last, total)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !unix
+
+package midi
+
+import (
+	"os"
+)
+
+// MappedFile is a midi file backed by a read-only memory mapping, on platforms
+// without mmap support the file is read into memory instead
+type MappedFile struct {
+	*File
+}
+
+// OpenMapped reads the midi file at path into memory and parses it
+func OpenMapped(path string) (*MappedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mf := &MappedFile{File: NewFile()}
+
+	_, err = mf.ReadBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// Close is a no-op on platforms without mmap support
+func (mf *MappedFile) Close() error {
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package midi
+
+import (
+	"os"
+	"syscall"
+)
+
+// MappedFile is a midi file backed by a read-only memory mapping, the raw chunk data
+// references the mapping directly and is only valid until Close is called
+type MappedFile struct {
+	*File
+	data []byte
+}
+
+// OpenMapped maps the midi file at path into memory and parses it, paging is left to the OS
+func OpenMapped(path string) (*MappedFile, error) {
+	fo, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer fo.Close()
+
+	info, err := fo.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	mf := &MappedFile{File: NewFile()}
+
+	if info.Size() > 0 {
+		mf.data, err = syscall.Mmap(int(fo.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = mf.ReadBytes(mf.data)
+	if err != nil {
+		mf.Close()
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// Close releases the memory mapping, parsed tracks stay valid but chunk data does not
+func (mf *MappedFile) Close() error {
+	if mf.data == nil {
+		return nil
+	}
+
+	data := mf.data
+	mf.data = nil
+
+	return syscall.Munmap(data)
+}
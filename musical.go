@@ -0,0 +1,98 @@
+package midi
+
+import (
+	"math"
+)
+
+// Duration is a musical note length expressed in whole notes
+type Duration float64
+
+const (
+	// Whole note
+	Whole Duration = 1
+	// Half note
+	Half Duration = 1.0 / 2
+	// Quarter note
+	Quarter Duration = 1.0 / 4
+	// Eighth note
+	Eighth Duration = 1.0 / 8
+	// Sixteenth note
+	Sixteenth Duration = 1.0 / 16
+	// ThirtySecond note
+	ThirtySecond Duration = 1.0 / 32
+)
+
+// Dotted returns the dotted duration (one and a half times as long)
+func (d Duration) Dotted() Duration {
+	return d * 3 / 2
+}
+
+// Triplet returns the triplet duration (two thirds as long)
+func (d Duration) Triplet() Duration {
+	return d * 2 / 3
+}
+
+// Ticks converts the duration to ticks
+func (d Duration) Ticks(ticksPerQuarterNote uint16) uint32 {
+	return uint32(math.Round(float64(d) * 4 * float64(ticksPerQuarterNote)))
+}
+
+// Position is a musical position in bars, beats and ticks, bars and beats start at 1
+type Position struct {
+	BarNumber  int
+	BeatNumber int
+	TickOffset uint32
+}
+
+// Bar returns the position of the first beat of bar n
+func Bar(n int) Position {
+	return Position{BarNumber: n, BeatNumber: 1}
+}
+
+// Beat returns the position with beat n within the bar
+func (p Position) Beat(n int) Position {
+	p.BeatNumber = n
+	return p
+}
+
+// Tick returns the position with a tick offset from the beat
+func (p Position) Tick(n uint32) Position {
+	p.TickOffset = n
+	return p
+}
+
+// PositionToTick converts a musical position to an absolute tick, the time signature is
+// 4/4 until the first change and changes without a numerator or denominator count as 4/4
+func (m *TimeSigMap) PositionToTick(p Position, ticksPerQuarterNote uint16) uint32 {
+	numerator := uint32(4)
+	denominator := uint32(4)
+	index := 0
+	tick := uint32(0)
+
+	for bar := 1; ; bar++ {
+		// Apply changes at or before the start of this bar
+		for m != nil && index < len(m.Changes) && m.Changes[index].Tick <= tick {
+			numerator = uint32(m.Changes[index].Numerator)
+			denominator = uint32(m.Changes[index].Denominator)
+			index++
+
+			// An invalid time signature would divide by zero, use 4/4 instead
+			if numerator == 0 || denominator == 0 {
+				numerator, denominator = 4, 4
+			}
+		}
+
+		beatTicks := uint32(ticksPerQuarterNote) * 4 / denominator
+
+		if bar >= p.BarNumber {
+			beat := p.BeatNumber
+			if beat < 1 {
+				beat = 1
+			}
+
+			return tick + uint32(beat-1)*beatTicks + p.TickOffset
+		}
+
+		tick += numerator * beatTicks
+	}
+}
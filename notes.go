@@ -0,0 +1,198 @@
+package midi
+
+import (
+	"sort"
+)
+
+// Note is a note on paired with its note off
+type Note struct {
+	// Track index, only set for notes of a file
+	Track       int
+	Channel     uint16
+	Key         uint8
+	Velocity    uint8
+	OffVelocity uint8
+	// Absolute start tick
+	Start uint32
+	// Absolute end tick
+	End uint32
+}
+
+// Duration returns the length of the note in ticks
+func (n Note) Duration() uint32 {
+	return n.End - n.Start
+}
+
+// events returns the note on and note off events of the note at their absolute ticks
+func (n Note) events() (AbsEvent, AbsEvent) {
+	on := AbsEvent{Tick: n.Start, Event: NewChannelEvent(0, NoteOn, n.Channel, uint16(n.Key), uint16(n.Velocity))}
+	off := AbsEvent{Tick: n.End, Event: NewChannelEvent(0, NoteOff, n.Channel, uint16(n.Key), uint16(n.OffVelocity))}
+
+	return on, off
+}
+
+// isNoteOff returns true for note off events and note on events with velocity 0
+func isNoteOff(ce *ChannelEvent) bool {
+	return ce.eventType == NoteOff || (ce.eventType == NoteOn && ce.Value2 == 0)
+}
+
+// Notes pairs the note on and note off events of a track, a note on with velocity 0 counts as
+// note off. Overlapping notes on the same channel and key are paired first in first out, notes
+// without note off end at the last tick of the track. Notes are sorted by start tick
+func (t *Track) Notes() []Note {
+	notes := []Note{}
+	open := map[uint16][]int{}
+	tick := uint32(0)
+
+	for _, event := range t.Events {
+		tick += event.DeltaTime()
+
+		ce, ok := event.(*ChannelEvent)
+		if !ok || (ce.eventType != NoteOn && ce.eventType != NoteOff) {
+			continue
+		}
+
+		id := ce.Channel<<8 | ce.Value1
+
+		if isNoteOff(ce) {
+			if indices := open[id]; len(indices) > 0 {
+				notes[indices[0]].End = tick
+				notes[indices[0]].OffVelocity = uint8(ce.Value2)
+				open[id] = indices[1:]
+			}
+
+			continue
+		}
+
+		open[id] = append(open[id], len(notes))
+		notes = append(notes, Note{
+			Channel:  ce.Channel,
+			Key:      uint8(ce.Value1),
+			Velocity: uint8(ce.Value2),
+			Start:    tick,
+		})
+	}
+
+	for _, indices := range open {
+		for _, index := range indices {
+			notes[index].End = tick
+		}
+	}
+
+	return notes
+}
+
+// Notes pairs the notes of all tracks, notes are sorted by start tick and track
+func (f *File) Notes() []Note {
+	notes := []Note{}
+
+	for index, track := range f.Tracks {
+		for _, note := range track.Notes() {
+			note.Track = index
+			notes = append(notes, note)
+		}
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].Start < notes[j].Start
+	})
+
+	return notes
+}
+
+// ActiveNotesAt returns the notes of all tracks sounding at tick, started at or before tick and
+// ending after it, sorted by start tick
+func (f *File) ActiveNotesAt(tick uint32) []Note {
+	return NewNoteList(f.Notes()).NotesActiveAt(tick)
+}
+
+// NoteList is a sorted list of notes answering time range and key queries
+type NoteList struct {
+	// Notes sorted by start tick
+	notes []Note
+	// Maximum end tick of notes[0:i+1]
+	maxEnd []uint32
+	// Note indices per key
+	keys [128][]int
+}
+
+// NewNoteList creates a note list
+func NewNoteList(notes []Note) *NoteList {
+	l := &NoteList{
+		notes:  make([]Note, len(notes)),
+		maxEnd: make([]uint32, len(notes)),
+	}
+
+	copy(l.notes, notes)
+
+	sort.SliceStable(l.notes, func(i, j int) bool {
+		return l.notes[i].Start < l.notes[j].Start
+	})
+
+	end := uint32(0)
+
+	for index, note := range l.notes {
+		if note.End > end {
+			end = note.End
+		}
+
+		l.maxEnd[index] = end
+		l.keys[note.Key&0x7F] = append(l.keys[note.Key&0x7F], index)
+	}
+
+	return l
+}
+
+// Notes returns all notes sorted by start tick
+func (l *NoteList) Notes() []Note {
+	return l.notes
+}
+
+// overlapping returns the notes starting before end and ending after start, in start order
+func (l *NoteList) overlapping(start, end uint32) []Note {
+	// First note starting at or after end
+	index := sort.Search(len(l.notes), func(i int) bool {
+		return l.notes[i].Start >= end
+	})
+
+	result := []Note{}
+
+	for i := index - 1; i >= 0 && l.maxEnd[i] > start; i-- {
+		if l.notes[i].End > start {
+			result = append(result, l.notes[i])
+		}
+	}
+
+	// Reverse to start order
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result
+}
+
+// NotesActiveAt returns the notes sounding at tick (start <= tick < end)
+func (l *NoteList) NotesActiveAt(tick uint32) []Note {
+	return l.overlapping(tick, tick+1)
+}
+
+// NotesInRange returns the notes overlapping the tick range [a, b)
+func (l *NoteList) NotesInRange(a, b uint32) []Note {
+	if b <= a {
+		return []Note{}
+	}
+
+	return l.overlapping(a, b)
+}
+
+// NotesOnKey returns the notes with key, in start order
+func (l *NoteList) NotesOnKey(key uint8) []Note {
+	indices := l.keys[key&0x7F]
+	result := make([]Note, len(indices))
+
+	for i, index := range indices {
+		result[i] = l.notes[index]
+	}
+
+	return result
+}
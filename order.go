@@ -0,0 +1,126 @@
+package midi
+
+import (
+	"sort"
+)
+
+// OrderPolicy decides the order of events at the same tick
+type OrderPolicy int
+
+const (
+	// OrderByType is the recommended order: meta events, system exclusive and other system
+	// events, control changes, program changes, pitch wheel changes, channel pressure, polyphonic
+	// key pressure, note offs, note ons and finally end of track. Events of the same type keep
+	// their order
+	OrderByType OrderPolicy = iota
+	// OrderPreserve keeps events at the same tick in the order they were added, only end of
+	// track is moved last
+	OrderPreserve
+	// OrderCanonical is OrderByType with channel events of the same type also ordered by channel
+	// and note events by key, so equal content always ends up in the same order
+	OrderCanonical
+)
+
+// orderRank returns the position of an event among events at the same tick for OrderByType
+func orderRank(event Event) int {
+	if isEndOfTrack(event) {
+		return 10
+	}
+
+	switch event.EventType() {
+	case Meta:
+		return 0
+	case ControlChange:
+		return 2
+	case ProgramChange:
+		return 3
+	case PitchWheelChange:
+		return 4
+	case ChannelPressure:
+		return 5
+	case PolyphonicKeyPressure:
+		return 6
+	case NoteOff:
+		return 7
+	case NoteOn:
+		return 8
+	}
+
+	return 1
+}
+
+// Less reports whether a should come before b when both are at the same tick
+func (p OrderPolicy) Less(a, b Event) bool {
+	if p == OrderPreserve {
+		return !isEndOfTrack(a) && isEndOfTrack(b)
+	}
+
+	rankA, rankB := orderRank(a), orderRank(b)
+	if rankA != rankB || p != OrderCanonical {
+		return rankA < rankB
+	}
+
+	ca, okA := a.(*ChannelEvent)
+	cb, okB := b.(*ChannelEvent)
+	if !okA || !okB {
+		return false
+	}
+
+	if ca.Channel != cb.Channel {
+		return ca.Channel < cb.Channel
+	}
+
+	if ca.eventType == NoteOff || ca.eventType == NoteOn {
+		return ca.Value1 < cb.Value1
+	}
+
+	return false
+}
+
+// SortAbsEvents stable sorts events by tick and orders events at the same tick with the policy,
+// e.g. after editing the ticks of AbsEvents before passing them to SetAbsEvents
+func SortAbsEvents(events []AbsEvent, order OrderPolicy) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Tick != events[j].Tick {
+			return events[i].Tick < events[j].Tick
+		}
+
+		return order.Less(events[i].Event, events[j].Event)
+	})
+}
+
+// Sort stable sorts the events of the track with OrderByType
+func (t *Track) Sort() {
+	t.SortWithOrder(OrderByType)
+}
+
+// SortWithOrder stable sorts the events of the track by absolute tick, orders events at the same
+// tick with the policy and rebuilds the delta times. End of track events are replaced by a single
+// end of track at the last tick
+func (t *Track) SortWithOrder(order OrderPolicy) {
+	events := t.AbsEvents()
+	kept := make([]AbsEvent, 0, len(events))
+
+	var endOfTrack *AbsEvent
+
+	for index, ae := range events {
+		if isEndOfTrack(ae.Event) {
+			endOfTrack = &events[index]
+			continue
+		}
+
+		kept = append(kept, ae)
+	}
+
+	SortAbsEvents(kept, order)
+
+	if endOfTrack != nil {
+		if len(kept) > 0 && kept[len(kept)-1].Tick > endOfTrack.Tick {
+			endOfTrack.Tick = kept[len(kept)-1].Tick
+		}
+
+		kept = append(kept, *endOfTrack)
+	}
+
+	t.SetAbsEvents(kept)
+}
@@ -0,0 +1,408 @@
+package midi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Controller numbers of bank select and the channel mode messages used to reset a channel
+const (
+	ControllerBankSelectMSB       uint16 = 0
+	ControllerBankSelectLSB       uint16 = 32
+	ControllerResetAllControllers uint16 = 121
+	ControllerAllNotesOff         uint16 = 123
+)
+
+// BankNumber combines the bank select MSB and LSB in a 14 bit bank number
+func BankNumber(msb, lsb uint8) uint16 {
+	return uint16(msb&0x7F)<<7 | uint16(lsb&0x7F)
+}
+
+// Patch is a named program in a bank
+type Patch struct {
+	// Bank is the 14 bit bank number, see BankNumber
+	Bank    uint16 `json:"bank"`
+	Program uint8  `json:"program"`
+	Name    string `json:"name"`
+}
+
+// PatchMap maps banks and programs of a device to patch names
+type PatchMap struct {
+	Device  string  `json:"device,omitempty"`
+	Patches []Patch `json:"patches"`
+}
+
+// ReadPatchMap reads a patch map in text form, one patch per line with the bank, program and
+// name separated by white space. The bank is a 14 bit number or MSB:LSB. Blank lines and lines
+// starting with '#' are ignored, a line "device <name>" sets the device of the map:
+//
+//	device General MIDI
+//	0 0 Acoustic Grand Piano
+//	121:1 0 Wide Acoustic Grand
+func ReadPatchMap(r io.Reader) (*PatchMap, error) {
+	m := &PatchMap{Patches: []Patch{}}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if fields[0] == "device" {
+			m.Device = strings.TrimSpace(strings.TrimPrefix(line, "device"))
+			continue
+		}
+
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %v: expected bank, program and name", lineNumber)
+		}
+
+		bank, err := parsePatchBank(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+
+		program, err := strconv.ParseUint(fields[1], 10, 7)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid program %v", lineNumber, fields[1])
+		}
+
+		m.Patches = append(m.Patches, Patch{Bank: bank, Program: uint8(program), Name: strings.Join(fields[2:], " ")})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// parsePatchBank parses a 14 bit bank number or MSB:LSB
+func parsePatchBank(s string) (uint16, error) {
+	if msb, lsb, ok := strings.Cut(s, ":"); ok {
+		m, err1 := strconv.ParseUint(msb, 10, 7)
+		l, err2 := strconv.ParseUint(lsb, 10, 7)
+		if err1 != nil || err2 != nil {
+			return 0, fmt.Errorf("invalid bank %v", s)
+		}
+
+		return BankNumber(uint8(m), uint8(l)), nil
+	}
+
+	bank, err := strconv.ParseUint(s, 10, 14)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bank %v", s)
+	}
+
+	return uint16(bank), nil
+}
+
+// ReadPatchMapJSON reads a patch map in JSON form
+func ReadPatchMapJSON(r io.Reader) (*PatchMap, error) {
+	m := &PatchMap{}
+
+	err := json.NewDecoder(r).Decode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, patch := range m.Patches {
+		if patch.Bank > 0x3FFF || patch.Program > 0x7F {
+			return nil, fmt.Errorf("patch %v: bank %v or program %v out of range", patch.Name, patch.Bank, patch.Program)
+		}
+	}
+
+	return m, nil
+}
+
+// Name returns the name of a program in a bank, if the bank is not in the map the name of the
+// program in bank 0 is returned
+func (m *PatchMap) Name(bank uint16, program uint8) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+
+	fallback := ""
+	found := false
+
+	for _, patch := range m.Patches {
+		if patch.Program != program {
+			continue
+		}
+
+		if patch.Bank == bank {
+			return patch.Name, true
+		}
+
+		if patch.Bank == 0 {
+			fallback, found = patch.Name, true
+		}
+	}
+
+	return fallback, found
+}
+
+// Lookup returns the first patch with the given name, names are compared case insensitively
+func (m *PatchMap) Lookup(name string) (Patch, bool) {
+	if m == nil {
+		return Patch{}, false
+	}
+
+	for _, patch := range m.Patches {
+		if strings.EqualFold(patch.Name, name) {
+			return patch, true
+		}
+	}
+
+	return Patch{}, false
+}
+
+// PatchChange is a program change with the bank selected on its channel at that moment
+type PatchChange struct {
+	Tick    uint32
+	Channel uint16
+	Bank    uint16
+	Program uint8
+}
+
+// PatchChanges returns the program changes of the track with the bank selected by the preceding
+// bank select controllers on the same channel
+func (t *Track) PatchChanges() []PatchChange {
+	changes := []PatchChange{}
+	msb := [16]uint8{}
+	lsb := [16]uint8{}
+	tick := uint32(0)
+
+	for _, event := range t.Events {
+		tick += event.DeltaTime()
+
+		ce, ok := event.(*ChannelEvent)
+		if !ok || ce.Channel > 15 {
+			continue
+		}
+
+		switch {
+		case ce.eventType == ControlChange && ce.Value1 == ControllerBankSelectMSB:
+			msb[ce.Channel] = uint8(ce.Value2)
+		case ce.eventType == ControlChange && ce.Value1 == ControllerBankSelectLSB:
+			lsb[ce.Channel] = uint8(ce.Value2)
+		case ce.eventType == ProgramChange:
+			changes = append(changes, PatchChange{
+				Tick:    tick,
+				Channel: ce.Channel,
+				Bank:    BankNumber(msb[ce.Channel], lsb[ce.Channel]),
+				Program: uint8(ce.Value1),
+			})
+		}
+	}
+
+	return changes
+}
+
+// gmProgramNames holds the General MIDI level 1 instrument names by program
+var gmProgramNames = [128]string{
+	"Acoustic Grand Piano", "Bright Acoustic Piano", "Electric Grand Piano", "Honky-tonk Piano",
+	"Electric Piano 1", "Electric Piano 2", "Harpsichord", "Clavi",
+	"Celesta", "Glockenspiel", "Music Box", "Vibraphone",
+	"Marimba", "Xylophone", "Tubular Bells", "Dulcimer",
+	"Drawbar Organ", "Percussive Organ", "Rock Organ", "Church Organ",
+	"Reed Organ", "Accordion", "Harmonica", "Tango Accordion",
+	"Acoustic Guitar (nylon)", "Acoustic Guitar (steel)", "Electric Guitar (jazz)", "Electric Guitar (clean)",
+	"Electric Guitar (muted)", "Overdriven Guitar", "Distortion Guitar", "Guitar Harmonics",
+	"Acoustic Bass", "Electric Bass (finger)", "Electric Bass (pick)", "Fretless Bass",
+	"Slap Bass 1", "Slap Bass 2", "Synth Bass 1", "Synth Bass 2",
+	"Violin", "Viola", "Cello", "Contrabass",
+	"Tremolo Strings", "Pizzicato Strings", "Orchestral Harp", "Timpani",
+	"String Ensemble 1", "String Ensemble 2", "Synth Strings 1", "Synth Strings 2",
+	"Choir Aahs", "Voice Oohs", "Synth Voice", "Orchestra Hit",
+	"Trumpet", "Trombone", "Tuba", "Muted Trumpet",
+	"French Horn", "Brass Section", "Synth Brass 1", "Synth Brass 2",
+	"Soprano Sax", "Alto Sax", "Tenor Sax", "Baritone Sax",
+	"Oboe", "English Horn", "Bassoon", "Clarinet",
+	"Piccolo", "Flute", "Recorder", "Pan Flute",
+	"Blown Bottle", "Shakuhachi", "Whistle", "Ocarina",
+	"Lead 1 (square)", "Lead 2 (sawtooth)", "Lead 3 (calliope)", "Lead 4 (chiff)",
+	"Lead 5 (charang)", "Lead 6 (voice)", "Lead 7 (fifths)", "Lead 8 (bass + lead)",
+	"Pad 1 (new age)", "Pad 2 (warm)", "Pad 3 (polysynth)", "Pad 4 (choir)",
+	"Pad 5 (bowed)", "Pad 6 (metallic)", "Pad 7 (halo)", "Pad 8 (sweep)",
+	"FX 1 (rain)", "FX 2 (soundtrack)", "FX 3 (crystal)", "FX 4 (atmosphere)",
+	"FX 5 (brightness)", "FX 6 (goblins)", "FX 7 (echoes)", "FX 8 (sci-fi)",
+	"Sitar", "Banjo", "Shamisen", "Koto",
+	"Kalimba", "Bag pipe", "Fiddle", "Shanai",
+	"Tinkle Bell", "Agogo", "Steel Drums", "Woodblock",
+	"Taiko Drum", "Melodic Tom", "Synth Drum", "Reverse Cymbal",
+	"Guitar Fret Noise", "Breath Noise", "Seashore", "Bird Tweet",
+	"Telephone Ring", "Helicopter", "Applause", "Gunshot",
+}
+
+// GMProgramName returns the General MIDI instrument name of program (0-127), or an empty string
+// for programs out of range
+func GMProgramName(program uint8) string {
+	if program > 127 {
+		return ""
+	}
+
+	return gmProgramNames[program]
+}
+
+// isInstrumentEvent returns true for the bank select, program change and instrument name events
+// replaced by SetInstrument
+func isInstrumentEvent(event Event, channel uint16) bool {
+	switch e := event.(type) {
+	case *MetaEvent:
+		return e.MetaType == InstrumentName
+	case *ChannelEvent:
+		if e.Channel != channel {
+			return false
+		}
+
+		return e.eventType == ProgramChange ||
+			(e.eventType == ControlChange && (e.Value1 == ControllerBankSelectMSB || e.Value1 == ControllerBankSelectLSB))
+	}
+
+	return false
+}
+
+// SetInstrument assigns an instrument to the track, bank select MSB and LSB, a program change and
+// an instrument name with the General MIDI name of the program are set at tick 0 on the channel
+// of the first channel event of the track, channel 0 if it has none. Existing instrument events
+// at tick 0 are replaced, the new events follow the meta events at tick 0 so a track name stays
+// first
+func (t *Track) SetInstrument(bankMSB, bankLSB, program uint8) {
+	events := t.AbsEvents()
+	channel := uint16(0)
+
+	for _, ae := range events {
+		if ce, ok := ae.Event.(*ChannelEvent); ok {
+			channel = ce.Channel
+			break
+		}
+	}
+
+	kept := make([]AbsEvent, 0, len(events)+4)
+	for _, ae := range events {
+		if ae.Tick != 0 || !isInstrumentEvent(ae.Event, channel) {
+			kept = append(kept, ae)
+		}
+	}
+
+	index := 0
+	for index < len(kept) && kept[index].Tick == 0 && kept[index].Event.EventType() == Meta && !isEndOfTrack(kept[index].Event) {
+		index++
+	}
+
+	instrument := []AbsEvent{
+		{Tick: 0, Event: NewMetaEvent(0, InstrumentName, []byte(GMProgramName(program)))},
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, channel, ControllerBankSelectMSB, uint16(bankMSB&0x7F))},
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, channel, ControllerBankSelectLSB, uint16(bankLSB&0x7F))},
+		{Tick: 0, Event: NewChannelEvent(0, ProgramChange, channel, uint16(program&0x7F), 0)},
+	}
+
+	kept = append(kept[:index], append(instrument, kept[index:]...)...)
+
+	t.SetAbsEvents(kept)
+}
+
+// PatchUsage is a bank and program combination selected on a channel of a file
+type PatchUsage struct {
+	Channel uint16
+	// Bank is the 14 bit bank number, 0 if no bank was selected
+	Bank    uint16
+	Program uint16
+	// Count is the number of program changes selecting the combination
+	Count int
+	// Track and Tick of the first program change selecting the combination
+	Track int
+	Tick  uint32
+	// OutsideGM is true for programs over 127 and banks other than 0, General MIDI players
+	// ignore bank selects and play such a patch with another sound. The drum channel is never
+	// flagged for its bank
+	OutsideGM bool
+	// MissingBankSelect is true if a program change of the combination was not preceded by a bank
+	// select on its channel, the sound then depends on the bank the receiver was left in
+	MissingBankSelect bool
+}
+
+// PatchUsage lists every channel, bank and program combination the program changes of the file
+// select, sorted by channel, bank and program. Bank selects and program changes are followed in
+// time order over all tracks, since tracks share the channels of a port
+func (f *File) PatchUsage() []PatchUsage {
+	type patchKey struct {
+		channel uint16
+		bank    uint16
+		program uint16
+	}
+
+	usage := map[patchKey]*PatchUsage{}
+	msb := map[uint16]uint8{}
+	lsb := map[uint16]uint8{}
+	selected := map[uint16]bool{}
+
+	it := NewEventIterator(f, false)
+
+	for it.Next() {
+		ce, ok := it.Event().(*ChannelEvent)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case ce.eventType == ControlChange && ce.Value1 == ControllerBankSelectMSB:
+			msb[ce.Channel] = uint8(ce.Value2)
+			selected[ce.Channel] = true
+		case ce.eventType == ControlChange && ce.Value1 == ControllerBankSelectLSB:
+			lsb[ce.Channel] = uint8(ce.Value2)
+			selected[ce.Channel] = true
+		case ce.eventType == ProgramChange:
+			key := patchKey{channel: ce.Channel, bank: BankNumber(msb[ce.Channel], lsb[ce.Channel]), program: ce.Value1}
+
+			u, ok := usage[key]
+			if !ok {
+				u = &PatchUsage{
+					Channel:   key.channel,
+					Bank:      key.bank,
+					Program:   key.program,
+					Track:     it.Track(),
+					Tick:      it.Tick(),
+					OutsideGM: key.program > 127 || (key.bank != 0 && key.channel != GMDrumChannel),
+				}
+
+				usage[key] = u
+			}
+
+			u.Count++
+			u.MissingBankSelect = u.MissingBankSelect || !selected[ce.Channel]
+		}
+	}
+
+	result := make([]PatchUsage, 0, len(usage))
+	for _, u := range usage {
+		result = append(result, *u)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+
+		if a.Bank != b.Bank {
+			return a.Bank < b.Bank
+		}
+
+		return a.Program < b.Program
+	})
+
+	return result
+}
@@ -0,0 +1,485 @@
+package midi
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// FlushMode selects how the player ends the notes still sounding when playback stops
+type FlushMode int
+
+const (
+	// FlushNoteOffs sends a note off for every sounding note
+	FlushNoteOffs FlushMode = iota
+	// FlushAllNotesOff sends an all notes off controller on every channel with sounding notes
+	FlushAllNotesOff
+	// FlushNone leaves sounding notes alone
+	FlushNone
+)
+
+// TimedEventSink is an event sink that accepts the time an event should sound, the player
+// dispatches events to timed sinks ahead of time when a lookahead is configured
+type TimedEventSink interface {
+	EventSink
+	HandleTimedEvent(at time.Time, track int, tick uint32, event Event) error
+}
+
+// targetTimeForwarder is implemented by timed sinks wrapping other sinks, they only take events
+// ahead of time if the wrapped sinks accept target times
+type targetTimeForwarder interface {
+	acceptsTargetTimes() bool
+}
+
+// acceptsTargetTimes returns true if sink is a TimedEventSink and every sink it forwards events
+// to accepts target times
+func acceptsTargetTimes(sink EventSink) bool {
+	if _, ok := sink.(TimedEventSink); !ok {
+		return false
+	}
+
+	if forwarder, ok := sink.(targetTimeForwarder); ok {
+		return forwarder.acceptsTargetTimes()
+	}
+
+	return true
+}
+
+// Player plays the events of a file to a sink in real time
+type Player struct {
+	// Sink receives the events of all tracks
+	Sink EventSink
+	// Lookahead dispatches events to a TimedEventSink this much earlier than their target time,
+	// so sinks backed by audio callbacks or drivers can schedule them precisely
+	Lookahead time.Duration
+	// Clock the player follows, the system timer if nil. An OfflineClock plays without waiting
+	Clock Clock
+	// CountIn is the number of bars clicked before the file starts, at the tempo and time
+	// signature of the start of the file, files with a SMPTE division have no count-in
+	CountIn int
+	// Metronome generates the count-in clicks and clicks along with the file while enabled, a
+	// default metronome is used for the count-in if nil
+	Metronome *Metronome
+	// MetronomeSink receives the metronome clicks, Sink if nil
+	MetronomeSink EventSink
+	// StartTick is the tick playback starts at, the channel state at StartTick is chased first
+	// so playback sounds as if the file was played from the start
+	StartTick uint32
+	// Flush selects how notes still sounding are ended when playback stops because the context
+	// is done or the file ended, so hardware is not left with stuck notes when seeking
+	Flush FlushMode
+
+	file *File
+}
+
+// NewPlayer creates a new player for a file
+func NewPlayer(f *File, sink EventSink) *Player {
+	return &Player{
+		Sink: sink,
+		file: f,
+	}
+}
+
+// dispatch hands an event to a sink, with its target time if the sink accepts it
+func dispatch(sink EventSink, at time.Time, track int, tick uint32, event Event) error {
+	if timed, ok := sink.(TimedEventSink); ok {
+		return timed.HandleTimedEvent(at, track, tick, event)
+	}
+
+	return sink.HandleEvent(track, tick, event)
+}
+
+// sleepUntil waits until t or until the context is done
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// wallTime returns the wall clock time of song time d, exact for clocks that know their wall
+// clock start and estimated from the current song time for others
+func wallTime(clock Clock, d time.Duration) time.Time {
+	if wc, ok := clock.(interface{ WallTime(time.Duration) time.Time }); ok {
+		return wc.WallTime(d)
+	}
+
+	return time.Now().Add(d - clock.Now())
+}
+
+// clock returns the clock of the player
+func (p *Player) clock() Clock {
+	if p.Clock == nil {
+		p.Clock = NewInternalClock()
+	}
+
+	return p.Clock
+}
+
+// lookahead returns the lookahead for sink, 0 if the sink or a sink it wraps does not accept
+// target times
+func (p *Player) lookahead(sink EventSink) time.Duration {
+	if acceptsTargetTimes(sink) {
+		return p.Lookahead
+	}
+
+	return 0
+}
+
+// metronomeSink returns the sink of the metronome clicks
+func (p *Player) metronomeSink() EventSink {
+	if p.MetronomeSink == nil {
+		return p.Sink
+	}
+
+	return p.MetronomeSink
+}
+
+// click dispatches a metronome click at song time d
+func (p *Player) click(ctx context.Context, clock Clock, d time.Duration, ae AbsEvent) error {
+	sink := p.metronomeSink()
+
+	err := clock.WaitUntil(ctx, d-p.lookahead(sink))
+	if err != nil {
+		return err
+	}
+
+	return dispatch(sink, wallTime(clock, d), MetronomeTrack, ae.Tick, ae.Event)
+}
+
+// playCountIn dispatches the count-in clicks and returns the length of the count-in
+func (p *Player) playCountIn(ctx context.Context, clock Clock, tempoMap *TempoMap, timeSigMap *TimeSigMap) (time.Duration, error) {
+	if p.CountIn <= 0 {
+		return 0, nil
+	}
+
+	metronome := p.Metronome
+	if metronome == nil {
+		metronome = NewMetronome()
+	}
+
+	clicks, times, length := metronome.countIn(p.CountIn, timeSigMap.At(p.StartTick), tempoMap.TempoAt(p.StartTick), tempoMap.TicksPerQuarterNote)
+
+	for index, ae := range clicks {
+		err := p.click(ctx, clock, times[index], ae)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return length, nil
+}
+
+// endTick returns the last tick of the longest track of the file
+func (f *File) endTick() uint32 {
+	end := uint32(0)
+
+	for _, track := range f.Tracks {
+		tick := uint32(0)
+		for _, event := range track.Events {
+			tick += event.DeltaTime()
+		}
+
+		if tick > end {
+			end = tick
+		}
+	}
+
+	return end
+}
+
+// soundingNote identifies a note started by the player
+type soundingNote struct {
+	track   int
+	channel uint16
+	key     uint16
+}
+
+// noteTracker counts the notes started by the player that were not ended yet
+type noteTracker struct {
+	notes map[soundingNote]int
+	tick  uint32
+}
+
+// update counts the note on and note off events dispatched at tick
+func (t *noteTracker) update(track int, tick uint32, event Event) {
+	t.tick = tick
+
+	ce, ok := event.(*ChannelEvent)
+	if !ok || (ce.eventType != NoteOn && ce.eventType != NoteOff) {
+		return
+	}
+
+	note := soundingNote{track: track, channel: ce.Channel, key: ce.Value1}
+
+	if !isNoteOff(ce) {
+		t.notes[note]++
+	} else if t.notes[note] > 0 {
+		t.notes[note]--
+	}
+}
+
+// flush dispatches the events ending the sounding notes right away
+func (p *Player) flush(clock Clock, tracker *noteTracker) error {
+	if p.Flush == FlushNone {
+		return nil
+	}
+
+	notes := []soundingNote{}
+	for note, count := range tracker.notes {
+		for ; count > 0; count-- {
+			notes = append(notes, note)
+		}
+	}
+
+	sort.Slice(notes, func(i, j int) bool {
+		a, b := notes[i], notes[j]
+		if a.track != b.track {
+			return a.track < b.track
+		}
+
+		if a.channel != b.channel {
+			return a.channel < b.channel
+		}
+
+		return a.key < b.key
+	})
+
+	at := wallTime(clock, clock.Now())
+	flushed := map[uint16]bool{}
+
+	for _, note := range notes {
+		event := NewChannelEvent(0, NoteOff, note.channel, note.key, 0)
+
+		if p.Flush == FlushAllNotesOff {
+			if flushed[note.channel] {
+				continue
+			}
+
+			flushed[note.channel] = true
+			event = NewChannelEvent(0, ControlChange, note.channel, ControllerAllNotesOff, 0)
+		}
+
+		err := dispatch(p.Sink, at, note.track, tracker.tick, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	tracker.notes = map[soundingNote]int{}
+
+	return nil
+}
+
+// locatingClock is implemented by clocks whose song position can jump, like a MIDIClock
+// following a song position pointer. The number of jumps changes on every jump
+type locatingClock interface {
+	location() (tick uint32, jumps uint64)
+}
+
+// chase dispatches the events restoring the channel state at tick at song time d
+func (p *Player) chase(ctx context.Context, clock Clock, d time.Duration, tick uint32) error {
+	err := clock.WaitUntil(ctx, d-p.lookahead(p.Sink))
+	if err != nil {
+		return err
+	}
+
+	state := StateAt(p.file, tick)
+
+	for channel := range state.Channels {
+		values := &state.Channels[channel]
+
+		for _, event := range values.Events(uint16(channel)) {
+			err := dispatch(p.Sink, wallTime(clock, d), values.Track, tick, event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Play plays the file from StartTick after the count-in and blocks until all events were
+// dispatched, the context is done or the sink returns an error. Target times are derived from
+// the clock so sleep jitter does not accumulate. Notes still sounding when playback stops are
+// ended as selected by Flush, unless the sink returned an error. When a MIDIClock moves to a
+// song position pointer on continue, sounding notes are ended and playback restarts at the new
+// position after chasing the channel state there
+func (p *Player) Play(ctx context.Context) (err error) {
+	it := NewEventIterator(p.file, true)
+	clock := p.clock()
+	clock.Start()
+
+	tempoMap, timeSigMap, _ := ExtractTempoMap(p.file)
+
+	countIn, err := p.playCountIn(ctx, clock, tempoMap, timeSigMap)
+	if err != nil {
+		return err
+	}
+
+	// Song time is shifted so the start tick sounds right after the count-in
+	start := tempoMap.TickToDuration(p.StartTick)
+	offset := countIn - start
+
+	var allClicks []AbsEvent
+	if p.Metronome != nil {
+		allClicks = p.Metronome.clicksUntil(timeSigMap, tempoMap.TicksPerQuarterNote, p.file.endTick())
+	}
+
+	clicks := allClicks
+	for len(clicks) > 0 && clicks[0].Tick < p.StartTick {
+		clicks = clicks[1:]
+	}
+
+	cursor := newTempoCursor(tempoMap)
+	lookahead := p.lookahead(p.Sink)
+	sounding := 0
+	startTick := p.StartTick
+	tracker := &noteTracker{notes: map[soundingNote]int{}, tick: startTick}
+
+	defer func() {
+		if err == nil || ctx.Err() != nil {
+			flushErr := p.flush(clock, tracker)
+			if err == nil {
+				err = flushErr
+			}
+		}
+	}()
+
+	if startTick > 0 {
+		err := p.chase(ctx, clock, countIn, startTick)
+		if err != nil {
+			return err
+		}
+	}
+
+	locating, _ := clock.(locatingClock)
+
+	jumps := uint64(0)
+	if locating != nil {
+		_, jumps = locating.location()
+	}
+
+	// relocate restarts playback at tick, which sounds at the current song time
+	relocate := func(tick uint32) error {
+		err := p.flush(clock, tracker)
+		if err != nil {
+			return err
+		}
+
+		// End sounding clicks right away
+		for _, ae := range clicks {
+			if sounding == 0 {
+				break
+			}
+
+			if ae.Event.EventType() == NoteOff {
+				sounding--
+
+				err := dispatch(p.metronomeSink(), wallTime(clock, clock.Now()), MetronomeTrack, ae.Tick, ae.Event)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		clicks = allClicks
+		for len(clicks) > 0 && clicks[0].Tick < tick {
+			clicks = clicks[1:]
+		}
+
+		it = NewEventIterator(p.file, true)
+		cursor = newTempoCursor(tempoMap)
+		startTick = tick
+		tracker.tick = tick
+		offset = clock.Now() - tempoMap.TickToDuration(tick)
+
+		return p.chase(ctx, clock, clock.Now(), tick)
+	}
+
+	for it.Next() {
+		if it.Tick() < startTick {
+			continue
+		}
+
+		// Clicks are generated for the whole file and skipped while the metronome is disabled,
+		// note offs of sounding clicks are always sent
+		for len(clicks) > 0 && clicks[0].Tick <= it.Tick() {
+			ae := clicks[0]
+			clicks = clicks[1:]
+
+			if ae.Event.EventType() == NoteOff {
+				if sounding == 0 {
+					continue
+				}
+
+				sounding--
+			} else if p.Metronome.Enabled() {
+				sounding++
+			} else {
+				continue
+			}
+
+			err := p.click(ctx, clock, offset+cursor.timeAt(ae.Tick), ae)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := clock.WaitUntil(ctx, offset+it.Time()-lookahead)
+		if err != nil {
+			return err
+		}
+
+		if locating != nil {
+			if tick, n := locating.location(); n != jumps {
+				jumps = n
+
+				err := relocate(tick)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		target := wallTime(clock, offset+it.Time())
+
+		err = dispatch(p.Sink, target, it.Track(), it.Tick(), it.Event())
+		if err != nil {
+			return err
+		}
+
+		tracker.update(it.Track(), it.Tick(), it.Event())
+	}
+
+	// End the clicks still sounding at the end of the file
+	for _, ae := range clicks {
+		if sounding == 0 {
+			break
+		}
+
+		if ae.Event.EventType() == NoteOff {
+			sounding--
+
+			err := p.click(ctx, clock, offset+cursor.timeAt(ae.Tick), ae)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,588 @@
+package midi
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+type timedRecorder struct {
+	events  []Event
+	targets []time.Time
+	early   []time.Duration
+}
+
+func (r *timedRecorder) HandleEvent(track int, tick uint32, event Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *timedRecorder) HandleTimedEvent(at time.Time, track int, tick uint32, event Event) error {
+	r.events = append(r.events, event)
+	r.targets = append(r.targets, at)
+	r.early = append(r.early, time.Until(at))
+	return nil
+}
+
+func newTestFile() *File {
+	b := NewTrackBuilder(480)
+	b.AddNote(Bar(1), Sixteenth, 60, 100)
+	b.AddNote(Bar(1).Beat(2), Sixteenth, 62, 100)
+
+	conductor := BuildConductorTrack(NewTempoMap(480, []TempoChange{{Tick: 0, MicrosecondsPerQuarterNote: 50000}}), nil, nil)
+
+	return newFileWithTracks(Format1, 480, []*Track{conductor, b.Build()})
+}
+
+func TestPlayerLookahead(t *testing.T) {
+	sink := &timedRecorder{}
+	p := NewPlayer(newTestFile(), sink)
+	p.Lookahead = 20 * time.Millisecond
+
+	err := p.Play(context.Background())
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if len(sink.targets) != 7 {
+		t.Fatalf("expected 7 events, got %v", len(sink.targets))
+	}
+
+	// Second note on is one quarter note (50ms) after the first event
+	if d := sink.targets[4].Sub(sink.targets[0]); d != 50*time.Millisecond {
+		t.Errorf("expected target 50ms after start, got %v", d)
+	}
+
+	if sink.early[4] <= 0 {
+		t.Errorf("expected event to be dispatched before its target time")
+	}
+}
+
+func TestPlayerSampleClock(t *testing.T) {
+	sink := &timedRecorder{}
+	clock := NewSampleClock(1000)
+
+	p := NewPlayer(newTestFile(), EventSinkFunc(sink.HandleEvent))
+	p.Clock = clock
+
+	done := make(chan error)
+	go func() {
+		done <- p.Play(context.Background())
+	}()
+
+	// Advance in audio buffer sized steps until playback finished
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("err %v", err)
+			}
+
+			if len(sink.events) != 7 {
+				t.Errorf("expected 7 events, got %v", len(sink.events))
+			}
+
+			if clock.Now() < 50*time.Millisecond {
+				t.Errorf("expected playback to follow the sample clock, finished at %v", clock.Now())
+			}
+
+			return
+		case <-time.After(time.Millisecond):
+			clock.Advance(16)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	a := &timedRecorder{}
+	b := &timedRecorder{}
+
+	router := NewRouter()
+	router.AddPort("a", EventSinkFunc(a.HandleEvent))
+	router.AddPort("b", b)
+
+	if err := router.AddRoute(Route{Track: 1, Channel: 0, Port: "a", RemapChannel: 5}); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if err := router.AddRoute(Route{Track: AllTracks, Channel: AllChannels, Port: "b", RemapChannel: KeepChannel}); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	for _, channel := range []int{-2, 16} {
+		if err := router.AddRoute(Route{Track: AllTracks, Channel: AllChannels, Port: "b", RemapChannel: channel}); err == nil {
+			t.Errorf("expected remap channel %v to be rejected", channel)
+		}
+	}
+
+	f := newTestFile()
+
+	p := NewPlayer(f, router)
+	p.Lookahead = 10 * time.Millisecond
+
+	if err := p.Play(context.Background()); err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if len(a.events) != 4 || len(b.events) != 7 || len(b.targets) != 7 {
+		t.Fatalf("unexpected routed event counts %v and %v", len(a.events), len(b.events))
+	}
+
+	if ce := a.events[0].(*ChannelEvent); ce.Channel != 5 {
+		t.Errorf("expected remapped channel 5, got %v", ce.Channel)
+	}
+
+	if ce := f.Tracks[1].Events[0].(*ChannelEvent); ce.Channel != 0 {
+		t.Errorf("expected file events to be unchanged")
+	}
+
+	// Port a does not accept target times and would get its events early
+	for _, early := range b.early {
+		if early > time.Millisecond {
+			t.Errorf("expected no lookahead with a plain port, got an event %v early", early)
+			break
+		}
+	}
+
+	timed := NewRouter()
+	timed.AddPort("b", b)
+
+	if p.lookahead(router) != 0 || p.lookahead(timed) != p.Lookahead {
+		t.Errorf("expected the lookahead to apply only to routers with timed ports")
+	}
+}
+
+type sliceSource struct {
+	events []Event
+}
+
+func (s *sliceSource) ReadEvent() (Event, error) {
+	if len(s.events) == 0 {
+		return nil, io.EOF
+	}
+
+	event := s.events[0]
+	s.events = s.events[1:]
+
+	return event, nil
+}
+
+func TestFilters(t *testing.T) {
+	events := []Event{
+		NewChannelEvent(0, NoteOn, 1, 60, 100),
+		ActiveSensingEvent,
+		NewChannelEvent(0, NoteOn, 3, 60, 100),
+		TimingClockEvent,
+	}
+
+	source := FilterSource(&sliceSource{events: events}, OnlyChannels(1, 2), DropActiveSensing())
+	r := &timedRecorder{}
+	sink := FilterSink(r, DropTimingClock())
+
+	for {
+		event, err := source.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+
+		sink.HandleEvent(0, 0, event)
+	}
+
+	if len(r.events) != 1 || r.events[0] != events[0] {
+		t.Errorf("expected only the first event to pass, got %v", r.events)
+	}
+
+	p := &Player{Lookahead: 10 * time.Millisecond}
+	if p.lookahead(sink) != p.Lookahead || p.lookahead(FilterSink(EventSinkFunc(r.HandleEvent))) != 0 {
+		t.Errorf("expected the lookahead to apply only to filters of timed sinks")
+	}
+}
+
+func TestStream(t *testing.T) {
+	lost := make(chan struct{}, 1)
+
+	source := &sliceSource{events: []Event{
+		ActiveSensingEvent,
+		TimingClockEvent,
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		ActiveSensingEvent,
+	}}
+
+	stream := NewStream(source, StreamOptions{
+		DropActiveSensing: true,
+		DropTimingClock:   true,
+		SensingTimeout:    20 * time.Millisecond,
+		OnSensingLost:     func() { lost <- struct{}{} },
+	})
+
+	defer stream.Close()
+
+	events := []Event{}
+	for {
+		event, err := stream.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+
+		events = append(events, event)
+	}
+
+	if len(events) != 1 || events[0].EventType() != NoteOn {
+		t.Errorf("expected only the note on to pass, got %v", events)
+	}
+
+	if stream.SensingLost() {
+		t.Errorf("expected sensing not to be lost yet")
+	}
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("expected sensing to be lost")
+	}
+
+	if !stream.SensingLost() {
+		t.Errorf("expected sensing to be reported lost")
+	}
+}
+
+func TestPlayerCountIn(t *testing.T) {
+	f := newTestFile()
+	clicks := &timedRecorder{}
+	r := &timedRecorder{}
+
+	p := NewPlayer(f, r)
+	p.CountIn = 1
+	p.MetronomeSink = clicks
+
+	start := time.Now()
+
+	if err := p.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 4/4 at 50000 µs per quarter note
+	if len(clicks.events) != 8 {
+		t.Errorf("expected 8 click events, got %d", len(clicks.events))
+	}
+
+	if len(r.events) != 7 {
+		t.Errorf("expected 7 events, got %d", len(r.events))
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected the count-in to take 200ms, took %v", elapsed)
+	}
+}
+
+func TestPlayerMetronome(t *testing.T) {
+	f := newTestFile()
+	clicks := &timedRecorder{}
+
+	metronome := NewMetronome()
+	metronome.Accents = []bool{true, false, true, false}
+	metronome.Enable(true)
+
+	p := NewPlayer(f, &timedRecorder{})
+	p.Metronome = metronome
+	p.MetronomeSink = clicks
+
+	if err := p.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test file ends after the second beat
+	if len(clicks.events) != 4 {
+		t.Fatalf("expected 4 click events, got %d", len(clicks.events))
+	}
+
+	on := clicks.events[2].(*ChannelEvent)
+	if on.EventType() != NoteOn || on.Value1 != uint16(metronome.Key) {
+		t.Errorf("expected an unaccented click on the second beat, got %v", on)
+	}
+}
+
+type frameRecorder struct {
+	frames []int64
+}
+
+func (r *frameRecorder) NoteOn(frame int64, channel, key, velocity uint8) {
+	r.frames = append(r.frames, frame)
+}
+
+func (r *frameRecorder) NoteOff(frame int64, channel, key, velocity uint8) {
+	r.frames = append(r.frames, -frame)
+}
+
+func (r *frameRecorder) PolyphonicKeyPressure(frame int64, channel, key, pressure uint8) {}
+func (r *frameRecorder) ControlChange(frame int64, channel, controller, value uint8)     {}
+func (r *frameRecorder) ProgramChange(frame int64, channel, program uint8)               {}
+func (r *frameRecorder) ChannelPressure(frame int64, channel, pressure uint8)            {}
+func (r *frameRecorder) PitchBend(frame int64, channel uint8, value uint16)              {}
+
+func TestRender(t *testing.T) {
+	r := &frameRecorder{}
+
+	if err := newTestFile().Render(r, 48000); err != nil {
+		t.Fatal(err)
+	}
+
+	// 50000 µs per quarter note is 2400 frames, note offs are recorded negative
+	expected := []int64{0, -600, 2400, -3000}
+
+	if len(r.frames) != len(expected) {
+		t.Fatalf("expected %d frames, got %v", len(expected), r.frames)
+	}
+
+	for i, frame := range r.frames {
+		if frame != expected[i] {
+			t.Errorf("event %d: expected frame %d, got %d", i, expected[i], frame)
+		}
+	}
+}
+
+func TestPlayerOffline(t *testing.T) {
+	origin := time.Unix(1000, 0)
+	r := &timedRecorder{}
+
+	p := NewPlayer(newTestFile(), r)
+	p.Clock = NewOfflineClock(origin)
+	p.CountIn = 1
+
+	start := time.Now()
+
+	if err := p.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected offline playback to be instant, took %v", elapsed)
+	}
+
+	// Count-in of one 4/4 bar at 50000 µs per quarter note
+	last := r.targets[len(r.targets)-1]
+	if expected := origin.Add(200*time.Millisecond + 62500*time.Microsecond); !last.Equal(expected) {
+		t.Errorf("expected last target %v, got %v", expected, last)
+	}
+}
+
+func TestStateAt(t *testing.T) {
+	track := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, 3, ControllerBankSelectMSB, 2)},
+		{Tick: 0, Event: NewChannelEvent(0, ProgramChange, 3, 40, 0)},
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, 3, 6, 12)},
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, 3, 101, 0)},
+		{Tick: 0, Event: NewChannelEvent(0, ControlChange, 3, 100, 0)},
+		{Tick: 100, Event: NewChannelEvent(0, PitchWheelChange, 3, 9000, 0)},
+		{Tick: 200, Event: NewChannelEvent(0, NoteOn, 3, 60, 90)},
+		{Tick: 300, Event: NewChannelEvent(0, ControlChange, 3, 7, 80)},
+		{Tick: 480, Event: NewChannelEvent(0, NoteOff, 3, 60, 0)},
+		{Tick: 480, Event: NewChannelEvent(0, NoteOn, 3, 62, 90)},
+		{Tick: 960, Event: NewChannelEvent(0, NoteOff, 3, 62, 0)},
+		{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	f := newFileWithTracks(Format1, 480, []*Track{BuildConductorTrack(NewTempoMap(480, []TempoChange{{MicrosecondsPerQuarterNote: 50000}}), nil, nil), track})
+
+	state := StateAt(f, 400)
+	c := state.Channels[3]
+
+	if c.Track != 1 || !c.HasProgram || c.Program != 40 || c.Bank != BankNumber(2, 0) || c.PitchBend != 9000 || c.Controllers[7] != 80 {
+		t.Errorf("unexpected channel state %+v", c)
+	}
+
+	if len(c.Notes) != 1 || c.Notes[60] != 90 {
+		t.Errorf("expected key 60 to sound, got %v", c.Notes)
+	}
+
+	if state.Channels[0].Track != -1 || len(state.Channels[0].Events(0)) != 0 {
+		t.Errorf("expected channel 0 to be unused")
+	}
+
+	// Bank, program, parameter numbers, data entry, volume and pitch wheel
+	events := state.Events()
+	if len(events) != 8 {
+		t.Fatalf("expected 8 chase events, got %v", events)
+	}
+
+	if ce := events[3].(*ChannelEvent); ce.Value1 != 101 {
+		t.Errorf("expected parameter numbers before data entry, got %v", ce)
+	}
+
+	r := &timedRecorder{}
+	p := NewPlayer(f, r)
+	p.Clock = NewOfflineClock(time.Unix(1000, 0))
+	p.StartTick = 480
+
+	if err := p.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chase events followed by the note events from the start tick on and the end of track event
+	if len(r.events) != len(events)+4 {
+		t.Fatalf("expected %v events, got %v", len(events)+4, len(r.events))
+	}
+
+	if !r.targets[0].Equal(time.Unix(1000, 0)) || !r.targets[len(events)].Equal(time.Unix(1000, 0)) {
+		t.Errorf("expected playback to start at the start tick, got %v", r.targets[len(events)])
+	}
+}
+
+func TestPlayerFlush(t *testing.T) {
+	f := newTestFile()
+
+	notes := f.ActiveNotesAt(100)
+	if len(notes) != 1 || notes[0].Key != 60 || notes[0].Track != 1 {
+		t.Fatalf("expected key 60 to sound at tick 100, got %+v", notes)
+	}
+
+	for _, mode := range []FlushMode{FlushNoteOffs, FlushAllNotesOff, FlushNone} {
+		ctx, cancel := context.WithCancel(context.Background())
+		events := []Event{}
+
+		// Stop playback after the first note on
+		sink := EventSinkFunc(func(track int, tick uint32, event Event) error {
+			events = append(events, event)
+			if event.EventType() == NoteOn {
+				cancel()
+			}
+
+			return nil
+		})
+
+		p := NewPlayer(f, sink)
+		p.Clock = NewOfflineClock(time.Unix(1000, 0))
+		p.Flush = mode
+
+		if err := p.Play(ctx); err != context.Canceled {
+			t.Fatalf("expected playback to be canceled, got %v", err)
+		}
+
+		cancel()
+
+		last := events[len(events)-1].(*ChannelEvent)
+
+		switch mode {
+		case FlushNoteOffs:
+			if last.eventType != NoteOff || last.Value1 != 60 {
+				t.Errorf("expected a note off for key 60, got %v", last)
+			}
+		case FlushAllNotesOff:
+			if last.eventType != ControlChange || last.Value1 != ControllerAllNotesOff {
+				t.Errorf("expected all notes off, got %v", last)
+			}
+		case FlushNone:
+			if last.eventType != NoteOn {
+				t.Errorf("expected no flush events, got %v", last)
+			}
+		}
+	}
+}
+
+func TestSongPositionPointer(t *testing.T) {
+	if position := TickToSongPosition(1000, 480); position != 8 {
+		t.Errorf("expected song position 8, got %v", position)
+	}
+
+	if tick := SongPositionToTick(8, 480); tick != 960 {
+		t.Errorf("expected tick 960, got %v", tick)
+	}
+
+	if position := TickToSongPosition(0xFFFFFFFF, 24); position != MaxSongPosition {
+		t.Errorf("expected the song position to be limited, got %v", position)
+	}
+
+	// Generator: locate, continue and one quarter note of clocks
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := []Event{}
+	g := NewClockGenerator(NewTempoMap(480, nil), EventSinkFunc(func(track int, tick uint32, event Event) error {
+		events = append(events, event)
+		if len(events) == 26 {
+			cancel()
+		}
+
+		return nil
+	}))
+
+	if err := g.Locate(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Continue(); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := NewOfflineClock(time.Unix(1000, 0))
+	if err := g.Run(ctx, clock); err != context.Canceled {
+		t.Fatalf("expected the generator to be canceled, got %v", err)
+	}
+
+	if spp := events[0].(*SystemCommonEvent); spp.eventType != SongPositionPointer || spp.Value1 != 8 {
+		t.Errorf("expected a song position pointer to 8, got %v", spp)
+	}
+
+	if events[1] != ContinueEvent || events[25] != TimingClockEvent {
+		t.Errorf("expected continue followed by timing clocks")
+	}
+
+	if g.tick() != 960+480 {
+		t.Errorf("expected one quarter note of clocks, got tick %v", g.tick())
+	}
+
+	// Slave: a song position pointer followed by continue moves the player
+	f := newTestFile()
+	midiClock := NewMIDIClock(f.TempoMap())
+	started := make(chan struct{})
+	received := []Event{}
+
+	p := NewPlayer(f, EventSinkFunc(func(track int, tick uint32, event Event) error {
+		received = append(received, event)
+		if len(received) == 1 {
+			close(started)
+		}
+
+		return nil
+	}))
+
+	p.Clock = midiClock
+
+	done := make(chan error)
+	go func() {
+		done <- p.Play(context.Background())
+	}()
+
+	<-started
+
+	// Jump to the second note at tick 480 while the first note sounds
+	for _, event := range []Event{NewSongPositionPointerEvent(4), ContinueEvent} {
+		midiClock.HandleEvent(0, 0, event)
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keys := []uint16{}
+			for _, event := range received {
+				if ce, ok := event.(*ChannelEvent); ok {
+					keys = append(keys, ce.Value1)
+				}
+			}
+
+			// Note on 60, its flushed note off, then the second note
+			if len(keys) != 4 || keys[0] != 60 || keys[1] != 60 || keys[2] != 62 || keys[3] != 62 {
+				t.Errorf("expected the player to jump to the second note, got keys %v", keys)
+			}
+
+			return
+		case <-time.After(time.Millisecond):
+			midiClock.Pulse()
+		}
+	}
+}
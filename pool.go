@@ -0,0 +1,57 @@
+package midi
+
+import (
+	"sync"
+)
+
+// payloadPool holds reusable payload buffers for the pooled parse paths
+var payloadPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 64)
+		return &buf
+	},
+}
+
+// getPayload gets a buffer of length n from the pool
+func getPayload(n uint32) *[]byte {
+	buf := payloadPool.Get().(*[]byte)
+
+	if uint32(cap(*buf)) < n {
+		*buf = make([]byte, n)
+	}
+
+	*buf = (*buf)[:n]
+
+	return buf
+}
+
+// putPayload returns a buffer to the pool
+func putPayload(buf *[]byte) {
+	payloadPool.Put(buf)
+}
+
+// retainPayload returns a private copy of pooled data
+func retainPayload(data []byte) []byte {
+	retained := make([]byte, len(data))
+	copy(retained, data)
+
+	return retained
+}
+
+// releaseEvent returns the pooled payload of an event that was not retained
+func releaseEvent(event Event) {
+	switch e := event.(type) {
+	case *MetaEvent:
+		if e.pooled != nil {
+			putPayload(e.pooled)
+			e.pooled = nil
+			e.Data = nil
+		}
+	case *SystemExclusiveEvent:
+		if e.pooled != nil {
+			putPayload(e.pooled)
+			e.pooled = nil
+			e.Data = nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package midi
+
+import (
+	"io"
+	"os"
+)
+
+// ProgressFunc receives the number of bytes processed so far and the total number of bytes, the
+// total is -1 if it is unknown
+type ProgressFunc func(bytesRead, totalBytes int64)
+
+// ProgressReader reports the progress of reads from the underlying reader, wrap the reader given
+// to ReadText or a decoder to follow the progress of conversions
+type ProgressReader struct {
+	R        io.Reader
+	Total    int64
+	Progress ProgressFunc
+	n        int64
+}
+
+// NewProgressReader creates a progress reader, the total is taken from the size of the reader
+// if it has one
+func NewProgressReader(r io.Reader, progress ProgressFunc) *ProgressReader {
+	return &ProgressReader{
+		R:        r,
+		Total:    readerSize(r),
+		Progress: progress,
+	}
+}
+
+// Read reads from the underlying reader and reports progress
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	n, err := p.R.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.Progress(p.n, p.Total)
+	}
+
+	return n, err
+}
+
+// ProgressWriter reports the progress of writes to the underlying writer
+type ProgressWriter struct {
+	W        io.Writer
+	Total    int64
+	Progress ProgressFunc
+	n        int64
+}
+
+// NewProgressWriter creates a progress writer, total is -1 if unknown
+func NewProgressWriter(w io.Writer, total int64, progress ProgressFunc) *ProgressWriter {
+	return &ProgressWriter{
+		W:        w,
+		Total:    total,
+		Progress: progress,
+	}
+}
+
+// Write writes to the underlying writer and reports progress
+func (p *ProgressWriter) Write(b []byte) (int, error) {
+	n, err := p.W.Write(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.Progress(p.n, p.Total)
+	}
+
+	return n, err
+}
+
+// readerSize returns the number of bytes left in readers that know their size like
+// bytes.Reader, strings.Reader and os.File, -1 otherwise
+func readerSize(r io.Reader) int64 {
+	switch sized := r.(type) {
+	case interface{ Len() int }:
+		return int64(sized.Len())
+	case *os.File:
+		info, err := sized.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := sized.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	}
+
+	return -1
+}
@@ -0,0 +1,375 @@
+package midi
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the messages in midi.proto
+const (
+	protoFileFormat              protowire.Number = 1
+	protoFileTicksPerQuarterNote protowire.Number = 2
+	protoFileFramesPerSecond     protowire.Number = 3
+	protoFileTicksPerFrame       protowire.Number = 4
+	protoFileTracks              protowire.Number = 5
+
+	protoTrackEvents protowire.Number = 1
+
+	protoEventDeltaTime    protowire.Number = 1
+	protoEventType         protowire.Number = 2
+	protoEventChannel      protowire.Number = 3
+	protoEventValue1       protowire.Number = 4
+	protoEventValue2       protowire.Number = 5
+	protoEventMetaType     protowire.Number = 6
+	protoEventData         protowire.Number = 7
+	protoEventContinuation protowire.Number = 8
+)
+
+// appendProtoVarint appends a varint field, zero values are omitted as in proto3
+func appendProtoVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+
+	return protowire.AppendVarint(b, v)
+}
+
+// appendProtoBytes appends a length delimited field, empty values are omitted as in proto3
+func appendProtoBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendBytes(b, v)
+}
+
+// consumeProto calls fn for every varint and length delimited field of a message, other wire
+// types are skipped
+func consumeProto(data []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		var v uint64
+		var b []byte
+
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			err := fn(num, typ, v, b)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// appendProtoEvent appends the fields of an event message
+func appendProtoEvent(b []byte, event Event) ([]byte, error) {
+	eventType := event.EventType()
+	if _, ok := event.(*RawEvent); ok {
+		// Raw events with a registered event type are encoded as Raw as well
+		eventType = Raw
+	}
+
+	b = appendProtoVarint(b, protoEventDeltaTime, uint64(event.DeltaTime()))
+	b = appendProtoVarint(b, protoEventType, uint64(eventType))
+
+	switch e := event.(type) {
+	case *ChannelEvent:
+		b = appendProtoVarint(b, protoEventChannel, uint64(e.Channel))
+		b = appendProtoVarint(b, protoEventValue1, uint64(e.Value1))
+		b = appendProtoVarint(b, protoEventValue2, uint64(e.Value2))
+	case *SequencerSpecificEvent:
+		b = appendProtoVarint(b, protoEventMetaType, uint64(e.MetaType))
+		b = appendProtoBytes(b, protoEventData, e.Data)
+	case *MetaEvent:
+		b = appendProtoVarint(b, protoEventMetaType, uint64(e.MetaType))
+		b = appendProtoBytes(b, protoEventData, e.Data)
+	case *SystemExclusiveEvent:
+		b = appendProtoBytes(b, protoEventData, e.Data)
+		b = appendProtoVarint(b, protoEventContinuation, protowire.EncodeBool(e.Continuation))
+	case *SystemCommonEvent:
+		b = appendProtoVarint(b, protoEventValue1, uint64(e.Value1))
+	case *SystemRealTimeEvent:
+	case *RawEvent:
+		b = appendProtoVarint(b, protoEventValue1, uint64(e.Status))
+		b = appendProtoBytes(b, protoEventData, e.Data)
+	default:
+		return nil, fmt.Errorf("event %v has no protobuf representation", event)
+	}
+
+	return b, nil
+}
+
+// EventToProto encodes an event as a protobuf Event message
+func EventToProto(event Event) ([]byte, error) {
+	return appendProtoEvent(nil, event)
+}
+
+// protoValue16 checks that a varint field fits in 16 bits
+func protoValue16(v uint64, name string) (uint16, error) {
+	if v > 0xFFFF {
+		return 0, fmt.Errorf("%v %v out of range", name, v)
+	}
+
+	return uint16(v), nil
+}
+
+// EventFromProto decodes a protobuf Event message
+func EventFromProto(data []byte) (Event, error) {
+	var deltaTime, eventType, channel, value1, value2, metaType uint64
+	var eventData []byte
+	var continuation bool
+
+	err := consumeProto(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch num {
+		case protoEventDeltaTime:
+			deltaTime = v
+		case protoEventType:
+			eventType = v
+		case protoEventChannel:
+			channel = v
+		case protoEventValue1:
+			value1 = v
+		case protoEventValue2:
+			value2 = v
+		case protoEventMetaType:
+			metaType = v
+		case protoEventData:
+			eventData = append([]byte{}, b...)
+		case protoEventContinuation:
+			continuation = protowire.DecodeBool(v)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if deltaTime > 0x0FFFFFFF {
+		return nil, fmt.Errorf("delta time %v out of range", deltaTime)
+	}
+
+	if eventType > uint64(Raw) {
+		return nil, fmt.Errorf("unknown event type %v", eventType)
+	}
+
+	core := coreEvent{deltaTime: uint32(deltaTime), eventType: EventType(eventType)}
+
+	switch core.eventType {
+	case NoteOff, NoteOn, PolyphonicKeyPressure, ControlChange, ProgramChange, ChannelPressure, PitchWheelChange:
+		if channel > 15 {
+			return nil, fmt.Errorf("channel %v out of range", channel)
+		}
+
+		v1, err := protoValue16(value1, "value1")
+		if err != nil {
+			return nil, err
+		}
+
+		v2, err := protoValue16(value2, "value2")
+		if err != nil {
+			return nil, err
+		}
+
+		return &ChannelEvent{coreEvent: core, Channel: uint16(channel), Value1: v1, Value2: v2}, nil
+	case Meta:
+		if metaType > 0xFF {
+			return nil, fmt.Errorf("meta type %v out of range", metaType)
+		}
+
+		return NewMetaEvent(core.deltaTime, MetaType(metaType), eventData), nil
+	case SystemExclusive:
+		return &SystemExclusiveEvent{coreEvent: core, Data: eventData, Continuation: continuation}, nil
+	case SongPositionPointer, SongSelect, TuneRequest, MTCQuarterFrame:
+		v1, err := protoValue16(value1, "value1")
+		if err != nil {
+			return nil, err
+		}
+
+		return &SystemCommonEvent{coreEvent: core, Value1: v1}, nil
+	case Raw:
+		if value1 > 0xFF {
+			return nil, fmt.Errorf("status %v out of range", value1)
+		}
+
+		return NewRawEvent(core.deltaTime, byte(value1), eventData), nil
+	}
+
+	return &SystemRealTimeEvent{coreEvent: core}, nil
+}
+
+// appendProtoTrack appends the fields of a track message
+func appendProtoTrack(b []byte, t *Track) ([]byte, error) {
+	for _, event := range t.Events {
+		eventData, err := appendProtoEvent(nil, event)
+		if err != nil {
+			return nil, err
+		}
+
+		b = protowire.AppendTag(b, protoTrackEvents, protowire.BytesType)
+		b = protowire.AppendBytes(b, eventData)
+	}
+
+	return b, nil
+}
+
+// ToProto encodes the track as a protobuf Track message
+func (t *Track) ToProto() ([]byte, error) {
+	return appendProtoTrack(nil, t)
+}
+
+// FromProto replaces the events of the track with a decoded protobuf Track message
+func (t *Track) FromProto(data []byte) error {
+	events := []Event{}
+
+	err := consumeProto(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		if num != protoTrackEvents || typ != protowire.BytesType {
+			return nil
+		}
+
+		event, err := EventFromProto(b)
+		if err != nil {
+			return fmt.Errorf("event %v: %v", len(events), err)
+		}
+
+		events = append(events, event)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	t.Events = events
+
+	return nil
+}
+
+// ToProto encodes the header and tracks of the file as a protobuf File message
+func (f *File) ToProto() ([]byte, error) {
+	var b []byte
+
+	if f.Header != nil {
+		b = appendProtoVarint(b, protoFileFormat, uint64(f.Header.Format))
+
+		if f.Header.DivisionType == DivisionFramesTicks {
+			b = appendProtoVarint(b, protoFileFramesPerSecond, uint64(f.Header.FramesPerSecond))
+			b = appendProtoVarint(b, protoFileTicksPerFrame, uint64(f.Header.TicksPerFrame))
+		} else {
+			b = appendProtoVarint(b, protoFileTicksPerQuarterNote, uint64(f.Header.TicksPerQuarterNote))
+		}
+	}
+
+	for _, track := range f.Tracks {
+		trackData, err := appendProtoTrack(nil, track)
+		if err != nil {
+			return nil, err
+		}
+
+		b = protowire.AppendTag(b, protoFileTracks, protowire.BytesType)
+		b = protowire.AppendBytes(b, trackData)
+	}
+
+	return b, nil
+}
+
+// FromProto replaces the header and tracks of the file with a decoded protobuf File message and
+// rebuilds the chunks
+func (f *File) FromProto(data []byte) error {
+	var format, ticksPerQuarterNote, framesPerSecond, ticksPerFrame uint64
+	tracks := []*Track{}
+
+	err := consumeProto(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch num {
+		case protoFileFormat:
+			format = v
+		case protoFileTicksPerQuarterNote:
+			ticksPerQuarterNote = v
+		case protoFileFramesPerSecond:
+			framesPerSecond = v
+		case protoFileTicksPerFrame:
+			ticksPerFrame = v
+		case protoFileTracks:
+			if typ != protowire.BytesType {
+				return nil
+			}
+
+			track := &Track{}
+
+			err := track.FromProto(b)
+			if err != nil {
+				return fmt.Errorf("track %v: %v", len(tracks), err)
+			}
+
+			tracks = append(tracks, track)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if format > 2 {
+		return fmt.Errorf("unknown format %v", format)
+	}
+
+	header := &FileHeader{Format: Format(format)}
+
+	if framesPerSecond != 0 {
+		if framesPerSecond > 0xFF || ticksPerFrame > 0xFF {
+			return fmt.Errorf("invalid SMPTE division %v %v", framesPerSecond, ticksPerFrame)
+		}
+
+		err = header.SetSMPTE(uint8(framesPerSecond), uint8(ticksPerFrame))
+	} else {
+		if ticksPerQuarterNote > 0xFFFF {
+			return fmt.Errorf("ticks per quarter note %v out of range", ticksPerQuarterNote)
+		}
+
+		err = header.SetTicksPerQuarterNote(uint16(ticksPerQuarterNote))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	f.Header = header
+	f.Tracks = tracks
+	f.Chunks = nil
+	f.Warnings = nil
+	f.trackErrors = nil
+	f.Rebuild()
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package midi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// RawEvent holds track content the parser could not interpret, it is written back verbatim so
+// unknown content is preserved. Status is the first byte after the delta time, which may be a
+// data byte if running status was not active, Data holds the bytes following it
+type RawEvent struct {
+	coreEvent
+	Status byte
+	Data   []byte
+}
+
+// NewRawEvent creates a raw event
+func NewRawEvent(deltaTime uint32, status byte, data []byte) *RawEvent {
+	return &RawEvent{
+		coreEvent: coreEvent{
+			eventType: Raw,
+			deltaTime: deltaTime,
+		},
+		Status: status,
+		Data:   data,
+	}
+}
+
+// String representation
+func (e *RawEvent) String() string {
+	return fmt.Sprintf("%v: deltaTime %v, status %X, %v data bytes", eventTypeToString(e.eventType), e.deltaTime, e.Status, len(e.Data))
+}
+
+// WriteTo writes the delta time followed by the status and data bytes as they were read
+func (e *RawEvent) WriteTo(w io.Writer) (int64, error) {
+	data := writeVariableLengthInteger(e.deltaTime)
+	data = append(data, e.Status)
+	data = append(data, e.Data...)
+
+	n, err := w.Write(data)
+
+	return int64(n), err
+}
+
+// Clone returns a copy of the event
+func (e *RawEvent) Clone() Event {
+	c := *e
+	c.Data = bytes.Clone(e.Data)
+
+	return &c
+}
@@ -1,34 +1,43 @@
 package midi
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 )
 
 // parseFunction type
 type parseFunction func(statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error)
 
-// Mapping from event type to parse function
-var eventTypeToParseFunctionMapping = map[EventType]parseFunction{
-	NoteOff:               parseNoteOff,
-	NoteOn:                parseNoteOn,
-	PolyphonicKeyPressure: parsePolyphonicKeyPressure,
-	ControlChange:         parseControlChange,
-	ProgramChange:         parseProgramChange,
-	ChannelPressure:       parseChannelPressure,
-	PitchWheelChange:      parsePitchWheelChange,
-	SystemExclusive:       parseSystemExclusive,
-	SongPositionPointer:   parseSongPositionPointer,
-	SongSelect:            parseSongSelect,
-	TuneRequest:           parseTuneRequest,
-	TimingClock:           parseTimingClock,
-	Start:                 parseStart,
-	Continue:              parseContinue,
-	Stop:                  parseStop,
-	ActiveSensing:         parseActiveSensing,
-	Meta:                  parseMeta,
+// Mapping from status byte to parse function, a fixed array avoids a map lookup per event
+var statusByteToParseFunctionMapping [256]parseFunction
+
+func init() {
+	for channel := 0; channel < 16; channel++ {
+		statusByteToParseFunctionMapping[0x80|channel] = parseNoteOff
+		statusByteToParseFunctionMapping[0x90|channel] = parseNoteOn
+		statusByteToParseFunctionMapping[0xA0|channel] = parsePolyphonicKeyPressure
+		statusByteToParseFunctionMapping[0xB0|channel] = parseControlChange
+		statusByteToParseFunctionMapping[0xC0|channel] = parseProgramChange
+		statusByteToParseFunctionMapping[0xD0|channel] = parseChannelPressure
+		statusByteToParseFunctionMapping[0xE0|channel] = parsePitchWheelChange
+	}
+
+	statusByteToParseFunctionMapping[0xF0] = parseSystemExclusive
+	statusByteToParseFunctionMapping[0xF1] = parseMTCQuarterFrame
+	statusByteToParseFunctionMapping[0xF2] = parseSongPositionPointer
+	statusByteToParseFunctionMapping[0xF3] = parseSongSelect
+	statusByteToParseFunctionMapping[0xF6] = parseTuneRequest
+	statusByteToParseFunctionMapping[0xF7] = parseSystemExclusive
+	statusByteToParseFunctionMapping[0xF8] = parseTimingClock
+	statusByteToParseFunctionMapping[0xFA] = parseStart
+	statusByteToParseFunctionMapping[0xFB] = parseContinue
+	statusByteToParseFunctionMapping[0xFC] = parseStop
+	statusByteToParseFunctionMapping[0xFE] = parseActiveSensing
+	statusByteToParseFunctionMapping[0xFF] = parseMeta
 }
 
 // readVariableLengthInteger reads a variable length integer from a slice of bytes
@@ -37,6 +46,10 @@ func readVariableLengthInteger(data []byte) (result uint32, bytesRead uint32, er
 	err = nil
 
 	for _, b := range data {
+		if bytesRead == 4 {
+			return 0, 0, errors.New("a variable length quantity should not be longer than 4 bytes")
+		}
+
 		bytesRead++
 		result <<= 7
 		result ^= uint32(b) & 0x7F
@@ -58,7 +71,7 @@ func (c *Chunk) FileHeader() (*FileHeader, error) {
 	data := c.Data
 	header := &FileHeader{}
 
-	if c.Length != 6 {
+	if c.Length != 6 || len(data) != 6 {
 		return nil, errors.New("midi header chunk data should be 6 bytes long")
 	}
 
@@ -68,7 +81,8 @@ func (c *Chunk) FileHeader() (*FileHeader, error) {
 
 	if (header.Division >> 15) == 1 {
 		header.DivisionType = DivisionFramesTicks
-		header.FramesPerSecond = uint8((header.Division & 0x7FFF) >> 8)
+		// The frame rate is stored as a negative two's complement number
+		header.FramesPerSecond = uint8(-int8(header.Division >> 8))
 		header.TicksPerFrame = uint8(header.Division & 0xFF)
 	} else {
 		header.DivisionType = DivisionTicksPerQuarterNote
@@ -80,153 +94,716 @@ func (c *Chunk) FileHeader() (*FileHeader, error) {
 
 // Track parses a track object from a chunk
 func (c *Chunk) Track() (*Track, error) {
-	data := c.Data
+	events := []Event{}
+
+	err := parseTrackData(c.Data, false, func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Track{Events: events}, nil
+}
+
+// parsePooledMetaEvent parses a meta event with a pooled payload
+func parsePooledMetaEvent(statusByte uint8, deltaTime uint32, data []byte) (Event, uint32, error) {
+	return parseMetaEvent(deltaTime, data, true)
+}
+
+// parsePooledSystemExclusiveEvent parses a system exclusive event with a pooled payload
+func parsePooledSystemExclusiveEvent(statusByte uint8, deltaTime uint32, data []byte) (Event, uint32, error) {
+	return parseSystemExclusiveEvent(statusByte, deltaTime, data, true)
+}
+
+// parseUndefinedRealTime keeps an undefined real time status byte as raw event
+func parseUndefinedRealTime(statusByte uint8, deltaTime uint32, data []byte) (Event, uint32, error) {
+	return NewRawEvent(deltaTime, statusByte, nil), 0, nil
+}
+
+// callParser calls a status parser and checks its result, a panic on malformed data, e.g. in a
+// registered parser, is returned as error so no input bytes can crash the caller
+func callParser(parse parseFunction, statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			event, bytesRead, err = nil, 0, fmt.Errorf("panic while parsing status byte %X: %v", statusByte, r)
+		}
+	}()
+
+	event, bytesRead, err = parse(statusByte, deltaTime, data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if event == nil {
+		return nil, 0, fmt.Errorf("parser for status byte %X returned no event", statusByte)
+	}
+
+	if uint64(bytesRead) > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("parser for status byte %X read beyond the available data", statusByte)
+	}
+
+	return event, bytesRead, nil
+}
+
+// parseTrackData decodes events from track data one at a time and hands them to fn. If pooled
+// is true, meta and system exclusive payloads are taken from the payload pool and recycled
+// after fn returns, unless the event was retained
+func parseTrackData(data []byte, pooled bool, fn func(Event) error) error {
+	return parseTrackDataWithOptions(data, pooled, ReadOptions{}, fn)
+}
+
+// parseTrackDataWithOptions decodes events like parseTrackData with the running status mode of
+// the options, events are recorded in the metrics of the options if set
+func parseTrackDataWithOptions(data []byte, pooled bool, opts ReadOptions, fn func(Event) error) error {
+	table := activeStatusParsers()
 	runningStatusActive := false
 	var runningStatusByte uint8
-	events := []Event{}
 
 	for {
 		deltaTime, bytesRead, err := readVariableLengthInteger(data)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
+		deltaTimeSize := bytesRead
 		data = data[bytesRead:]
 
 		if len(data) == 0 {
-			return nil, errors.New("expected another event after delta time")
+			return errors.New("expected another event after delta time")
 		}
 
 		statusByte := data[0]
+		runningStatus := (statusByte >> 7) == 0
 
-		if (statusByte >> 7) == 1 {
+		// The rest of the track is kept as raw event if it can not be interpreted
+		eventData := data
+		keepRaw := func(err error) error {
+			if !opts.KeepRawEvents {
+				return err
+			}
+
+			raw := NewRawEvent(deltaTime, eventData[0], bytes.Clone(eventData[1:]))
+
+			if opts.Metrics != nil {
+				opts.Metrics.addEvent(Raw, deltaTimeSize, false)
+			}
+
+			return fn(raw)
+		}
+
+		if !runningStatus {
 			// Skip status byte
 			data = data[1:]
 		} else {
 			// Data byte, we expect runningStatusActive to be true
 			if !runningStatusActive {
-				return nil, errors.New("received data byte without running status active")
+				return keepRaw(errors.New("received data byte without running status active"))
 			}
 
 			statusByte = runningStatusByte
 		}
 
-		var parseFunc parseFunction
-		var event Event
+		parseFunc := table.parsers[statusByte]
+		if parseFunc == nil && opts.KeepRawEvents && statusByte >= 0xF8 {
+			// Undefined real time status bytes have no data bytes
+			parseFunc = parseUndefinedRealTime
+		}
+
+		if parseFunc == nil {
+			return keepRaw(fmt.Errorf("unknown status byte %X encountered", statusByte))
+		}
 
 		switch {
-		case (statusByte >> 4) == 0x8:
-			parseFunc = eventTypeToParseFunctionMapping[NoteOff]
-			runningStatusActive = true
-			runningStatusByte = statusByte
-		case (statusByte >> 4) == 0x9:
-			parseFunc = eventTypeToParseFunctionMapping[NoteOn]
-			runningStatusActive = true
-			runningStatusByte = statusByte
-		case (statusByte >> 4) == 0xA:
-			parseFunc = eventTypeToParseFunctionMapping[PolyphonicKeyPressure]
-			runningStatusActive = true
-			runningStatusByte = statusByte
-		case (statusByte >> 4) == 0xB:
-			parseFunc = eventTypeToParseFunctionMapping[ControlChange]
-			runningStatusActive = true
-			runningStatusByte = statusByte
-		case (statusByte >> 4) == 0xC:
-			parseFunc = eventTypeToParseFunctionMapping[ProgramChange]
+		case statusByte < 0xF0:
+			// Channel events activate running status
 			runningStatusActive = true
 			runningStatusByte = statusByte
-		case (statusByte >> 4) == 0xD:
-			parseFunc = eventTypeToParseFunctionMapping[ChannelPressure]
-			runningStatusActive = true
-			runningStatusByte = statusByte
-		case (statusByte >> 4) == 0xE:
-			parseFunc = eventTypeToParseFunctionMapping[PitchWheelChange]
+		case statusByte == 0xF0 || statusByte == 0xF7:
+			// System exclusive events cancel running status unless it is kept for legacy files
+			runningStatusActive = runningStatusActive && opts.RunningStatus == RunningStatusKeep
+		case statusByte < 0xF8:
+			// System common events cancel running status
+			runningStatusActive = false
+		case statusByte == 0xFF:
+			// Meta events only cancel running status in spec mode
+			runningStatusActive = runningStatusActive && opts.RunningStatus != RunningStatusSpec
+		}
+
+		var event Event
+
+		// Registered status parsers take precedence over the pooled built-in parsers
+		switch {
+		case table.registered[statusByte]:
+			event, bytesRead, err = callParser(parseFunc, statusByte, deltaTime, data)
+		case pooled && statusByte == 0xFF:
+			event, bytesRead, err = callParser(parsePooledMetaEvent, statusByte, deltaTime, data)
+		case pooled && (statusByte == 0xF0 || statusByte == 0xF7):
+			event, bytesRead, err = callParser(parsePooledSystemExclusiveEvent, statusByte, deltaTime, data)
+		default:
+			event, bytesRead, err = callParser(parseFunc, statusByte, deltaTime, data)
+		}
+
+		if err != nil {
+			return keepRaw(err)
+		}
+
+		// A data byte with the high bit set is a status byte, the event was cut short
+		if opts.Strict && statusByte < 0xF0 {
+			for _, b := range data[:bytesRead] {
+				if b&0x80 != 0 {
+					return keepRaw(fmt.Errorf("%v data byte %X has the high bit set", eventTypeToString(event.EventType()), b))
+				}
+			}
+		}
+
+		if opts.Metrics != nil {
+			opts.Metrics.addEvent(event.EventType(), deltaTimeSize, runningStatus)
+		}
+
+		err = fn(event)
+
+		if pooled {
+			releaseEvent(event)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		data = data[bytesRead:]
+
+		if len(data) == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+// scanTrackData walks the events in track data without materializing them, fn receives the
+// absolute tick, the status byte and the raw event bytes following the status byte. The
+// absolute tick at the end of the track is returned
+func scanTrackData(data []byte, fn func(tick uint32, statusByte uint8, payload []byte) error) (uint32, error) {
+	runningStatusActive := false
+	var runningStatusByte uint8
+	var tick uint32
+
+	for len(data) > 0 {
+		deltaTime, bytesRead, err := readVariableLengthInteger(data)
+		if err != nil {
+			return 0, err
+		}
+
+		tick += deltaTime
+		data = data[bytesRead:]
+
+		if len(data) == 0 {
+			return 0, errors.New("expected another event after delta time")
+		}
+
+		statusByte := data[0]
+
+		if (statusByte >> 7) == 1 {
+			data = data[1:]
+		} else {
+			if !runningStatusActive {
+				return 0, errors.New("received data byte without running status active")
+			}
+
+			statusByte = runningStatusByte
+		}
+
+		var length uint32
+
+		switch {
+		case statusByte < 0xF0:
 			runningStatusActive = true
 			runningStatusByte = statusByte
-		case statusByte == 0xF0:
-			parseFunc = eventTypeToParseFunctionMapping[SystemExclusive]
+			length = 2
+
+			if statusByte>>4 == 0xC || statusByte>>4 == 0xD {
+				length = 1
+			}
+		case statusByte == 0xF0 || statusByte == 0xF7:
 			runningStatusActive = false
+
+			numBytes, n, err := readVariableLengthInteger(data)
+			if err != nil {
+				return 0, err
+			}
+
+			length = n + numBytes
 		case statusByte == 0xF2:
-			parseFunc = eventTypeToParseFunctionMapping[SongPositionPointer]
 			runningStatusActive = false
-		case statusByte == 0xF3:
-			parseFunc = eventTypeToParseFunctionMapping[SongSelect]
+			length = 2
+		case statusByte == 0xF1, statusByte == 0xF3:
 			runningStatusActive = false
+			length = 1
 		case statusByte == 0xF6:
-			parseFunc = eventTypeToParseFunctionMapping[TuneRequest]
 			runningStatusActive = false
-		case statusByte == 0xF7:
-			parseFunc = eventTypeToParseFunctionMapping[SystemExclusive]
-			runningStatusActive = false
-		case statusByte == 0xF8:
-			parseFunc = eventTypeToParseFunctionMapping[TimingClock]
-		case statusByte == 0xFA:
-			parseFunc = eventTypeToParseFunctionMapping[Start]
-		case statusByte == 0xFB:
-			parseFunc = eventTypeToParseFunctionMapping[Continue]
-		case statusByte == 0xFC:
-			parseFunc = eventTypeToParseFunctionMapping[Stop]
-		case statusByte == 0xFE:
-			parseFunc = eventTypeToParseFunctionMapping[ActiveSensing]
 		case statusByte == 0xFF:
-			parseFunc = eventTypeToParseFunctionMapping[Meta]
-		default:
-			return nil, fmt.Errorf("unknown status byte %X encountered", statusByte)
+			if len(data) == 0 {
+				return 0, errors.New("end of data before meta event was identified")
+			}
+
+			numBytes, n, err := readVariableLengthInteger(data[1:])
+			if err != nil {
+				return 0, err
+			}
+
+			length = 1 + n + numBytes
+		case statusByteToParseFunctionMapping[statusByte] == nil:
+			return 0, fmt.Errorf("unknown status byte %X encountered", statusByte)
+		}
+
+		if uint32(len(data)) < length {
+			return 0, errors.New("event length exceeds available data length")
 		}
 
-		event, bytesRead, err = parseFunc(statusByte, deltaTime, data)
+		err = fn(tick, statusByte, data[:length])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 
-		events = append(events, event)
-		data = data[bytesRead:]
+		data = data[length:]
+	}
 
-		if len(data) == 0 {
-			break
-		}
+	return tick, nil
+}
+
+// maxChunkPreallocation limits the buffer allocated up front for chunk data, larger chunks grow
+// their buffer as data arrives so a corrupt length can not allocate memory the data does not fill
+const maxChunkPreallocation = 1 << 20
+
+// readChunkHeader reads the type and length of a chunk. It returns io.EOF only if the reader
+// ended before the chunk, a partial chunk header is io.ErrUnexpectedEOF
+func readChunkHeader(r io.Reader) (ChunkType, uint32, error) {
+	var header [8]byte
+
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return "", 0, err
 	}
 
-	return &Track{Events: events}, nil
+	return ChunkType(header[:4]), binary.BigEndian.Uint32(header[4:]), nil
 }
 
-// ReadFrom reads chunk data from reader
-func (c *Chunk) ReadFrom(r io.Reader) (int64, error) {
-	var totalBytes int64
+// readChunkData reads length bytes of chunk data, a reader ending early is io.ErrUnexpectedEOF
+func readChunkData(r io.Reader, length uint32) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.Grow(int(min(length, maxChunkPreallocation)))
 
-	p := make([]byte, 4)
-	numBytes, err := r.Read(p)
+	n, err := io.CopyN(buf, r, int64(length))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return buf.Bytes()[:n:n], err
+}
+
+// ReadFrom reads a chunk from reader, short reads of network connections and pipes are
+// continued until the chunk is complete. It returns io.EOF only if the reader ended before the
+// chunk, a chunk cut short is io.ErrUnexpectedEOF
+func (c *Chunk) ReadFrom(r io.Reader) (int64, error) {
+	chunkType, length, err := readChunkHeader(r)
 	if err != nil {
 		return 0, err
 	}
 
-	totalBytes += int64(numBytes)
+	c.Type = chunkType
+	c.Length = length
 
-	c.Type = ChunkType(p)
-	err = binary.Read(r, binary.BigEndian, &c.Length)
+	c.Data, err = readChunkData(r, length)
 	if err != nil {
-		return 0, err
+		return 8 + int64(len(c.Data)), err
 	}
 
-	c.Data = make([]byte, c.Length)
-	numBytes, err = r.Read(c.Data)
+	return 8 + int64(length), nil
+}
+
+// ReadBytes parses a midi file from a byte slice, the chunk data references the
+// slice directly instead of being copied
+func (f *File) ReadBytes(data []byte) (int64, error) {
+	return f.ReadBytesWithOptions(data, ReadOptions{})
+}
+
+// ReadBytesWithOptions parses a midi file from a byte slice like ReadBytes, recoverable problems
+// are collected in Warnings or returned as error in strict mode
+func (f *File) ReadBytesWithOptions(data []byte, opts ReadOptions) (int64, error) {
+	var totalBytesRead int64
+	var errs []error
+	totalBytes := int64(len(data))
+
+	f.Header = nil
+	f.Chunks = []*Chunk{}
+	f.Tracks = []*Track{}
+	f.Warnings = nil
+	f.trackErrors = nil
+	f.trackChunks = 0
+
+	for len(data) > 0 {
+		if f.declaredTracksRead(opts) {
+			err := f.warn(opts, Warning{Track: -1, Message: fmt.Sprintf("%v bytes of trailing data ignored", len(data))})
+			if err != nil {
+				return 0, err
+			}
+
+			break
+		}
+
+		if len(data) < 8 {
+			return 0, errors.Join(append(errs, errors.New("not enough data left for chunk type and length"))...)
+		}
+
+		chunk := &Chunk{
+			Type:   ChunkType(data[:4]),
+			Length: binary.BigEndian.Uint32(data[4:]),
+		}
+
+		data = data[8:]
+		if uint64(len(data)) < uint64(chunk.Length) {
+			return 0, errors.Join(append(errs, errors.New("given chunk length exceeds available data length"))...)
+		}
+
+		chunk.Data = data[:chunk.Length:chunk.Length]
+		data = data[chunk.Length:]
+		opts.debug("midi chunk", "type", string(chunk.Type), "offset", totalBytesRead, "length", chunk.Length)
+		opts.Metrics.addChunk(chunk)
+		totalBytesRead += 8 + int64(chunk.Length)
+
+		if opts.Progress != nil {
+			opts.Progress(totalBytesRead, totalBytes)
+		}
+
+		if chunk.Type == HeaderType {
+			err := f.readHeaderChunk(chunk, opts)
+			if err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		err := f.readChunk(chunk, opts)
+		if err != nil {
+			if !opts.CollectErrors {
+				return 0, err
+			}
+
+			errs = append(errs, err)
+		}
+	}
+
+	if f.Header == nil {
+		return 0, errors.Join(append(errs, errors.New("no midi header chunk found"))...)
+	}
+
+	err := f.checkTrackCount(opts)
 	if err != nil {
 		return 0, err
 	}
 
-	totalBytes += int64(numBytes)
+	if opts.CollectErrors {
+		err = f.collectedError(opts, errs)
+		if err != nil {
+			return totalBytesRead, err
+		}
+	}
+
+	return totalBytesRead, nil
+}
+
+// PeekHeader reads only the header chunk from reader and stops, this allows for
+// quick inspection of format, division and number of tracks without parsing the tracks
+func PeekHeader(r io.Reader) (*FileHeader, error) {
+	chunkType, length, err := readChunkHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunkType != HeaderType {
+		return nil, errors.New("midi file should start with a header chunk")
+	}
+
+	// Check the length before reading so a corrupt length is not read
+	if length != 6 {
+		return nil, errors.New("midi header chunk data should be 6 bytes long")
+	}
+
+	chunk := &Chunk{Type: chunkType, Length: length}
+
+	chunk.Data, err = readChunkData(r, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return chunk.FileHeader()
+}
+
+// RunningStatusMode controls which events cancel running status while parsing tracks
+type RunningStatusMode uint8
+
+const (
+	// RunningStatusDefault lets system exclusive events cancel running status, meta events keep it
+	RunningStatusDefault RunningStatusMode = iota
+	// RunningStatusSpec lets meta and system exclusive events cancel running status as the
+	// standard midi file specification requires
+	RunningStatusSpec
+	// RunningStatusKeep keeps running status across meta and system exclusive events, some
+	// legacy files and players assume this
+	RunningStatusKeep
+)
+
+// ReadOptions control how problems in malformed files are handled
+type ReadOptions struct {
+	// Strict turns recoverable problems into errors instead of warnings, channel events with a
+	// data byte that has the high bit set make the track fail to parse. Without Strict such values
+	// and tracks missing an end of track event are reported as warnings
+	Strict bool
+	// IgnoreTrailingData stops reading after the number of track chunks declared by the header,
+	// padding or junk after the last track is reported instead of parsed as chunks
+	IgnoreTrailingData bool
+	// MaxTracks limits the number of track chunks, 0 means no limit
+	MaxTracks int
+	// MaxEventsPerTrack limits the number of events in a track, 0 means no limit. Small files can
+	// expand into millions of events, the limit guards servers reading untrusted files
+	MaxEventsPerTrack int
+	// MaxSysExBytes limits the data length of system exclusive events, 0 means no limit
+	MaxSysExBytes int
+	// Progress is called with the number of bytes read so far, optional
+	Progress ProgressFunc
+	// Logger logs chunk boundaries, warnings and skipped data at debug level, optional
+	Logger *slog.Logger
+	// Metrics collects event and encoding statistics, optional
+	Metrics *ParseMetrics
+	// RunningStatus controls whether meta and system exclusive events cancel running status
+	RunningStatus RunningStatusMode
+	// KeepRawEvents keeps track content that can not be interpreted as RawEvent instead of
+	// failing, undefined real time status bytes become raw events without data and the rest of a
+	// track after any other problem becomes a single raw event. Raw events are reported as warnings
+	KeepRawEvents bool
+	// KeepSysExFragments keeps a system exclusive message divided over an initial event without
+	// terminating 0xF7 and 0xF7 continuation events as separate events, by default they are
+	// assembled into the initial event and the timing of the continuation packets is dropped
+	KeepSysExFragments bool
+	// CollectErrors reads to completion instead of stopping at the first problem, all errors are
+	// returned joined with errors.Join. In strict mode the warnings, including skipped tracks, are
+	// returned as WarningError too
+	CollectErrors bool
+}
+
+// debug logs a message at debug level if a logger is set
+func (opts ReadOptions) debug(msg string, args ...any) {
+	if opts.Logger != nil {
+		opts.Logger.Debug(msg, args...)
+	}
+}
+
+// readChunk adds a non header chunk read from a file and parses it if it is a track. A track
+// that cannot be parsed is skipped with a warning, exceeding a limit is always an error
+func (f *File) readChunk(chunk *Chunk, opts ReadOptions) error {
+	f.Chunks = append(f.Chunks, chunk)
+
+	if chunk.Type != TrackType {
+		return nil
+	}
+
+	trackIndex := f.trackChunks
+	f.trackChunks++
+
+	if opts.MaxTracks > 0 && trackIndex >= opts.MaxTracks {
+		return fmt.Errorf("file has more than %v tracks", opts.MaxTracks)
+	}
+
+	events := []Event{}
+	var limitErr error
+
+	err := parseTrackDataWithOptions(chunk.Data, false, opts, func(event Event) error {
+		if opts.MaxEventsPerTrack > 0 && len(events) >= opts.MaxEventsPerTrack {
+			limitErr = fmt.Errorf("more than %v events", opts.MaxEventsPerTrack)
+			return limitErr
+		}
+
+		if se, ok := event.(*SystemExclusiveEvent); ok && opts.MaxSysExBytes > 0 && len(se.Data) > opts.MaxSysExBytes {
+			limitErr = fmt.Errorf("system exclusive event of %v bytes, the limit is %v", len(se.Data), opts.MaxSysExBytes)
+			return limitErr
+		}
+
+		events = append(events, event)
+
+		return nil
+	})
+
+	if limitErr != nil {
+		return fmt.Errorf("track %v: %w", trackIndex, limitErr)
+	}
+
+	if err != nil {
+		// Keep the other tracks, the raw chunk of the failed track stays in Chunks
+		f.trackErrors = append(f.trackErrors, TrackError{Index: trackIndex, Chunk: chunk, Err: err})
+
+		return f.warn(opts, Warning{Track: trackIndex, Message: fmt.Sprintf("track skipped: %v", err)})
+	}
+
+	track := &Track{Events: events}
+	if !opts.KeepSysExFragments {
+		// Each fragment is within the limit, the assembled message has to be too
+		_, err = mergeSysExContinuations(track, opts.MaxSysExBytes)
+		if err != nil {
+			return fmt.Errorf("track %v: %w", trackIndex, err)
+		}
+
+		events = track.Events
+	}
+
+	tick := uint32(0)
+	for _, event := range events {
+		tick += event.DeltaTime()
+
+		switch e := event.(type) {
+		case *RawEvent:
+			err = f.warn(opts, Warning{Track: trackIndex, Tick: tick, Message: fmt.Sprintf("%v uninterpreted bytes kept as raw event", 1+len(e.Data))})
+		case *ChannelEvent:
+			if message := validateChannelEvent(e); message != "" {
+				err = f.warn(opts, Warning{Track: trackIndex, Tick: tick, Message: message})
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	var lastEvent Event
+	if len(events) > 0 {
+		lastEvent = events[len(events)-1]
+	}
+
+	// The end of track can be part of trailing bytes kept as raw event, which were reported
+	if _, raw := lastEvent.(*RawEvent); !raw && !isEndOfTrack(lastEvent) {
+		err = f.warn(opts, Warning{Track: trackIndex, Tick: tick, Message: "track does not end with an end of track event"})
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Tracks = append(f.Tracks, track)
+
+	return nil
+}
+
+// warn records a recoverable problem, or returns it as error in strict mode
+func (f *File) warn(opts ReadOptions, w Warning) error {
+	opts.debug("midi warning", "warning", w.String(), "strict", opts.Strict)
+
+	if opts.Strict && !opts.CollectErrors {
+		return WarningError{w}
+	}
+
+	f.Warnings = append(f.Warnings, w)
+
+	return nil
+}
+
+// collectedError joins the errors collected while reading with CollectErrors, in strict mode the
+// warnings are included
+func (f *File) collectedError(opts ReadOptions, errs []error) error {
+	if opts.Strict {
+		warningErrs := make([]error, len(f.Warnings))
+		for index, w := range f.Warnings {
+			warningErrs[index] = WarningError{w}
+		}
+
+		errs = append(warningErrs, errs...)
+	}
+
+	return errors.Join(errs...)
+}
 
-	return totalBytes, nil
+// declaredTracksRead returns true if trailing data is ignored and all track chunks declared by
+// the header were read, track chunks that could not be parsed count as read
+func (f *File) declaredTracksRead(opts ReadOptions) bool {
+	return opts.IgnoreTrailingData && f.Header != nil && f.trackChunks >= int(f.Header.NumTracks)
+}
+
+// readHeaderChunk handles a header chunk read from a file. The first header is used and moved in
+// front of the other chunks, a late header or additional headers are reported and additional
+// headers are dropped
+func (f *File) readHeaderChunk(chunk *Chunk, opts ReadOptions) error {
+	if f.Header != nil {
+		return f.warn(opts, Warning{Track: -1, Message: "additional header chunk ignored, the first header is used"})
+	}
+
+	header, err := chunk.FileHeader()
+	if err != nil {
+		return err
+	}
+
+	if len(f.Chunks) > 0 {
+		err = f.warn(opts, Warning{Track: -1, Message: "header chunk found after other chunks"})
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Header = header
+	f.Chunks = append([]*Chunk{chunk}, f.Chunks...)
+
+	return nil
+}
+
+// checkTrackCount reports a header declaring a different number of tracks than track chunks were
+// read, skipped tracks are counted
+func (f *File) checkTrackCount(opts ReadOptions) error {
+	if int(f.Header.NumTracks) == f.trackChunks {
+		return nil
+	}
+
+	return f.warn(opts, Warning{
+		Track:   -1,
+		Message: fmt.Sprintf("header declares %v tracks but %v track chunks were found", f.Header.NumTracks, f.trackChunks),
+	})
 }
 
 // ReadFrom reads a midi file from reader
 func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	return f.ReadFromWithOptions(r, ReadOptions{})
+}
+
+// ReadFromWithOptions reads a midi file from reader, recoverable problems are collected in
+// Warnings or returned as error in strict mode
+func (f *File) ReadFromWithOptions(r io.Reader, opts ReadOptions) (int64, error) {
 	var totalBytesRead int64
+	var errs []error
 
+	if opts.Progress != nil {
+		r = NewProgressReader(r, opts.Progress)
+	}
+
+	f.Header = nil
 	f.Chunks = []*Chunk{}
 	f.Tracks = []*Track{}
+	f.Warnings = nil
+	f.trackErrors = nil
+	f.trackChunks = 0
 
 	for {
+		if f.declaredTracksRead(opts) {
+			// Only check if there is trailing data, it is not read
+			n, _ := io.ReadFull(r, make([]byte, 1))
+			if n > 0 {
+				err := f.warn(opts, Warning{Track: -1, Message: "trailing data ignored"})
+				if err != nil {
+					return 0, err
+				}
+			}
+
+			break
+		}
+
 		chunk := &Chunk{}
 		chunkBytesRead, err := chunk.ReadFrom(r)
 		if err != nil {
@@ -234,30 +811,46 @@ func (f *File) ReadFrom(r io.Reader) (int64, error) {
 				break
 			}
 
-			return 0, err
+			return 0, errors.Join(append(errs, err)...)
 		}
 
+		opts.debug("midi chunk", "type", string(chunk.Type), "offset", totalBytesRead, "length", chunk.Length)
+		opts.Metrics.addChunk(chunk)
 		totalBytesRead += chunkBytesRead
 
-		f.Chunks = append(f.Chunks, chunk)
-
 		if chunk.Type == HeaderType {
-			f.Header, err = chunk.FileHeader()
+			err := f.readHeaderChunk(chunk, opts)
 			if err != nil {
 				return 0, err
 			}
-		} else if chunk.Type == TrackType {
-			track, err := chunk.Track()
-			if err != nil {
+
+			continue
+		}
+
+		err = f.readChunk(chunk, opts)
+		if err != nil {
+			if !opts.CollectErrors {
 				return 0, err
 			}
 
-			f.Tracks = append(f.Tracks, track)
+			errs = append(errs, err)
 		}
 	}
 
 	if f.Header == nil {
-		return 0, errors.New("no midi header chunk found")
+		return 0, errors.Join(append(errs, errors.New("no midi header chunk found"))...)
+	}
+
+	err := f.checkTrackCount(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.CollectErrors {
+		err = f.collectedError(opts, errs)
+		if err != nil {
+			return totalBytesRead, err
+		}
 	}
 
 	return totalBytesRead, nil
@@ -9,6 +9,40 @@ type SystemRealTimeEvent struct {
 	coreEvent
 }
 
+// Shared real time events with a zero delta time, these carry no payload so live streams
+// can reuse them instead of allocating. They must be treated as read-only
+var (
+	// TimingClockEvent shared timing clock event
+	TimingClockEvent Event = &SystemRealTimeEvent{coreEvent: coreEvent{eventType: TimingClock}}
+	// StartEvent shared start event
+	StartEvent Event = &SystemRealTimeEvent{coreEvent: coreEvent{eventType: Start}}
+	// ContinueEvent shared continue event
+	ContinueEvent Event = &SystemRealTimeEvent{coreEvent: coreEvent{eventType: Continue}}
+	// StopEvent shared stop event
+	StopEvent Event = &SystemRealTimeEvent{coreEvent: coreEvent{eventType: Stop}}
+	// ActiveSensingEvent shared active sensing event
+	ActiveSensingEvent Event = &SystemRealTimeEvent{coreEvent: coreEvent{eventType: ActiveSensing}}
+)
+
+// RealTimeEvent returns the shared read-only event for a real time status byte, or nil if
+// the status byte is not a real time message
+func RealTimeEvent(statusByte uint8) Event {
+	switch statusByte {
+	case 0xF8:
+		return TimingClockEvent
+	case 0xFA:
+		return StartEvent
+	case 0xFB:
+		return ContinueEvent
+	case 0xFC:
+		return StopEvent
+	case 0xFE:
+		return ActiveSensingEvent
+	}
+
+	return nil
+}
+
 // WriteTo writer
 func (e *SystemRealTimeEvent) WriteTo(w io.Writer) (int64, error) {
 	var totalBytesWritten int64
@@ -0,0 +1,280 @@
+package midi
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// recordedNote is an open note during recording, used to keep quantized notes from collapsing
+type recordedNote struct {
+	tick      uint32
+	quantized uint32
+}
+
+// Recorder records live events into a track, wall clock time is converted to ticks by the
+// embedded capture
+type Recorder struct {
+	*Capture
+	// QuantizeGrid snaps note on and note off ticks to multiples of the grid while recording,
+	// 0 disables quantization
+	QuantizeGrid uint32
+	// QuantizeStrength is the fraction (0-1) of the distance to the nearest grid point a note is moved
+	QuantizeStrength float64
+	// Punch limits recording to the window from PunchIn up to PunchOut, on commit the recorded
+	// window replaces the channel events of the track in that window
+	Punch    bool
+	PunchIn  uint32
+	PunchOut uint32
+	// Monitor receives every added event, also events outside the punch window, may be nil
+	Monitor EventSink
+	// Metronome generates the count-in clicks, a default metronome if nil
+	Metronome *Metronome
+
+	track  *Track
+	tick   uint32
+	events []AbsEvent
+	open   map[uint16][]recordedNote
+	// punched counts the recorded notes per channel and key without note off
+	punched map[uint16]int
+	// countInEnd is the wall clock time recording starts after a count-in
+	countInEnd time.Time
+}
+
+// recorderWriter receives the events of the capture of a recorder
+type recorderWriter struct {
+	recorder *Recorder
+}
+
+// WriteEvent records the captured event
+func (w recorderWriter) WriteEvent(event Event) error {
+	w.recorder.record(event)
+	return nil
+}
+
+// NewRecorder creates a new recorder recording into track
+func NewRecorder(track *Track, bpm float64, ticksPerQuarterNote uint16) *Recorder {
+	r := &Recorder{
+		QuantizeStrength: 1.0,
+		track:            track,
+		open:             map[uint16][]recordedNote{},
+		punched:          map[uint16]int{},
+	}
+
+	r.Capture = NewCapture(recorderWriter{recorder: r}, bpm, ticksPerQuarterNote)
+
+	return r
+}
+
+// quantize moves tick towards the nearest grid point
+func (r *Recorder) quantize(tick uint32) uint32 {
+	grid := float64(r.QuantizeGrid)
+	nearest := math.Round(float64(tick)/grid) * grid
+
+	return uint32(math.Round(float64(tick) + (nearest-float64(tick))*r.QuantizeStrength))
+}
+
+// CountIn clicks bars of time signature ts to sink at the tempo of the recorder starting at t
+// and starts recording after the last bar. Events added during the count-in are monitored but
+// not recorded. CountIn blocks until the count-in is over or the context is done
+func (r *Recorder) CountIn(ctx context.Context, t time.Time, bars int, ts TimeSignatureChange, sink EventSink) error {
+	if r.BPM <= 0 {
+		return errors.New("count-in needs a tempo above 0 BPM")
+	}
+
+	metronome := r.Metronome
+	if metronome == nil {
+		metronome = NewMetronome()
+	}
+
+	tempo := uint32(60000000 / r.BPM)
+	clicks, times, length := metronome.countIn(bars, ts, tempo, r.TicksPerQuarterNote)
+
+	r.countInEnd = t.Add(length)
+	r.Start(r.countInEnd)
+
+	for index, ae := range clicks {
+		at := t.Add(times[index])
+
+		err := sleepUntil(ctx, at)
+		if err != nil {
+			return err
+		}
+
+		err = dispatch(sink, at, MetronomeTrack, ae.Tick, ae.Event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sleepUntil(ctx, r.countInEnd)
+}
+
+// Add records an event received at time t and passes it to the monitor
+func (r *Recorder) Add(t time.Time, event Event) error {
+	if t.Before(r.countInEnd) {
+		if r.Monitor != nil {
+			return r.Monitor.HandleEvent(0, 0, event)
+		}
+
+		return nil
+	}
+
+	if err := r.Capture.Add(t, event); err != nil {
+		return err
+	}
+
+	if r.Monitor != nil {
+		return r.Monitor.HandleEvent(0, r.Capture.Tick(), event)
+	}
+
+	return nil
+}
+
+// inPunch returns true if tick is inside the punch window or punch is disabled
+func (r *Recorder) inPunch(tick uint32) bool {
+	return !r.Punch || (tick >= r.PunchIn && tick < r.PunchOut)
+}
+
+// record stores a captured event at its absolute tick, quantizing notes if enabled
+func (r *Recorder) record(event Event) {
+	r.tick += event.DeltaTime()
+	tick := r.tick
+
+	if !r.punchEvent(event, &tick) {
+		return
+	}
+
+	if ce, ok := event.(*ChannelEvent); ok && r.QuantizeGrid > 0 {
+		key := ce.Channel<<8 | ce.Value1
+
+		switch {
+		case isNoteOff(ce):
+			quantized := r.quantize(tick)
+
+			if open := r.open[key]; len(open) > 0 {
+				note := open[0]
+				r.open[key] = open[1:]
+
+				// Keep the played length if the note would collapse
+				if quantized <= note.quantized {
+					quantized = note.quantized + tick - note.tick
+				}
+			}
+
+			tick = quantized
+		case ce.eventType == NoteOn:
+			quantized := r.quantize(tick)
+			r.open[key] = append(r.open[key], recordedNote{tick: tick, quantized: quantized})
+			tick = quantized
+		}
+	}
+
+	r.events = append(r.events, AbsEvent{Tick: tick, Event: event})
+}
+
+// punchEvent returns false if event is outside the punch window, note offs of notes recorded
+// inside the window are moved to the punch out tick instead
+func (r *Recorder) punchEvent(event Event, tick *uint32) bool {
+	ce, ok := event.(*ChannelEvent)
+	if !r.Punch || !ok {
+		return r.inPunch(*tick)
+	}
+
+	key := ce.Channel<<8 | ce.Value1
+
+	switch {
+	case isNoteOff(ce):
+		if r.punched[key] == 0 {
+			return false
+		}
+
+		r.punched[key]--
+
+		if !r.inPunch(*tick) {
+			*tick = r.PunchOut
+		}
+
+		return true
+	case ce.eventType == NoteOn:
+		if !r.inPunch(*tick) {
+			return false
+		}
+
+		r.punched[key]++
+
+		return true
+	}
+
+	return r.inPunch(*tick)
+}
+
+// Events returns the recorded events that are not yet committed, sorted by tick
+func (r *Recorder) Events() []AbsEvent {
+	events := make([]AbsEvent, len(r.events))
+	copy(events, r.events)
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Tick < events[j].Tick
+	})
+
+	return events
+}
+
+// Commit merges the recorded events into the track and clears them, with punch enabled the
+// channel events of the track in the punch window are removed first
+func (r *Recorder) Commit() {
+	if r.Punch {
+		r.clearPunchWindow()
+	}
+
+	Overdub(r.track, r.Events())
+
+	r.events = nil
+	r.open = map[uint16][]recordedNote{}
+	r.punched = map[uint16]int{}
+}
+
+// clearPunchWindow removes the channel events in the punch window from the track, notes are
+// removed as a whole when they start in the window and kept when they start before it
+func (r *Recorder) clearPunchWindow() {
+	existing := r.track.AbsEvents()
+	kept := make([]AbsEvent, 0, len(existing))
+	removedNotes := map[uint16][]bool{}
+
+	for _, ae := range existing {
+		ce, ok := ae.Event.(*ChannelEvent)
+		if !ok {
+			kept = append(kept, ae)
+			continue
+		}
+
+		key := ce.Channel<<8 | ce.Value1
+		inside := ae.Tick >= r.PunchIn && ae.Tick < r.PunchOut
+
+		switch {
+		case isNoteOff(ce):
+			if open := removedNotes[key]; len(open) > 0 {
+				removedNotes[key] = open[1:]
+				if open[0] {
+					continue
+				}
+			}
+
+			kept = append(kept, ae)
+		case ce.eventType == NoteOn:
+			removedNotes[key] = append(removedNotes[key], inside)
+			if !inside {
+				kept = append(kept, ae)
+			}
+		default:
+			if !inside {
+				kept = append(kept, ae)
+			}
+		}
+	}
+
+	r.track.SetAbsEvents(kept)
+}
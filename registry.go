@@ -0,0 +1,152 @@
+package midi
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// StatusParser parses an event for a status byte, data starts after the status byte and the
+// number of data bytes consumed is returned
+type StatusParser func(statusByte uint8, deltaTime uint32, data []byte) (event Event, bytesRead uint32, err error)
+
+// MetaParser parses the data of a meta event of a registered meta type
+type MetaParser func(deltaTime uint32, data []byte) (Event, error)
+
+// SysExParser parses the data of a system exclusive event starting with a registered prefix
+type SysExParser func(deltaTime uint32, data []byte) (Event, error)
+
+// sysExParserEntry pairs a registered prefix with its parser
+type sysExParserEntry struct {
+	prefix string
+	parser SysExParser
+}
+
+var (
+	// registryMutex serializes registrations, readers use the atomic snapshots
+	registryMutex sync.Mutex
+	// statusParsers holds a *statusParserTable with the active status byte mapping
+	statusParsers atomic.Value
+	// metaParsers holds a map[MetaType]MetaParser
+	metaParsers atomic.Value
+	// sysExParsers holds a []sysExParserEntry sorted from longest to shortest prefix
+	sysExParsers atomic.Value
+)
+
+// statusParserTable is the status byte mapping including registered parsers
+type statusParserTable struct {
+	parsers    [256]parseFunction
+	registered [256]bool
+}
+
+func init() {
+	statusParsers.Store(&statusParserTable{parsers: statusByteToParseFunctionMapping})
+	metaParsers.Store(map[MetaType]MetaParser{})
+	sysExParsers.Store([]sysExParserEntry{})
+}
+
+// activeStatusParsers returns the status byte mapping including registered parsers
+func activeStatusParsers() *statusParserTable {
+	return statusParsers.Load().(*statusParserTable)
+}
+
+// RegisterStatusParser installs a parser for a status byte, replacing the built-in parser.
+// Running status follows the status byte range: channel status bytes activate it, system
+// exclusive and system common status bytes cancel it. A nil parser restores the built-in one
+func RegisterStatusParser(statusByte uint8, parser StatusParser) error {
+	if statusByte < 0x80 {
+		return errors.New("status byte should have the most significant bit set")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	table := *activeStatusParsers()
+
+	if parser == nil {
+		table.parsers[statusByte] = statusByteToParseFunctionMapping[statusByte]
+		table.registered[statusByte] = false
+	} else {
+		table.parsers[statusByte] = parseFunction(parser)
+		table.registered[statusByte] = true
+	}
+
+	statusParsers.Store(&table)
+
+	return nil
+}
+
+// RegisterMetaParser installs a parser for a meta type, the parser receives a private copy of
+// the meta data. A nil parser restores the built-in meta event parsing
+func RegisterMetaParser(metaType MetaType, parser MetaParser) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	current := metaParsers.Load().(map[MetaType]MetaParser)
+	parsers := make(map[MetaType]MetaParser, len(current)+1)
+
+	for t, p := range current {
+		parsers[t] = p
+	}
+
+	if parser == nil {
+		delete(parsers, metaType)
+	} else {
+		parsers[metaType] = parser
+	}
+
+	metaParsers.Store(parsers)
+}
+
+// RegisterSysExParser installs a parser for system exclusive events whose data starts with
+// prefix, the longest matching prefix wins. The parser receives a private copy of the data.
+// A nil parser removes the registration
+func RegisterSysExParser(prefix []byte, parser SysExParser) error {
+	if len(prefix) == 0 {
+		return errors.New("system exclusive prefix should not be empty")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	current := sysExParsers.Load().([]sysExParserEntry)
+	entries := make([]sysExParserEntry, 0, len(current)+1)
+
+	for _, entry := range current {
+		if entry.prefix != string(prefix) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if parser != nil {
+		entries = append(entries, sysExParserEntry{prefix: string(prefix), parser: parser})
+	}
+
+	// Keep longest prefixes first so the first match is the most specific
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && len(entries[j].prefix) > len(entries[j-1].prefix); j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+		}
+	}
+
+	sysExParsers.Store(entries)
+
+	return nil
+}
+
+// registeredMetaParser returns the registered parser for a meta type, or nil
+func registeredMetaParser(metaType MetaType) MetaParser {
+	return metaParsers.Load().(map[MetaType]MetaParser)[metaType]
+}
+
+// registeredSysExParser returns the registered parser for system exclusive data, or nil
+func registeredSysExParser(data []byte) SysExParser {
+	for _, entry := range sysExParsers.Load().([]sysExParserEntry) {
+		if strings.HasPrefix(string(data), entry.prefix) {
+			return entry.parser
+		}
+	}
+
+	return nil
+}
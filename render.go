@@ -0,0 +1,92 @@
+package midi
+
+import (
+	"time"
+)
+
+// RenderSink receives channel events with sample frame timestamps, implemented by software
+// synthesizers to render the events of the sequencer without gomidi depending on an audio package
+type RenderSink interface {
+	NoteOn(frame int64, channel, key, velocity uint8)
+	NoteOff(frame int64, channel, key, velocity uint8)
+	PolyphonicKeyPressure(frame int64, channel, key, pressure uint8)
+	ControlChange(frame int64, channel, controller, value uint8)
+	ProgramChange(frame int64, channel, program uint8)
+	ChannelPressure(frame int64, channel, pressure uint8)
+	// PitchBend value is 14 bit with 0x2000 as center
+	PitchBend(frame int64, channel uint8, value uint16)
+}
+
+// RenderAdapter is an event sink converting event ticks to sample frames for a render sink,
+// non channel events are ignored. Use it as the sink of a Player driven by a SampleClock or of
+// File.Render for offline rendering
+type RenderAdapter struct {
+	Sink       RenderSink
+	SampleRate int
+
+	tempoMap *TempoMap
+}
+
+// NewRenderAdapter creates a new render adapter, ticks are converted with the tempo map
+func NewRenderAdapter(sink RenderSink, sampleRate int, tempoMap *TempoMap) *RenderAdapter {
+	return &RenderAdapter{
+		Sink:       sink,
+		SampleRate: sampleRate,
+		tempoMap:   tempoMap,
+	}
+}
+
+// Frame returns the sample frame of tick
+func (a *RenderAdapter) Frame(tick uint32) int64 {
+	d := a.tempoMap.TickToDuration(tick)
+	return int64(d) * int64(a.SampleRate) / int64(time.Second)
+}
+
+// HandleEvent passes a channel event to the render sink at the sample frame of tick
+func (a *RenderAdapter) HandleEvent(track int, tick uint32, event Event) error {
+	ce, ok := event.(*ChannelEvent)
+	if !ok {
+		return nil
+	}
+
+	frame := a.Frame(tick)
+	channel := uint8(ce.Channel)
+
+	switch ce.eventType {
+	case NoteOff:
+		a.Sink.NoteOff(frame, channel, uint8(ce.Value1), uint8(ce.Value2))
+	case NoteOn:
+		if ce.Value2 == 0 {
+			a.Sink.NoteOff(frame, channel, uint8(ce.Value1), 0)
+		} else {
+			a.Sink.NoteOn(frame, channel, uint8(ce.Value1), uint8(ce.Value2))
+		}
+	case PolyphonicKeyPressure:
+		a.Sink.PolyphonicKeyPressure(frame, channel, uint8(ce.Value1), uint8(ce.Value2))
+	case ControlChange:
+		a.Sink.ControlChange(frame, channel, uint8(ce.Value1), uint8(ce.Value2))
+	case ProgramChange:
+		a.Sink.ProgramChange(frame, channel, uint8(ce.Value1))
+	case ChannelPressure:
+		a.Sink.ChannelPressure(frame, channel, uint8(ce.Value1))
+	case PitchWheelChange:
+		a.Sink.PitchBend(frame, channel, ce.Value1)
+	}
+
+	return nil
+}
+
+// Render passes all channel events of the file in time order to a render sink
+func (f *File) Render(sink RenderSink, sampleRate int) error {
+	adapter := NewRenderAdapter(sink, sampleRate, f.TempoMap())
+	it := NewEventIterator(f, false)
+
+	for it.Next() {
+		err := adapter.HandleEvent(it.Track(), it.Tick(), it.Event())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package midi
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// AllTracks matches events of every track in a route
+	AllTracks = -1
+	// AllChannels matches channel events of every channel and non channel events in a route
+	AllChannels = -1
+	// KeepChannel leaves the channel of routed channel events unchanged
+	KeepChannel = -1
+)
+
+// Route sends matching events to a named port
+type Route struct {
+	// Track index to match or AllTracks
+	Track int
+	// Channel to match (0-15) or AllChannels
+	Channel int
+	// Port name of the sink
+	Port string
+	// RemapChannel sets the channel of routed channel events (0-15) or KeepChannel
+	RemapChannel int
+}
+
+// Router is an event sink that distributes events over named sinks using a routing table, so
+// the player can drive multiple devices from one file. The player only applies its lookahead to
+// the router if all ports accept target times
+type Router struct {
+	ports  map[string]EventSink
+	routes []Route
+}
+
+// NewRouter creates a new empty router
+func NewRouter() *Router {
+	return &Router{
+		ports:  map[string]EventSink{},
+		routes: []Route{},
+	}
+}
+
+// AddPort adds a named sink
+func (r *Router) AddPort(name string, sink EventSink) {
+	r.ports[name] = sink
+}
+
+// AddRoute adds a route to a port added before
+func (r *Router) AddRoute(route Route) error {
+	if _, ok := r.ports[route.Port]; !ok {
+		return fmt.Errorf("unknown port %v", route.Port)
+	}
+
+	if route.RemapChannel < KeepChannel || route.RemapChannel > 15 {
+		return fmt.Errorf("invalid remap channel %v", route.RemapChannel)
+	}
+
+	r.routes = append(r.routes, route)
+
+	return nil
+}
+
+// route calls fn for every matching route with the event to send
+func (r *Router) route(track int, event Event, fn func(sink EventSink, event Event) error) error {
+	ce, isChannelEvent := event.(*ChannelEvent)
+
+	for _, route := range r.routes {
+		if route.Track != AllTracks && route.Track != track {
+			continue
+		}
+
+		if route.Channel != AllChannels && (!isChannelEvent || int(ce.Channel) != route.Channel) {
+			continue
+		}
+
+		routed := event
+		if isChannelEvent && route.RemapChannel != KeepChannel && int(ce.Channel) != route.RemapChannel {
+			// Copy so the events of the file are not changed
+			remapped := *ce
+			remapped.Channel = uint16(route.RemapChannel)
+			routed = &remapped
+		}
+
+		err := fn(r.ports[route.Port], routed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HandleEvent sends the event to the ports of all matching routes
+func (r *Router) HandleEvent(track int, tick uint32, event Event) error {
+	return r.route(track, event, func(sink EventSink, event Event) error {
+		return sink.HandleEvent(track, tick, event)
+	})
+}
+
+// HandleTimedEvent sends the event with its target time to the ports of all matching routes
+func (r *Router) HandleTimedEvent(at time.Time, track int, tick uint32, event Event) error {
+	return r.route(track, event, func(sink EventSink, event Event) error {
+		return dispatch(sink, at, track, tick, event)
+	})
+}
+
+// acceptsTargetTimes returns true if all ports accept target times
+func (r *Router) acceptsTargetTimes() bool {
+	for _, sink := range r.ports {
+		if !acceptsTargetTimes(sink) {
+			return false
+		}
+	}
+
+	return true
+}
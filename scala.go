@@ -0,0 +1,359 @@
+package midi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is a Scala (.scl) scale, pitches are in cents relative to the 1/1 of the scale and the
+// last pitch is the period (usually 1200 cents)
+type Scale struct {
+	Description string
+	Cents       []float64
+}
+
+// KeyboardMapping is a Scala keyboard mapping (.kbm), a size of 0 maps scale degrees linearly
+// to keys
+type KeyboardMapping struct {
+	Size               int
+	FirstKey           uint8
+	LastKey            uint8
+	MiddleKey          uint8
+	ReferenceKey       uint8
+	ReferenceFrequency float64
+	// Scale degree that is the formal octave
+	FormalOctave int
+	// Scale degree per key in the mapping pattern, -1 for unmapped keys
+	Mapping []int
+}
+
+// NewLinearKeyboardMapping creates the default mapping: every key is the next scale degree,
+// key 60 is the 1/1 and key 69 is tuned to 440 Hz
+func NewLinearKeyboardMapping() *KeyboardMapping {
+	return &KeyboardMapping{
+		FirstKey:           0,
+		LastKey:            127,
+		MiddleKey:          60,
+		ReferenceKey:       69,
+		ReferenceFrequency: A4Frequency,
+	}
+}
+
+// scalaLines returns the lines of a Scala file without comments
+func scalaLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// firstField returns the first whitespace separated field of a line
+func firstField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
+
+// parseScalaPitch parses a pitch in cents (with a period) or as a ratio
+func parseScalaPitch(s string) (float64, error) {
+	if strings.Contains(s, ".") {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+
+	numerator, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	denominator := 1.0
+	if len(parts) == 2 {
+		denominator, err = strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if numerator <= 0 || denominator <= 0 {
+		return 0, fmt.Errorf("invalid ratio %v", s)
+	}
+
+	return 1200 * math.Log2(numerator/denominator), nil
+}
+
+// ParseScale parses a Scala scale file
+func ParseScale(r io.Reader) (*Scale, error) {
+	lines, err := scalaLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) < 2 {
+		return nil, errors.New("scale file should contain a description and the number of notes")
+	}
+
+	count, err := strconv.Atoi(firstField(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid number of notes: %v", err)
+	}
+
+	if count < 1 || len(lines)-2 < count {
+		return nil, fmt.Errorf("scale file should contain %v pitches", count)
+	}
+
+	scale := &Scale{
+		Description: strings.TrimSpace(lines[0]),
+		Cents:       make([]float64, count),
+	}
+
+	for index := 0; index < count; index++ {
+		scale.Cents[index], err = parseScalaPitch(firstField(lines[2+index]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pitch %v: %v", index+1, err)
+		}
+	}
+
+	return scale, nil
+}
+
+// ParseKeyboardMapping parses a Scala keyboard mapping file
+func ParseKeyboardMapping(r io.Reader) (*KeyboardMapping, error) {
+	lines, err := scalaLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for _, line := range lines {
+		if field := firstField(line); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) < 7 {
+		return nil, errors.New("keyboard mapping file should contain 7 header values")
+	}
+
+	ints := make([]int, 7)
+	for index := range ints {
+		if index == 5 {
+			continue
+		}
+
+		ints[index], err = strconv.Atoi(fields[index])
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyboard mapping value %v: %v", index+1, err)
+		}
+	}
+
+	for _, key := range ints[1:5] {
+		if key < 0 || key > 127 {
+			return nil, fmt.Errorf("keyboard mapping key %v out of range", key)
+		}
+	}
+
+	m := &KeyboardMapping{
+		Size:         ints[0],
+		FirstKey:     uint8(ints[1]),
+		LastKey:      uint8(ints[2]),
+		MiddleKey:    uint8(ints[3]),
+		ReferenceKey: uint8(ints[4]),
+		FormalOctave: ints[6],
+		Mapping:      []int{},
+	}
+
+	m.ReferenceFrequency, err = strconv.ParseFloat(fields[5], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference frequency: %v", err)
+	}
+
+	if m.Size < 0 || len(fields)-7 < m.Size {
+		return nil, fmt.Errorf("keyboard mapping should contain %v entries", m.Size)
+	}
+
+	for _, field := range fields[7 : 7+m.Size] {
+		if field == "x" || field == "X" {
+			m.Mapping = append(m.Mapping, -1)
+			continue
+		}
+
+		degree, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping entry %v: %v", field, err)
+		}
+
+		m.Mapping = append(m.Mapping, degree)
+	}
+
+	return m, nil
+}
+
+// floorDivMod returns floored division and modulo
+func floorDivMod(a, b int) (int, int) {
+	q := a / b
+	r := a % b
+
+	if r < 0 {
+		q--
+		r += b
+	}
+
+	return q, r
+}
+
+// degreeCents returns the cents of a scale degree relative to the 1/1
+func (s *Scale) degreeCents(degree int) float64 {
+	n := len(s.Cents)
+	period := s.Cents[n-1]
+	octave, step := floorDivMod(degree, n)
+
+	cents := float64(octave) * period
+	if step > 0 {
+		cents += s.Cents[step-1]
+	}
+
+	return cents
+}
+
+// keyCents returns the cents of key relative to the middle key of the mapping
+func (s *Scale) keyCents(m *KeyboardMapping, key int) (float64, bool) {
+	offset := key - int(m.MiddleKey)
+
+	if m.Size == 0 {
+		return s.degreeCents(offset), true
+	}
+
+	octave, index := floorDivMod(offset, m.Size)
+	degree := m.Mapping[index]
+	if degree < 0 {
+		return 0, false
+	}
+
+	return s.degreeCents(octave*m.FormalOctave + degree), true
+}
+
+// Frequencies returns the frequency of every key with the keyboard mapping (linear if nil),
+// unmapped keys and keys outside the mapping range have frequency 0
+func (s *Scale) Frequencies(m *KeyboardMapping) [128]float64 {
+	frequencies := [128]float64{}
+
+	if m == nil {
+		m = NewLinearKeyboardMapping()
+	}
+
+	if len(s.Cents) == 0 {
+		return frequencies
+	}
+
+	referenceCents, ok := s.keyCents(m, int(m.ReferenceKey))
+	if !ok {
+		return frequencies
+	}
+
+	for key := int(m.FirstKey); key <= int(m.LastKey) && key < 128; key++ {
+		cents, ok := s.keyCents(m, key)
+		if ok {
+			frequencies[key] = m.ReferenceFrequency * math.Pow(2, (cents-referenceCents)/1200)
+		}
+	}
+
+	return frequencies
+}
+
+// Offsets returns the deviation in cents of every key from equal temperament (A4 = 440 Hz) for
+// use with RetuneOptions, unmapped keys have offset 0
+func (s *Scale) Offsets(m *KeyboardMapping) [128]float64 {
+	offsets := [128]float64{}
+
+	for key, f := range s.Frequencies(m) {
+		if f > 0 {
+			offsets[key] = 1200*math.Log2(f/A4Frequency) - float64(key-69)*100
+		}
+	}
+
+	return offsets
+}
+
+// maxTuningChanges is the largest number of key changes in a single note tuning change message,
+// the count is a data byte
+const maxTuningChanges = 127
+
+// TuningSysEx creates MIDI Tuning Standard single note tuning change (real time) system exclusive
+// events retuning every key with a frequency greater than 0. A message holds at most 127 key
+// changes, retuning all 128 keys takes two messages
+func TuningSysEx(deviceID uint8, program uint8, frequencies [128]float64) []*SystemExclusiveEvent {
+	events := []*SystemExclusiveEvent{}
+	changes := []byte{}
+	count := 0
+
+	flush := func() {
+		data := []byte{0x7F, deviceID & 0x7F, 0x08, 0x02, program & 0x7F, byte(count)}
+		data = append(data, changes...)
+		data = append(data, 0xF7)
+
+		events = append(events, &SystemExclusiveEvent{
+			coreEvent: coreEvent{eventType: SystemExclusive},
+			Data:      data,
+		})
+
+		changes = []byte{}
+		count = 0
+	}
+
+	for key, f := range frequencies {
+		if f <= 0 {
+			continue
+		}
+
+		note := 69 + 12*math.Log2(f/A4Frequency)
+		semitone := math.Floor(note)
+		fraction := math.Round((note - semitone) * 16384)
+
+		if fraction >= 16384 {
+			semitone++
+			fraction = 0
+		}
+
+		if semitone < 0 {
+			semitone, fraction = 0, 0
+		} else if semitone > 127 {
+			semitone, fraction = 127, 16383
+		}
+
+		// 7F 7F 7F means no change, the highest frequency that can be set is one step lower
+		if semitone == 127 && fraction > 16382 {
+			fraction = 16382
+		}
+
+		changes = append(changes, byte(key), byte(semitone), byte(int(fraction)>>7), byte(int(fraction)&0x7F))
+		count++
+
+		if count == maxTuningChanges {
+			flush()
+		}
+	}
+
+	if count > 0 || len(events) == 0 {
+		flush()
+	}
+
+	return events
+}
@@ -0,0 +1,165 @@
+package midi
+
+import (
+	"sort"
+)
+
+// midiPort is the unofficial but common meta type selecting the output port of a track
+const midiPort MetaType = 0x21
+
+// setupMetaTypes are the meta types whose last value before a section still applies in it
+var setupMetaTypes = map[MetaType]bool{
+	SequenceNumber:  true,
+	CopyrightNotice: true,
+	TrackName:       true,
+	InstrumentName:  true,
+	ChannelPrefix:   true,
+	midiPort:        true,
+	SetTempo:        true,
+	TimeSignature:   true,
+	KeySignature:    true,
+}
+
+// setupKey identifies a piece of state set by an event, e.g. the value of one controller
+type setupKey struct {
+	eventType EventType
+	channel   uint16
+	number    uint16
+}
+
+// setupEntry is the last event setting a piece of state with its position in the track
+type setupEntry struct {
+	index int
+	event Event
+}
+
+// trackSetupAt returns the events that set the state of a track at tick: the last program
+// change, controller value, pitch wheel and channel pressure of every channel and the last
+// tempo, time signature, key signature, name and port meta events before tick. The events are
+// in their original order so bank selects stay before program changes and parameter numbers
+// before data entry, channel mode controllers are left out
+func trackSetupAt(track *Track, tick uint32) []Event {
+	state := map[setupKey]setupEntry{}
+	current := uint32(0)
+
+	for index, event := range track.Events {
+		current += event.DeltaTime()
+		if current >= tick {
+			break
+		}
+
+		switch e := event.(type) {
+		case *ChannelEvent:
+			key := setupKey{eventType: e.eventType, channel: e.Channel}
+
+			switch e.eventType {
+			case ControlChange:
+				if e.Value1 >= 120 {
+					continue
+				}
+
+				key.number = e.Value1
+			case ProgramChange, PitchWheelChange, ChannelPressure:
+			default:
+				continue
+			}
+
+			state[key] = setupEntry{index: index, event: e}
+		case *MetaEvent:
+			if setupMetaTypes[e.MetaType] {
+				state[setupKey{eventType: Meta, number: uint16(e.MetaType)}] = setupEntry{index: index, event: e}
+			}
+		}
+	}
+
+	entries := make([]setupEntry, 0, len(state))
+	for _, entry := range state {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].index < entries[j].index
+	})
+
+	events := make([]Event, len(entries))
+	for index, entry := range entries {
+		events[index] = cloneEvent(entry.event)
+		events[index].SetDeltaTime(0)
+	}
+
+	return events
+}
+
+// ExtractSection returns a standalone file with the events from startTick up to endTick, moved
+// to start at tick 0. Every track starts with the events setting its state at startTick, see
+// trackSetupAt, so the excerpt sounds as in the original. Note offs of notes started before the
+// section are left out and notes still sounding at endTick are ended there. System exclusive
+// events before the section are not repeated
+func ExtractSection(f *File, startTick, endTick uint32) *File {
+	if endTick < startTick {
+		endTick = startTick
+	}
+
+	length := endTick - startTick
+	tracks := make([]*Track, len(f.Tracks))
+
+	for trackIndex, track := range f.Tracks {
+		events := []AbsEvent{}
+
+		for _, event := range trackSetupAt(track, startTick) {
+			events = append(events, AbsEvent{Tick: 0, Event: event})
+		}
+
+		open := map[uint16]int{}
+
+		for _, ae := range track.AbsEvents() {
+			if ae.Tick < startTick || ae.Tick >= endTick || isEndOfTrack(ae.Event) {
+				continue
+			}
+
+			if ce, ok := ae.Event.(*ChannelEvent); ok && (ce.eventType == NoteOn || ce.eventType == NoteOff) {
+				id := ce.Channel<<8 | ce.Value1
+
+				if isNoteOff(ce) {
+					if open[id] == 0 {
+						continue
+					}
+
+					open[id]--
+				} else {
+					open[id]++
+				}
+			}
+
+			events = append(events, AbsEvent{Tick: ae.Tick - startTick, Event: cloneEvent(ae.Event)})
+		}
+
+		ids := make([]int, 0, len(open))
+		for id, count := range open {
+			for ; count > 0; count-- {
+				ids = append(ids, int(id))
+			}
+		}
+
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			events = append(events, AbsEvent{Tick: length, Event: NewChannelEvent(0, NoteOff, uint16(id>>8), uint16(id&0xFF), 0)})
+		}
+
+		events = append(events, AbsEvent{Tick: length, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+		tracks[trackIndex] = NewTrackFromAbsEvents(events)
+	}
+
+	section := NewFile()
+
+	if f.Header != nil {
+		header := *f.Header
+		section.Header = &header
+	}
+
+	section.Tracks = tracks
+	section.Rebuild()
+
+	return section
+}
@@ -0,0 +1,125 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SequencerSpecificDecoder decodes the vendor defined data that follows the manufacturer id
+// in a sequencer specific meta event
+type SequencerSpecificDecoder func(data []byte) (interface{}, error)
+
+// SequencerSpecificEvent is a sequencer specific meta event decoded by a registered decoder
+type SequencerSpecificEvent struct {
+	MetaEvent
+	ManufacturerID []byte
+	// Value returned by the decoder
+	Value interface{}
+}
+
+// String representation
+func (e *SequencerSpecificEvent) String() string {
+	return fmt.Sprintf("%v: deltaTime %v, type %v, manufacturer %X, value %v", eventTypeToString(e.eventType), e.deltaTime, metaTypeToString(e.MetaType), e.ManufacturerID, e.Value)
+}
+
+var (
+	sequencerSpecificDecodersMutex sync.RWMutex
+	sequencerSpecificDecoders      = map[string]SequencerSpecificDecoder{}
+)
+
+// RegisterSequencerSpecificDecoder installs a decoder for sequencer specific meta events with
+// the given manufacturer id (one byte, or three bytes starting with 0x00). Parsed events with
+// a registered manufacturer id surface as *SequencerSpecificEvent
+func RegisterSequencerSpecificDecoder(manufacturerID []byte, decoder SequencerSpecificDecoder) error {
+	if len(manufacturerID) != 1 && !(len(manufacturerID) == 3 && manufacturerID[0] == 0) {
+		return errors.New("manufacturer id should be one byte or three bytes starting with 0x00")
+	}
+
+	sequencerSpecificDecodersMutex.Lock()
+	defer sequencerSpecificDecodersMutex.Unlock()
+
+	if decoder == nil {
+		delete(sequencerSpecificDecoders, string(manufacturerID))
+	} else {
+		sequencerSpecificDecoders[string(manufacturerID)] = decoder
+	}
+
+	return nil
+}
+
+// splitManufacturerID splits sequencer specific data in manufacturer id and vendor data
+func splitManufacturerID(data []byte) (id []byte, rest []byte, err error) {
+	if len(data) == 0 {
+		return nil, nil, errors.New("sequencer specific data should start with a manufacturer id")
+	}
+
+	if data[0] != 0 {
+		return data[:1], data[1:], nil
+	}
+
+	if len(data) < 3 {
+		return nil, nil, errors.New("extended manufacturer id should be three bytes long")
+	}
+
+	return data[:3], data[3:], nil
+}
+
+// DecodeSequencerSpecific decodes a sequencer specific meta event with the registered decoder
+// for its manufacturer id
+func DecodeSequencerSpecific(e *MetaEvent) (*SequencerSpecificEvent, error) {
+	if e.MetaType != SequencerSpecific {
+		return nil, errors.New("meta event is not a sequencer specific event")
+	}
+
+	id, rest, err := splitManufacturerID(e.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	sequencerSpecificDecodersMutex.RLock()
+	decoder := sequencerSpecificDecoders[string(id)]
+	sequencerSpecificDecodersMutex.RUnlock()
+
+	if decoder == nil {
+		return nil, fmt.Errorf("no sequencer specific decoder registered for manufacturer %X", id)
+	}
+
+	value, err := decoder(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SequencerSpecificEvent{
+		MetaEvent:      *e,
+		ManufacturerID: id,
+		Value:          value,
+	}, nil
+}
+
+// decodeSequencerSpecificEvent replaces a parsed sequencer specific meta event by its decoded
+// form if a decoder is registered, events that can not be decoded are kept as meta event
+func decodeSequencerSpecificEvent(e *MetaEvent) Event {
+	id, _, err := splitManufacturerID(e.Data)
+	if err != nil {
+		return e
+	}
+
+	sequencerSpecificDecodersMutex.RLock()
+	_, registered := sequencerSpecificDecoders[string(id)]
+	sequencerSpecificDecodersMutex.RUnlock()
+
+	if !registered {
+		return e
+	}
+
+	// Decoded values may reference the data so it can not stay in a pooled buffer
+	e.Retain()
+
+	decoded, err := DecodeSequencerSpecific(e)
+	if err != nil {
+		return e
+	}
+
+	return decoded
+}
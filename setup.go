@@ -0,0 +1,115 @@
+package midi
+
+// Controller numbers of the channel defaults and registered parameter numbers of a setup preamble
+const (
+	ControllerDataEntryMSB uint16 = 6
+	ControllerVolume       uint16 = 7
+	ControllerPan          uint16 = 10
+	ControllerDataEntryLSB uint16 = 38
+	ControllerReverb       uint16 = 91
+	ControllerChorus       uint16 = 93
+	ControllerRPNLSB       uint16 = 100
+	ControllerRPNMSB       uint16 = 101
+)
+
+// ResetMode selects the system reset message that starts a setup preamble
+type ResetMode int
+
+const (
+	// ResetNone sends no reset message
+	ResetNone ResetMode = iota
+	// ResetGM sends General MIDI system on
+	ResetGM
+	// ResetGM2 sends General MIDI 2 system on
+	ResetGM2
+	// ResetGS sends the Roland GS reset
+	ResetGS
+	// ResetXG sends the Yamaha XG system on
+	ResetXG
+)
+
+// resetMessages holds the system exclusive data of the reset messages, without the F0 status
+var resetMessages = map[ResetMode][]byte{
+	ResetGM:  {0x7E, 0x7F, 0x09, 0x01, 0xF7},
+	ResetGM2: {0x7E, 0x7F, 0x09, 0x03, 0xF7},
+	ResetGS:  {0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x7F, 0x00, 0x41, 0xF7},
+	ResetXG:  {0x43, 0x10, 0x4C, 0x00, 0x00, 0x7E, 0x00, 0xF7},
+}
+
+// ControllerValue is a controller with the value it is set to
+type ControllerValue struct {
+	Controller uint16
+	Value      uint16
+}
+
+// SetupOptions configures the preamble generated by SetupEvents
+type SetupOptions struct {
+	// Reset selects the system reset message sent first
+	Reset ResetMode
+	// Channels receiving the controller defaults and pitch bend range, all 16 channels if nil
+	Channels []uint16
+	// Controllers are set in order on every channel
+	Controllers []ControllerValue
+	// PitchBendRange in semitones is set with registered parameter number 0 on every channel, it
+	// is not sent if 0
+	PitchBendRange uint8
+}
+
+// DefaultSetupOptions returns the common preamble of distributable files: General MIDI system
+// on, volume 100, pan center, reverb 40, chorus 0 and a pitch bend range of 2 semitones on all
+// channels
+func DefaultSetupOptions() SetupOptions {
+	return SetupOptions{
+		Reset: ResetGM,
+		Controllers: []ControllerValue{
+			{Controller: ControllerVolume, Value: 100},
+			{Controller: ControllerPan, Value: 64},
+			{Controller: ControllerReverb, Value: 40},
+			{Controller: ControllerChorus, Value: 0},
+		},
+		PitchBendRange: 2,
+	}
+}
+
+// SetupEvents returns a file preamble with zero delta times for insertion at tick 0 of the first
+// track: the reset message, followed per channel by the controllers and the pitch bend range.
+// The registered parameter number is set to null after the pitch bend range so later data entry
+// does not change it. Receivers may need time after a reset, keep the first notes a little
+// later than the preamble
+func SetupEvents(opts SetupOptions) []Event {
+	events := []Event{}
+
+	if data, ok := resetMessages[opts.Reset]; ok {
+		events = append(events, &SystemExclusiveEvent{
+			coreEvent: coreEvent{eventType: SystemExclusive},
+			Data:      append([]byte{}, data...),
+		})
+	}
+
+	channels := opts.Channels
+	if channels == nil {
+		channels = make([]uint16, 16)
+		for channel := range channels {
+			channels[channel] = uint16(channel)
+		}
+	}
+
+	for _, channel := range channels {
+		for _, cv := range opts.Controllers {
+			events = append(events, NewChannelEvent(0, ControlChange, channel, cv.Controller&0x7F, cv.Value&0x7F))
+		}
+
+		if opts.PitchBendRange > 0 {
+			events = append(events,
+				NewChannelEvent(0, ControlChange, channel, ControllerRPNMSB, 0),
+				NewChannelEvent(0, ControlChange, channel, ControllerRPNLSB, 0),
+				NewChannelEvent(0, ControlChange, channel, ControllerDataEntryMSB, uint16(opts.PitchBendRange&0x7F)),
+				NewChannelEvent(0, ControlChange, channel, ControllerDataEntryLSB, 0),
+				NewChannelEvent(0, ControlChange, channel, ControllerRPNMSB, 127),
+				NewChannelEvent(0, ControlChange, channel, ControllerRPNLSB, 127),
+			)
+		}
+	}
+
+	return events
+}
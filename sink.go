@@ -0,0 +1,111 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EventSink receives events together with their track index and absolute tick
+type EventSink interface {
+	HandleEvent(track int, tick uint32, event Event) error
+}
+
+// EventSinkFunc adapts a function to the EventSink interface
+type EventSinkFunc func(track int, tick uint32, event Event) error
+
+// HandleEvent calls the function
+func (fn EventSinkFunc) HandleEvent(track int, tick uint32, event Event) error {
+	return fn(track, tick, event)
+}
+
+// ReadFromSink reads a midi file from reader and forwards the events to sink as they are
+// decoded like ReadFromSinkWithOptions with default options
+func (f *File) ReadFromSink(r io.Reader, sink EventSink) (int64, error) {
+	return f.ReadFromSinkWithOptions(r, sink, ReadOptions{})
+}
+
+// ReadFromSinkWithOptions reads a midi file from reader and forwards the events to sink as they
+// are decoded, only the header is kept in the file. Meta and system exclusive events use reusable
+// buffers and must be retained if the sink keeps them. Of the read options the running status
+// mode, Strict data byte checks, KeepRawEvents, MaxTracks, MaxEventsPerTrack, MaxSysExBytes,
+// KeepSysExFragments and Metrics are used. Like ReadFrom, system exclusive messages divided over
+// continuation events are assembled before they reach the sink unless fragments are kept
+func (f *File) ReadFromSinkWithOptions(r io.Reader, sink EventSink, opts ReadOptions) (int64, error) {
+	var totalBytesRead int64
+
+	f.Header = nil
+	f.Chunks = []*Chunk{}
+	f.Tracks = []*Track{}
+
+	trackIndex := 0
+
+	for {
+		chunk := &Chunk{}
+		chunkBytesRead, err := chunk.ReadFrom(r)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return 0, err
+		}
+
+		totalBytesRead += chunkBytesRead
+		opts.Metrics.addChunk(chunk)
+
+		if chunk.Type == HeaderType {
+			f.Header, err = chunk.FileHeader()
+			if err != nil {
+				return 0, err
+			}
+		} else if chunk.Type == TrackType {
+			if opts.MaxTracks > 0 && trackIndex >= opts.MaxTracks {
+				return 0, fmt.Errorf("file has more than %v tracks", opts.MaxTracks)
+			}
+
+			tick := uint32(0)
+			handle := func(event Event) error {
+				tick += event.DeltaTime()
+				return sink.HandleEvent(trackIndex, tick, event)
+			}
+
+			var stream *sysExStream
+			if !opts.KeepSysExFragments {
+				stream = &sysExStream{fn: handle, assembler: sysExAssembler{maxBytes: opts.MaxSysExBytes}}
+				handle = stream.handle
+			}
+
+			events := 0
+
+			err = parseTrackDataWithOptions(chunk.Data, true, opts, func(event Event) error {
+				events++
+				if opts.MaxEventsPerTrack > 0 && events > opts.MaxEventsPerTrack {
+					return fmt.Errorf("more than %v events", opts.MaxEventsPerTrack)
+				}
+
+				if se, ok := event.(*SystemExclusiveEvent); ok && opts.MaxSysExBytes > 0 && len(se.Data) > opts.MaxSysExBytes {
+					return fmt.Errorf("system exclusive event of %v bytes, the limit is %v", len(se.Data), opts.MaxSysExBytes)
+				}
+
+				return handle(event)
+			})
+
+			if err == nil && stream != nil {
+				err = stream.flush()
+			}
+
+			if err != nil {
+				return 0, err
+			}
+
+			trackIndex++
+		}
+	}
+
+	if f.Header == nil {
+		return 0, errors.New("no midi header chunk found")
+	}
+
+	return totalBytesRead, nil
+}
@@ -0,0 +1,122 @@
+package midi
+
+import (
+	"context"
+	"errors"
+)
+
+// ClocksPerMIDIBeat is the number of timing clocks in a midi beat, the unit of song position
+// pointers. A midi beat is a sixteenth note
+const ClocksPerMIDIBeat = 6
+
+// MaxSongPosition is the highest song position a song position pointer can hold
+const MaxSongPosition uint16 = 0x3FFF
+
+// TickToSongPosition returns the song position in midi beats of tick, rounded down to a midi
+// beat and limited to MaxSongPosition
+func TickToSongPosition(tick uint32, ticksPerQuarterNote uint16) uint16 {
+	if ticksPerQuarterNote == 0 {
+		return 0
+	}
+
+	position := uint64(tick) * 4 / uint64(ticksPerQuarterNote)
+	if position > uint64(MaxSongPosition) {
+		return MaxSongPosition
+	}
+
+	return uint16(position)
+}
+
+// SongPositionToTick returns the tick of a song position in midi beats
+func SongPositionToTick(position uint16, ticksPerQuarterNote uint16) uint32 {
+	return uint32(position) * uint32(ticksPerQuarterNote) / 4
+}
+
+// NewSongPositionPointerEvent creates a song position pointer event for a position in midi beats
+func NewSongPositionPointerEvent(position uint16) *SystemCommonEvent {
+	return &SystemCommonEvent{
+		coreEvent: coreEvent{eventType: SongPositionPointer},
+		Value1:    position & MaxSongPosition,
+	}
+}
+
+// ClockGenerator sends midi clock to slave devices: timing clocks following a tempo map, start,
+// stop and continue, and a song position pointer when locating
+type ClockGenerator struct {
+	// Sink receives the clock events on track MetronomeTrack
+	Sink     EventSink
+	tempoMap *TempoMap
+	// pulses is the song position in timing clocks
+	pulses uint32
+}
+
+// NewClockGenerator creates a clock generator at song position 0, tempoMap sets the speed of
+// the timing clocks
+func NewClockGenerator(tempoMap *TempoMap, sink EventSink) *ClockGenerator {
+	return &ClockGenerator{Sink: sink, tempoMap: tempoMap}
+}
+
+// tick returns the tick of the song position
+func (g *ClockGenerator) tick() uint32 {
+	return uint32(uint64(g.pulses) * uint64(g.tempoMap.TicksPerQuarterNote) / 24)
+}
+
+// send hands a clock event to the sink
+func (g *ClockGenerator) send(event Event) error {
+	return g.Sink.HandleEvent(MetronomeTrack, g.tick(), event)
+}
+
+// Locate moves the song position to tick, rounded down to a midi beat, and sends a song
+// position pointer. Slaves follow it on the next continue
+func (g *ClockGenerator) Locate(tick uint32) error {
+	position := TickToSongPosition(tick, g.tempoMap.TicksPerQuarterNote)
+	g.pulses = uint32(position) * ClocksPerMIDIBeat
+
+	return g.send(NewSongPositionPointerEvent(position))
+}
+
+// Start moves the song position to 0 and sends start
+func (g *ClockGenerator) Start() error {
+	g.pulses = 0
+	return g.send(StartEvent)
+}
+
+// Continue sends continue, slaves resume at the song position
+func (g *ClockGenerator) Continue() error {
+	return g.send(ContinueEvent)
+}
+
+// Stop sends stop, the song position is kept
+func (g *ClockGenerator) Stop() error {
+	return g.send(StopEvent)
+}
+
+// Run sends timing clocks from the song position until the context is done, the clock is
+// started and song time 0 is the song position at the time Run is called. Send Start or
+// Continue first so slaves follow the clocks
+func (g *ClockGenerator) Run(ctx context.Context, clock Clock) error {
+	if g.tempoMap == nil || g.tempoMap.TicksPerQuarterNote == 0 {
+		return errors.New("clock generator needs a tempo map with ticks per quarter note")
+	}
+
+	clock.Start()
+
+	origin := g.tempoMap.TickToDuration(g.tick())
+
+	for {
+		next := g.pulses + 1
+		tick := uint32(uint64(next) * uint64(g.tempoMap.TicksPerQuarterNote) / 24)
+
+		err := clock.WaitUntil(ctx, g.tempoMap.TickToDuration(tick)-origin)
+		if err != nil {
+			return err
+		}
+
+		g.pulses = next
+
+		err = g.send(TimingClockEvent)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package midi
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLExecer executes SQL statements, *sql.DB, *sql.Conn and *sql.Tx satisfy it. Exporting inside
+// a transaction is much faster for large files
+type SQLExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// SQLiteSchema holds the statements creating the tables written by ExportSQL. Ticks are absolute,
+// times are in seconds from the start of the file
+var SQLiteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS files (
+		id INTEGER PRIMARY KEY,
+		name TEXT,
+		format INTEGER,
+		ticks_per_quarter_note INTEGER,
+		frames_per_second INTEGER,
+		ticks_per_frame INTEGER,
+		duration REAL
+	)`,
+	`CREATE TABLE IF NOT EXISTS tracks (
+		file_id INTEGER,
+		track INTEGER,
+		name TEXT,
+		events INTEGER,
+		end_tick INTEGER,
+		PRIMARY KEY (file_id, track)
+	)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		file_id INTEGER,
+		track INTEGER,
+		position INTEGER,
+		tick INTEGER,
+		time REAL,
+		type TEXT,
+		channel INTEGER,
+		value1 INTEGER,
+		value2 INTEGER,
+		meta_type INTEGER,
+		data BLOB,
+		continuation INTEGER,
+		PRIMARY KEY (file_id, track, position)
+	)`,
+	`CREATE TABLE IF NOT EXISTS notes (
+		file_id INTEGER,
+		track INTEGER,
+		channel INTEGER,
+		key INTEGER,
+		velocity INTEGER,
+		off_velocity INTEGER,
+		start_tick INTEGER,
+		end_tick INTEGER,
+		start_time REAL,
+		end_time REAL
+	)`,
+	`CREATE INDEX IF NOT EXISTS notes_key ON notes (file_id, key)`,
+}
+
+// CreateSQLiteSchema creates the tables written by ExportSQL if they do not exist
+func CreateSQLiteSchema(ctx context.Context, db SQLExecer) error {
+	for _, statement := range SQLiteSchema {
+		_, err := db.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sqlEventColumns returns the channel, value1, value2, meta type, data and continuation columns of
+// an event, unused columns are nil
+func sqlEventColumns(event Event) (channel, value1, value2, metaType any, data []byte, continuation any) {
+	switch e := event.(type) {
+	case *ChannelEvent:
+		channel, value1 = e.Channel, e.Value1
+
+		switch e.eventType {
+		case NoteOff, NoteOn, PolyphonicKeyPressure, ControlChange:
+			value2 = e.Value2
+		}
+	case *SequencerSpecificEvent:
+		metaType, data = uint8(e.MetaType), e.Data
+	case *MetaEvent:
+		metaType, data = uint8(e.MetaType), e.Data
+	case *SystemExclusiveEvent:
+		data, continuation = e.Data, e.Continuation
+	case *SystemCommonEvent:
+		if e.eventType != TuneRequest {
+			value1 = e.Value1
+		}
+	case *RawEvent:
+		value1, data = e.Status, e.Data
+	}
+
+	return
+}
+
+// ExportSQL writes the file, its tracks, events and notes to the tables of SQLiteSchema under
+// fileID, the schema is created if needed. Statements use ? placeholders
+func (f *File) ExportSQL(ctx context.Context, db SQLExecer, fileID int64, name string) error {
+	err := CreateSQLiteSchema(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	tempoMap := f.TempoMap()
+	duration := tempoMap.TickToDuration(f.endTick())
+
+	var format, ticksPerQuarterNote, framesPerSecond, ticksPerFrame any
+	if f.Header != nil {
+		format = uint16(f.Header.Format)
+
+		if f.Header.DivisionType == DivisionFramesTicks {
+			framesPerSecond, ticksPerFrame = f.Header.FramesPerSecond, f.Header.TicksPerFrame
+		} else {
+			ticksPerQuarterNote = f.Header.TicksPerQuarterNote
+		}
+	}
+
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO files (id, name, format, ticks_per_quarter_note, frames_per_second, ticks_per_frame, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		fileID, name, format, ticksPerQuarterNote, framesPerSecond, ticksPerFrame, duration.Seconds())
+	if err != nil {
+		return err
+	}
+
+	for index, track := range f.Tracks {
+		cursor := newTempoCursor(tempoMap)
+		events := track.AbsEvents()
+		trackName := ""
+		endTick := uint32(0)
+
+		for position, ae := range events {
+			if me, ok := ae.Event.(*MetaEvent); ok && me.MetaType == TrackName && trackName == "" {
+				trackName = string(me.Data)
+			}
+
+			channel, value1, value2, metaType, data, continuation := sqlEventColumns(ae.Event)
+
+			_, err = db.ExecContext(ctx,
+				`INSERT INTO events (file_id, track, position, tick, time, type, channel, value1, value2, meta_type, data, continuation)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				fileID, index, position, ae.Tick, cursor.timeAt(ae.Tick).Seconds(),
+				eventTypeToString(ae.Event.EventType()), channel, value1, value2, metaType, data, continuation)
+			if err != nil {
+				return err
+			}
+
+			endTick = ae.Tick
+		}
+
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO tracks (file_id, track, name, events, end_tick) VALUES (?, ?, ?, ?, ?)`,
+			fileID, index, trackName, len(events), endTick)
+		if err != nil {
+			return err
+		}
+
+		for _, note := range track.Notes() {
+			_, err = db.ExecContext(ctx,
+				`INSERT INTO notes (file_id, track, channel, key, velocity, off_velocity, start_tick, end_tick, start_time, end_time)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				fileID, index, note.Channel, note.Key, note.Velocity, note.OffVelocity, note.Start, note.End,
+				tempoMap.TickToDuration(note.Start).Seconds(), tempoMap.TickToDuration(note.End).Seconds())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
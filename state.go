@@ -0,0 +1,167 @@
+package midi
+
+import (
+	"sort"
+)
+
+// DefaultPitchBend is the centered pitch wheel value
+const DefaultPitchBend uint16 = 0x2000
+
+// ChannelValues is the effective state of one channel
+type ChannelValues struct {
+	// Track of the last event on the channel, -1 if the channel is not used
+	Track int
+	// Program is only meaningful if HasProgram is true
+	Program    uint8
+	HasProgram bool
+	// Bank selected by the last bank select controllers, see BankNumber
+	Bank uint16
+	// Controllers holds the last value of every controller that was set, bank select and channel
+	// mode controllers are not included
+	Controllers map[uint8]uint8
+	// PitchBend is DefaultPitchBend until the first pitch wheel change
+	PitchBend uint16
+	// Pressure is the last channel pressure
+	Pressure uint8
+	// Notes maps the keys of sounding notes to their velocity
+	Notes map[uint8]uint8
+}
+
+// ChannelState is the effective state of all channels at a tick
+type ChannelState struct {
+	Channels [16]ChannelValues
+}
+
+// newChannelState creates the state of a file before any event
+func newChannelState() *ChannelState {
+	s := &ChannelState{}
+
+	for channel := range s.Channels {
+		s.Channels[channel] = ChannelValues{
+			Track:       -1,
+			Controllers: map[uint8]uint8{},
+			PitchBend:   DefaultPitchBend,
+			Notes:       map[uint8]uint8{},
+		}
+	}
+
+	return s
+}
+
+// apply updates the state with a channel event of a track
+func (s *ChannelState) apply(track int, ce *ChannelEvent) {
+	if ce.Channel > 15 {
+		return
+	}
+
+	c := &s.Channels[ce.Channel]
+	c.Track = track
+
+	switch ce.eventType {
+	case NoteOn, NoteOff:
+		if isNoteOff(ce) {
+			delete(c.Notes, uint8(ce.Value1))
+		} else {
+			c.Notes[uint8(ce.Value1)] = uint8(ce.Value2)
+		}
+	case ControlChange:
+		switch {
+		case ce.Value1 == ControllerBankSelectMSB:
+			c.Bank = c.Bank&0x7F | (ce.Value2&0x7F)<<7
+		case ce.Value1 == ControllerBankSelectLSB:
+			c.Bank = c.Bank&^0x7F | ce.Value2&0x7F
+		case ce.Value1 == ControllerResetAllControllers:
+			c.Controllers = map[uint8]uint8{}
+			c.PitchBend = DefaultPitchBend
+			c.Pressure = 0
+		case ce.Value1 == ControllerAllNotesOff:
+			c.Notes = map[uint8]uint8{}
+		case ce.Value1 < 120:
+			c.Controllers[uint8(ce.Value1)] = uint8(ce.Value2)
+		}
+	case ProgramChange:
+		c.Program = uint8(ce.Value1)
+		c.HasProgram = true
+	case PitchWheelChange:
+		c.PitchBend = ce.Value1
+	case ChannelPressure:
+		c.Pressure = uint8(ce.Value1)
+	}
+}
+
+// StateAt returns the effective state of every channel at tick, from the channel events of all
+// tracks before tick. Notes sounding at tick were started before it and end after it
+func StateAt(f *File, tick uint32) *ChannelState {
+	s := newChannelState()
+	it := NewEventIterator(f, false)
+
+	for it.Next() && it.Tick() < tick {
+		if ce, ok := it.Event().(*ChannelEvent); ok {
+			s.apply(it.Track(), ce)
+		}
+	}
+
+	return s
+}
+
+// parameterNumberControllers are emitted first by Events, ending with the registered parameter
+// number so data entry values apply to it
+var parameterNumberControllers = []uint8{99, 98, 101, 100}
+
+// Events returns the channel events that chase the state of channel: bank select and program
+// change, the controllers and the pitch wheel and channel pressure if they differ from their
+// default. Parameter number controllers are sent before the other controllers, sounding notes
+// are not included
+func (c *ChannelValues) Events(channel uint16) []Event {
+	events := []Event{}
+
+	if c.HasProgram {
+		events = append(events,
+			NewChannelEvent(0, ControlChange, channel, ControllerBankSelectMSB, c.Bank>>7),
+			NewChannelEvent(0, ControlChange, channel, ControllerBankSelectLSB, c.Bank&0x7F),
+			NewChannelEvent(0, ProgramChange, channel, uint16(c.Program), 0),
+		)
+	}
+
+	controllers := make([]int, 0, len(c.Controllers))
+	for controller := range c.Controllers {
+		controllers = append(controllers, int(controller))
+	}
+
+	sort.Ints(controllers)
+
+	for _, controller := range parameterNumberControllers {
+		if value, ok := c.Controllers[controller]; ok {
+			events = append(events, NewChannelEvent(0, ControlChange, channel, uint16(controller), uint16(value)))
+		}
+	}
+
+	for _, controller := range controllers {
+		if controller >= 98 && controller <= 101 {
+			continue
+		}
+
+		events = append(events, NewChannelEvent(0, ControlChange, channel, uint16(controller), uint16(c.Controllers[uint8(controller)])))
+	}
+
+	if c.PitchBend != DefaultPitchBend {
+		events = append(events, NewChannelEvent(0, PitchWheelChange, channel, c.PitchBend, 0))
+	}
+
+	if c.Pressure != 0 {
+		events = append(events, NewChannelEvent(0, ChannelPressure, channel, uint16(c.Pressure), 0))
+	}
+
+	return events
+}
+
+// Events returns the chase events of all used channels, see ChannelValues.Events
+func (s *ChannelState) Events() []Event {
+	events := []Event{}
+
+	for channel := range s.Channels {
+		events = append(events, s.Channels[channel].Events(uint16(channel))...)
+	}
+
+	return events
+}
@@ -0,0 +1,125 @@
+package midi
+
+import (
+	"sort"
+)
+
+// Step is a single step of a step sequencer pattern
+type Step struct {
+	// Velocity of the hit, 0 if the step is empty
+	Velocity uint8
+	// Flam is true if more than one hit of the same instrument fell on the step
+	Flam bool
+}
+
+// StepPattern is a drum track resampled to a fixed grid of steps per bar
+type StepPattern struct {
+	StepsPerBar int
+	NumBars     int
+	// Steps per key, indexed by bar and step
+	Lanes map[uint8][][]Step
+}
+
+// Keys returns the keys used in the pattern in ascending order
+func (p *StepPattern) Keys() []uint8 {
+	keys := make([]uint8, 0, len(p.Lanes))
+	for key := range p.Lanes {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// ExportStepPattern resamples the note ons of a drum track onto a grid of stepsPerBar steps per
+// bar (typically 16 or 32). Hits are snapped to the nearest step, the loudest hit determines the
+// step velocity and multiple hits of one key on the same step are marked as flam
+func ExportStepPattern(track *Track, timeSignatures *TimeSigMap, ticksPerQuarterNote uint16, stepsPerBar int) *StepPattern {
+	if stepsPerBar < 1 {
+		stepsPerBar = 16
+	}
+
+	notes := track.Notes()
+
+	end := uint32(0)
+	for _, note := range notes {
+		if note.Start > end {
+			end = note.Start
+		}
+	}
+
+	starts := timeSignatures.BarStartTicks(ticksPerQuarterNote, end)
+	barLength := func(bar int) uint32 {
+		if bar+1 < len(starts) {
+			return starts[bar+1] - starts[bar]
+		}
+
+		// Length of the last bar from the time signature in effect
+		ts := TimeSignatureChange{Numerator: 4, Denominator: 4}
+		if timeSignatures != nil {
+			for _, change := range timeSignatures.Changes {
+				if change.Tick <= starts[bar] {
+					ts = change
+				}
+			}
+		}
+
+		if ts.Numerator == 0 || ts.Denominator == 0 {
+			ts.Numerator, ts.Denominator = 4, 4
+		}
+
+		return uint32(ts.Numerator) * uint32(ticksPerQuarterNote) * 4 / uint32(ts.Denominator)
+	}
+
+	pattern := &StepPattern{
+		StepsPerBar: stepsPerBar,
+		NumBars:     len(starts),
+		Lanes:       map[uint8][][]Step{},
+	}
+
+	for _, note := range notes {
+		bar := sort.Search(len(starts), func(i int) bool {
+			return starts[i] > note.Start
+		}) - 1
+
+		length := barLength(bar)
+		if length == 0 {
+			continue
+		}
+
+		// Snap to the nearest step, which may be the first step of the next bar
+		step := int((uint64(note.Start-starts[bar])*uint64(stepsPerBar) + uint64(length)/2) / uint64(length))
+		if step >= stepsPerBar {
+			step -= stepsPerBar
+			bar++
+		}
+
+		if bar >= pattern.NumBars {
+			continue
+		}
+
+		lane, ok := pattern.Lanes[note.Key]
+		if !ok {
+			lane = make([][]Step, pattern.NumBars)
+			for index := range lane {
+				lane[index] = make([]Step, stepsPerBar)
+			}
+
+			pattern.Lanes[note.Key] = lane
+		}
+
+		s := &lane[bar][step]
+		if s.Velocity > 0 {
+			s.Flam = true
+		}
+
+		if note.Velocity > s.Velocity {
+			s.Velocity = note.Velocity
+		}
+	}
+
+	return pattern
+}
@@ -0,0 +1,119 @@
+package midi
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSensingTimeout is the time without active sensing after which a receiver assumes the
+// connection is lost, as specified by the midi specification
+const DefaultSensingTimeout = 300 * time.Millisecond
+
+// StreamOptions control a live event stream
+type StreamOptions struct {
+	// DropActiveSensing drops active sensing events, the watchdog still sees them
+	DropActiveSensing bool
+	// DropTimingClock drops timing clock events
+	DropTimingClock bool
+	// SensingTimeout is the time without active sensing after which sensing is lost, 0 uses
+	// DefaultSensingTimeout
+	SensingTimeout time.Duration
+	// OnSensingLost enables the watchdog, it is called from another goroutine when active sensing
+	// stops arriving. The watchdog starts with the first active sensing event, a receiver should
+	// usually turn all notes off when sensing is lost
+	OnSensingLost func()
+}
+
+// Stream reads events from a live source, drops active sensing and timing clock if requested
+// and watches active sensing
+type Stream struct {
+	source  EventSource
+	opts    StreamOptions
+	filters []EventFilter
+	mu      sync.Mutex
+	timer   *time.Timer
+	lost    bool
+}
+
+// NewStream creates a stream reading from source
+func NewStream(source EventSource, opts StreamOptions) *Stream {
+	s := &Stream{source: source, opts: opts}
+
+	if opts.SensingTimeout == 0 {
+		s.opts.SensingTimeout = DefaultSensingTimeout
+	}
+
+	if opts.DropActiveSensing {
+		s.filters = append(s.filters, DropActiveSensing())
+	}
+
+	if opts.DropTimingClock {
+		s.filters = append(s.filters, DropTimingClock())
+	}
+
+	return s
+}
+
+// ReadEvent returns the next event that is not dropped
+func (s *Stream) ReadEvent() (Event, error) {
+	for {
+		event, err := s.source.ReadEvent()
+		if err != nil {
+			return nil, err
+		}
+
+		if event.EventType() == ActiveSensing {
+			s.sensed()
+		}
+
+		if passes(s.filters, event) {
+			return event, nil
+		}
+	}
+}
+
+// sensed restarts the watchdog after an active sensing event
+func (s *Stream) sensed() {
+	if s.opts.OnSensingLost == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lost = false
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.opts.SensingTimeout, s.sensingLost)
+		return
+	}
+
+	s.timer.Reset(s.opts.SensingTimeout)
+}
+
+// sensingLost is called by the watchdog timer
+func (s *Stream) sensingLost() {
+	s.mu.Lock()
+	s.lost = true
+	s.mu.Unlock()
+
+	s.opts.OnSensingLost()
+}
+
+// SensingLost returns true if active sensing stopped arriving and has not resumed
+func (s *Stream) SensingLost() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lost
+}
+
+// Close stops the watchdog, the source is not closed
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
@@ -0,0 +1,361 @@
+package midi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamParser decodes the events of a midi file from a reader one at a time and hands them to
+// a callback, chunks are never read into memory as a whole and no event slices are collected.
+// Use it for archives of files too large to read with File.ReadFrom
+type StreamParser struct {
+	r      *bufio.Reader
+	opts   ReadOptions
+	header *FileHeader
+}
+
+// NewStreamParser creates a stream parser reading from r. Of the read options the running status
+// mode, Strict data byte checks, MaxTracks, MaxEventsPerTrack, MaxSysExBytes and
+// KeepSysExFragments are used, system exclusive data over the limit is rejected before it is read
+func NewStreamParser(r io.Reader, opts ReadOptions) *StreamParser {
+	return &StreamParser{r: bufio.NewReader(r), opts: opts}
+}
+
+// Header returns the file header, nil before the header chunk was parsed
+func (p *StreamParser) Header() *FileHeader {
+	return p.header
+}
+
+// Parse reads the file and calls fn for every event with the index of its track, the header is
+// available from Header when fn is first called. The header chunk must come first, chunks other
+// than tracks are skipped. Events are owned by fn and never reused. Parsing stops at the first
+// malformed event or error returned by fn, reaching the end of the reader after a complete chunk
+// ends parsing without error
+func (p *StreamParser) Parse(fn func(track int, event Event) error) error {
+	track := 0
+
+	for {
+		chunkType, length, err := readChunkHeader(p.r)
+		if err == io.EOF && p.header != nil {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case p.header == nil:
+			if chunkType != HeaderType {
+				return errors.New("midi file should start with a header chunk")
+			}
+
+			if length != 6 {
+				return errors.New("midi header chunk data should be 6 bytes long")
+			}
+
+			chunk := &Chunk{Type: chunkType, Length: length}
+
+			chunk.Data, err = readChunkData(p.r, length)
+			if err != nil {
+				return err
+			}
+
+			p.header, err = chunk.FileHeader()
+			if err != nil {
+				return err
+			}
+		case chunkType == TrackType:
+			if p.opts.MaxTracks > 0 && track >= p.opts.MaxTracks {
+				return fmt.Errorf("file has more than %v tracks", p.opts.MaxTracks)
+			}
+
+			ts := &trackStream{r: p.r, remaining: length, opts: p.opts}
+			handle := func(event Event) error {
+				return fn(track, event)
+			}
+
+			if p.opts.KeepSysExFragments {
+				err = ts.parse(handle)
+			} else {
+				s := &sysExStream{fn: handle, assembler: sysExAssembler{maxBytes: p.opts.MaxSysExBytes}}
+
+				err = ts.parse(s.handle)
+				if err == nil {
+					err = s.flush()
+				}
+			}
+
+			if err != nil {
+				return fmt.Errorf("track %v: %w", track, err)
+			}
+
+			track++
+		default:
+			_, err = io.CopyN(io.Discard, p.r, int64(length))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sysExStream assembles system exclusive messages divided over continuation events like
+// mergeSysExContinuations before handing the events of a track to fn. An unterminated message is
+// held until it is terminated or another event follows, the delta times of merged continuations
+// are added to the next event handed over
+type sysExStream struct {
+	fn        func(Event) error
+	assembler sysExAssembler
+	pending   Event
+	carry     uint32
+}
+
+// handle assembles event or hands it to fn
+func (s *sysExStream) handle(event Event) error {
+	keep, err := s.assembler.add(event)
+	if err != nil {
+		return err
+	}
+
+	if !keep {
+		s.carry += event.DeltaTime()
+
+		if s.assembler.terminated() {
+			return s.flush()
+		}
+
+		return nil
+	}
+
+	err = s.flush()
+	if err != nil {
+		return err
+	}
+
+	event.SetDeltaTime(event.DeltaTime() + s.carry)
+	s.carry = 0
+
+	if !s.assembler.terminated() {
+		s.pending = event
+		return nil
+	}
+
+	return s.fn(event)
+}
+
+// flush hands a held message to fn
+func (s *sysExStream) flush() error {
+	if s.pending == nil {
+		return nil
+	}
+
+	event := s.pending
+	s.pending = nil
+
+	return s.fn(event)
+}
+
+// streamReadStep is the largest number of bytes read into an event at once
+const streamReadStep = 64 * 1024
+
+// trackStream decodes the events of a single track chunk from a reader
+type trackStream struct {
+	r         *bufio.Reader
+	remaining uint32
+	opts      ReadOptions
+}
+
+// readByte reads the next byte of the track chunk
+func (ts *trackStream) readByte() (byte, error) {
+	if ts.remaining == 0 {
+		return 0, errors.New("event length exceeds available data length")
+	}
+
+	b, err := ts.r.ReadByte()
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	ts.remaining--
+
+	return b, nil
+}
+
+// read appends n bytes of the track chunk to data
+func (ts *trackStream) read(data []byte, n uint32) ([]byte, error) {
+	if n > ts.remaining {
+		return nil, errors.New("event length exceeds available data length")
+	}
+
+	// Grow in steps so a corrupt length can not allocate more than the data that is there
+	for n > 0 {
+		step := min(n, streamReadStep)
+		start := len(data)
+		data = append(data, make([]byte, step)...)
+
+		_, err := io.ReadFull(ts.r, data[start:])
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		ts.remaining -= step
+		n -= step
+	}
+
+	return data, nil
+}
+
+// readVariableLengthInteger reads a variable length integer, the encoded bytes are appended to
+// data if it is not nil
+func (ts *trackStream) readVariableLengthInteger(data []byte) (uint32, []byte, error) {
+	var result uint32
+
+	for i := 0; i < 4; i++ {
+		b, err := ts.readByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if data != nil {
+			data = append(data, b)
+		}
+
+		result = result<<7 | uint32(b&0x7F)
+
+		if b&0x80 == 0 {
+			return result, data, nil
+		}
+	}
+
+	return 0, nil, errors.New("variable length integer is longer than 4 bytes")
+}
+
+// parse decodes the events of the track chunk and hands them to fn
+func (ts *trackStream) parse(fn func(Event) error) error {
+	table := activeStatusParsers()
+	runningStatusActive := false
+	var runningStatusByte uint8
+	events := 0
+
+	for ts.remaining > 0 {
+		deltaTime, _, err := ts.readVariableLengthInteger(nil)
+		if err != nil {
+			return err
+		}
+
+		statusByte, err := ts.readByte()
+		if err != nil {
+			return fmt.Errorf("expected another event after delta time: %w", err)
+		}
+
+		// The bytes following the status byte, each event gets its own slice because parsed
+		// meta and system exclusive events reference it
+		data := []byte{}
+
+		if (statusByte >> 7) == 0 {
+			if !runningStatusActive {
+				return errors.New("received data byte without running status active")
+			}
+
+			data = append(data, statusByte)
+			statusByte = runningStatusByte
+		}
+
+		parseFunc := table.parsers[statusByte]
+		if parseFunc == nil {
+			return fmt.Errorf("unknown status byte %X encountered", statusByte)
+		}
+
+		switch {
+		case statusByte < 0xF0:
+			runningStatusActive = true
+			runningStatusByte = statusByte
+
+			length := uint32(2)
+			if statusByte>>4 == 0xC || statusByte>>4 == 0xD {
+				length = 1
+			}
+
+			data, err = ts.read(data, length-uint32(len(data)))
+		case statusByte == 0xF0 || statusByte == 0xF7:
+			runningStatusActive = runningStatusActive && ts.opts.RunningStatus == RunningStatusKeep
+
+			var numBytes uint32
+
+			numBytes, data, err = ts.readVariableLengthInteger(data)
+			if err != nil {
+				return err
+			}
+
+			if ts.opts.MaxSysExBytes > 0 && numBytes > uint32(ts.opts.MaxSysExBytes) {
+				return fmt.Errorf("system exclusive event of %v bytes, the limit is %v", numBytes, ts.opts.MaxSysExBytes)
+			}
+
+			data, err = ts.read(data, numBytes)
+		case statusByte == 0xFF:
+			runningStatusActive = runningStatusActive && ts.opts.RunningStatus != RunningStatusSpec
+
+			data, err = ts.read(data, 1)
+			if err != nil {
+				return fmt.Errorf("end of data before meta event was identified: %w", err)
+			}
+
+			var numBytes uint32
+
+			numBytes, data, err = ts.readVariableLengthInteger(data)
+			if err != nil {
+				return err
+			}
+
+			data, err = ts.read(data, numBytes)
+		case statusByte == 0xF2:
+			runningStatusActive = false
+			data, err = ts.read(data, 2)
+		case statusByte == 0xF1 || statusByte == 0xF3:
+			runningStatusActive = false
+			data, err = ts.read(data, 1)
+		case statusByte < 0xF8:
+			runningStatusActive = false
+		}
+
+		if err != nil {
+			return err
+		}
+
+		event, _, err := callParser(parseFunc, statusByte, deltaTime, data)
+		if err != nil {
+			return err
+		}
+
+		if ts.opts.Strict && statusByte < 0xF0 {
+			for _, b := range data {
+				if b&0x80 != 0 {
+					return fmt.Errorf("%v data byte %X has the high bit set", eventTypeToString(event.EventType()), b)
+				}
+			}
+		}
+
+		events++
+		if ts.opts.MaxEventsPerTrack > 0 && events > ts.opts.MaxEventsPerTrack {
+			return fmt.Errorf("more than %v events", ts.opts.MaxEventsPerTrack)
+		}
+
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,379 @@
+package midi
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// DefaultTempo in microseconds per quarter note (120 bpm), used until the first tempo change
+const DefaultTempo uint32 = 500000
+
+// TempoChange is a tempo change at an absolute tick
+type TempoChange struct {
+	Tick                       uint32
+	MicrosecondsPerQuarterNote uint32
+}
+
+// MetaEvent creates a set tempo meta event for the tempo change
+func (c TempoChange) MetaEvent(deltaTime uint32) *MetaEvent {
+	tempo := c.MicrosecondsPerQuarterNote
+
+	return NewMetaEvent(deltaTime, SetTempo, []byte{byte(tempo >> 16), byte(tempo >> 8), byte(tempo)})
+}
+
+// TempoMap converts between ticks and time using the tempo changes of a file
+type TempoMap struct {
+	TicksPerQuarterNote uint16
+	// FramesPerSecond and TicksPerFrame are set for files with a SMPTE division, ticks are then
+	// fixed subdivisions of a second and tempo changes do not affect timing. 29 frames per
+	// second is 29.97 (30 drop frame)
+	FramesPerSecond uint8
+	TicksPerFrame   uint8
+	// Tempo changes sorted by tick
+	Changes []TempoChange
+}
+
+// NewTempoMap creates a new tempo map, the changes are sorted by tick
+func NewTempoMap(ticksPerQuarterNote uint16, changes []TempoChange) *TempoMap {
+	sorted := make([]TempoChange, len(changes))
+	copy(sorted, changes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Tick < sorted[j].Tick
+	})
+
+	return &TempoMap{
+		TicksPerQuarterNote: ticksPerQuarterNote,
+		Changes:             sorted,
+	}
+}
+
+// NewSMPTETempoMap creates a new tempo map for a SMPTE division, the changes are sorted by tick
+func NewSMPTETempoMap(framesPerSecond, ticksPerFrame uint8, changes []TempoChange) *TempoMap {
+	m := NewTempoMap(0, changes)
+	m.FramesPerSecond = framesPerSecond
+	m.TicksPerFrame = ticksPerFrame
+
+	return m
+}
+
+// newTempoMapForHeader creates a new tempo map for the division of a file header
+func newTempoMapForHeader(header *FileHeader, changes []TempoChange) *TempoMap {
+	if header != nil && header.DivisionType == DivisionFramesTicks {
+		return NewSMPTETempoMap(header.FramesPerSecond, header.TicksPerFrame, changes)
+	}
+
+	var ticksPerQuarterNote uint16
+	if header != nil {
+		ticksPerQuarterNote = header.TicksPerQuarterNote
+	}
+
+	return NewTempoMap(ticksPerQuarterNote, changes)
+}
+
+// smpteRate returns the number of ticks per second of a SMPTE division as a fraction
+func (m *TempoMap) smpteRate() (num uint64, den uint64) {
+	if m.FramesPerSecond == 29 {
+		return 30000 * uint64(m.TicksPerFrame), 1001
+	}
+
+	return uint64(m.FramesPerSecond) * uint64(m.TicksPerFrame), 1
+}
+
+// TempoAt returns the tempo in microseconds per quarter note at tick
+func (m *TempoMap) TempoAt(tick uint32) uint32 {
+	tempo := DefaultTempo
+
+	for _, change := range m.Changes {
+		if change.Tick > tick {
+			break
+		}
+
+		tempo = change.MicrosecondsPerQuarterNote
+	}
+
+	return tempo
+}
+
+// ticksToDuration converts a number of ticks at a fixed tempo to a duration
+func (m *TempoMap) ticksToDuration(ticks uint32, tempo uint32) time.Duration {
+	if m.TicksPerFrame != 0 {
+		num, den := m.smpteRate()
+		if num == 0 {
+			return 0
+		}
+
+		// Split in whole seconds and remainder to avoid overflow
+		total := uint64(ticks) * den
+		seconds := total / num
+		nanos := (total % num) * uint64(time.Second) / num
+
+		return time.Duration(seconds)*time.Second + time.Duration(nanos)
+	}
+
+	if m.TicksPerQuarterNote == 0 {
+		return 0
+	}
+
+	total := uint64(ticks) * uint64(tempo)
+	ppq := uint64(m.TicksPerQuarterNote)
+
+	// Split in whole microseconds and remainder to avoid overflow
+	micros := total / ppq
+	nanos := (total % ppq) * 1000 / ppq
+
+	return time.Duration(micros)*time.Microsecond + time.Duration(nanos)
+}
+
+// durationToTicks converts a duration at a fixed tempo to a number of ticks
+func (m *TempoMap) durationToTicks(d time.Duration, tempo uint32) uint32 {
+	if m.TicksPerFrame != 0 {
+		num, den := m.smpteRate()
+		seconds := uint64(d) / uint64(time.Second)
+		nanos := uint64(d) % uint64(time.Second)
+
+		return uint32((seconds*num + nanos*num/uint64(time.Second)) / den)
+	}
+
+	if tempo == 0 {
+		return 0
+	}
+
+	return uint32(uint64(d) * uint64(m.TicksPerQuarterNote) / (uint64(tempo) * 1000))
+}
+
+// TickToDuration returns the time offset of tick from the start
+func (m *TempoMap) TickToDuration(tick uint32) time.Duration {
+	var d time.Duration
+
+	lastTick := uint32(0)
+	tempo := DefaultTempo
+
+	for _, change := range m.Changes {
+		if change.Tick >= tick {
+			break
+		}
+
+		d += m.ticksToDuration(change.Tick-lastTick, tempo)
+		lastTick = change.Tick
+		tempo = change.MicrosecondsPerQuarterNote
+	}
+
+	return d + m.ticksToDuration(tick-lastTick, tempo)
+}
+
+// DurationToTick returns the tick at time offset d from the start
+func (m *TempoMap) DurationToTick(d time.Duration) uint32 {
+	var elapsed time.Duration
+
+	lastTick := uint32(0)
+	tempo := DefaultTempo
+
+	for _, change := range m.Changes {
+		segment := m.ticksToDuration(change.Tick-lastTick, tempo)
+		if elapsed+segment > d {
+			break
+		}
+
+		elapsed += segment
+		lastTick = change.Tick
+		tempo = change.MicrosecondsPerQuarterNote
+	}
+
+	return lastTick + m.durationToTicks(d-elapsed, tempo)
+}
+
+// tempoFromData decodes the 24 bits tempo of a set tempo meta event
+func tempoFromData(data []byte) (uint32, bool) {
+	if len(data) < 3 {
+		return 0, false
+	}
+
+	return uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]), true
+}
+
+// EstimateDuration reports the playing time of a midi file by walking only delta times and
+// set tempo events, no events are materialized
+func EstimateDuration(r io.Reader) (time.Duration, error) {
+	var header *FileHeader
+	var trackEnds []uint32
+	var trackTempos [][]TempoChange
+
+	for {
+		chunk := &Chunk{}
+		_, err := chunk.ReadFrom(r)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return 0, err
+		}
+
+		if chunk.Type == HeaderType {
+			header, err = chunk.FileHeader()
+			if err != nil {
+				return 0, err
+			}
+		} else if chunk.Type == TrackType {
+			tempos := []TempoChange{}
+
+			end, err := scanTrackData(chunk.Data, func(tick uint32, statusByte uint8, payload []byte) error {
+				if statusByte == 0xFF && len(payload) > 0 && MetaType(payload[0]) == SetTempo {
+					// Skip meta type and length
+					_, n, err := readVariableLengthInteger(payload[1:])
+					if err != nil {
+						return err
+					}
+
+					if tempo, ok := tempoFromData(payload[1+n:]); ok {
+						tempos = append(tempos, TempoChange{Tick: tick, MicrosecondsPerQuarterNote: tempo})
+					}
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				return 0, err
+			}
+
+			trackEnds = append(trackEnds, end)
+			trackTempos = append(trackTempos, tempos)
+		}
+	}
+
+	if header == nil {
+		return 0, errors.New("no midi header chunk found")
+	}
+
+	if header.Format == Format2 {
+		// Independent sequences are played one after another
+		var total time.Duration
+
+		for index, end := range trackEnds {
+			total += newTempoMapForHeader(header, trackTempos[index]).TickToDuration(end)
+		}
+
+		return total, nil
+	}
+
+	// Simultaneous tracks share the tempo changes of all tracks
+	var end uint32
+	var tempos []TempoChange
+
+	for index, trackEnd := range trackEnds {
+		if trackEnd > end {
+			end = trackEnd
+		}
+
+		tempos = append(tempos, trackTempos[index]...)
+	}
+
+	return newTempoMapForHeader(header, tempos).TickToDuration(end), nil
+}
+
+// ExtractTempoMap reads the tempo and time signature events from the conductor track, which is
+// the first track of a format 1 file or all tracks of a format 0 file. Tempo and time signature
+// events found outside the conductor track are reported as warnings and ignored
+func ExtractTempoMap(f *File) (*TempoMap, *TimeSigMap, []Warning) {
+	var format Format
+
+	if f.Header != nil {
+		format = f.Header.Format
+	}
+
+	tempos := []TempoChange{}
+	timeSignatures := []TimeSignatureChange{}
+	warnings := []Warning{}
+
+	for index, track := range f.Tracks {
+		conductor := format == Format0 || index == 0
+		tick := uint32(0)
+
+		for _, event := range track.Events {
+			tick += event.DeltaTime()
+
+			me, ok := event.(*MetaEvent)
+			if !ok || (me.MetaType != SetTempo && me.MetaType != TimeSignature) {
+				continue
+			}
+
+			if !conductor {
+				warnings = append(warnings, Warning{
+					Track:   index,
+					Tick:    tick,
+					Message: metaTypeToString(me.MetaType) + " event found outside the conductor track",
+				})
+
+				continue
+			}
+
+			if me.MetaType == SetTempo {
+				if tempo, ok := tempoFromData(me.Data); ok {
+					tempos = append(tempos, TempoChange{Tick: tick, MicrosecondsPerQuarterNote: tempo})
+				}
+			} else if ts, ok := timeSignatureFromData(tick, me.Data); ok {
+				timeSignatures = append(timeSignatures, ts)
+			}
+		}
+	}
+
+	return newTempoMapForHeader(f.Header, tempos), NewTimeSigMap(timeSignatures), warnings
+}
+
+// TempoMap returns the tempo map of the conductor track of the file
+func (f *File) TempoMap() *TempoMap {
+	tm, _, _ := ExtractTempoMap(f)
+	return tm
+}
+
+// TimeSigMap returns the time signature map of the file, see ExtractTempoMap
+func (f *File) TimeSigMap() *TimeSigMap {
+	_, tsm, _ := ExtractTempoMap(f)
+	return tsm
+}
+
+// TickAtTime returns the tick at time offset d from the start of the file
+func (f *File) TickAtTime(d time.Duration) uint32 {
+	return f.TempoMap().DurationToTick(d)
+}
+
+// TimeAtTick returns the time offset of tick from the start of the file
+func (f *File) TimeAtTick(tick uint32) time.Duration {
+	return f.TempoMap().TickToDuration(tick)
+}
+
+// tempoCursor converts ascending ticks to time offsets in amortized constant time
+type tempoCursor struct {
+	tempoMap *TempoMap
+	index    int
+	tick     uint32
+	time     time.Duration
+	tempo    uint32
+}
+
+// newTempoCursor creates a cursor at tick 0
+func newTempoCursor(tempoMap *TempoMap) *tempoCursor {
+	return &tempoCursor{
+		tempoMap: tempoMap,
+		tempo:    DefaultTempo,
+	}
+}
+
+// timeAt returns the time offset of tick, ticks should not decrease between calls
+func (c *tempoCursor) timeAt(tick uint32) time.Duration {
+	changes := c.tempoMap.Changes
+
+	for c.index < len(changes) && changes[c.index].Tick <= tick {
+		change := changes[c.index]
+		c.time += c.tempoMap.ticksToDuration(change.Tick-c.tick, c.tempo)
+		c.tick = change.Tick
+		c.tempo = change.MicrosecondsPerQuarterNote
+		c.index++
+	}
+
+	return c.time + c.tempoMap.ticksToDuration(tick-c.tick, c.tempo)
+}
@@ -0,0 +1,836 @@
+package midi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTempoMap(t *testing.T) {
+	tm := NewTempoMap(480, []TempoChange{
+		{Tick: 960, MicrosecondsPerQuarterNote: 1000000},
+	})
+
+	// Two quarter notes at 120 bpm
+	if d := tm.TickToDuration(960); d != time.Second {
+		t.Errorf("expected 1s at tick 960, got %v", d)
+	}
+
+	// Followed by one quarter note at 60 bpm
+	if d := tm.TickToDuration(1440); d != 2*time.Second {
+		t.Errorf("expected 2s at tick 1440, got %v", d)
+	}
+
+	if tick := tm.DurationToTick(2 * time.Second); tick != 1440 {
+		t.Errorf("expected tick 1440 at 2s, got %v", tick)
+	}
+
+	if tick := tm.DurationToTick(500 * time.Millisecond); tick != 480 {
+		t.Errorf("expected tick 480 at 500ms, got %v", tick)
+	}
+}
+
+func TestEstimateDuration(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	d, err := EstimateDuration(fo)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	if d <= 0 {
+		t.Errorf("expected a positive duration, got %v", d)
+	}
+
+	t.Logf("duration %v", d)
+}
+
+func TestExtractTempoMap(t *testing.T) {
+	fo, err := os.Open("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer fo.Close()
+
+	mf := &File{}
+
+	_, err = mf.ReadFrom(fo)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	tm, tsm, warnings := ExtractTempoMap(mf)
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+
+	if len(tm.Changes) != 1 || len(tsm.Changes) != 1 {
+		t.Errorf("expected one tempo and one time signature change, got %v and %v", tm.Changes, tsm.Changes)
+	}
+}
+
+func TestBuildConductorTrack(t *testing.T) {
+	tm := NewTempoMap(480, []TempoChange{
+		{Tick: 1920, MicrosecondsPerQuarterNote: 400000},
+		{Tick: 0, MicrosecondsPerQuarterNote: 600000},
+	})
+
+	tsm := NewTimeSigMap([]TimeSignatureChange{
+		{Tick: 0, Numerator: 3, Denominator: 4, ClocksPerClick: 24, ThirtySecondNotesPerQuarterNote: 8},
+	})
+
+	track := BuildConductorTrack(tm, tsm, []MarkerPoint{{Tick: 960, Name: "verse"}})
+
+	expected := []MetaType{TimeSignature, SetTempo, Marker, SetTempo, EndOfTrack}
+	if len(track.Events) != len(expected) {
+		t.Fatalf("expected %v events, got %v", len(expected), len(track.Events))
+	}
+
+	for index, event := range track.Events {
+		if me := event.(*MetaEvent); me.MetaType != expected[index] {
+			t.Errorf("event %v: expected %v, got %v", index, metaTypeToString(expected[index]), metaTypeToString(me.MetaType))
+		}
+	}
+
+	if track.Events[3].DeltaTime() != 960 {
+		t.Errorf("expected second tempo change at delta 960, got %v", track.Events[3].DeltaTime())
+	}
+
+	ts, _ := timeSignatureFromData(0, track.Events[0].(*MetaEvent).Data)
+	if ts.Numerator != 3 || ts.Denominator != 4 {
+		t.Errorf("expected 3/4 time signature, got %v/%v", ts.Numerator, ts.Denominator)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	track := &Track{}
+	capture := NewCapture(track, 120, 480)
+
+	start := time.Now()
+
+	capture.Add(start, NewChannelEvent(0, NoteOn, 0, 60, 100))
+	capture.Add(start.Add(250*time.Millisecond), NewChannelEvent(0, NoteOff, 0, 60, 0))
+	capture.Add(start.Add(300*time.Millisecond), ActiveSensingEvent)
+
+	if len(track.Events) != 2 {
+		t.Fatalf("expected 2 captured events, got %v", len(track.Events))
+	}
+
+	if dt := track.Events[1].DeltaTime(); dt != 240 {
+		t.Errorf("expected delta time 240, got %v", dt)
+	}
+}
+
+func TestEventIteratorTime(t *testing.T) {
+	mf, err := OpenMapped("data/teddybear.mid")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	defer mf.Close()
+
+	tm := mf.TempoMap()
+	it := NewEventIterator(mf.File, true)
+
+	count := 0
+	lastTick := uint32(0)
+
+	for it.Next() {
+		if it.Tick() < lastTick {
+			t.Fatalf("events out of order at tick %v", it.Tick())
+		}
+
+		if it.Time() != tm.TickToDuration(it.Tick()) {
+			t.Fatalf("iterator time %v differs from tempo map time %v", it.Time(), tm.TickToDuration(it.Tick()))
+		}
+
+		lastTick = it.Tick()
+		count++
+	}
+
+	total := 0
+	for _, track := range mf.Tracks {
+		total += len(track.Events)
+	}
+
+	if count != total {
+		t.Errorf("expected %v events, iterated %v", total, count)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	f := newFileWithTracks(Format1, 480, []*Track{
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: TempoChange{MicrosecondsPerQuarterNote: 1000000}.MetaEvent(0)},
+			{Tick: 480, Event: TempoChange{MicrosecondsPerQuarterNote: 250000}.MetaEvent(0)},
+			{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+			{Tick: 960, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+			{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+	})
+
+	events := Flatten(f)
+	if len(events) != 4 {
+		t.Fatalf("expected the tempo events to be dropped, got %v events", len(events))
+	}
+
+	// One quarter note at 60 bpm followed by one at 240 bpm
+	if events[2].Time != 1250*time.Millisecond || events[2].Track != 1 || events[2].Event.EventType() != NoteOff {
+		t.Errorf("expected the note off at 1.25s, got %v at %v", events[2].Event, events[2].Time)
+	}
+}
+
+func TestTrackBuilder(t *testing.T) {
+	b := NewTrackBuilder(480)
+	b.TimeSignatures = NewTimeSigMap([]TimeSignatureChange{
+		{Tick: 0, Numerator: 3, Denominator: 4},
+	})
+
+	if tick := b.Tick(Bar(4).Beat(2)); tick != 3*1440+480 {
+		t.Errorf("expected bar 4 beat 2 at tick %v, got %v", 3*1440+480, tick)
+	}
+
+	b.AddNote(Bar(2), Quarter.Dotted(), 60, 100)
+
+	events := b.Build().AbsEvents()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", len(events))
+	}
+
+	if events[0].Tick != 1440 || events[1].Tick != 1440+720 {
+		t.Errorf("unexpected note ticks %v and %v", events[0].Tick, events[1].Tick)
+	}
+
+	if _, ok := timeSignatureFromData(0, []byte{4, 8, 24, 8}); ok {
+		t.Error("expected a denominator exponent of 8 to be rejected")
+	}
+
+	b.TimeSignatures = NewTimeSigMap([]TimeSignatureChange{{Tick: 0, Numerator: 4, Denominator: 0}})
+	if tick := b.Tick(Bar(2)); tick != 1920 {
+		t.Errorf("expected a zero denominator to be treated as 4/4, got bar 2 at tick %v", tick)
+	}
+}
+
+func TestRecorderQuantize(t *testing.T) {
+	track := &Track{}
+	r := NewRecorder(track, 120, 480)
+	r.QuantizeGrid = 120
+
+	start := time.Unix(0, 0)
+	ticks := func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Second / 960)
+	}
+
+	r.Start(start)
+	r.Add(ticks(130), NewChannelEvent(0, NoteOn, 0, 60, 100))
+	r.Add(ticks(170), NewChannelEvent(0, NoteOff, 0, 60, 0))
+	r.Add(ticks(350), NewChannelEvent(0, NoteOn, 0, 62, 100))
+	r.Commit()
+
+	expected := []uint32{120, 160, 360}
+	events := track.AbsEvents()
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+
+	for i, ae := range events {
+		if ae.Tick != expected[i] {
+			t.Errorf("event %d: expected tick %d, got %d", i, expected[i], ae.Tick)
+		}
+	}
+}
+
+func TestRecorderPunch(t *testing.T) {
+	track := &Track{}
+	track.AddNote(0, 100, 0, 60, 100)
+	track.AddNote(500, 100, 0, 62, 100)
+	track.AddNote(1500, 100, 0, 64, 100)
+
+	monitored := 0
+	r := NewRecorder(track, 120, 480)
+	r.Punch = true
+	r.PunchIn = 480
+	r.PunchOut = 960
+	r.Monitor = EventSinkFunc(func(track int, tick uint32, event Event) error {
+		monitored++
+		return nil
+	})
+
+	start := time.Unix(0, 0)
+	ticks := func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Second / 960)
+	}
+
+	r.Start(start)
+	r.Add(ticks(100), NewChannelEvent(0, NoteOn, 0, 70, 100))
+	r.Add(ticks(200), NewChannelEvent(0, NoteOff, 0, 70, 0))
+	r.Add(ticks(600), NewChannelEvent(0, NoteOn, 0, 72, 100))
+	r.Add(ticks(1000), NewChannelEvent(0, NoteOff, 0, 72, 0))
+	r.Commit()
+
+	if monitored != 4 {
+		t.Errorf("expected 4 monitored events, got %d", monitored)
+	}
+
+	notes := track.Notes()
+	keys := []uint8{60, 72, 64}
+
+	if len(notes) != len(keys) {
+		t.Fatalf("expected %d notes, got %d", len(keys), len(notes))
+	}
+
+	for i, note := range notes {
+		if note.Key != keys[i] {
+			t.Errorf("note %d: expected key %d, got %d", i, keys[i], note.Key)
+		}
+	}
+
+	if notes[1].End != 960 {
+		t.Errorf("expected punched note to end at punch out, got %d", notes[1].End)
+	}
+}
+
+func TestRecorderCountInTempo(t *testing.T) {
+	r := NewRecorder(&Track{}, 0, 480)
+	ts := TimeSignatureChange{Numerator: 4, Denominator: 4}
+
+	if err := r.CountIn(context.Background(), time.Now(), 1, ts, nil); err == nil {
+		t.Error("expected a count-in without tempo to fail")
+	}
+}
+
+func TestSMPTEDivision(t *testing.T) {
+	track := &Track{}
+	track.AddNote(0, 1200, 0, 60, 100)
+	track.Events = append(track.Events, NewMetaEvent(0, EndOfTrack, nil))
+
+	f := newFileWithTracks(Format0, 96, []*Track{track})
+
+	if err := f.Header.SetSMPTE(30, 40); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Header.Division != 0xE228 {
+		t.Errorf("expected division 0xE228, got %X", f.Header.Division)
+	}
+
+	if err := f.Header.SetSMPTE(31, 40); err == nil {
+		t.Error("expected invalid frame rate to fail")
+	}
+
+	if err := (&FileHeader{}).SetTicksPerQuarterNote(0x8000); err == nil {
+		t.Error("expected ticks per quarter note over 15 bits to fail")
+	}
+
+	f.Chunks[0] = f.Header.Chunk()
+
+	buf := &bytes.Buffer{}
+	if _, err := f.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	d, err := EstimateDuration(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d != time.Second {
+		t.Errorf("expected 1s, got %v", d)
+	}
+
+	mf := &File{}
+	if _, err := mf.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if mf.Header.FramesPerSecond != 30 || mf.Header.TicksPerFrame != 40 {
+		t.Errorf("unexpected division %d fps %d ticks per frame", mf.Header.FramesPerSecond, mf.Header.TicksPerFrame)
+	}
+
+	if tick := mf.TickAtTime(500 * time.Millisecond); tick != 600 {
+		t.Errorf("expected tick 600, got %d", tick)
+	}
+
+	// 30 drop frame runs at 29.97 frames per second
+	tm := NewSMPTETempoMap(29, 80, nil)
+	if d := tm.TickToDuration(24000); d != 10010*time.Millisecond {
+		t.Errorf("expected 10.01s, got %v", d)
+	}
+
+	if tick := tm.DurationToTick(10010 * time.Millisecond); tick != 24000 {
+		t.Errorf("expected tick 24000, got %d", tick)
+	}
+}
+
+func TestOrderPolicy(t *testing.T) {
+	b := NewTrackBuilder(96)
+	b.AddEvent(0, NewChannelEvent(0, NoteOn, 0, 60, 100))
+	b.AddEvent(0, NewChannelEvent(0, NoteOff, 0, 62, 0))
+	b.AddEvent(0, NewChannelEvent(0, ProgramChange, 0, 1, 0))
+
+	track := b.Build()
+	expected := []EventType{ProgramChange, NoteOff, NoteOn, Meta}
+
+	for i, event := range track.Events {
+		if event.EventType() != expected[i] {
+			t.Errorf("event %d: expected %v, got %v", i, eventTypeToString(expected[i]), event)
+		}
+	}
+
+	b.Order = OrderPreserve
+	if first := b.Build().Events[0]; first.EventType() != NoteOn {
+		t.Errorf("expected insertion order to be preserved, got %v", first)
+	}
+
+	dst := &Track{}
+	dst.AddNote(0, 96, 0, 60, 100)
+	OverdubWithOrder(dst, []AbsEvent{{Tick: 96, Event: NewChannelEvent(0, ControlChange, 0, 7, 100)}}, OrderByType)
+
+	if last := dst.Events[len(dst.Events)-1]; last.EventType() != NoteOff {
+		t.Errorf("expected the control change before the note off, got %v last", last)
+	}
+
+	// Events of other types that report a channel event type have the same rank but can not be
+	// compared by channel
+	note := NewChannelEvent(0, NoteOn, 0, 60, 100)
+	other := &SystemCommonEvent{coreEvent: coreEvent{eventType: NoteOn}}
+	if OrderCanonical.Less(note, other) || OrderCanonical.Less(other, note) {
+		t.Error("expected events of different types with the same rank to be unordered")
+	}
+}
+
+func TestTrackSort(t *testing.T) {
+	track := &Track{Events: []Event{
+		NewChannelEvent(0, NoteOn, 0, 60, 100),
+		NewMetaEvent(0, EndOfTrack, nil),
+		NewChannelEvent(0, ControlChange, 0, 7, 100),
+		NewChannelEvent(10, NoteOff, 0, 60, 0),
+	}}
+
+	track.Sort()
+
+	expected := []EventType{ControlChange, NoteOn, NoteOff, Meta}
+	for i, event := range track.Events {
+		if event.EventType() != expected[i] {
+			t.Errorf("event %d: expected %v, got %v", i, eventTypeToString(expected[i]), event)
+		}
+	}
+
+	if ticks := track.AbsEvents(); ticks[3].Tick != 10 {
+		t.Errorf("expected end of track at tick 10, got %d", ticks[3].Tick)
+	}
+
+	events := []AbsEvent{
+		{Tick: 20, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+		{Tick: 5, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+	}
+
+	SortAbsEvents(events, OrderByType)
+	if events[0].Tick != 5 {
+		t.Errorf("expected events sorted by tick")
+	}
+}
+
+func TestBars(t *testing.T) {
+	mf := NewFile()
+	mf.Header = &FileHeader{Format: Format1}
+	if err := mf.Header.SetTicksPerQuarterNote(480); err != nil {
+		t.Fatal(err)
+	}
+
+	// A 3/4 change in the middle of the first bar takes effect at bar 2
+	conductor := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 960, Event: TimeSignatureChange{Numerator: 3, Denominator: 4, ClocksPerClick: 24, ThirtySecondNotesPerQuarterNote: 8}.MetaEvent(0)},
+		{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	notes := NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+		{Tick: 1920, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+		{Tick: 4800, Event: NewChannelEvent(0, NoteOn, 0, 62, 100)},
+		{Tick: 5280, Event: NewChannelEvent(0, NoteOff, 0, 62, 0)},
+		{Tick: 5280, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})
+
+	mf.Tracks = []*Track{conductor, notes}
+
+	expected := []struct {
+		start, end uint32
+		numerator  uint8
+		events     int
+	}{
+		{0, 1920, 4, 3},
+		{1920, 3360, 3, 1},
+		{3360, 4800, 3, 0},
+		{4800, 6240, 3, 3},
+	}
+
+	bars := []Measure{}
+	for bar := range Bars(mf) {
+		bars = append(bars, bar)
+	}
+
+	if len(bars) != len(expected) {
+		t.Fatalf("expected %v bars, got %v", len(expected), len(bars))
+	}
+
+	for index, bar := range bars {
+		e := expected[index]
+		if bar.Number != index+1 || bar.Start != e.start || bar.End != e.end || bar.TimeSignature.Numerator != e.numerator || len(bar.Events) != e.events {
+			t.Errorf("bar %v: unexpected %v-%v %v/4 with %v events", index+1, bar.Start, bar.End, bar.TimeSignature.Numerator, len(bar.Events))
+		}
+	}
+
+	if ev := bars[1].Events[0]; ev.Track != 1 || ev.Tick != 1920 || ev.Event.EventType() != NoteOff {
+		t.Errorf("unexpected first event of bar 2 %v", ev)
+	}
+
+	count := 0
+	for range Bars(mf) {
+		count++
+		break
+	}
+
+	if count != 1 {
+		t.Errorf("expected iteration to stop after one bar, got %v", count)
+	}
+}
+
+func TestTimeSigMap(t *testing.T) {
+	tsm := NewTimeSigMap([]TimeSignatureChange{
+		{Tick: 1920, Numerator: 3, Denominator: 4},
+		{Tick: 3840, Numerator: 6, Denominator: 8},
+	})
+
+	if ts := tsm.At(1919); ts.Numerator != 4 || ts.Denominator != 4 {
+		t.Errorf("expected 4/4 before the first change, got %v/%v", ts.Numerator, ts.Denominator)
+	}
+
+	if ts := tsm.At(3000); ts.Numerator != 3 {
+		t.Errorf("expected 3/4 at tick 3000, got %v/%v", ts.Numerator, ts.Denominator)
+	}
+
+	starts := tsm.BarStartTicks(480, 5000)
+	expected := []uint32{0, 1920, 3360, 4800}
+	if len(starts) != len(expected) {
+		t.Fatalf("expected bar starts %v, got %v", expected, starts)
+	}
+
+	for index, start := range starts {
+		if start != expected[index] {
+			t.Errorf("expected bar starts %v, got %v", expected, starts)
+			break
+		}
+	}
+
+	if err := tsm.Validate(480, false); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// 3840 falls in the middle of the second 3/4 bar
+	var warning WarningError
+	if err := tsm.Validate(480, true); !errors.As(err, &warning) || warning.Tick != 3840 {
+		t.Errorf("expected the 6/8 change to be reported, got %v", err)
+	}
+
+	invalid := NewTimeSigMap([]TimeSignatureChange{{Numerator: 3, Denominator: 6}})
+	if err := invalid.Validate(480, false); err == nil {
+		t.Error("expected an invalid denominator to be reported")
+	}
+
+	zero := NewTimeSigMap([]TimeSignatureChange{{Numerator: 4, Denominator: 0}, {Tick: 1920, Numerator: 3, Denominator: 4}})
+	if err := zero.Validate(480, true); err == nil {
+		t.Error("expected a zero denominator to be reported")
+	}
+
+	if starts := zero.BarStartTicks(480, 3840); len(starts) != 3 || starts[1] != 1920 || starts[2] != 3360 {
+		t.Errorf("expected a zero denominator to be treated as 4/4, got %v", starts)
+	}
+}
+
+func TestKeyMap(t *testing.T) {
+	mf := NewFile()
+	mf.Tracks = []*Track{NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: KeySignatureChange{Sharps: 7}.MetaEvent(0)},
+		{Tick: 960, Event: KeySignatureChange{Sharps: -3, Minor: true}.MetaEvent(0)},
+		{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})}
+
+	km := mf.KeyMap()
+	if len(km.Changes) != 2 || km.At(960).String() != "C minor" || km.At(0).String() != "C# major" {
+		t.Fatalf("unexpected key map %v", km.Changes)
+	}
+
+	expected := []struct {
+		tick uint32
+		key  uint8
+		name string
+	}{
+		{0, 60, "B#3"},
+		{0, 65, "E#4"},
+		{0, 62, "D4"},
+		{960, 63, "Eb4"},
+		{960, 66, "Gb4"},
+		{960, 71, "B4"},
+	}
+
+	for _, e := range expected {
+		if name := km.NoteName(e.tick, e.key); name != e.name {
+			t.Errorf("key %v at %v: expected %v, got %v", e.key, e.tick, e.name, name)
+		}
+	}
+
+	if name := NoteName(61, KeySignatureChange{}); name != "C#4" {
+		t.Errorf("expected C#4 in C major, got %v", name)
+	}
+
+	if name := NoteName(65, KeySignatureChange{Sharps: 1}); name != "F4" {
+		t.Errorf("expected F4 in G major, got %v", name)
+	}
+
+	if name := NoteName(71, KeySignatureChange{Sharps: -7}); name != "Cb5" {
+		t.Errorf("expected Cb5 in Cb major, got %v", name)
+	}
+}
+
+func TestConcatenate(t *testing.T) {
+	first := newFileWithTracks(Format0, 240, []*Track{NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: TempoChange{MicrosecondsPerQuarterNote: 600000}.MetaEvent(0)},
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 2, 60, 100)},
+		{Tick: 240, Event: NewChannelEvent(0, NoteOff, 2, 60, 0)},
+		{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})})
+
+	second := newFileWithTracks(Format1, 480, []*Track{
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: TimeSignatureChange{Numerator: 3, Denominator: 4, ClocksPerClick: 24, ThirtySecondNotesPerQuarterNote: 8}.MetaEvent(0)},
+			{Tick: 0, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 64, 100)},
+			{Tick: 480, Event: NewChannelEvent(0, NoteOff, 0, 64, 0)},
+			{Tick: 480, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+	})
+
+	medley := Concatenate([]*File{first, second}, 1920)
+
+	if medley.Header.Format != Format1 || medley.Header.TicksPerQuarterNote != 480 || len(medley.Tracks) != 2 {
+		t.Fatalf("unexpected medley header %+v with %v tracks", medley.Header, len(medley.Tracks))
+	}
+
+	// The first song ends halfway the first bar at tick 960 at 480 ppq, the second song starts a
+	// bar of 1920 ticks after the next bar line
+	tm, tsm, _ := ExtractTempoMap(medley)
+	if tm.TempoAt(0) != 600000 || tm.TempoAt(3839) != 600000 || tm.TempoAt(3840) != DefaultTempo {
+		t.Errorf("expected the tempo of each song, got %v", tm.Changes)
+	}
+
+	if tsm.At(0).Numerator != 4 || tsm.At(3840).Numerator != 3 {
+		t.Errorf("expected the time signature of each song, got %v", tsm.Changes)
+	}
+
+	if starts := tsm.BarStartTicks(480, 5280); starts[2] != 3840 || starts[3] != 5280 {
+		t.Errorf("expected the second song to start on a bar line, got %v", starts)
+	}
+
+	// The conductor track is ordered like BuildConductorTrack
+	conductor := medley.Tracks[0].Events
+	if me, ok := conductor[0].(*MetaEvent); !ok || me.MetaType != TimeSignature || conductor[1].(*MetaEvent).MetaType != SetTempo {
+		t.Errorf("expected the time signature before the tempo, got %v", conductor)
+	}
+
+	notes := medley.Tracks[1].Notes()
+	if len(notes) != 2 || notes[0].End != 480 || notes[1].Start != 3840 || notes[1].End != 4320 {
+		t.Errorf("unexpected notes %+v", notes)
+	}
+
+	resets := 0
+	for _, ae := range medley.Tracks[1].AbsEvents() {
+		if ce, ok := ae.Event.(*ChannelEvent); ok && ce.Channel == 2 && ae.Tick == 3840 && ce.eventType != NoteOn {
+			resets++
+		}
+	}
+
+	if resets != 3 {
+		t.Errorf("expected 3 reset events for channel 2, got %v", resets)
+	}
+
+	if medley.endTick() != 4320 {
+		t.Errorf("expected the medley to end at 4320, got %v", medley.endTick())
+	}
+
+	// 1000 ticks at 25 frames per second and 40 ticks per frame are one second, 960 ticks at
+	// 480 ticks per quarter note and the default tempo
+	smpte := newFileWithTracks(Format0, 480, []*Track{NewTrackFromAbsEvents([]AbsEvent{
+		{Tick: 0, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+		{Tick: 1000, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+		{Tick: 1000, Event: NewMetaEvent(0, EndOfTrack, nil)},
+	})})
+	smpte.Header.SetSMPTE(25, 40)
+
+	notes = Concatenate([]*File{smpte}, 0).Tracks[1].Notes()
+	if len(notes) != 1 || notes[0].End != 960 {
+		t.Errorf("expected the SMPTE note to end at 960, got %+v", notes)
+	}
+}
+
+func TestExtractSection(t *testing.T) {
+	mf := newFileWithTracks(Format1, 480, []*Track{
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: TempoChange{MicrosecondsPerQuarterNote: 600000}.MetaEvent(0)},
+			{Tick: 960, Event: TempoChange{MicrosecondsPerQuarterNote: 400000}.MetaEvent(0)},
+			{Tick: 3840, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: NewMetaEvent(0, TrackName, []byte("Piano"))},
+			{Tick: 0, Event: NewChannelEvent(0, ControlChange, 0, ControllerBankSelectMSB, 1)},
+			{Tick: 0, Event: NewChannelEvent(0, ProgramChange, 0, 5, 0)},
+			{Tick: 0, Event: NewChannelEvent(0, ControlChange, 0, 7, 90)},
+			{Tick: 480, Event: NewChannelEvent(0, ControlChange, 0, 7, 100)},
+			{Tick: 480, Event: NewChannelEvent(0, ControlChange, 0, ControllerAllNotesOff, 0)},
+			{Tick: 1000, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+			{Tick: 2000, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+			{Tick: 2000, Event: NewChannelEvent(0, NoteOn, 0, 62, 100)},
+			{Tick: 3000, Event: NewChannelEvent(0, NoteOff, 0, 62, 0)},
+			{Tick: 3840, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+	})
+
+	section := ExtractSection(mf, 1920, 2880)
+
+	if len(section.Tracks) != 2 || section.Header.TicksPerQuarterNote != 480 {
+		t.Fatalf("unexpected section with %v tracks", len(section.Tracks))
+	}
+
+	if tempo := section.TempoMap().TempoAt(0); tempo != 400000 {
+		t.Errorf("expected tempo 400000 at the start of the section, got %v", tempo)
+	}
+
+	expected := []string{"Meta TrackName \"Piano\"", "ControlChange 0 0 1", "ProgramChange 0 5", "ControlChange 0 7 100", "NoteOn 0 62 100", "NoteOff 0 62 0", "Meta EndOfTrack"}
+	ticks := []uint32{0, 0, 0, 0, 80, 960, 960}
+
+	events := section.Tracks[1].AbsEvents()
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v events, got %v", len(expected), len(events))
+	}
+
+	for index, ae := range events {
+		line, _ := textEventLine(ae.Event)
+		if line != expected[index] || ae.Tick != ticks[index] {
+			t.Errorf("event %v: expected %v at %v, got %v at %v", index, expected[index], ticks[index], line, ae.Tick)
+		}
+	}
+}
+
+func TestAlignTempo(t *testing.T) {
+	stem := newFileWithTracks(Format1, 240, []*Track{
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 0, Event: TempoChange{MicrosecondsPerQuarterNote: 600000}.MetaEvent(0)},
+			{Tick: 0, Event: TimeSignatureChange{Numerator: 3, Denominator: 4, ClocksPerClick: 24, ThirtySecondNotesPerQuarterNote: 8}.MetaEvent(0)},
+			{Tick: 0, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+		NewTrackFromAbsEvents([]AbsEvent{
+			{Tick: 720, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+			{Tick: 960, Event: NewChannelEvent(0, NoteOff, 0, 60, 0)},
+			{Tick: 960, Event: NewMetaEvent(0, EndOfTrack, nil)},
+		}),
+	})
+
+	reference := NewTempoMap(480, []TempoChange{
+		{Tick: 0, MicrosecondsPerQuarterNote: 500000},
+		{Tick: 1440, MicrosecondsPerQuarterNote: 250000},
+	})
+
+	if err := AlignTempo(stem, reference); err != nil {
+		t.Fatal(err)
+	}
+
+	if stem.Header.TicksPerQuarterNote != 480 {
+		t.Errorf("expected 480 ticks per quarter note, got %v", stem.Header.TicksPerQuarterNote)
+	}
+
+	tm, tsm, _ := ExtractTempoMap(stem)
+	if len(tm.Changes) != 2 || tm.Changes[0].MicrosecondsPerQuarterNote != 500000 || tm.Changes[1].Tick != 1440 {
+		t.Errorf("expected the reference tempo changes, got %v", tm.Changes)
+	}
+
+	if tsm.At(0).Numerator != 3 {
+		t.Errorf("expected the time signature to be kept")
+	}
+
+	// The note starts on the second bar of 3/4, which starts at 1.5s in the reference
+	notes := stem.Notes()
+	if len(notes) != 1 || notes[0].Start != 1440 || notes[0].End != 1920 {
+		t.Fatalf("unexpected notes %+v", notes)
+	}
+
+	if d := stem.TimeAtTick(notes[0].Start); d != 1500*time.Millisecond {
+		t.Errorf("expected the note at 1.5s, got %v", d)
+	}
+
+	if err := AlignTempo(stem, NewSMPTETempoMap(25, 40, nil)); err == nil {
+		t.Error("expected an error for a SMPTE reference")
+	}
+}
+
+func TestFindLoops(t *testing.T) {
+	events := []AbsEvent{}
+	addNote := func(tick uint32, key uint16, length uint32) {
+		events = append(events,
+			AbsEvent{Tick: tick, Event: NewChannelEvent(0, NoteOn, 0, key, 100)},
+			AbsEvent{Tick: tick + length, Event: NewChannelEvent(0, NoteOff, 0, key, 0)},
+		)
+	}
+
+	// Bars 1 to 3 are the same, bar 4 changes one note and bar 5 is different
+	for bar := uint32(0); bar < 4; bar++ {
+		keys := []uint16{60, 64, 67, 72}
+		if bar == 3 {
+			keys[3] = 71
+		}
+
+		for beat, key := range keys {
+			addNote(bar*1920+uint32(beat)*480, key, 240)
+		}
+	}
+
+	addNote(4*1920, 48, 1920)
+	events = append(events, AbsEvent{Tick: 5 * 1920, Event: NewMetaEvent(0, EndOfTrack, nil)})
+
+	f := newFileWithTracks(Format0, 480, []*Track{NewTrackFromAbsEvents(events)})
+
+	loops := FindLoops(f, 1)
+	if len(loops) != 1 || loops[0] != (LoopCandidate{StartBar: 1, EndBar: 1, Repeats: 3, Similarity: 1}) {
+		t.Fatalf("unexpected exact loops %+v", loops)
+	}
+
+	loops = FindLoops(f, 0.5)
+	if len(loops) != 1 || loops[0].StartBar != 1 || loops[0].Bars() != 1 || loops[0].Repeats != 4 {
+		t.Fatalf("unexpected near loops %+v", loops)
+	}
+
+	if similarity := (1 + 1 + 0.6) / 3; math.Abs(loops[0].Similarity-similarity) > 1e-9 {
+		t.Errorf("expected similarity %v, got %v", similarity, loops[0].Similarity)
+	}
+
+	if loops := FindLoops(newFileWithTracks(Format0, 480, []*Track{NewTrackFromAbsEvents(events[len(events)-3:])}), 0.5); len(loops) != 0 {
+		t.Errorf("expected no loops without repetitions, got %+v", loops)
+	}
+}
@@ -0,0 +1,407 @@
+package midi
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The text format has one item per line, blank lines and lines starting with '#' are ignored:
+//
+//	format 1
+//	division ppq 480            (or: division smpte 25 40)
+//	track
+//	0 Meta TrackName "Piano"
+//	0 Meta SetTempo 07a120
+//	0 ProgramChange 0 5         (channel, program)
+//	0 NoteOn 0 60 100           (channel, key, velocity)
+//	480 NoteOff 0 60 0
+//	480 PitchWheelChange 0 8192 (channel, 14 bit value)
+//	960 SystemExclusive 7e7f0901f7
+//	960 SystemExclusiveContinuation f8
+//	960 Raw f4 0102             (status, data)
+//	960 Meta EndOfTrack
+//
+// Ticks are absolute. Text meta events hold a quoted string, other meta events and system
+// exclusive events hold hex data. System exclusive events with status 0xF7 are written as
+// SystemExclusiveContinuation. Raw events hold the status byte and the data bytes as hex.
+// Unknown meta types are written as hex numbers, e.g. Meta 0x60
+
+// textSysExContinuation is the name of system exclusive events with status 0xF7
+const textSysExContinuation = "SystemExclusiveContinuation"
+
+// isTextMetaType returns true for meta types holding text
+func isTextMetaType(metaType MetaType) bool {
+	return metaType >= Text && metaType <= 0x0F
+}
+
+// textEventLine formats an event without tick for the text format
+func textEventLine(event Event) (string, error) {
+	switch e := event.(type) {
+	case *ChannelEvent:
+		name := eventTypeToString(e.eventType)
+
+		switch e.eventType {
+		case ProgramChange, ChannelPressure, PitchWheelChange:
+			return fmt.Sprintf("%v %v %v", name, e.Channel, e.Value1), nil
+		}
+
+		return fmt.Sprintf("%v %v %v %v", name, e.Channel, e.Value1, e.Value2), nil
+	case *SequencerSpecificEvent:
+		return textEventLine(&e.MetaEvent)
+	case *MetaEvent:
+		name := metaTypeToString(e.MetaType)
+		if name == "Unknown" {
+			name = fmt.Sprintf("0x%02x", uint8(e.MetaType))
+		}
+
+		switch {
+		case isTextMetaType(e.MetaType):
+			return fmt.Sprintf("Meta %v %v", name, strconv.Quote(string(e.Data))), nil
+		case len(e.Data) == 0:
+			return "Meta " + name, nil
+		}
+
+		return fmt.Sprintf("Meta %v %v", name, hex.EncodeToString(e.Data)), nil
+	case *SystemExclusiveEvent:
+		if e.Continuation {
+			return textSysExContinuation + " " + hex.EncodeToString(e.Data), nil
+		}
+
+		return "SystemExclusive " + hex.EncodeToString(e.Data), nil
+	case *SystemCommonEvent:
+		if e.eventType == TuneRequest {
+			return eventTypeToString(e.eventType), nil
+		}
+
+		return fmt.Sprintf("%v %v", eventTypeToString(e.eventType), e.Value1), nil
+	case *SystemRealTimeEvent:
+		return eventTypeToString(e.eventType), nil
+	case *RawEvent:
+		// Raw events with a registered event type are written as Raw as well
+		if len(e.Data) == 0 {
+			return fmt.Sprintf("%v %02x", eventTypeToString(Raw), e.Status), nil
+		}
+
+		return fmt.Sprintf("%v %02x %v", eventTypeToString(Raw), e.Status, hex.EncodeToString(e.Data)), nil
+	}
+
+	return "", fmt.Errorf("event %v has no text representation", event)
+}
+
+// WriteText writes the file in the line oriented text format
+func (f *File) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if f.Header != nil {
+		fmt.Fprintf(bw, "format %v\n", f.Header.Format)
+
+		if f.Header.DivisionType == DivisionFramesTicks {
+			fmt.Fprintf(bw, "division smpte %v %v\n", f.Header.FramesPerSecond, f.Header.TicksPerFrame)
+		} else {
+			fmt.Fprintf(bw, "division ppq %v\n", f.Header.TicksPerQuarterNote)
+		}
+	}
+
+	for _, track := range f.Tracks {
+		fmt.Fprintln(bw, "track")
+
+		for _, ae := range track.AbsEvents() {
+			line, err := textEventLine(ae.Event)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(bw, "%v %v\n", ae.Tick, line)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// textEventTypes maps event names to event types
+var textEventTypes = func() map[string]EventType {
+	types := map[string]EventType{}
+	for eventType := NoteOff; eventType <= Raw; eventType++ {
+		types[eventTypeToString(eventType)] = eventType
+	}
+
+	return types
+}()
+
+// textMetaTypes maps meta event names to meta types
+var textMetaTypes = func() map[string]MetaType {
+	types := map[string]MetaType{}
+	for metaType := 0; metaType < 0x80; metaType++ {
+		if name := metaTypeToString(MetaType(metaType)); name != "Unknown" {
+			types[name] = MetaType(metaType)
+		}
+	}
+
+	return types
+}()
+
+// parseTextValues parses n decimal numbers
+func parseTextValues(fields []string, n int) ([]uint16, error) {
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %v values, got %v", n, len(fields))
+	}
+
+	values := make([]uint16, n)
+	for index, field := range fields {
+		v, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+
+		values[index] = uint16(v)
+	}
+
+	return values, nil
+}
+
+// parseTextMeta parses the type and payload of a meta event line
+func parseTextMeta(rest string) (Event, error) {
+	name, payload, _ := strings.Cut(rest, " ")
+
+	metaType, ok := textMetaTypes[name]
+	if !ok {
+		v, err := strconv.ParseUint(name, 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("unknown meta type %v", name)
+		}
+
+		metaType = MetaType(v)
+	}
+
+	var data []byte
+	var err error
+
+	if strings.HasPrefix(payload, "\"") {
+		var s string
+
+		s, err = strconv.Unquote(payload)
+		data = []byte(s)
+	} else {
+		data, err = hex.DecodeString(payload)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMetaEvent(0, metaType, data), nil
+}
+
+// parseTextEvent parses an event line without tick
+func parseTextEvent(name string, rest string) (Event, error) {
+	if name == "Meta" {
+		return parseTextMeta(rest)
+	}
+
+	if name == textSysExContinuation {
+		data, err := hex.DecodeString(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: data, Continuation: true}, nil
+	}
+
+	eventType, ok := textEventTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown event %v", name)
+	}
+
+	fields := strings.Fields(rest)
+
+	switch eventType {
+	case NoteOff, NoteOn, PolyphonicKeyPressure, ControlChange:
+		values, err := parseTextValues(fields, 3)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewChannelEvent(0, eventType, values[0], values[1], values[2]), nil
+	case ProgramChange, ChannelPressure, PitchWheelChange:
+		values, err := parseTextValues(fields, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewChannelEvent(0, eventType, values[0], values[1], 0), nil
+	case SystemExclusive:
+		data, err := hex.DecodeString(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: data}, nil
+	case SongPositionPointer, SongSelect, MTCQuarterFrame:
+		values, err := parseTextValues(fields, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SystemCommonEvent{coreEvent: coreEvent{eventType: eventType}, Value1: values[0]}, nil
+	case TuneRequest:
+		return &SystemCommonEvent{coreEvent: coreEvent{eventType: eventType}}, nil
+	case Raw:
+		if len(fields) < 1 || len(fields) > 2 {
+			return nil, errors.New("expected a status byte and optional data")
+		}
+
+		if len(fields) == 1 {
+			fields = append(fields, "")
+		}
+
+		return parseRawEvent(fields[0], fields[1])
+	}
+
+	return &SystemRealTimeEvent{coreEvent: coreEvent{eventType: eventType}}, nil
+}
+
+// parseRawEvent creates a raw event from a hex status byte and hex data
+func parseRawEvent(status string, data string) (Event, error) {
+	statusBytes, err := hex.DecodeString(status)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(statusBytes) != 1 {
+		return nil, fmt.Errorf("expected a single status byte, got %v", status)
+	}
+
+	rawData, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRawEvent(0, statusBytes[0], rawData), nil
+}
+
+// parseTextHeader applies a format or division line to the header
+func parseTextHeader(header *FileHeader, fields []string) error {
+	if fields[0] == "format" {
+		if len(fields) != 2 {
+			return errors.New("expected format <number>")
+		}
+
+		format, err := strconv.ParseUint(fields[1], 10, 16)
+		header.Format = Format(format)
+
+		return err
+	}
+
+	if len(fields) == 3 && fields[1] == "ppq" {
+		ppq, err := strconv.ParseUint(fields[2], 10, 16)
+		if err != nil {
+			return err
+		}
+
+		return header.SetTicksPerQuarterNote(uint16(ppq))
+	}
+
+	if len(fields) == 4 && fields[1] == "smpte" {
+		fps, err := strconv.ParseUint(fields[2], 10, 8)
+		if err != nil {
+			return err
+		}
+
+		ticksPerFrame, err := strconv.ParseUint(fields[3], 10, 8)
+		if err != nil {
+			return err
+		}
+
+		return header.SetSMPTE(uint8(fps), uint8(ticksPerFrame))
+	}
+
+	return errors.New("expected division ppq <ticks> or division smpte <fps> <ticks per frame>")
+}
+
+// ReadText reads a file in the line oriented text format written by WriteText, the chunks are
+// rebuilt from the parsed header and tracks
+func (f *File) ReadText(r io.Reader) error {
+	header := &FileHeader{}
+	tracks := []*Track{}
+
+	var events []AbsEvent
+
+	endTrack := func() {
+		if events != nil {
+			tracks = append(tracks, NewTrackFromAbsEvents(events))
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		switch fields[0] {
+		case "format", "division":
+			err := parseTextHeader(header, fields)
+			if err != nil {
+				return fmt.Errorf("line %v: %v", lineNumber, err)
+			}
+
+			continue
+		case "track":
+			endTrack()
+			events = []AbsEvent{}
+
+			continue
+		}
+
+		if events == nil {
+			return fmt.Errorf("line %v: event outside of a track", lineNumber)
+		}
+
+		tickField, rest, _ := strings.Cut(line, " ")
+		name, rest, _ := strings.Cut(strings.TrimSpace(rest), " ")
+
+		tick, err := strconv.ParseUint(tickField, 10, 32)
+		if err != nil {
+			return fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+
+		if len(events) > 0 && uint32(tick) < events[len(events)-1].Tick {
+			return fmt.Errorf("line %v: ticks should be ascending", lineNumber)
+		}
+
+		event, err := parseTextEvent(name, strings.TrimSpace(rest))
+		if err != nil {
+			return fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+
+		events = append(events, AbsEvent{Tick: uint32(tick), Event: event})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	endTrack()
+
+	f.Header = header
+	f.Tracks = tracks
+	f.Chunks = nil
+	f.Warnings = nil
+	f.trackErrors = nil
+	f.Rebuild()
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FrameRate is a SMPTE frame rate, the values match the rate codes of SMPTE offset meta events
+// and midi time code messages
+type FrameRate uint8
+
+const (
+	// FrameRate24 is 24 frames per second
+	FrameRate24 FrameRate = iota
+	// FrameRate25 is 25 frames per second
+	FrameRate25
+	// FrameRate2997Drop is 29.97 frames per second drop frame
+	FrameRate2997Drop
+	// FrameRate30 is 30 frames per second
+	FrameRate30
+)
+
+// FramesPerSecond returns the real time number of frames per second
+func (r FrameRate) FramesPerSecond() float64 {
+	switch r {
+	case FrameRate24:
+		return 24
+	case FrameRate25:
+		return 25
+	case FrameRate2997Drop:
+		return 30000.0 / 1001.0
+	}
+
+	return 30
+}
+
+// nominal returns the number of frame numbers per second of timecode
+func (r FrameRate) nominal() int64 {
+	switch r {
+	case FrameRate24:
+		return 24
+	case FrameRate25:
+		return 25
+	}
+
+	return 30
+}
+
+// Timecode is a SMPTE timecode
+type Timecode struct {
+	Hours     uint8
+	Minutes   uint8
+	Seconds   uint8
+	Frames    uint8
+	SubFrames uint8
+	Rate      FrameRate
+}
+
+// ParseTimecode parses a timecode of the form "hh:mm:ss:ff", a ';' or '.' before the frames
+// selects 29.97 drop frame regardless of rate
+func ParseTimecode(s string, rate FrameRate) (Timecode, error) {
+	var h, m, sec, f int
+
+	if len(s) != 11 || s[2] != ':' || s[5] != ':' {
+		return Timecode{}, fmt.Errorf("invalid timecode %q", s)
+	}
+
+	sep := s[8]
+	if sep == ';' || sep == '.' {
+		rate = FrameRate2997Drop
+	} else if sep != ':' {
+		return Timecode{}, fmt.Errorf("invalid timecode %q", s)
+	}
+
+	_, err := fmt.Sscanf(s[:8]+":"+s[9:], "%02d:%02d:%02d:%02d", &h, &m, &sec, &f)
+	if err != nil {
+		return Timecode{}, fmt.Errorf("invalid timecode %q: %v", s, err)
+	}
+
+	tc := Timecode{Hours: uint8(h), Minutes: uint8(m), Seconds: uint8(sec), Frames: uint8(f), Rate: rate}
+
+	return tc, tc.validate()
+}
+
+// validate checks the fields of the timecode against its frame rate
+func (t Timecode) validate() error {
+	switch {
+	case t.Rate > FrameRate30:
+		return fmt.Errorf("invalid frame rate %d", t.Rate)
+	case t.Hours > 23 || t.Minutes > 59 || t.Seconds > 59:
+		return errors.New("timecode out of range")
+	case int64(t.Frames) >= t.Rate.nominal():
+		return fmt.Errorf("frame %d out of range for the frame rate", t.Frames)
+	case t.Rate == FrameRate2997Drop && t.Seconds == 0 && t.Frames < 2 && t.Minutes%10 != 0:
+		return fmt.Errorf("frame %d is dropped in drop frame timecode", t.Frames)
+	}
+
+	return nil
+}
+
+// String formats the timecode, drop frame timecode uses ';' before the frames
+func (t Timecode) String() string {
+	sep := ':'
+	if t.Rate == FrameRate2997Drop {
+		sep = ';'
+	}
+
+	return fmt.Sprintf("%02d:%02d:%02d%c%02d", t.Hours, t.Minutes, t.Seconds, sep, t.Frames)
+}
+
+// FrameCount returns the number of frames since 00:00:00:00, skipping the dropped frame
+// numbers of drop frame timecode
+func (t Timecode) FrameCount() int64 {
+	fps := t.Rate.nominal()
+	count := (int64(t.Hours)*3600+int64(t.Minutes)*60+int64(t.Seconds))*fps + int64(t.Frames)
+
+	if t.Rate == FrameRate2997Drop {
+		// Frame numbers 0 and 1 are dropped every minute except every tenth minute
+		minutes := int64(t.Hours)*60 + int64(t.Minutes)
+		count -= 2 * (minutes - minutes/10)
+	}
+
+	return count
+}
+
+// TimecodeFromFrames returns the timecode of a frame count
+func TimecodeFromFrames(count int64, rate FrameRate) Timecode {
+	fps := rate.nominal()
+
+	if rate == FrameRate2997Drop {
+		// 17982 frames per ten minutes, 1798 per minute after the first of ten
+		tens, rest := count/17982, count%17982
+		count += 18 * tens
+
+		if rest > 1 {
+			count += 2 * ((rest - 2) / 1798)
+		}
+	}
+
+	day := 24 * 3600 * fps
+	count = ((count % day) + day) % day
+
+	return Timecode{
+		Hours:   uint8(count / (3600 * fps)),
+		Minutes: uint8(count / (60 * fps) % 60),
+		Seconds: uint8(count / fps % 60),
+		Frames:  uint8(count % fps),
+		Rate:    rate,
+	}
+}
+
+// Duration returns the real time offset of the timecode, sub frames are hundredths of a frame
+func (t Timecode) Duration() time.Duration {
+	frames := float64(t.FrameCount()) + float64(t.SubFrames)/100
+
+	return time.Duration(frames / t.Rate.FramesPerSecond() * float64(time.Second))
+}
+
+// TimecodeFromDuration returns the timecode of a real time offset
+func TimecodeFromDuration(d time.Duration, rate FrameRate) Timecode {
+	frames := d.Seconds() * rate.FramesPerSecond()
+	count := int64(frames)
+
+	tc := TimecodeFromFrames(count, rate)
+	tc.SubFrames = uint8((frames - float64(count)) * 100)
+
+	return tc
+}
+
+// MetaEvent creates a SMPTE offset meta event for the timecode
+func (t Timecode) MetaEvent(deltaTime uint32) *MetaEvent {
+	return NewMetaEvent(deltaTime, SMPTEOffset, []byte{
+		byte(t.Rate)<<5 | t.Hours&0x1F,
+		t.Minutes,
+		t.Seconds,
+		t.Frames,
+		t.SubFrames,
+	})
+}
+
+// TimecodeFromMetaEvent decodes a SMPTE offset meta event
+func TimecodeFromMetaEvent(event *MetaEvent) (Timecode, error) {
+	if event.MetaType != SMPTEOffset || len(event.Data) < 5 {
+		return Timecode{}, errors.New("not a SMPTE offset meta event")
+	}
+
+	tc := Timecode{
+		Hours:     event.Data[0] & 0x1F,
+		Minutes:   event.Data[1],
+		Seconds:   event.Data[2],
+		Frames:    event.Data[3],
+		SubFrames: event.Data[4],
+		Rate:      FrameRate(event.Data[0] >> 5 & 0x3),
+	}
+
+	return tc, tc.validate()
+}
+
+// QuarterFrames returns the eight midi time code quarter frame messages describing the timecode,
+// sent over two frames starting at the frame of the timecode
+func (t Timecode) QuarterFrames() []*SystemCommonEvent {
+	nibbles := [8]uint8{
+		t.Frames & 0xF, t.Frames >> 4 & 0x1,
+		t.Seconds & 0xF, t.Seconds >> 4 & 0x3,
+		t.Minutes & 0xF, t.Minutes >> 4 & 0x3,
+		t.Hours & 0xF, t.Hours>>4&0x1 | uint8(t.Rate)<<1,
+	}
+
+	events := make([]*SystemCommonEvent, len(nibbles))
+	for piece, nibble := range nibbles {
+		events[piece] = &SystemCommonEvent{
+			coreEvent: coreEvent{eventType: MTCQuarterFrame},
+			Value1:    uint16(piece)<<4 | uint16(nibble),
+		}
+	}
+
+	return events
+}
+
+// FullFrame returns the midi time code full frame system exclusive message for the timecode,
+// used to locate a receiver while transport is stopped
+func (t Timecode) FullFrame(deviceID uint8) *SystemExclusiveEvent {
+	return &SystemExclusiveEvent{
+		coreEvent: coreEvent{eventType: SystemExclusive},
+		Data: []byte{
+			0x7F, deviceID & 0x7F, 0x01, 0x01,
+			byte(t.Rate)<<5 | t.Hours&0x1F, t.Minutes, t.Seconds, t.Frames,
+			0xF7,
+		},
+	}
+}
+
+// MTCDecoder assembles timecodes from received midi time code messages
+type MTCDecoder struct {
+	nibbles [8]uint8
+	seen    uint8
+}
+
+// Decode handles a received event, it returns the timecode when a full frame message or the
+// eighth quarter frame of a sequence is received. Quarter frame timecodes describe the frame the
+// first quarter frame was sent at, which is two frames before the last one is received
+func (d *MTCDecoder) Decode(event Event) (Timecode, bool) {
+	switch e := event.(type) {
+	case *SystemCommonEvent:
+		if e.eventType != MTCQuarterFrame {
+			return Timecode{}, false
+		}
+
+		piece := uint8(e.Value1>>4) & 0x7
+		d.nibbles[piece] = uint8(e.Value1) & 0xF
+
+		// Sequences start at piece 0 so forward and stale pieces are not mixed
+		if piece == 0 {
+			d.seen = 0
+		}
+
+		d.seen |= 1 << piece
+
+		if piece != 7 || d.seen != 0xFF {
+			return Timecode{}, false
+		}
+
+		n := d.nibbles
+
+		return Timecode{
+			Frames:  n[0] | n[1]&0x1<<4,
+			Seconds: n[2] | n[3]&0x3<<4,
+			Minutes: n[4] | n[5]&0x3<<4,
+			Hours:   n[6] | n[7]&0x1<<4,
+			Rate:    FrameRate(n[7] >> 1 & 0x3),
+		}, true
+	case *SystemExclusiveEvent:
+		data := e.Data
+		if len(data) < 8 || data[0] != 0x7F || data[2] != 0x01 || data[3] != 0x01 {
+			return Timecode{}, false
+		}
+
+		return Timecode{
+			Hours:   data[4] & 0x1F,
+			Minutes: data[5],
+			Seconds: data[6],
+			Frames:  data[7],
+			Rate:    FrameRate(data[4] >> 5 & 0x3),
+		}, true
+	}
+
+	return Timecode{}, false
+}
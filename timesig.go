@@ -0,0 +1,154 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// TimeSignatureChange is a time signature change at an absolute tick
+type TimeSignatureChange struct {
+	Tick uint32
+	// Numerator of the time signature, e.g. 6 for 6/8
+	Numerator uint8
+	// Denominator of the time signature, e.g. 8 for 6/8
+	Denominator uint8
+	// Number of midi clocks in a metronome click
+	ClocksPerClick uint8
+	// Number of notated 32nd notes in a midi quarter note (24 midi clocks)
+	ThirtySecondNotesPerQuarterNote uint8
+}
+
+// MetaEvent creates a time signature meta event for the time signature change
+func (c TimeSignatureChange) MetaEvent(deltaTime uint32) *MetaEvent {
+	return NewMetaEvent(deltaTime, TimeSignature, []byte{
+		c.Numerator,
+		uint8(bits.TrailingZeros8(c.Denominator)),
+		c.ClocksPerClick,
+		c.ThirtySecondNotesPerQuarterNote,
+	})
+}
+
+// TimeSigMap holds the time signature changes of a file
+type TimeSigMap struct {
+	// Time signature changes sorted by tick
+	Changes []TimeSignatureChange
+}
+
+// NewTimeSigMap creates a new time signature map, the changes are sorted by tick
+func NewTimeSigMap(changes []TimeSignatureChange) *TimeSigMap {
+	sorted := make([]TimeSignatureChange, len(changes))
+	copy(sorted, changes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Tick < sorted[j].Tick
+	})
+
+	return &TimeSigMap{Changes: sorted}
+}
+
+// timeSignatureFromData decodes the data of a time signature meta event
+func timeSignatureFromData(tick uint32, data []byte) (TimeSignatureChange, bool) {
+	// The denominator is a power of two exponent, exponents above 7 do not fit a byte
+	if len(data) < 4 || data[1] > 7 {
+		return TimeSignatureChange{}, false
+	}
+
+	return TimeSignatureChange{
+		Tick:                            tick,
+		Numerator:                       data[0],
+		Denominator:                     uint8(1) << data[1],
+		ClocksPerClick:                  data[2],
+		ThirtySecondNotesPerQuarterNote: data[3],
+	}, true
+}
+
+// At returns the time signature at tick, 4/4 before the first change
+func (m *TimeSigMap) At(tick uint32) TimeSignatureChange {
+	ts := TimeSignatureChange{Numerator: 4, Denominator: 4, ClocksPerClick: 24, ThirtySecondNotesPerQuarterNote: 8}
+
+	if m == nil {
+		return ts
+	}
+
+	for _, change := range m.Changes {
+		if change.Tick > tick {
+			break
+		}
+
+		ts = change
+	}
+
+	return ts
+}
+
+// BarStartTicks returns the start ticks of all bars beginning at or before end, the time
+// signature is 4/4 until the first change and changes take effect at the start of the next bar.
+// Changes without a numerator or denominator are treated as 4/4
+func (m *TimeSigMap) BarStartTicks(ticksPerQuarterNote uint16, end uint32) []uint32 {
+	starts := []uint32{}
+	numerator := uint32(4)
+	denominator := uint32(4)
+	index := 0
+
+	for tick := uint32(0); tick <= end; {
+		for m != nil && index < len(m.Changes) && m.Changes[index].Tick <= tick {
+			numerator = uint32(m.Changes[index].Numerator)
+			denominator = uint32(m.Changes[index].Denominator)
+			index++
+
+			// An invalid time signature would divide by zero or never end the bar, use 4/4 instead
+			if numerator == 0 || denominator == 0 {
+				numerator, denominator = 4, 4
+			}
+		}
+
+		starts = append(starts, tick)
+
+		length := numerator * uint32(ticksPerQuarterNote) * 4 / denominator
+		if length == 0 {
+			break
+		}
+
+		tick += length
+	}
+
+	return starts
+}
+
+// Validate checks that every change has a numerator and a power of two denominator, if
+// barBoundaries is true changes must also start a bar. Problems are returned as WarningError on
+// the conductor track joined with errors.Join, nil if the map is valid
+func (m *TimeSigMap) Validate(ticksPerQuarterNote uint16, barBoundaries bool) error {
+	if m == nil || len(m.Changes) == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	problem := func(tick uint32, format string, args ...any) {
+		errs = append(errs, WarningError{Warning{Track: 0, Tick: tick, Message: fmt.Sprintf(format, args...)}})
+	}
+
+	for _, change := range m.Changes {
+		if change.Numerator == 0 || change.Denominator == 0 || change.Denominator&(change.Denominator-1) != 0 {
+			problem(change.Tick, "invalid time signature %v/%v", change.Numerator, change.Denominator)
+		}
+	}
+
+	if barBoundaries {
+		starts := map[uint32]bool{}
+		for _, start := range m.BarStartTicks(ticksPerQuarterNote, m.Changes[len(m.Changes)-1].Tick) {
+			starts[start] = true
+		}
+
+		for _, change := range m.Changes {
+			if !starts[change.Tick] {
+				problem(change.Tick, "time signature %v/%v does not start a bar", change.Numerator, change.Denominator)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,187 @@
+package midi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TokenType identifies the kind of a token
+type TokenType uint8
+
+const (
+	// TokenNoteOn starts a note, the value is the key
+	TokenNoteOn TokenType = iota
+	// TokenNoteOff ends a note, the value is the key
+	TokenNoteOff
+	// TokenTimeShift advances time, the value is the number of time steps
+	TokenTimeShift
+	// TokenVelocity sets the velocity bucket for the following note on tokens
+	TokenVelocity
+)
+
+// Token is an element of a MIDI-Like event token sequence
+type Token struct {
+	Type  TokenType
+	Value int
+}
+
+// String representation
+func (t Token) String() string {
+	switch t.Type {
+	case TokenNoteOn:
+		return fmt.Sprintf("NOTE_ON_%v", t.Value)
+	case TokenNoteOff:
+		return fmt.Sprintf("NOTE_OFF_%v", t.Value)
+	case TokenTimeShift:
+		return fmt.Sprintf("TIME_SHIFT_%v", t.Value)
+	case TokenVelocity:
+		return fmt.Sprintf("VELOCITY_%v", t.Value)
+	}
+
+	return "UNKNOWN"
+}
+
+// TokenizerOptions configures the token representation
+type TokenizerOptions struct {
+	// Ticks per time step
+	TimeStep uint32
+	// Maximum number of steps in one time shift token, longer gaps use multiple tokens
+	MaxTimeShift int
+	// Number of velocity buckets
+	VelocityBuckets int
+	// Skip drum notes (channel 10)
+	SkipDrums bool
+}
+
+// DefaultTokenizerOptions returns options with a 32nd note time step, time shifts up to a whole
+// note and 32 velocity buckets
+func DefaultTokenizerOptions(ticksPerQuarterNote uint16) TokenizerOptions {
+	step := uint32(ticksPerQuarterNote) / 8
+	if step == 0 {
+		step = 1
+	}
+
+	return TokenizerOptions{
+		TimeStep:        step,
+		MaxTimeShift:    32,
+		VelocityBuckets: 32,
+	}
+}
+
+// validate fills invalid options with safe values
+func (o TokenizerOptions) validate() TokenizerOptions {
+	if o.TimeStep == 0 {
+		o.TimeStep = 1
+	}
+
+	if o.MaxTimeShift < 1 {
+		o.MaxTimeShift = 1
+	}
+
+	if o.VelocityBuckets < 1 || o.VelocityBuckets > 128 {
+		o.VelocityBuckets = 128
+	}
+
+	return o
+}
+
+// Tokenize converts the notes of all tracks of a file to a MIDI-Like token sequence, times are
+// quantized to the time step and note offs precede note ons at the same time
+func Tokenize(f *File, opts TokenizerOptions) []Token {
+	opts = opts.validate()
+
+	type timedToken struct {
+		step  uint32
+		token Token
+		vel   int
+	}
+
+	timed := []timedToken{}
+
+	for _, note := range f.Notes() {
+		if opts.SkipDrums && note.Channel == 9 {
+			continue
+		}
+
+		start := (note.Start + opts.TimeStep/2) / opts.TimeStep
+		end := (note.End + opts.TimeStep/2) / opts.TimeStep
+		if end <= start {
+			end = start + 1
+		}
+
+		velocity := int(note.Velocity&0x7F) * opts.VelocityBuckets / 128
+
+		timed = append(timed,
+			timedToken{step: start, token: Token{Type: TokenNoteOn, Value: int(note.Key)}, vel: velocity},
+			timedToken{step: end, token: Token{Type: TokenNoteOff, Value: int(note.Key)}},
+		)
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		if timed[i].step != timed[j].step {
+			return timed[i].step < timed[j].step
+		}
+
+		return timed[i].token.Type == TokenNoteOff && timed[j].token.Type != TokenNoteOff
+	})
+
+	tokens := []Token{}
+	currentStep := uint32(0)
+	currentVelocity := -1
+
+	for _, tt := range timed {
+		for shift := tt.step - currentStep; shift > 0; {
+			steps := shift
+			if steps > uint32(opts.MaxTimeShift) {
+				steps = uint32(opts.MaxTimeShift)
+			}
+
+			tokens = append(tokens, Token{Type: TokenTimeShift, Value: int(steps)})
+			shift -= steps
+		}
+
+		currentStep = tt.step
+
+		if tt.token.Type == TokenNoteOn && tt.vel != currentVelocity {
+			tokens = append(tokens, Token{Type: TokenVelocity, Value: tt.vel})
+			currentVelocity = tt.vel
+		}
+
+		tokens = append(tokens, tt.token)
+	}
+
+	return tokens
+}
+
+// Detokenize converts a MIDI-Like token sequence back to a format 0 file with all notes on
+// channel 1, velocity buckets are mapped to the center of their range
+func Detokenize(tokens []Token, ticksPerQuarterNote uint16, opts TokenizerOptions) *File {
+	opts = opts.validate()
+
+	events := []AbsEvent{}
+	tick := uint32(0)
+	velocity := uint16(64)
+
+	for _, token := range tokens {
+		switch token.Type {
+		case TokenTimeShift:
+			tick += uint32(token.Value) * opts.TimeStep
+		case TokenVelocity:
+			bucketSize := 128 / float64(opts.VelocityBuckets)
+			velocity = uint16(float64(token.Value)*bucketSize + bucketSize/2)
+			if velocity > 127 {
+				velocity = 127
+			} else if velocity < 1 {
+				velocity = 1
+			}
+		case TokenNoteOn:
+			events = append(events, AbsEvent{Tick: tick, Event: NewChannelEvent(0, NoteOn, 0, uint16(token.Value&0x7F), velocity)})
+		case TokenNoteOff:
+			events = append(events, AbsEvent{Tick: tick, Event: NewChannelEvent(0, NoteOff, 0, uint16(token.Value&0x7F), 0)})
+		}
+	}
+
+	events = append(events, AbsEvent{Tick: tick, Event: NewMetaEvent(0, EndOfTrack, []byte{})})
+
+	return newFileWithTracks(Format0, ticksPerQuarterNote, []*Track{NewTrackFromAbsEvents(events)})
+}
@@ -0,0 +1,109 @@
+package midi
+
+import (
+	"sort"
+)
+
+// AbsEvent is an event at an absolute tick
+type AbsEvent struct {
+	Tick  uint32
+	Event Event
+}
+
+// AbsEvents returns the events of the track paired with their absolute ticks
+func (t *Track) AbsEvents() []AbsEvent {
+	events := make([]AbsEvent, len(t.Events))
+	tick := uint32(0)
+
+	for index, event := range t.Events {
+		tick += event.DeltaTime()
+		events[index] = AbsEvent{Tick: tick, Event: event}
+	}
+
+	return events
+}
+
+// SetAbsEvents replaces the events of the track, delta times are recomputed from the
+// absolute ticks which should be in ascending order
+func (t *Track) SetAbsEvents(events []AbsEvent) {
+	t.Events = make([]Event, len(events))
+	tick := uint32(0)
+
+	for index, ae := range events {
+		if ae.Tick > tick {
+			ae.Event.SetDeltaTime(ae.Tick - tick)
+			tick = ae.Tick
+		} else {
+			ae.Event.SetDeltaTime(0)
+		}
+
+		t.Events[index] = ae.Event
+	}
+}
+
+// NewTrackFromAbsEvents creates a track from events with absolute ticks in ascending order
+func NewTrackFromAbsEvents(events []AbsEvent) *Track {
+	track := &Track{}
+	track.SetAbsEvents(events)
+
+	return track
+}
+
+// WriteEvent appends an event to the track, the delta time of the event should already be set
+func (t *Track) WriteEvent(event Event) error {
+	t.Events = append(t.Events, event)
+	return nil
+}
+
+// isEndOfTrack returns true if event is an end of track meta event
+func isEndOfTrack(event Event) bool {
+	me, ok := event.(*MetaEvent)
+	return ok && me.MetaType == EndOfTrack
+}
+
+// insertAbsEvent inserts an event in a list of events sorted by tick, if before is true the event
+// is placed before existing events at the same tick, otherwise after them. A trailing end of track
+// event stays last and is moved forward if needed
+func insertAbsEvent(events []AbsEvent, ae AbsEvent, before bool) []AbsEvent {
+	end := len(events)
+	if end > 0 && isEndOfTrack(events[end-1].Event) {
+		end--
+
+		if events[end].Tick < ae.Tick {
+			events[end].Tick = ae.Tick
+		}
+	}
+
+	index := sort.Search(end, func(i int) bool {
+		if before {
+			return events[i].Tick >= ae.Tick
+		}
+
+		return events[i].Tick > ae.Tick
+	})
+
+	events = append(events, AbsEvent{})
+	copy(events[index+1:], events[index:])
+	events[index] = ae
+
+	return events
+}
+
+// AddNote inserts a note on and matching note off at absolute ticks, fixing up the delta times of
+// the surrounding events. The note on is placed after existing events at the start tick and the
+// note off before existing events at the end tick
+func (t *Track) AddNote(startTick, durationTicks uint32, channel, key, velocity uint8) {
+	events := t.AbsEvents()
+
+	events = insertAbsEvent(events, AbsEvent{
+		Tick:  startTick,
+		Event: NewChannelEvent(0, NoteOn, uint16(channel), uint16(key), uint16(velocity)),
+	}, false)
+
+	events = insertAbsEvent(events, AbsEvent{
+		Tick:  startTick + durationTicks,
+		Event: NewChannelEvent(0, NoteOff, uint16(channel), uint16(key), 0),
+	}, true)
+
+	t.SetAbsEvents(events)
+}
@@ -0,0 +1,169 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// A4Frequency is the standard tuning reference of key 69 in Hz
+const A4Frequency = 440.0
+
+// NoteToFrequency returns the frequency in Hz of key bent by bendSemitones, with a4Hz as the
+// frequency of key 69
+func NoteToFrequency(key uint8, bendSemitones float64, a4Hz float64) float64 {
+	return a4Hz * math.Pow(2, (float64(key)+bendSemitones-69)/12)
+}
+
+// FrequencyToNote returns the nearest key for a frequency in Hz (A4 = 440 Hz) and the deviation
+// from that key in cents, keys are clamped to the midi range
+func FrequencyToNote(f float64) (key uint8, cents float64) {
+	if f <= 0 {
+		return 0, 0
+	}
+
+	note := 69 + 12*math.Log2(f/A4Frequency)
+	nearest := math.Round(note)
+
+	if nearest < 0 {
+		nearest = 0
+	} else if nearest > 127 {
+		nearest = 127
+	}
+
+	return uint8(nearest), (note - nearest) * 100
+}
+
+// RetuneOptions configures the microtonal retuning transform
+type RetuneOptions struct {
+	// Offsets in cents per key
+	Offsets [128]float64
+	// Channels used for rotation, every sounding note gets its own pitch bend on one of them
+	Channels []uint16
+	// Pitch bend range of the receiving synth in semitones, 2 if 0
+	PitchBendRange float64
+}
+
+// pitchBendForCents returns the 14 bits pitch bend value for a cents offset
+func pitchBendForCents(cents float64, bendRange float64) (uint16, bool) {
+	value := math.Round(8192 + cents/(bendRange*100)*8192)
+	if value < 0 || value > 16383 {
+		return 0, false
+	}
+
+	return uint16(value), true
+}
+
+// Retune rewrites a single instrument track so every note is realized with a pitch bend for its
+// cents offset. Notes are rotated over the configured channels so simultaneous notes can have
+// different bends, other channel events are copied to all rotation channels and the original
+// pitch bends are dropped
+func Retune(track *Track, opts RetuneOptions) error {
+	if len(opts.Channels) == 0 {
+		return errors.New("retuning needs at least one channel")
+	}
+
+	bendRange := opts.PitchBendRange
+	if bendRange == 0 {
+		bendRange = 2
+	}
+
+	bends := [128]uint16{}
+	for key, cents := range opts.Offsets {
+		bend, ok := pitchBendForCents(cents, bendRange)
+		if !ok {
+			return fmt.Errorf("offset of key %v exceeds the pitch bend range", key)
+		}
+
+		bends[key] = bend
+	}
+
+	numChannels := len(opts.Channels)
+	sounding := make([]int, numChannels)
+	lastUsed := make([]int, numChannels)
+	currentBend := make([]int, numChannels)
+	for index := range currentBend {
+		currentBend[index] = -1
+	}
+
+	// Channel slots used per original channel and key, first in first out
+	assigned := map[uint16][]int{}
+	next := 0
+	counter := 0
+
+	events := []AbsEvent{}
+
+	for _, ae := range track.AbsEvents() {
+		ce, ok := ae.Event.(*ChannelEvent)
+		if !ok {
+			events = append(events, ae)
+			continue
+		}
+
+		id := ce.Channel<<8 | ce.Value1
+
+		switch {
+		case ce.eventType == NoteOn && ce.Value2 > 0:
+			key := ce.Value1 & 0x7F
+
+			// Prefer a free channel, otherwise steal the least recently used one
+			slot := -1
+			for i := 0; i < numChannels; i++ {
+				candidate := (next + i) % numChannels
+				if sounding[candidate] == 0 {
+					slot = candidate
+					break
+				}
+			}
+
+			if slot == -1 {
+				slot = 0
+				for candidate := range lastUsed {
+					if lastUsed[candidate] < lastUsed[slot] {
+						slot = candidate
+					}
+				}
+			}
+
+			next = (slot + 1) % numChannels
+			counter++
+			lastUsed[slot] = counter
+			sounding[slot]++
+			assigned[id] = append(assigned[id], slot)
+
+			channel := opts.Channels[slot]
+
+			if currentBend[slot] != int(bends[key]) {
+				currentBend[slot] = int(bends[key])
+				events = append(events, AbsEvent{Tick: ae.Tick, Event: NewChannelEvent(0, PitchWheelChange, channel, bends[key], 0)})
+			}
+
+			events = append(events, AbsEvent{Tick: ae.Tick, Event: NewChannelEvent(0, NoteOn, channel, ce.Value1, ce.Value2)})
+		case isNoteOff(ce) || ce.eventType == PolyphonicKeyPressure:
+			slots := assigned[id]
+			if len(slots) == 0 {
+				continue
+			}
+
+			slot := slots[0]
+			if isNoteOff(ce) {
+				assigned[id] = slots[1:]
+				if sounding[slot] > 0 {
+					sounding[slot]--
+				}
+			}
+
+			events = append(events, AbsEvent{Tick: ae.Tick, Event: NewChannelEvent(0, ce.eventType, opts.Channels[slot], ce.Value1, ce.Value2)})
+		case ce.eventType == PitchWheelChange:
+			// Pitch bend is used for the tuning
+		default:
+			for _, channel := range opts.Channels {
+				events = append(events, AbsEvent{Tick: ae.Tick, Event: NewChannelEvent(0, ce.eventType, channel, ce.Value1, ce.Value2)})
+			}
+		}
+	}
+
+	track.SetAbsEvents(events)
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// USBPacket is a 32 bits USB-MIDI class event packet: cable number and code index number
+// followed by three midi bytes
+type USBPacket [4]byte
+
+// Cable returns the virtual cable number of the packet
+func (p USBPacket) Cable() uint8 {
+	return p[0] >> 4
+}
+
+// CodeIndex returns the code index number of the packet
+func (p USBPacket) CodeIndex() uint8 {
+	return p[0] & 0xF
+}
+
+// EncodeUSBPackets encodes an event to USB-MIDI packets for a virtual cable (0-15), system
+// exclusive messages span multiple packets
+func EncodeUSBPackets(cable uint8, event Event) ([]USBPacket, error) {
+	data, err := framedMessageBytes(event)
+	if err != nil {
+		return nil, err
+	}
+
+	header := (cable & 0xF) << 4
+	status := data[0]
+
+	if status != 0xF0 {
+		var cin byte
+
+		switch {
+		case status < 0xF0:
+			cin = status >> 4
+		case len(data) == 1 && status >= 0xF8:
+			cin = 0xF
+		case len(data) == 1:
+			cin = 0x5
+		case len(data) == 2:
+			cin = 0x2
+		default:
+			cin = 0x3
+		}
+
+		p := USBPacket{header | cin}
+		copy(p[1:], data)
+
+		return []USBPacket{p}, nil
+	}
+
+	packets := []USBPacket{}
+
+	for len(data) > 0 {
+		p := USBPacket{}
+
+		switch {
+		case len(data) > 3:
+			p[0] = header | 0x4
+			copy(p[1:], data[:3])
+			data = data[3:]
+		case len(data) == 3:
+			p[0] = header | 0x7
+			copy(p[1:], data)
+			data = nil
+		case len(data) == 2:
+			p[0] = header | 0x6
+			copy(p[1:], data)
+			data = nil
+		default:
+			p[0] = header | 0x5
+			copy(p[1:], data)
+			data = nil
+		}
+
+		packets = append(packets, p)
+	}
+
+	return packets, nil
+}
+
+// USBDecoder decodes USB-MIDI packets to events, it assembles system exclusive messages per cable
+type USBDecoder struct {
+	sysEx [16][]byte
+}
+
+// Decode decodes a packet, the returned event is nil if the packet did not complete a message
+func (d *USBDecoder) Decode(p USBPacket) (Event, error) {
+	cable := p.Cable()
+
+	switch cin := p.CodeIndex(); cin {
+	case 0x0, 0x1:
+		// Reserved for future extensions
+		return nil, nil
+	case 0x4:
+		if p[1] == 0xF0 {
+			d.sysEx[cable] = []byte{}
+			return d.appendSysEx(cable, p[2:4], false)
+		}
+
+		return d.appendSysEx(cable, p[1:4], false)
+	case 0x5, 0x6, 0x7:
+		length := int(cin) - 4
+
+		if p[1] == 0xF0 {
+			d.sysEx[cable] = []byte{}
+			return d.appendSysEx(cable, p[2:1+length], true)
+		}
+
+		if d.sysEx[cable] == nil {
+			if cin == 0x5 {
+				// Single byte system common message
+				return ParseMessage(p[1], nil)
+			}
+
+			return nil, errors.New("end of system exclusive without start")
+		}
+
+		return d.appendSysEx(cable, p[1:1+length], true)
+	case 0x2:
+		return ParseMessage(p[1], p[2:3])
+	case 0x3:
+		return ParseMessage(p[1], p[2:4])
+	case 0xF:
+		return ParseMessage(p[1], nil)
+	default:
+		status := p[1]
+		if status>>4 != cin {
+			return nil, fmt.Errorf("code index number %X does not match status byte %X", cin, status)
+		}
+
+		return ParseMessage(status, p[2:2+messageDataLength(status)])
+	}
+}
+
+// appendSysEx appends data to the system exclusive message of a cable
+func (d *USBDecoder) appendSysEx(cable uint8, data []byte, end bool) (Event, error) {
+	if d.sysEx[cable] == nil {
+		return nil, errors.New("system exclusive data without start")
+	}
+
+	d.sysEx[cable] = append(d.sysEx[cable], data...)
+
+	if !end {
+		return nil, nil
+	}
+
+	event, err := ParseMessage(0xF0, d.sysEx[cable])
+	d.sysEx[cable] = nil
+
+	return event, err
+}
@@ -0,0 +1,89 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WarningError is a warning returned as error, use errors.As to get the track and tick of a
+// problem from a joined error
+type WarningError struct {
+	Warning
+}
+
+// Error returns the warning message
+func (e WarningError) Error() string {
+	return e.Warning.String()
+}
+
+// validateChannelEvent returns a problem with the values of a channel event or an empty string
+func validateChannelEvent(ce *ChannelEvent) string {
+	if ce.Channel > 15 {
+		return fmt.Sprintf("channel %v out of range", ce.Channel)
+	}
+
+	switch ce.eventType {
+	case PitchWheelChange:
+		if ce.Value1 > 0x3FFF {
+			return fmt.Sprintf("pitch wheel value %v out of range", ce.Value1)
+		}
+	case ProgramChange, ChannelPressure:
+		if ce.Value1 > 0x7F {
+			return fmt.Sprintf("%v value %v out of range", eventTypeToString(ce.eventType), ce.Value1)
+		}
+	default:
+		if ce.Value1 > 0x7F || ce.Value2 > 0x7F {
+			return fmt.Sprintf("%v values %v %v out of range", eventTypeToString(ce.eventType), ce.Value1, ce.Value2)
+		}
+	}
+
+	return ""
+}
+
+// Validate checks the header and tracks against the rules of the standard midi file
+// specification. It runs to completion and returns every problem found as WarningError joined
+// with errors.Join, nil if the file is valid
+func (f *File) Validate() error {
+	var errs []error
+
+	problem := func(track int, tick uint32, format string, args ...any) {
+		errs = append(errs, WarningError{Warning{Track: track, Tick: tick, Message: fmt.Sprintf(format, args...)}})
+	}
+
+	if f.Header == nil {
+		problem(-1, 0, "missing header")
+	} else if f.Header.Format == Format0 && len(f.Tracks) != 1 {
+		problem(-1, 0, "format 0 file should have exactly one track, found %v", len(f.Tracks))
+	}
+
+	for index, track := range f.Tracks {
+		tick := uint32(0)
+
+		if len(track.Events) == 0 || !isEndOfTrack(track.Events[len(track.Events)-1]) {
+			problem(index, 0, "track should end with an end of track event")
+		}
+
+		for eventIndex, event := range track.Events {
+			tick += event.DeltaTime()
+
+			if event.DeltaTime() > 0x0FFFFFFF {
+				problem(index, tick, "delta time %v out of range", event.DeltaTime())
+			}
+
+			switch e := event.(type) {
+			case *ChannelEvent:
+				if message := validateChannelEvent(e); message != "" {
+					problem(index, tick, "%v", message)
+				}
+			case *MetaEvent:
+				if e.MetaType == EndOfTrack && eventIndex != len(track.Events)-1 {
+					problem(index, tick, "end of track event before the last event")
+				}
+			case *RawEvent:
+				problem(index, tick, "uninterpreted raw event with status %X", e.Status)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package midi
+
+// EventVisitor receives parsed events through typed methods, returning an error stops parsing.
+// Meta and system exclusive events handed to a visitor use reusable buffers and must be
+// retained if they are kept after the method returns
+type EventVisitor interface {
+	VisitNoteOff(e *ChannelEvent) error
+	VisitNoteOn(e *ChannelEvent) error
+	VisitPolyphonicKeyPressure(e *ChannelEvent) error
+	VisitControlChange(e *ChannelEvent) error
+	VisitProgramChange(e *ChannelEvent) error
+	VisitChannelPressure(e *ChannelEvent) error
+	VisitPitchWheelChange(e *ChannelEvent) error
+	VisitSystemExclusive(e *SystemExclusiveEvent) error
+	VisitSystemCommon(e *SystemCommonEvent) error
+	VisitSystemRealTime(e *SystemRealTimeEvent) error
+	VisitMeta(e *MetaEvent) error
+	// VisitOther receives events of other types, e.g. from registered parsers
+	VisitOther(e Event) error
+}
+
+// BaseVisitor ignores all events, embed it to implement only the methods of interest
+type BaseVisitor struct{}
+
+// VisitNoteOff ignores the event
+func (BaseVisitor) VisitNoteOff(e *ChannelEvent) error { return nil }
+
+// VisitNoteOn ignores the event
+func (BaseVisitor) VisitNoteOn(e *ChannelEvent) error { return nil }
+
+// VisitPolyphonicKeyPressure ignores the event
+func (BaseVisitor) VisitPolyphonicKeyPressure(e *ChannelEvent) error { return nil }
+
+// VisitControlChange ignores the event
+func (BaseVisitor) VisitControlChange(e *ChannelEvent) error { return nil }
+
+// VisitProgramChange ignores the event
+func (BaseVisitor) VisitProgramChange(e *ChannelEvent) error { return nil }
+
+// VisitChannelPressure ignores the event
+func (BaseVisitor) VisitChannelPressure(e *ChannelEvent) error { return nil }
+
+// VisitPitchWheelChange ignores the event
+func (BaseVisitor) VisitPitchWheelChange(e *ChannelEvent) error { return nil }
+
+// VisitSystemExclusive ignores the event
+func (BaseVisitor) VisitSystemExclusive(e *SystemExclusiveEvent) error { return nil }
+
+// VisitSystemCommon ignores the event
+func (BaseVisitor) VisitSystemCommon(e *SystemCommonEvent) error { return nil }
+
+// VisitSystemRealTime ignores the event
+func (BaseVisitor) VisitSystemRealTime(e *SystemRealTimeEvent) error { return nil }
+
+// VisitMeta ignores the event
+func (BaseVisitor) VisitMeta(e *MetaEvent) error { return nil }
+
+// VisitOther ignores the event
+func (BaseVisitor) VisitOther(e Event) error { return nil }
+
+// ParseTrack parses track chunk data and hands each event to the visitor without building
+// an event slice
+func ParseTrack(data []byte, visitor EventVisitor) error {
+	return parseTrackData(data, true, func(event Event) error {
+		return visitEvent(visitor, event)
+	})
+}
+
+// visitEvent dispatches an event to the typed visitor method
+func visitEvent(visitor EventVisitor, event Event) error {
+	switch e := event.(type) {
+	case *ChannelEvent:
+		switch e.eventType {
+		case NoteOff:
+			return visitor.VisitNoteOff(e)
+		case NoteOn:
+			return visitor.VisitNoteOn(e)
+		case PolyphonicKeyPressure:
+			return visitor.VisitPolyphonicKeyPressure(e)
+		case ControlChange:
+			return visitor.VisitControlChange(e)
+		case ProgramChange:
+			return visitor.VisitProgramChange(e)
+		case ChannelPressure:
+			return visitor.VisitChannelPressure(e)
+		case PitchWheelChange:
+			return visitor.VisitPitchWheelChange(e)
+		}
+	case *SystemExclusiveEvent:
+		return visitor.VisitSystemExclusive(e)
+	case *SystemCommonEvent:
+		return visitor.VisitSystemCommon(e)
+	case *SystemRealTimeEvent:
+		return visitor.VisitSystemRealTime(e)
+	case *MetaEvent:
+		return visitor.VisitMeta(e)
+	}
+
+	return visitor.VisitOther(event)
+}
@@ -0,0 +1,148 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// messageDataLength returns the number of data bytes following a status byte on the wire, -1
+// for system exclusive and for status bytes without a known message
+func messageDataLength(statusByte uint8) int {
+	switch {
+	case statusByte < 0x80:
+		return -1
+	case statusByte < 0xF0:
+		if statusByte>>4 == 0xC || statusByte>>4 == 0xD {
+			return 1
+		}
+
+		return 2
+	case statusByte == 0xF2:
+		return 2
+	case statusByte == 0xF1, statusByte == 0xF3:
+		return 1
+	case statusByte == 0xF6, statusByte >= 0xF8:
+		return 0
+	}
+
+	return -1
+}
+
+// MessageBytes returns the bytes of an event as sent over a midi connection, without delta
+// time. System exclusive data is framed by 0xF0 and 0xF7, the data of continuation events is
+// returned as is and may be empty or start with a data byte. Meta events can not be sent
+func MessageBytes(event Event) ([]byte, error) {
+	switch e := event.(type) {
+	case *ChannelEvent:
+		var status byte
+
+		switch e.eventType {
+		case NoteOff:
+			status = 0x80
+		case NoteOn:
+			status = 0x90
+		case PolyphonicKeyPressure:
+			status = 0xA0
+		case ControlChange:
+			status = 0xB0
+		case ProgramChange:
+			return []byte{0xC0 | byte(e.Channel&0xF), byte(e.Value1 & 0x7F)}, nil
+		case ChannelPressure:
+			return []byte{0xD0 | byte(e.Channel&0xF), byte(e.Value1 & 0x7F)}, nil
+		case PitchWheelChange:
+			return []byte{0xE0 | byte(e.Channel&0xF), byte(e.Value1 & 0x7F), byte((e.Value1 >> 7) & 0x7F)}, nil
+		default:
+			return nil, fmt.Errorf("unknown channel event type %v", e.eventType)
+		}
+
+		return []byte{status | byte(e.Channel&0xF), byte(e.Value1 & 0x7F), byte(e.Value2 & 0x7F)}, nil
+	case *SystemExclusiveEvent:
+		if e.Continuation {
+			return append([]byte{}, e.Data...), nil
+		}
+
+		data := make([]byte, 0, len(e.Data)+2)
+		data = append(data, 0xF0)
+		data = append(data, e.Data...)
+
+		if len(e.Data) == 0 || e.Data[len(e.Data)-1] != 0xF7 {
+			data = append(data, 0xF7)
+		}
+
+		return data, nil
+	case *SystemCommonEvent:
+		switch e.eventType {
+		case MTCQuarterFrame:
+			return []byte{0xF1, byte(e.Value1 & 0x7F)}, nil
+		case SongPositionPointer:
+			return []byte{0xF2, byte(e.Value1 & 0x7F), byte((e.Value1 >> 7) & 0x7F)}, nil
+		case SongSelect:
+			return []byte{0xF3, byte(e.Value1 & 0x7F)}, nil
+		case TuneRequest:
+			return []byte{0xF6}, nil
+		}
+	case *SystemRealTimeEvent:
+		switch e.eventType {
+		case TimingClock:
+			return []byte{0xF8}, nil
+		case Start:
+			return []byte{0xFA}, nil
+		case Continue:
+			return []byte{0xFB}, nil
+		case Stop:
+			return []byte{0xFC}, nil
+		case ActiveSensing:
+			return []byte{0xFE}, nil
+		}
+	case *MetaEvent:
+		return nil, errors.New("meta events can not be sent over a midi connection")
+	case *RawEvent:
+		return append([]byte{e.Status}, e.Data...), nil
+	}
+
+	return nil, fmt.Errorf("event %v has no wire representation", event)
+}
+
+// framedMessageBytes returns the bytes of an event for transports that frame complete messages,
+// continuation events that are empty or start with a data byte continue a message sent before
+// and can not be framed on their own
+func framedMessageBytes(event Event) ([]byte, error) {
+	data, err := MessageBytes(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 || data[0] < 0x80 {
+		return nil, errors.New("system exclusive continuation events can not be sent as separate messages")
+	}
+
+	return data, nil
+}
+
+// ParseMessage creates an event from a status byte and its data bytes as received over a midi
+// connection, system exclusive data should not include 0xF0 but may end with 0xF7. Real time
+// messages return the shared real time events
+func ParseMessage(statusByte uint8, data []byte) (Event, error) {
+	if statusByte == 0xF0 {
+		exclusiveData := make([]byte, len(data))
+		copy(exclusiveData, data)
+
+		return &SystemExclusiveEvent{
+			coreEvent: coreEvent{eventType: SystemExclusive},
+			Data:      exclusiveData,
+		}, nil
+	}
+
+	if event := RealTimeEvent(statusByte); event != nil {
+		return event, nil
+	}
+
+	parseFunc := statusByteToParseFunctionMapping[statusByte]
+	if parseFunc == nil || statusByte == 0xF7 || statusByte == 0xFF {
+		return nil, fmt.Errorf("unknown status byte %X encountered", statusByte)
+	}
+
+	event, _, err := callParser(parseFunc, statusByte, 0, data)
+
+	return event, err
+}
@@ -0,0 +1,238 @@
+package midi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBLERoundTrip(t *testing.T) {
+	sysEx := &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x43, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0xF7}}
+
+	messages := []BLEMessage{
+		{Timestamp: 100, Event: NewChannelEvent(0, NoteOn, 2, 60, 100)},
+		{Timestamp: 120, Event: NewChannelEvent(0, NoteOn, 2, 64, 100)},
+		{Timestamp: 130, Event: TimingClockEvent},
+		{Timestamp: 140, Event: sysEx},
+		{Timestamp: 8000, Event: NewChannelEvent(0, PitchWheelChange, 2, 9000, 0)},
+	}
+
+	packets, err := EncodeBLEPackets(messages, 8)
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	decoder := &BLEDecoder{}
+	decoded := []BLEMessage{}
+
+	for _, packet := range packets {
+		result, err := decoder.Decode(packet)
+		if err != nil {
+			t.Fatalf("err %v", err)
+		}
+
+		decoded = append(decoded, result...)
+	}
+
+	if len(decoded) != len(messages) {
+		t.Fatalf("expected %v messages, got %v", len(messages), len(decoded))
+	}
+
+	for index, message := range messages {
+		expected, _ := MessageBytes(message.Event)
+		actual, _ := MessageBytes(decoded[index].Event)
+
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("message %v: expected %X, got %X", index, expected, actual)
+		}
+
+		if decoded[index].Timestamp != message.Timestamp {
+			t.Errorf("message %v: expected timestamp %v, got %v", index, message.Timestamp, decoded[index].Timestamp)
+		}
+	}
+}
+
+func TestUSBRoundTrip(t *testing.T) {
+	events := []Event{
+		NewChannelEvent(0, ControlChange, 3, 7, 100),
+		NewChannelEvent(0, ProgramChange, 3, 12, 0),
+		&SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x7E, 0x7F, 0x09, 0x01, 0xF7}},
+		StopEvent,
+	}
+
+	decoder := &USBDecoder{}
+
+	for _, event := range events {
+		packets, err := EncodeUSBPackets(2, event)
+		if err != nil {
+			t.Fatalf("err %v", err)
+		}
+
+		var decoded Event
+
+		for _, p := range packets {
+			if p.Cable() != 2 {
+				t.Errorf("expected cable 2, got %v", p.Cable())
+			}
+
+			decoded, err = decoder.Decode(p)
+			if err != nil {
+				t.Fatalf("err %v", err)
+			}
+		}
+
+		expected, _ := MessageBytes(event)
+		actual, _ := MessageBytes(decoded)
+
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("expected %X, got %X", expected, actual)
+		}
+	}
+}
+
+func TestDINScheduler(t *testing.T) {
+	sysEx := &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{1, 2, 3, 4, 5, 6, 0xF7}}
+
+	s := NewDINScheduler(true)
+
+	result, err := s.Schedule([]DINMessage{
+		{Time: 0, Event: sysEx},
+		{Time: DINByteDuration * 3, Event: TimingClockEvent},
+		{Time: DINByteDuration * 20, Event: NewChannelEvent(0, NoteOn, 0, 60, 100)},
+		{Time: DINByteDuration * 20, Event: NewChannelEvent(0, NoteOn, 0, 64, 100)},
+	})
+
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+
+	expected := []byte{0xF0, 1, 2, 0xF8, 3, 4, 5, 6, 0xF7, 0x90, 60, 100, 64, 100}
+	if len(result) != len(expected) {
+		t.Fatalf("expected %v bytes, got %v", len(expected), result)
+	}
+
+	for index, b := range result {
+		if b.Byte != expected[index] {
+			t.Errorf("byte %v: expected %X, got %X", index, expected[index], b.Byte)
+		}
+	}
+
+	if result[3].Time != DINByteDuration*3 {
+		t.Errorf("expected clock at its due time, got %v", result[3].Time)
+	}
+}
+
+func TestTimecode(t *testing.T) {
+	tc, err := ParseTimecode("01:00:02;12", FrameRate30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tc.Rate != FrameRate2997Drop || tc.String() != "01:00:02;12" {
+		t.Errorf("unexpected timecode %v", tc)
+	}
+
+	// One hour of drop frame timecode is 107892 frames
+	if count := tc.FrameCount(); count != 107892+72 {
+		t.Errorf("expected frame count %d, got %d", 107892+72, count)
+	}
+
+	for _, count := range []int64{0, 1799, 1800, 17982, 107964, 2589407} {
+		if back := TimecodeFromFrames(count, FrameRate2997Drop).FrameCount(); back != count {
+			t.Errorf("frame count %d round trips to %d", count, back)
+		}
+	}
+
+	if next := TimecodeFromFrames(1800, FrameRate2997Drop); next.String() != "00:01:00;02" {
+		t.Errorf("expected 00:01:00;02, got %v", next)
+	}
+
+	if _, err := ParseTimecode("00:01:00;00", FrameRate30); err == nil {
+		t.Error("expected dropped frame to be rejected")
+	}
+
+	meta, err := TimecodeFromMetaEvent(tc.MetaEvent(0))
+	if err != nil || meta != tc {
+		t.Errorf("meta event round trip failed: %v %v", meta, err)
+	}
+
+	decoder := &MTCDecoder{}
+	decoded := false
+
+	for _, qf := range tc.QuarterFrames() {
+		data, err := MessageBytes(qf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event, err := ParseMessage(data[0], data[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, ok := decoder.Decode(event); ok {
+			decoded = true
+			if got != tc {
+				t.Errorf("expected %v, got %v", tc, got)
+			}
+		}
+	}
+
+	if !decoded {
+		t.Error("expected quarter frames to decode")
+	}
+
+	if got, ok := decoder.Decode(tc.FullFrame(0x7F)); !ok || got != tc {
+		t.Errorf("full frame round trip failed: %v", got)
+	}
+}
+
+func TestContinuationTransports(t *testing.T) {
+	empty := &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Continuation: true}
+	terminated := &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0x12, 0x34, 0xF7}, Continuation: true}
+
+	for _, event := range []Event{empty, terminated} {
+		if _, err := EncodeUSBPackets(0, event); err == nil {
+			t.Errorf("expected USB encoding of continuation % X to fail", event.(*SystemExclusiveEvent).Data)
+		}
+
+		if _, err := EncodeBLEPackets([]BLEMessage{{Event: event}}, 8); err == nil {
+			t.Errorf("expected BLE encoding of continuation % X to fail", event.(*SystemExclusiveEvent).Data)
+		}
+
+		if _, err := NewDINScheduler(false).Schedule([]DINMessage{{Event: event}}); err == nil {
+			t.Errorf("expected DIN scheduling of continuation % X to fail", event.(*SystemExclusiveEvent).Data)
+		}
+	}
+
+	// An escaped real time message starts with a status byte and is sent as is
+	escape := &SystemExclusiveEvent{coreEvent: coreEvent{eventType: SystemExclusive}, Data: []byte{0xF8}, Continuation: true}
+	if packets, err := EncodeUSBPackets(0, escape); err != nil || packets[0] != (USBPacket{0x0F, 0xF8, 0, 0}) {
+		t.Errorf("expected a real time packet, got %v (%v)", packets, err)
+	}
+}
+
+func TestRealTimeEvent(t *testing.T) {
+	shared := map[uint8]Event{
+		0xF8: TimingClockEvent,
+		0xFA: StartEvent,
+		0xFB: ContinueEvent,
+		0xFC: StopEvent,
+		0xFE: ActiveSensingEvent,
+	}
+
+	for status := 0; status < 256; status++ {
+		event := RealTimeEvent(uint8(status))
+
+		if expected, ok := shared[uint8(status)]; ok {
+			if event != expected {
+				t.Errorf("status %X: expected the shared event, got %v", status, event)
+			}
+
+			if data, err := MessageBytes(event); err != nil || !bytes.Equal(data, []byte{uint8(status)}) {
+				t.Errorf("status %X: shared event encodes to % X (%v)", status, data, err)
+			}
+		} else if event != nil {
+			t.Errorf("status %X: expected nil, got %v", status, event)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package midi
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"log/slog"
 )
 
 func writeVariableLengthInteger(value uint32) []byte {
@@ -52,16 +54,66 @@ func (h *FileHeader) Chunk() *Chunk {
 	}
 }
 
-// Chunk from track
-func (t *Track) Chunk() *Chunk {
-	var buf bytes.Buffer
+// estimatedEventSize is the number of bytes reserved per event by NewChunkBuilder, a delta time
+// byte, a status byte and two data bytes
+const estimatedEventSize = 4
 
-	for _, event := range t.Events {
-		event.WriteTo(&buf)
+// ChunkBuilder builds the data of a track chunk, writes of one or more events are atomic: if an
+// event fails to write, the data of the events written in the same call is removed again
+type ChunkBuilder struct {
+	buf bytes.Buffer
+}
+
+// NewChunkBuilder creates a chunk builder with room for the given number of events
+func NewChunkBuilder(numEvents int) *ChunkBuilder {
+	b := &ChunkBuilder{}
+	b.buf.Grow(numEvents * estimatedEventSize)
+
+	return b
+}
+
+// WriteEvent appends an event, nothing is appended if the event fails to write
+func (b *ChunkBuilder) WriteEvent(event Event) error {
+	return b.WriteEvents([]Event{event})
+}
+
+// WriteEvents appends events, nothing is appended if one of the events fails to write
+func (b *ChunkBuilder) WriteEvents(events []Event) error {
+	length := b.buf.Len()
+
+	for index, event := range events {
+		_, err := event.WriteTo(&b.buf)
+		if err != nil {
+			b.buf.Truncate(length)
+			return fmt.Errorf("event %v: %w", index, err)
+		}
 	}
 
-	data := buf.Bytes()
+	return nil
+}
+
+// Len returns the number of bytes written so far
+func (b *ChunkBuilder) Len() int {
+	return b.buf.Len()
+}
+
+// Bytes returns the data written so far, it is only valid until the next write or Reset
+func (b *ChunkBuilder) Bytes() []byte {
+	return b.buf.Bytes()
+}
 
+// Reset removes all data but keeps the allocated buffer
+func (b *ChunkBuilder) Reset() {
+	b.buf.Reset()
+}
+
+// Chunk returns a track chunk holding a copy of the data written so far
+func (b *ChunkBuilder) Chunk() *Chunk {
+	return newTrackChunk(bytes.Clone(b.buf.Bytes()))
+}
+
+// newTrackChunk creates a track chunk for data
+func newTrackChunk(data []byte) *Chunk {
 	return &Chunk{
 		Type:   TrackType,
 		Length: uint32(len(data)),
@@ -69,6 +121,36 @@ func (t *Track) Chunk() *Chunk {
 	}
 }
 
+// WriteTo writes the data written so far as a track chunk to writer without copying it
+func (b *ChunkBuilder) WriteTo(w io.Writer) (int64, error) {
+	return newTrackChunk(b.buf.Bytes()).WriteTo(w)
+}
+
+// BuildChunk creates a track chunk from the events of the track, an error is returned if an event
+// fails to write
+func (t *Track) BuildChunk() (*Chunk, error) {
+	b := NewChunkBuilder(len(t.Events))
+
+	err := b.WriteEvents(t.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	// The builder is not used again so its buffer can be handed over
+	return newTrackChunk(b.Bytes()), nil
+}
+
+// Chunk from track, events that fail to write are left out, use BuildChunk to get the error
+func (t *Track) Chunk() *Chunk {
+	b := NewChunkBuilder(len(t.Events))
+
+	for _, event := range t.Events {
+		_ = b.WriteEvent(event)
+	}
+
+	return newTrackChunk(b.Bytes())
+}
+
 // WriteTo writes a chunk to writer
 func (c *Chunk) WriteTo(w io.Writer) (int64, error) {
 	// Length needs to be written as big endian
@@ -93,14 +175,52 @@ func (c *Chunk) WriteTo(w io.Writer) (int64, error) {
 	return int64(n1) + int64(n2) + int64(n3), nil
 }
 
-// WriteTo writes a file to writer
+// WriteOptions control how a file is written
+type WriteOptions struct {
+	// Progress is called with the number of bytes written so far, optional
+	Progress ProgressFunc
+	// Logger logs chunk boundaries at debug level, optional
+	Logger *slog.Logger
+}
+
+// WriteTo writes the chunks of a file to writer, edits to the header or tracks are only written
+// after Rebuild. The number of tracks in the header is recomputed from the track chunks
 func (mf *File) WriteTo(w io.Writer) (int64, error) {
+	return mf.WriteToWithOptions(w, WriteOptions{})
+}
+
+// WriteToWithOptions writes the chunks of a file to writer like WriteTo
+func (mf *File) WriteToWithOptions(w io.Writer, opts WriteOptions) (int64, error) {
 	var n int64
 
+	numTracks := uint16(0)
+	totalBytes := int64(0)
+	for _, chunk := range mf.Chunks {
+		if chunk.Type == TrackType {
+			numTracks++
+		}
+
+		totalBytes += 8 + int64(len(chunk.Data))
+	}
+
+	if opts.Progress != nil {
+		w = NewProgressWriter(w, totalBytes, opts.Progress)
+	}
+
 	for _, chunk := range mf.Chunks {
+		if chunk.Type == HeaderType && mf.Header != nil && mf.Header.NumTracks != numTracks {
+			header := *mf.Header
+			header.NumTracks = numTracks
+			chunk = header.Chunk()
+		}
+
+		if opts.Logger != nil {
+			opts.Logger.Debug("midi chunk", "type", string(chunk.Type), "offset", n, "length", len(chunk.Data))
+		}
+
 		nb, err := chunk.WriteTo(w)
 		if err != nil {
-			return 0, nil
+			return 0, err
 		}
 
 		n += nb
@@ -0,0 +1,28 @@
+package midi
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalYAML marshals the file in the document schema
+func (f *File) MarshalYAML() (interface{}, error) {
+	return f.Document()
+}
+
+// UnmarshalYAML unmarshals a file in the document schema
+func (f *File) UnmarshalYAML(value *yaml.Node) error {
+	doc := &FileDocument{}
+
+	err := value.Decode(doc)
+	if err != nil {
+		return err
+	}
+
+	if doc.Tracks == nil {
+		return errors.New("document has no tracks")
+	}
+
+	return f.SetDocument(doc)
+}